@@ -5,6 +5,7 @@ package cni
 
 import (
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniVers "github.com/containernetworking/cni/pkg/version"
 )
 
 const (
@@ -12,23 +13,69 @@ const (
 	Cmd       = "CNI_COMMAND"
 	CmdAdd    = "ADD"
 	CmdGet    = "GET"
+	CmdCheck  = "CHECK"
 	CmdDel    = "DEL"
 	CmdUpdate = "UPDATE"
 
+	// Environment variable selecting the key value store backend.
+	EnvStoreType = "AZURE_CNI_STORE_TYPE"
+
 	// CNI errors.
 	ErrRuntime = 100
 
+	// CNI errors returned by CHECK for each divergence from the expected state.
+	ErrCheckEndpointNotFound          = 101
+	ErrCheckPrevResultMismatch        = 102
+	ErrCheckContainerInterfaceMissing = 103
+	ErrCheckContainerAddressMissing   = 104
+	ErrCheckContainerRouteMissing     = 105
+	ErrCheckHostInterfaceMissing      = 106
+	ErrCheckHostInterfaceNotAttached  = 107
+	ErrCheckHostRouteMissing          = 108
+	ErrCheckEndpointRuleMissing       = 109
+
 	// DefaultVersion is the CNI version used when no version is specified in a network config file.
 	defaultVersion = "0.2.0"
 )
 
 // Supported CNI versions.
-var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0"}
+var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0", "1.0.0"}
+
+// selectVersion returns the highest supported version among the given versions.
+func selectVersion(versions []string) string {
+	var selected string
+
+	for _, version := range versions {
+		if !isSupportedVersion(version) {
+			continue
+		}
+
+		if selected == "" {
+			selected = version
+		} else if newer, err := cniVers.GreaterThanOrEqualTo(version, selected); err == nil && newer {
+			selected = version
+		}
+	}
+
+	return selected
+}
+
+// isSupportedVersion returns whether the given version is supported.
+func isSupportedVersion(version string) bool {
+	for _, supportedVersion := range supportedVersions {
+		if version == supportedVersion {
+			return true
+		}
+	}
+
+	return false
+}
 
 // CNI contract.
 type PluginApi interface {
 	Add(args *cniSkel.CmdArgs) error
 	Get(args *cniSkel.CmdArgs) error
+	Check(args *cniSkel.CmdArgs) error
 	Delete(args *cniSkel.CmdArgs) error
 	Update(args *cniSkel.CmdArgs) error
 }
@@ -5,14 +5,19 @@ package ipam
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/ipam"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/store"
 
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
@@ -22,10 +27,23 @@ import (
 const (
 	// Plugin name.
 	name = "azure-vnet-ipam"
+
+	// Name of the network plugin whose endpoints own the allocated addresses.
+	networkPluginName = "azure-vnet"
+
+	// Extension of the file recording when orphaned addresses were last released on start.
+	reconcileExtension = ".reconcile"
+
+	// Minimum time between releases of orphaned addresses on start.
+	reconcileInterval = 10 * time.Minute
 )
 
 var (
+	// Error returned when the network plugin state may be missing its most recent endpoints.
+	errNetworkStateFromBackup = fmt.Errorf("network plugin state was loaded from its backup")
+
 	ipv4DefaultRouteDstPrefix = net.IPNet{net.IPv4zero, net.IPv4Mask(0, 0, 0, 0)}
+	ipv6DefaultRouteDstPrefix = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
 )
 
 // IpamPlugin represents the CNI IPAM plugin.
@@ -61,6 +79,21 @@ func NewPlugin(config *common.PluginConfig) (*ipamPlugin, error) {
 
 // Starts the plugin.
 func (plugin *ipamPlugin) Start(config *common.PluginConfig) error {
+	err := plugin.start(config)
+	if err != nil {
+		return err
+	}
+
+	// Release addresses leaked by endpoints deleted without a DEL command.
+	plugin.reconcileOnStart(config)
+
+	log.Printf("[cni-ipam] Plugin started.")
+
+	return nil
+}
+
+// Initializes the base plugin and the address manager.
+func (plugin *ipamPlugin) start(config *common.PluginConfig) error {
 	// Initialize base plugin.
 	err := plugin.Initialize(config)
 	if err != nil {
@@ -79,11 +112,98 @@ func (plugin *ipamPlugin) Start(config *common.PluginConfig) error {
 		return err
 	}
 
-	log.Printf("[cni-ipam] Plugin started.")
-
 	return nil
 }
 
+// reconcileOnStart releases orphaned addresses without waiting for the network plugin's store lock.
+// The network plugin holds its lock while it calls into this plugin, and the JSON store is replaced
+// atomically on every write, so its last saved state can be read safely. Other store types cannot
+// be read while locked and are reconciled by the reconcile command only.
+// The plugin is started for every CNI command, so this runs at most once per reconcileInterval.
+func (plugin *ipamPlugin) reconcileOnStart(config *common.PluginConfig) {
+	if config.StoreType != "" && config.StoreType != store.StoreTypeJsonFile {
+		return
+	}
+
+	if !reconcileDue(platform.CNIRuntimePath + name + reconcileExtension) {
+		return
+	}
+
+	nwStore, err := store.NewKeyValueStore(config.StoreType, platform.CNIRuntimePath+networkPluginName)
+	if err != nil {
+		log.Printf("[cni-ipam] Failed to open network plugin store, err:%v.", err)
+		return
+	}
+
+	if _, err = plugin.releaseOrphanedAddresses(nwStore); err != nil {
+		log.Printf("[cni-ipam] Skipped reconciliation, err:%v.", err)
+	}
+}
+
+// reconcileDue returns whether orphaned addresses were not released on start within the last
+// reconcileInterval, as recorded by the modification time of the given file, and records this start.
+func reconcileDue(fileName string) bool {
+	info, err := os.Stat(fileName)
+	if err == nil && time.Since(info.ModTime()) < reconcileInterval {
+		return false
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		log.Printf("[cni-ipam] Failed to record reconciliation time, err:%v.", err)
+		return false
+	}
+
+	file.Close()
+
+	return true
+}
+
+// Reconcile starts the plugin and releases the addresses of endpoints that no longer exist
+// in the network plugin's state. The network plugin's store is locked while its state is read.
+func (plugin *ipamPlugin) Reconcile(config *common.PluginConfig) ([]*ipam.ReleasedAddressInfo, error) {
+	err := plugin.start(config)
+	if err != nil {
+		return nil, err
+	}
+
+	nwStore, err := store.NewKeyValueStore(config.StoreType, platform.CNIRuntimePath+networkPluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = nwStore.Lock(true); err != nil {
+		log.Printf("[cni-ipam] Failed to lock network plugin store, err:%v.", err)
+		return nil, err
+	}
+
+	defer nwStore.Unlock(false)
+
+	return plugin.releaseOrphanedAddresses(nwStore)
+}
+
+// releaseOrphanedAddresses releases the addresses of endpoints missing from the given network plugin store.
+func (plugin *ipamPlugin) releaseOrphanedAddresses(nwStore store.KeyValueStore) ([]*ipam.ReleasedAddressInfo, error) {
+	// An unreadable state must not be mistaken for a state without endpoints.
+	liveIDs, err := network.GetEndpointIDs(nwStore)
+	if err != nil {
+		return nil, err
+	}
+
+	// The backup is one write behind, so the most recently added endpoints would look orphaned
+	// and their addresses could be allocated to other endpoints.
+	if store.LoadedFromBackup(nwStore) {
+		return nil, errNetworkStateFromBackup
+	}
+
+	released, err := plugin.am.Reconcile(liveIDs)
+	for _, info := range released {
+		log.Printf("[cni-ipam] Released orphaned address %v of endpoint %v.", info.Address, info.ID)
+	}
+
+	return released, err
+}
+
 // Stops the plugin.
 func (plugin *ipamPlugin) Stop() {
 	plugin.am.Uninitialize()
@@ -115,6 +235,13 @@ func (plugin *ipamPlugin) Configure(stdinData []byte) (*cni.NetworkConfig, error
 		plugin.SetOption(common.OptIpamQueryInterval, i)
 	}
 
+	// Set address allocation strategy.
+	plugin.SetOption(common.OptIpamAllocationStrategy, nwCfg.Ipam.Allocation)
+	if nwCfg.Ipam.Quarantine != "" {
+		i, _ := strconv.Atoi(nwCfg.Ipam.Quarantine)
+		plugin.SetOption(common.OptIpamQuarantinePeriod, i)
+	}
+
 	err = plugin.am.StartSource(plugin.Options)
 	if err != nil {
 		return nil, err
@@ -176,48 +303,55 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 
 		nwCfg.Ipam.Subnet = subnet
 		log.Printf("[cni-ipam] Allocated address poolID %v with subnet %v.", poolID, subnet)
+
+		// Pair the pool with an IPv6 pool on the same interface, if one is available.
+		var apInfo *ipam.AddressPoolInfo
+		if apInfo, err = plugin.am.GetPoolInfo(nwCfg.Ipam.AddrSpace, poolID); err != nil {
+			err = plugin.Errorf("Failed to get pool information: %v", err)
+			return err
+		}
+
+		options[ipam.OptInterfaceName] = apInfo.IfName
+		poolIDV6, subnetV6, errV6 := plugin.am.RequestPool(nwCfg.Ipam.AddrSpace, "", "", options, true)
+		if errV6 != nil {
+			log.Printf("[cni-ipam] No IPv6 pool available on interface %v, err:%v.", apInfo.IfName, errV6)
+		} else {
+			// On failure, release the IPv6 address pool.
+			defer func() {
+				if err != nil {
+					log.Printf("[cni-ipam] Releasing pool %v.", poolIDV6)
+					plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, poolIDV6)
+				}
+			}()
+
+			nwCfg.Ipam.SubnetV6 = subnetV6
+			log.Printf("[cni-ipam] Allocated address poolID %v with subnet %v.", poolIDV6, subnetV6)
+		}
+	}
+
+	// Tag addresses with the endpoint ID, so that addresses of deleted endpoints can be reconciled.
+	options := make(map[string]string)
+	if endpointID, _ := network.ConstructEndpointID(args.ContainerID, args.Netns, args.IfName); endpointID != "" {
+		options[ipam.OptAddressID] = endpointID
 	}
 
 	// Allocate an address for the endpoint.
-	address, err := plugin.am.RequestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, nil)
+	ipConfig, apInfo, err := plugin.requestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, options)
 	if err != nil {
-		err = plugin.Errorf("Failed to allocate address: %v", err)
 		return err
 	}
 
 	// On failure, release the address.
 	defer func() {
-		if err != nil && address != "" {
-			log.Printf("[cni-ipam] Releasing address %v.", address)
-			plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, address, nil)
+		if err != nil {
+			log.Printf("[cni-ipam] Releasing address %v.", ipConfig.Address.IP)
+			plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, ipConfig.Address.IP.String(), nil)
 		}
 	}()
 
-	log.Printf("[cni-ipam] Allocated address %v.", address)
-
-	// Parse IP address.
-	ipAddress, err := platform.ConvertStringToIPNet(address)
-	if err != nil {
-		err = plugin.Errorf("Failed to parse address: %v", err)
-		return err
-	}
-
-	// Query pool information for gateways and DNS servers.
-	apInfo, err := plugin.am.GetPoolInfo(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet)
-	if err != nil {
-		err = plugin.Errorf("Failed to get pool information: %v", err)
-		return err
-	}
-
 	// Populate result.
 	result = &cniTypesCurr.Result{
-		IPs: []*cniTypesCurr.IPConfig{
-			{
-				Version: "4",
-				Address: *ipAddress,
-				Gateway: apInfo.Gateway,
-			},
-		},
+		IPs: []*cniTypesCurr.IPConfig{ipConfig},
 		Routes: []*cniTypes.Route{
 			{
 				Dst: ipv4DefaultRouteDstPrefix,
@@ -226,13 +360,38 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 		},
 	}
 
+	// Allocate an IPv6 address for the endpoint if the pool is dual-stack.
+	if nwCfg.Ipam.SubnetV6 != "" {
+		var ipConfigV6 *cniTypesCurr.IPConfig
+		var apInfoV6 *ipam.AddressPoolInfo
+
+		ipConfigV6, apInfoV6, err = plugin.requestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6, nwCfg.Ipam.AddressV6, options)
+		if err != nil {
+			return err
+		}
+
+		// On failure, release the IPv6 address.
+		defer func() {
+			if err != nil {
+				log.Printf("[cni-ipam] Releasing address %v.", ipConfigV6.Address.IP)
+				plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6, ipConfigV6.Address.IP.String(), nil)
+			}
+		}()
+
+		result.IPs = append(result.IPs, ipConfigV6)
+		result.Routes = append(result.Routes, &cniTypes.Route{
+			Dst: ipv6DefaultRouteDstPrefix,
+			GW:  apInfoV6.Gateway,
+		})
+	}
+
 	// Populate DNS servers.
 	for _, dnsServer := range apInfo.DnsServers {
 		result.DNS.Nameservers = append(result.DNS.Nameservers, dnsServer.String())
 	}
 
 	// Convert result to the requested CNI version.
-	res, err := result.GetAsVersion(nwCfg.CNIVersion)
+	res, err := cni.GetResultAsVersion(result, nwCfg.CNIVersion)
 	if err != nil {
 		err = plugin.Errorf("Failed to convert result: %v", err)
 		return err
@@ -250,11 +409,54 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// requestAddress allocates an address from the given pool and returns its IP configuration.
+func (plugin *ipamPlugin) requestAddress(asID, poolID, address string, options map[string]string) (*cniTypesCurr.IPConfig, *ipam.AddressPoolInfo, error) {
+	// Allocate an address for the endpoint.
+	address, err := plugin.am.RequestAddress(asID, poolID, address, options)
+	if err != nil {
+		return nil, nil, plugin.Errorf("Failed to allocate address: %v", err)
+	}
+
+	log.Printf("[cni-ipam] Allocated address %v.", address)
+
+	// Parse IP address.
+	ipAddress, err := platform.ConvertStringToIPNet(address)
+	if err != nil {
+		plugin.am.ReleaseAddress(asID, poolID, address, nil)
+		return nil, nil, plugin.Errorf("Failed to parse address: %v", err)
+	}
+
+	// Query pool information for gateways and DNS servers.
+	apInfo, err := plugin.am.GetPoolInfo(asID, poolID)
+	if err != nil {
+		plugin.am.ReleaseAddress(asID, poolID, ipAddress.IP.String(), nil)
+		return nil, nil, plugin.Errorf("Failed to get pool information: %v", err)
+	}
+
+	ipConfig := &cniTypesCurr.IPConfig{
+		Version: "4",
+		Address: *ipAddress,
+		Gateway: apInfo.Gateway,
+	}
+
+	if apInfo.IsIPv6 {
+		ipConfig.Version = "6"
+	}
+
+	return ipConfig, apInfo, nil
+}
+
 // Get handles CNI Get commands.
 func (plugin *ipamPlugin) Get(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// Check handles CNI check commands.
+// Addresses are verified against the endpoint by the network plugin.
+func (plugin *ipamPlugin) Check(args *cniSkel.CmdArgs) error {
+	return nil
+}
+
 // Delete handles CNI delete commands.
 func (plugin *ipamPlugin) Delete(args *cniSkel.CmdArgs) error {
 	var err error
@@ -272,20 +474,38 @@ func (plugin *ipamPlugin) Delete(args *cniSkel.CmdArgs) error {
 	}
 
 	// If an address is specified, release that address. Otherwise, release the pool.
-	if nwCfg.Ipam.Address != "" {
-		// Release the address.
-		err := plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, nil)
-		if err != nil {
-			err = plugin.Errorf("Failed to release address: %v", err)
-			return err
+	if nwCfg.Ipam.Address != "" || nwCfg.Ipam.AddressV6 != "" {
+		// Release the addresses.
+		if nwCfg.Ipam.Address != "" {
+			err = plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, nil)
+			if err != nil {
+				err = plugin.Errorf("Failed to release address: %v", err)
+				return err
+			}
+		}
+
+		if nwCfg.Ipam.AddressV6 != "" {
+			err = plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6, nwCfg.Ipam.AddressV6, nil)
+			if err != nil {
+				err = plugin.Errorf("Failed to release address: %v", err)
+				return err
+			}
 		}
 	} else {
-		// Release the pool.
-		err := plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet)
+		// Release the pools.
+		err = plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet)
 		if err != nil {
 			err = plugin.Errorf("Failed to release pool: %v", err)
 			return err
 		}
+
+		if nwCfg.Ipam.SubnetV6 != "" {
+			err = plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6)
+			if err != nil {
+				err = plugin.Errorf("Failed to release pool: %v", err)
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -4,13 +4,20 @@
 package ipam
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
 )
 
 var plugin *ipamPlugin
@@ -24,6 +31,10 @@ var ipamQueryResponse = "" +
 	"			<IPAddress Address=\"10.0.0.5\" IsPrimary=\"false\"/>" +
 	"			<IPAddress Address=\"10.0.0.6\" IsPrimary=\"false\"/>" +
 	"		</IPSubnet>" +
+	"		<IPSubnet Prefix=\"fd00::/64\">" +
+	"			<IPAddress Address=\"fd00::4\" IsPrimary=\"true\"/>" +
+	"			<IPAddress Address=\"fd00::5\" IsPrimary=\"false\"/>" +
+	"		</IPSubnet>" +
 	"	</Interface>" +
 	"</Interfaces>"
 
@@ -94,3 +105,174 @@ func TestAddSuccess(t *testing.T) {
 
 func TestDelSuccess(t *testing.T) {
 }
+
+// Tests that an IPv6 address is allocated along with the IPv4 address on dual-stack interfaces.
+func TestAddDualStack(t *testing.T) {
+	nwCfg := cni.NetworkConfig{
+		CNIVersion: "0.3.0",
+		Name:       "dualstack",
+		Type:       "azure-vnet",
+	}
+	nwCfg.Ipam.Type = cni.Internal
+
+	args := &cniSkel.CmdArgs{ContainerID: "test"}
+	args.StdinData, _ = json.Marshal(&nwCfg)
+
+	if err := plugin.Add(args); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+
+	var result cniTypesCurr.Result
+	if err := json.Unmarshal(args.StdinData, &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	if len(result.IPs) != 2 {
+		t.Fatalf("Got %d addresses, expected 2: %+v", len(result.IPs), result.IPs)
+	}
+
+	if result.IPs[0].Version != "4" || result.IPs[0].Address.IP.To4() == nil {
+		t.Errorf("First address %+v is not IPv4", result.IPs[0])
+	}
+
+	if result.IPs[1].Version != "6" || result.IPs[1].Address.String() != "fd00::5/64" {
+		t.Errorf("Second address %+v is not the IPv6 address", result.IPs[1])
+	}
+
+	if len(result.Routes) != 2 || result.Routes[1].Dst.String() != "::/0" {
+		t.Errorf("Routes %+v do not contain an IPv6 default route", result.Routes)
+	}
+
+	// Release the addresses and pools.
+	nwCfg.Ipam.Subnet = "10.0.0.0/16"
+	nwCfg.Ipam.SubnetV6 = "fd00::/64"
+	nwCfg.Ipam.Address = result.IPs[0].Address.IP.String()
+	nwCfg.Ipam.AddressV6 = result.IPs[1].Address.IP.String()
+	args.StdinData, _ = json.Marshal(&nwCfg)
+
+	if err := plugin.Delete(args); err != nil {
+		t.Fatalf("Failed to release addresses: %v", err)
+	}
+
+	nwCfg.Ipam.Address = ""
+	nwCfg.Ipam.AddressV6 = ""
+	args.StdinData, _ = json.Marshal(&nwCfg)
+
+	if err := plugin.Delete(args); err != nil {
+		t.Fatalf("Failed to release pools: %v", err)
+	}
+}
+
+// Tests addresses of endpoints missing from the network plugin state are released.
+func TestReconcileReleasesOrphanedAddresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cni-ipam")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	nwStore, err := store.NewJsonFileStore(filepath.Join(dir, networkPluginName+".json"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Addresses are not released if the network plugin state cannot be read.
+	if _, err = plugin.releaseOrphanedAddresses(nwStore); err == nil {
+		t.Errorf("Reconcile succeeded without network plugin state.")
+	}
+
+	// Allocate an address for each of two endpoints.
+	nwCfg := cni.NetworkConfig{
+		CNIVersion: "0.3.0",
+		Name:       "reconcile",
+		Type:       "azure-vnet",
+	}
+	nwCfg.Ipam.Type = cni.Internal
+	nwCfg.Ipam.Subnet = "10.0.0.0/16"
+
+	addresses := make(map[string]string)
+	for _, containerID := range []string{"1234567890", "abcdefghij"} {
+		args := &cniSkel.CmdArgs{ContainerID: containerID, IfName: "eth0"}
+		args.StdinData, _ = json.Marshal(&nwCfg)
+
+		if err = plugin.Add(args); err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+
+		var result cniTypesCurr.Result
+		json.Unmarshal(args.StdinData, &result)
+		addresses[containerID[:8]+"-eth0"] = result.IPs[0].Address.IP.String()
+	}
+
+	// Only the first endpoint exists in the network plugin state.
+	state := map[string]interface{}{
+		"ExternalInterfaces": map[string]interface{}{
+			"eth0": map[string]interface{}{
+				"Networks": map[string]interface{}{
+					"reconcile": map[string]interface{}{
+						"Endpoints": map[string]interface{}{
+							"12345678-eth0": map[string]interface{}{"Id": "12345678-eth0"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err = nwStore.Write("Network", state); err != nil {
+		t.Fatalf("Failed to write network state: %v", err)
+	}
+
+	// Addresses are not released if the network plugin state was loaded from its backup.
+	primaryName := filepath.Join(dir, networkPluginName+".json")
+	primary, err := ioutil.ReadFile(primaryName)
+	if err != nil {
+		t.Fatalf("Failed to read network state: %v", err)
+	}
+
+	if err = ioutil.WriteFile(primaryName+".bak", primary, 0644); err != nil {
+		t.Fatalf("Failed to write network state backup: %v", err)
+	}
+
+	if err = ioutil.WriteFile(primaryName, primary[:len(primary)/2], 0644); err != nil {
+		t.Fatalf("Failed to truncate network state: %v", err)
+	}
+
+	backupStore, err := store.NewJsonFileStore(primaryName)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if released, err := plugin.releaseOrphanedAddresses(backupStore); err != errNetworkStateFromBackup || len(released) != 0 {
+		t.Errorf("Reconcile from backup state released %+v, err:%v.", released, err)
+	}
+
+	if err = ioutil.WriteFile(primaryName, primary, 0644); err != nil {
+		t.Fatalf("Failed to restore network state: %v", err)
+	}
+
+	released, err := plugin.releaseOrphanedAddresses(nwStore)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if len(released) != 1 || released[0].ID != "abcdefgh-eth0" || released[0].Address != addresses["abcdefgh-eth0"] {
+		t.Errorf("Reconcile released %+v, expected address %v.", released, addresses["abcdefgh-eth0"])
+	}
+
+	// Orphaned addresses are released on start at most once per reconcile interval.
+	reconcileFileName := filepath.Join(dir, name+reconcileExtension)
+	if !reconcileDue(reconcileFileName) {
+		t.Errorf("Reconcile on start was not due without a previous reconcile.")
+	}
+
+	if reconcileDue(reconcileFileName) {
+		t.Errorf("Reconcile on start was due right after a reconcile.")
+	}
+
+	// Cleanup.
+	nwCfg.Ipam.Address = addresses["12345678-eth0"]
+	args := &cniSkel.CmdArgs{ContainerID: "1234567890", IfName: "eth0"}
+	args.StdinData, _ = json.Marshal(&nwCfg)
+	plugin.Delete(args)
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -12,6 +13,11 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 )
 
+const (
+	// Command releasing the addresses of endpoints that no longer exist.
+	reconcileCommand = "reconcile"
+)
+
 // Version is populated by make during build.
 var version string
 
@@ -19,6 +25,7 @@ var version string
 func main() {
 	var config common.PluginConfig
 	config.Version = version
+	config.StoreType = os.Getenv(cni.EnvStoreType)
 
 	ipamPlugin, err := ipam.NewPlugin(&config)
 	if err != nil {
@@ -41,6 +48,19 @@ func main() {
 		}
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == reconcileCommand {
+		released, err := ipamPlugin.Reconcile(&config)
+		ipamPlugin.Stop()
+		if err != nil {
+			fmt.Printf("Failed to reconcile IPAM plugin, err:%v.\n", err)
+			panic("ipam plugin fatal error")
+		}
+
+		out, _ := json.MarshalIndent(released, "", "    ")
+		fmt.Printf("%s\n", out)
+		return
+	}
+
 	err = ipamPlugin.Start(&config)
 	if err != nil {
 		fmt.Printf("Failed to start IPAM plugin, err:%v.\n", err)
@@ -29,8 +29,17 @@ type PortMapping struct {
 	HostIp        string `json:"hostIP,omitempty"`
 }
 type RuntimeConfig struct {
-	PortMappings []PortMapping    `json:"portMappings,omitempty"`
-	DNS          RuntimeDNSConfig `json:"dns,omitempty"`
+	PortMappings []PortMapping           `json:"portMappings,omitempty"`
+	DNS          RuntimeDNSConfig        `json:"dns,omitempty"`
+	Bandwidth    *RuntimeBandwidthConfig `json:"bandwidth,omitempty"`
+}
+
+// RuntimeBandwidthConfig is the bandwidth capability. Rates are in bits per second and bursts in bits.
+type RuntimeBandwidthConfig struct {
+	IngressRate  uint64 `json:"ingressRate,omitempty"`
+	IngressBurst uint64 `json:"ingressBurst,omitempty"`
+	EgressRate   uint64 `json:"egressRate,omitempty"`
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`
 }
 
 // https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/dockershim/network/cni/cni.go#L104
@@ -43,6 +52,7 @@ type RuntimeDNSConfig struct {
 // NetworkConfig represents Azure CNI plugin network configuration.
 type NetworkConfig struct {
 	CNIVersion                 string   `json:"cniVersion"`
+	CNIVersions                []string `json:"cniVersions,omitempty"`
 	Name                       string   `json:"name"`
 	Type                       string   `json:"type"`
 	Mode                       string   `json:"mode"`
@@ -56,16 +66,24 @@ type NetworkConfig struct {
 	EnableSnatOnHost           bool     `json:"enableSnatOnHost,omitempty"`
 	EnableExactMatchForPodName bool     `json:"enableExactMatchForPodName,omitempty"`
 	CNSUrl                     string   `json:"cnsurl,omitempty"`
+	CNSCAFile                  string   `json:"cnsCaFile,omitempty"`
+	CNSCertFile                string   `json:"cnsCertFile,omitempty"`
+	CNSKeyFile                 string   `json:"cnsKeyFile,omitempty"`
 	Ipam                       struct {
 		Type          string `json:"type"`
 		Environment   string `json:"environment,omitempty"`
 		AddrSpace     string `json:"addressSpace,omitempty"`
 		Subnet        string `json:"subnet,omitempty"`
+		SubnetV6      string `json:"subnetV6,omitempty"`
 		Address       string `json:"ipAddress,omitempty"`
+		AddressV6     string `json:"ipAddressV6,omitempty"`
 		QueryInterval string `json:"queryInterval,omitempty"`
+		Allocation    string `json:"allocationStrategy,omitempty"`
+		Quarantine    string `json:"quarantinePeriod,omitempty"`
 	}
-	DNS            cniTypes.DNS  `json:"dns"`
-	RuntimeConfig  RuntimeConfig `json:"runtimeConfig"`
+	DNS            cniTypes.DNS           `json:"dns"`
+	RuntimeConfig  RuntimeConfig          `json:"runtimeConfig"`
+	RawPrevResult  map[string]interface{} `json:"prevResult,omitempty"`
 	AdditionalArgs []KVPair
 }
 
@@ -96,6 +114,11 @@ func ParseNetworkConfig(b []byte) (*NetworkConfig, error) {
 		return nil, err
 	}
 
+	// Configs listing several versions use the highest one supported.
+	if nwCfg.CNIVersion == "" {
+		nwCfg.CNIVersion = selectVersion(nwCfg.CNIVersions)
+	}
+
 	if nwCfg.CNIVersion == "" {
 		nwCfg.CNIVersion = defaultVersion
 	}
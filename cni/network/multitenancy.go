@@ -1,6 +1,7 @@
 package network
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +19,20 @@ import (
 	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
 )
 
+// initCnsClient initializes the CNS client, connecting over TLS if a CA, certificate or key file is configured.
+func initCnsClient(nwCfg *cni.NetworkConfig) (*cnsclient.CNSClient, error) {
+	var tlsConfig *tls.Config
+	if nwCfg.CNSCAFile != "" || nwCfg.CNSCertFile != "" || nwCfg.CNSKeyFile != "" {
+		var err error
+		if tlsConfig, err = common.NewClientTLSConfig(nwCfg.CNSCAFile, nwCfg.CNSCertFile, nwCfg.CNSKeyFile); err != nil {
+			log.Printf("Failed to configure TLS for CNS client. Error: %v", err)
+			return nil, err
+		}
+	}
+
+	return cnsclient.InitCnsClientWithTLS(nwCfg.CNSUrl, tlsConfig)
+}
+
 func SetupRoutingForMultitenancy(
 	nwCfg *cni.NetworkConfig,
 	cnsNetworkConfig *cns.GetNetworkContainerResponse,
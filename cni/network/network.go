@@ -155,6 +155,39 @@ func (plugin *netPlugin) findMasterInterface(nwCfg *cni.NetworkConfig, subnetPre
 	return ""
 }
 
+// getIPConfigV6 returns the IPv6 address configuration of the given result, if any.
+func getIPConfigV6(result *cniTypesCurr.Result) *cniTypesCurr.IPConfig {
+	for _, ipconfig := range result.IPs {
+		if ipconfig.Address.IP.To4() == nil {
+			return ipconfig
+		}
+	}
+
+	return nil
+}
+
+// setIpamSubnets sets the IPv4 and IPv6 subnets of the IPAM config from the given network subnets.
+func setIpamSubnets(nwCfg *cni.NetworkConfig, subnets []network.SubnetInfo) {
+	for _, subnet := range subnets {
+		if subnet.Family == platform.AfINET6 {
+			nwCfg.Ipam.SubnetV6 = subnet.Prefix.String()
+		} else {
+			nwCfg.Ipam.Subnet = subnet.Prefix.String()
+		}
+	}
+}
+
+// setIpamAddresses sets the IPv4 and IPv6 addresses of the IPAM config from the given endpoint addresses.
+func setIpamAddresses(nwCfg *cni.NetworkConfig, addresses []net.IPNet) {
+	for _, address := range addresses {
+		if address.IP.To4() == nil {
+			nwCfg.Ipam.AddressV6 = address.IP.String()
+		} else {
+			nwCfg.Ipam.Address = address.IP.String()
+		}
+	}
+}
+
 // GetEndpointID returns a unique endpoint ID based on the CNI args.
 func GetEndpointID(args *cniSkel.CmdArgs) string {
 	infraEpId, _ := network.ConstructEndpointID(args.ContainerID, args.Netns, args.IfName)
@@ -256,9 +289,9 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		addSnatInterface(nwCfg, result)
 
 		// Convert result to the requested CNI version.
-		res, vererr := result.GetAsVersion(nwCfg.CNIVersion)
+		res, vererr := cni.GetResultAsVersion(result, nwCfg.CNIVersion)
 		if vererr != nil {
-			log.Printf("GetAsVersion failed with error %v", vererr)
+			log.Printf("GetResultAsVersion failed with error %v", vererr)
 			plugin.Error(vererr)
 		}
 
@@ -278,7 +311,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 
 	if nwCfg.MultiTenancy {
 		// Initialize CNSClient
-		cnsclient.InitCnsClient(nwCfg.CNSUrl)
+		initCnsClient(nwCfg)
 	}
 
 	k8sContainerID := args.ContainerID
@@ -372,14 +405,24 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		ipconfig := result.IPs[0]
 		gateway := ipconfig.Gateway
 
-		// On failure, call into IPAM plugin to release the address and address pool.
+		// An IPv6 address is allocated along with the IPv4 address on dual-stack pools.
+		ipconfigV6 := getIPConfigV6(result)
+
+		// On failure, call into IPAM plugin to release the addresses and address pools.
 		defer func() {
 			if err != nil {
 				nwCfg.Ipam.Subnet = subnetPrefix.String()
 				nwCfg.Ipam.Address = ipconfig.Address.IP.String()
+				if ipconfigV6 != nil {
+					subnetPrefixV6 := ipconfigV6.Address
+					subnetPrefixV6.IP = subnetPrefixV6.IP.Mask(subnetPrefixV6.Mask)
+					nwCfg.Ipam.SubnetV6 = subnetPrefixV6.String()
+					nwCfg.Ipam.AddressV6 = ipconfigV6.Address.IP.String()
+				}
 				plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
 
 				nwCfg.Ipam.Address = ""
+				nwCfg.Ipam.AddressV6 = ""
 				plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
 			}
 		}()
@@ -432,6 +475,16 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			NetNs:            args.Netns,
 		}
 
+		if ipconfigV6 != nil {
+			subnetPrefixV6 := ipconfigV6.Address
+			subnetPrefixV6.IP = subnetPrefixV6.IP.Mask(subnetPrefixV6.Mask)
+			nwInfo.Subnets = append(nwInfo.Subnets, network.SubnetInfo{
+				Family:  platform.AfINET6,
+				Prefix:  subnetPrefixV6,
+				Gateway: ipconfigV6.Gateway,
+			})
+		}
+
 		nwInfo.Options = make(map[string]interface{})
 		setNetworkOptions(cnsNetworkConfig, &nwInfo)
 
@@ -447,7 +500,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			// Network already exists.
 			subnetPrefix := nwInfo.Subnets[0].Prefix.String()
 			log.Printf("[cni-net] Found network %v with subnet %v.", networkId, subnetPrefix)
-			nwCfg.Ipam.Subnet = subnetPrefix
+			setIpamSubnets(nwCfg, nwInfo.Subnets)
 
 			// Call into IPAM plugin to allocate an address for the endpoint.
 			result, err = plugin.DelegateAdd(nwCfg.Ipam.Type, nwCfg)
@@ -456,14 +509,17 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 				return err
 			}
 
-			ipconfig := result.IPs[0]
 			iface := &cniTypesCurr.Interface{Name: args.IfName}
 			result.Interfaces = append(result.Interfaces, iface)
 
-			// On failure, call into IPAM plugin to release the address.
+			// On failure, call into IPAM plugin to release the addresses.
 			defer func() {
 				if err != nil {
-					nwCfg.Ipam.Address = ipconfig.Address.IP.String()
+					var addresses []net.IPNet
+					for _, ipconfig := range result.IPs {
+						addresses = append(addresses, ipconfig.Address)
+					}
+					setIpamAddresses(nwCfg, addresses)
 					plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
 				}
 			}()
@@ -498,6 +554,8 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		epInfo.Policies = append(epInfo.Policies, epPolicy)
 	}
 
+	epInfo.Bandwidth = getBandwidthFromRuntimeCfg(nwCfg)
+
 	// Populate addresses.
 	for _, ipconfig := range result.IPs {
 		epInfo.IPAddresses = append(epInfo.IPAddresses, ipconfig.Address)
@@ -565,9 +623,9 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 		result.Interfaces = append(result.Interfaces, iface)
 
 		// Convert result to the requested CNI version.
-		res, vererr := result.GetAsVersion(nwCfg.CNIVersion)
+		res, vererr := cni.GetResultAsVersion(&result, nwCfg.CNIVersion)
 		if vererr != nil {
-			log.Printf("GetAsVersion failed with error %v", vererr)
+			log.Printf("GetResultAsVersion failed with error %v", vererr)
 			plugin.Error(vererr)
 		}
 
@@ -594,7 +652,7 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 
 	if nwCfg.MultiTenancy {
 		// Initialize CNSClient
-		cnsclient.InitCnsClient(nwCfg.CNSUrl)
+		initCnsClient(nwCfg)
 	}
 
 	// Initialize values from network config.
@@ -640,6 +698,139 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// Check handles CNI check commands.
+func (plugin *netPlugin) Check(args *cniSkel.CmdArgs) error {
+	var (
+		err          error
+		nwCfg        *cni.NetworkConfig
+		epInfo       *network.EndpointInfo
+		k8sPodName   string
+		k8sNamespace string
+		networkId    string
+	)
+
+	log.Printf("[cni-net] Processing CHECK command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
+		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
+
+	defer func() { log.Printf("[cni-net] CHECK command completed with err:%v.", err) }()
+
+	// Parse network configuration from stdin.
+	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
+		err = plugin.Errorf("Failed to parse network configuration: %v.", err)
+		return err
+	}
+
+	log.Printf("[cni-net] Read network configuration %+v.", nwCfg)
+
+	// Parse Pod arguments.
+	if k8sPodName, k8sNamespace, err = plugin.getPodInfo(args.Args); err != nil {
+		return err
+	}
+
+	if nwCfg.MultiTenancy {
+		// Initialize CNSClient
+		initCnsClient(nwCfg)
+	}
+
+	// Initialize values from network config.
+	if networkId, err = getNetworkName(k8sPodName, k8sNamespace, args.IfName, nwCfg); err != nil {
+		log.Printf("[cni-net] Failed to extract network name from network config. error: %v", err)
+	}
+
+	endpointId := GetEndpointID(args)
+
+	// Query the endpoint.
+	if epInfo, err = plugin.nm.GetEndpointInfo(networkId, endpointId); err != nil {
+		err = &cniTypes.Error{Code: cni.ErrCheckEndpointNotFound, Msg: "Endpoint not found", Details: err.Error()}
+		plugin.Error(err)
+		return err
+	}
+
+	// Verify the result of the previous ADD against the persisted endpoint.
+	if nwCfg.RawPrevResult != nil {
+		if err = checkPrevResult(nwCfg.CNIVersion, nwCfg.RawPrevResult, epInfo); err != nil {
+			plugin.Error(err)
+			return err
+		}
+	}
+
+	// Verify the dataplane against the persisted endpoint.
+	if err = plugin.nm.CheckEndpoint(networkId, endpointId, args.Netns, args.IfName); err != nil {
+		err = checkErrorToCniError(err)
+		plugin.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// checkPrevResult verifies that every address in the previous result is assigned to the endpoint.
+func checkPrevResult(version string, rawPrevResult map[string]interface{}, epInfo *network.EndpointInfo) error {
+	newPrevResultError := func(format string, args ...interface{}) error {
+		return &cniTypes.Error{
+			Code:    cni.ErrCheckPrevResultMismatch,
+			Msg:     "Previous result does not match endpoint",
+			Details: fmt.Sprintf(format, args...),
+		}
+	}
+
+	data, err := json.Marshal(rawPrevResult)
+	if err != nil {
+		return newPrevResultError("failed to marshal prevResult: %v", err)
+	}
+
+	prevResult, err := cni.ParseResult(version, data)
+	if err != nil {
+		return newPrevResultError("failed to parse prevResult: %v", err)
+	}
+
+	for _, ipConfig := range prevResult.IPs {
+		found := false
+		for _, ipAddr := range epInfo.IPAddresses {
+			if ipAddr.IP.Equal(ipConfig.Address.IP) && ipAddr.Mask.String() == ipConfig.Address.Mask.String() {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return newPrevResultError("address %v is not assigned to endpoint %v", ipConfig.Address.String(), epInfo.Id)
+		}
+	}
+
+	return nil
+}
+
+// checkErrorToCniError maps a dataplane divergence reported by the network manager to a CNI error.
+func checkErrorToCniError(err error) error {
+	checkErr, ok := err.(*network.CheckError)
+	if !ok {
+		return err
+	}
+
+	var code uint
+	switch checkErr.Err {
+	case network.ErrContainerInterfaceNotFound:
+		code = cni.ErrCheckContainerInterfaceMissing
+	case network.ErrContainerAddressNotFound:
+		code = cni.ErrCheckContainerAddressMissing
+	case network.ErrContainerRouteNotFound:
+		code = cni.ErrCheckContainerRouteMissing
+	case network.ErrHostInterfaceNotFound:
+		code = cni.ErrCheckHostInterfaceMissing
+	case network.ErrHostInterfaceNotAttached:
+		code = cni.ErrCheckHostInterfaceNotAttached
+	case network.ErrHostRouteNotFound:
+		code = cni.ErrCheckHostRouteMissing
+	case network.ErrEndpointRuleNotFound:
+		code = cni.ErrCheckEndpointRuleMissing
+	default:
+		code = cni.ErrRuntime
+	}
+
+	return &cniTypes.Error{Code: code, Msg: checkErr.Err.Error(), Details: checkErr.Detail}
+}
+
 // Delete handles CNI delete commands.
 func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 	var (
@@ -674,7 +865,7 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 	if nwCfg.MultiTenancy {
 		// Initialize CNSClient
-		cnsclient.InitCnsClient(nwCfg.CNSUrl)
+		initCnsClient(nwCfg)
 	}
 
 	// Initialize values from network config.
@@ -708,14 +899,12 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 	if !nwCfg.MultiTenancy {
 		// Call into IPAM plugin to release the endpoint's addresses.
-		nwCfg.Ipam.Subnet = nwInfo.Subnets[0].Prefix.String()
-		for _, address := range epInfo.IPAddresses {
-			nwCfg.Ipam.Address = address.IP.String()
-			err = plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
-			if err != nil {
-				err = plugin.Errorf("Failed to release address: %v", err)
-				return err
-			}
+		setIpamSubnets(nwCfg, nwInfo.Subnets)
+		setIpamAddresses(nwCfg, epInfo.IPAddresses)
+		err = plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
+		if err != nil {
+			err = plugin.Errorf("Failed to release address: %v", err)
+			return err
 		}
 	} else if epInfo.EnableInfraVnet {
 		nwCfg.Ipam.Subnet = nwInfo.Subnets[0].Prefix.String()
@@ -766,9 +955,9 @@ func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
 		}
 
 		// Convert result to the requested CNI version.
-		res, vererr := result.GetAsVersion(nwCfg.CNIVersion)
+		res, vererr := cni.GetResultAsVersion(result, nwCfg.CNIVersion)
 		if vererr != nil {
-			log.Printf("GetAsVersion failed with error %v", vererr)
+			log.Printf("GetResultAsVersion failed with error %v", vererr)
 			plugin.Error(vererr)
 		}
 
@@ -822,7 +1011,7 @@ func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
 
 	// now query CNS to get the target routes that should be there in the networknamespace (as a result of update)
 	log.Printf("Going to collect target routes for [name=%v, namespace=%v] from CNS.", k8sPodName, k8sNamespace)
-	if cnsClient, err = cnsclient.InitCnsClient(nwCfg.CNSUrl); err != nil {
+	if cnsClient, err = initCnsClient(nwCfg); err != nil {
 		log.Printf("Initializing CNS client error in CNI Update%v", err)
 		log.Printf(err.Error())
 		return plugin.Errorf(err.Error())
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"encoding/json"
 	"net"
 	"strconv"
 
@@ -120,9 +121,43 @@ func getEndpointDNSSettings(nwCfg *cni.NetworkConfig, result *cniTypesCurr.Resul
 }
 
 // getPoliciesFromRuntimeCfg returns network policies from network config.
-// getPoliciesFromRuntimeCfg is a dummy function for Linux platform.
 func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
-	return nil
+	log.Printf("[net] RuntimeConfigs: %+v", nwCfg.RuntimeConfig)
+	var policies []policy.Policy
+	for _, mapping := range nwCfg.RuntimeConfig.PortMappings {
+		rawPolicy, _ := json.Marshal(&policy.PortMapping{
+			Type:         policy.PortMappingPolicy,
+			ExternalPort: uint16(mapping.HostPort),
+			InternalPort: uint16(mapping.ContainerPort),
+			Protocol:     mapping.Protocol,
+			HostIP:       mapping.HostIp,
+		})
+
+		policy := policy.Policy{
+			Type: policy.EndpointPolicy,
+			Data: rawPolicy,
+		}
+		log.Printf("[net] Creating port mapping policy: %+v", policy)
+
+		policies = append(policies, policy)
+	}
+
+	return policies
+}
+
+// getBandwidthFromRuntimeCfg returns the bandwidth limits of the endpoint from network config.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthInfo {
+	bw := nwCfg.RuntimeConfig.Bandwidth
+	if bw == nil || (bw.IngressRate == 0 && bw.EgressRate == 0) {
+		return nil
+	}
+
+	return &network.BandwidthInfo{
+		IngressRate:  bw.IngressRate,
+		IngressBurst: bw.IngressBurst,
+		EgressRate:   bw.EgressRate,
+		EgressBurst:  bw.EgressBurst,
+	}
 }
 
 func updateSubnetPrefix(cnsNetworkConfig *cns.GetNetworkContainerResponse, subnetPrefix *net.IPNet) error {
@@ -243,6 +243,12 @@ func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
 	return policies
 }
 
+// getBandwidthFromRuntimeCfg returns the bandwidth limits of the endpoint from network config.
+// getBandwidthFromRuntimeCfg is a dummy function for Windows platform.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthInfo {
+	return nil
+}
+
 func getCustomDNS(nwCfg *cni.NetworkConfig) network.DNSInfo {
 	var search string
 	if len(nwCfg.RuntimeConfig.DNS.Searches) > 0 {
@@ -150,6 +150,7 @@ func main() {
 	defer log.Close()
 
 	config.Version = version
+	config.StoreType = os.Getenv(cni.EnvStoreType)
 	reportManager := &telemetry.ReportManager{
 		HostNetAgentURL: hostNetAgentURL,
 		ContentType:     telemetry.ContentType,
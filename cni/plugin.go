@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	"github.com/Azure/azure-container-networking/common"
@@ -78,7 +79,7 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	pluginInfo := cniVers.PluginSupports(supportedVersions...)
 
 	// Parse args and call the appropriate cmd handler.
-	cniErr := cniSkel.PluginMainWithError(api.Add, api.Get, api.Delete, pluginInfo, plugin.version)
+	cniErr := cniSkel.PluginMainWithError(api.Add, api.Check, api.Delete, pluginInfo, plugin.version)
 	if cniErr != nil {
 		cniErr.Print()
 		return cniErr
@@ -97,12 +98,19 @@ func (plugin *Plugin) DelegateAdd(pluginName string, nwCfg *NetworkConfig) (*cni
 
 	os.Setenv(Cmd, CmdAdd)
 
-	res, err := cniInvoke.DelegateAdd(context.TODO(), pluginName, nwCfg.Serialize(), nil)
+	// The plugin is executed directly, as the CNI library cannot parse results newer than its own spec version.
+	pluginPath, err := cniInvoke.FindInPath(pluginName, filepath.SplitList(os.Getenv("CNI_PATH")))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to delegate: %v", err)
 	}
 
-	result, err = cniTypesCurr.NewResultFromResult(res)
+	exec := &cniInvoke.RawExec{Stderr: os.Stderr}
+	stdout, err := exec.ExecPlugin(context.TODO(), pluginPath, nwCfg.Serialize(), cniInvoke.ArgsFromEnv().AsEnv())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to delegate: %v", err)
+	}
+
+	result, err = ParseResult(nwCfg.CNIVersion, stdout)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to convert result: %v", err)
 	}
@@ -152,7 +160,7 @@ func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error
 	// Create the key value store.
 	if plugin.Store == nil {
 		var err error
-		plugin.Store, err = store.NewJsonFileStore(platform.CNIRuntimePath + plugin.Name + ".json")
+		plugin.Store, err = store.NewKeyValueStore(config.StoreType, platform.CNIRuntimePath+plugin.Name)
 		if err != nil {
 			log.Printf("[cni] Failed to create store: %v.", err)
 			return err
@@ -0,0 +1,152 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
+	cniVers "github.com/containernetworking/cni/pkg/version"
+)
+
+const (
+	// CNI spec version of Result100.
+	version100 = "1.0.0"
+)
+
+// Result100 is the result format of CNI spec 1.0.0.
+// It has the same layout as the 0.4.0 result, except that IP configs no longer carry a version.
+type Result100 struct {
+	CNIVersion string                    `json:"cniVersion,omitempty"`
+	Interfaces []*cniTypesCurr.Interface `json:"interfaces,omitempty"`
+	IPs        []*IPConfig100            `json:"ips,omitempty"`
+	Routes     []*cniTypes.Route         `json:"routes,omitempty"`
+	DNS        cniTypes.DNS              `json:"dns,omitempty"`
+}
+
+// IPConfig100 is an IP address configuration in a CNI spec 1.0.0 result.
+type IPConfig100 struct {
+	Interface *int           `json:"interface,omitempty"`
+	Address   cniTypes.IPNet `json:"address"`
+	Gateway   net.IP         `json:"gateway,omitempty"`
+}
+
+// newResult100 converts a current result to a CNI spec 1.0.0 result.
+func newResult100(result *cniTypesCurr.Result) *Result100 {
+	newResult := &Result100{
+		CNIVersion: version100,
+		Interfaces: result.Interfaces,
+		Routes:     result.Routes,
+		DNS:        result.DNS,
+	}
+
+	for _, ip := range result.IPs {
+		newResult.IPs = append(newResult.IPs, &IPConfig100{
+			Interface: ip.Interface,
+			Address:   cniTypes.IPNet(ip.Address),
+			Gateway:   ip.Gateway,
+		})
+	}
+
+	return newResult
+}
+
+// convertToCurrent converts a CNI spec 1.0.0 result to a current result.
+func (r *Result100) convertToCurrent() *cniTypesCurr.Result {
+	result := &cniTypesCurr.Result{
+		CNIVersion: cniTypesCurr.ImplementedSpecVersion,
+		Interfaces: r.Interfaces,
+		Routes:     r.Routes,
+		DNS:        r.DNS,
+	}
+
+	for _, ip := range r.IPs {
+		ipVersion := "6"
+		if ip.Address.IP.To4() != nil {
+			ipVersion = "4"
+		}
+
+		result.IPs = append(result.IPs, &cniTypesCurr.IPConfig{
+			Version:   ipVersion,
+			Interface: ip.Interface,
+			Address:   net.IPNet(ip.Address),
+			Gateway:   ip.Gateway,
+		})
+	}
+
+	return result
+}
+
+// Version returns the CNI spec version of the result.
+func (r *Result100) Version() string {
+	return version100
+}
+
+// GetAsVersion returns the result converted to the given CNI spec version.
+func (r *Result100) GetAsVersion(version string) (cniTypes.Result, error) {
+	if version == version100 {
+		r.CNIVersion = version
+		return r, nil
+	}
+
+	return r.convertToCurrent().GetAsVersion(version)
+}
+
+// Print prints the result in JSON format to stdout.
+func (r *Result100) Print() error {
+	return r.PrintTo(os.Stdout)
+}
+
+// PrintTo prints the result in JSON format to the given writer.
+func (r *Result100) PrintTo(writer io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
+
+// String returns a string representation of the result.
+func (r *Result100) String() string {
+	return fmt.Sprintf("Interfaces:%+v, IP:%+v, Routes:%+v, DNS:%+v", r.Interfaces, r.IPs, r.Routes, r.DNS)
+}
+
+// GetResultAsVersion returns the result converted to the given CNI spec version.
+func GetResultAsVersion(result *cniTypesCurr.Result, version string) (cniTypes.Result, error) {
+	if version == version100 {
+		return newResult100(result), nil
+	}
+
+	return result.GetAsVersion(version)
+}
+
+// ParseResult parses a result in the given CNI spec version and converts it to a current result.
+func ParseResult(version string, data []byte) (*cniTypesCurr.Result, error) {
+	if version == "" {
+		version = defaultVersion
+	}
+
+	if version == version100 {
+		var result Result100
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+
+		return result.convertToCurrent(), nil
+	}
+
+	res, err := cniVers.NewResult(version, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return cniTypesCurr.NewResultFromResult(res)
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package cni
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "update golden files")
+
+// Returns the result used to generate golden files.
+func newTestResult() *cniTypesCurr.Result {
+	_, podSubnet, _ := net.ParseCIDR("10.240.0.0/16")
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	gateway := net.ParseIP("10.240.0.1")
+
+	return &cniTypesCurr.Result{
+		Interfaces: []*cniTypesCurr.Interface{
+			{Name: "eth0", Sandbox: "/var/run/netns/test"},
+		},
+		IPs: []*cniTypesCurr.IPConfig{
+			{
+				Version:   "4",
+				Interface: cniTypesCurr.Int(0),
+				Address:   net.IPNet{IP: net.ParseIP("10.240.0.5").To4(), Mask: podSubnet.Mask},
+				Gateway:   gateway,
+			},
+		},
+		Routes: []*cniTypes.Route{
+			{Dst: *defaultDst, GW: gateway},
+		},
+		DNS: cniTypes.DNS{
+			Nameservers: []string{"168.63.129.16"},
+		},
+	}
+}
+
+// Returns the path of the golden result file for the given version.
+func goldenResultFile(version string) string {
+	return filepath.Join("testdata", "result-"+version+".json")
+}
+
+// Reads the golden file at the given path, updating it first if requested.
+func readGoldenFile(t *testing.T, path string, actual []byte) []byte {
+	if *updateGoldenFiles {
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatalf("Failed to update golden file %v: %v", path, err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %v: %v", path, err)
+	}
+
+	return expected
+}
+
+// Tests that results are emitted in the format of each supported version.
+func TestResultMatchesGoldenFiles(t *testing.T) {
+	for _, version := range supportedVersions {
+		t.Run(version, func(t *testing.T) {
+			res, err := GetResultAsVersion(newTestResult(), version)
+			if err != nil {
+				t.Fatalf("Failed to convert result to version %v: %v", version, err)
+			}
+
+			var actual bytes.Buffer
+			if err = res.PrintTo(&actual); err != nil {
+				t.Fatalf("Failed to print result: %v", err)
+			}
+
+			expected := readGoldenFile(t, goldenResultFile(version), actual.Bytes())
+			if !bytes.Equal(actual.Bytes(), expected) {
+				t.Errorf("Result for version %v does not match golden file:\n%s\nexpected:\n%s", version, actual.Bytes(), expected)
+			}
+		})
+	}
+}
+
+// Tests that results of each supported version are parsed back to the same result.
+func TestResultGoldenFilesAreParsed(t *testing.T) {
+	for _, version := range supportedVersions {
+		t.Run(version, func(t *testing.T) {
+			expected, err := ioutil.ReadFile(goldenResultFile(version))
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+
+			result, err := ParseResult(version, expected)
+			if err != nil {
+				t.Fatalf("Failed to parse result of version %v: %v", version, err)
+			}
+
+			res, err := GetResultAsVersion(result, version)
+			if err != nil {
+				t.Fatalf("Failed to convert result to version %v: %v", version, err)
+			}
+
+			var actual bytes.Buffer
+			if err = res.PrintTo(&actual); err != nil {
+				t.Fatalf("Failed to print result: %v", err)
+			}
+
+			if !bytes.Equal(actual.Bytes(), expected) {
+				t.Errorf("Parsed result for version %v does not match golden file:\n%s\nexpected:\n%s", version, actual.Bytes(), expected)
+			}
+		})
+	}
+}
+
+// Tests that the version of network configs is selected correctly.
+func TestNetworkConfigVersionIsSelected(t *testing.T) {
+	tests := []struct {
+		file    string
+		version string
+	}{
+		{"netconfig-0.3.1.json", "0.3.1"},
+		{"netconfig-1.0.0.json", "1.0.0"},
+		{"netconfig-versions.json", "1.0.0"},
+		{"netconfig-noversion.json", defaultVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Failed to read network config: %v", err)
+			}
+
+			nwCfg, err := ParseNetworkConfig(data)
+			if err != nil {
+				t.Fatalf("Failed to parse network config: %v", err)
+			}
+
+			if nwCfg.CNIVersion != tt.version {
+				t.Errorf("Selected version %v, expected %v", nwCfg.CNIVersion, tt.version)
+			}
+		})
+	}
+}
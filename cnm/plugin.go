@@ -4,6 +4,7 @@
 package cnm
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -13,6 +14,11 @@ import (
 	"github.com/Azure/azure-container-networking/log"
 )
 
+var (
+	// Error returned when TLS is configured for a listener on a unix domain socket.
+	errTLSOnUnixSocket = fmt.Errorf("TLS is not supported on unix domain sockets")
+)
+
 // Plugin is the parent class for CNM plugins.
 type Plugin struct {
 	*common.Plugin
@@ -53,6 +59,21 @@ func (plugin *Plugin) Initialize(config *common.PluginConfig) error {
 			return err
 		}
 
+		// Serve HTTPS if a certificate is configured.
+		// Docker reaches plugins on unix domain sockets over plain HTTP only.
+		if certFile, _ := plugin.GetOption(common.OptTlsCertFile).(string); certFile != "" {
+			if u.Scheme == "unix" {
+				log.Printf("[cnm] TLS is not supported on unix domain socket %v.", u)
+				return errTLSOnUnixSocket
+			}
+
+			keyFile, _ := plugin.GetOption(common.OptTlsKeyFile).(string)
+			clientCAFile, _ := plugin.GetOption(common.OptTlsClientCAFile).(string)
+			if err = listener.EnableTLS(certFile, keyFile, clientCAFile); err != nil {
+				return err
+			}
+		}
+
 		// Add generic protocol handlers.
 		listener.AddHandler(activatePath, plugin.activate)
 
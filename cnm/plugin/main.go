@@ -89,6 +89,20 @@ var args = common.ArgumentList{
 		Type:         "int",
 		DefaultValue: "",
 	},
+	{
+		Name:         common.OptIpamAllocationStrategy,
+		Shorthand:    common.OptIpamAllocationStrategyAlias,
+		Description:  "Set the IPAM address allocation strategy (sequential, lru or random)",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptIpamQuarantinePeriod,
+		Shorthand:    common.OptIpamQuarantinePeriodAlias,
+		Description:  "Set the IPAM quarantine period of released addresses in seconds",
+		Type:         "int",
+		DefaultValue: "",
+	},
 	{
 		Name:         common.OptVersion,
 		Shorthand:    common.OptVersionAlias,
@@ -96,6 +110,38 @@ var args = common.ArgumentList{
 		Type:         "bool",
 		DefaultValue: false,
 	},
+	{
+		Name:         common.OptTlsCertFile,
+		Shorthand:    common.OptTlsCertFileAlias,
+		Description:  "Serve HTTPS with this certificate file",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptTlsKeyFile,
+		Shorthand:    common.OptTlsKeyFileAlias,
+		Description:  "Set the key file of the HTTPS certificate",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptTlsClientCAFile,
+		Shorthand:    common.OptTlsClientCAFileAlias,
+		Description:  "Require client certificates signed by a CA in this file",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptStoreType,
+		Shorthand:    common.OptStoreTypeAlias,
+		Description:  "Set the key value store backend",
+		Type:         "string",
+		DefaultValue: store.StoreTypeJsonFile,
+		ValueMap: map[string]interface{}{
+			store.StoreTypeJsonFile: 0,
+			store.StoreTypeBolt:     0,
+		},
+	},
 }
 
 // Prints description and version information.
@@ -115,7 +161,13 @@ func main() {
 	logTarget := common.GetArg(common.OptLogTarget).(int)
 	ipamQueryUrl, _ := common.GetArg(common.OptIpamQueryUrl).(string)
 	ipamQueryInterval, _ := common.GetArg(common.OptIpamQueryInterval).(int)
+	ipamAllocationStrategy, _ := common.GetArg(common.OptIpamAllocationStrategy).(string)
+	ipamQuarantinePeriod, _ := common.GetArg(common.OptIpamQuarantinePeriod).(int)
 	vers := common.GetArg(common.OptVersion).(bool)
+	storeType := common.GetArg(common.OptStoreType).(string)
+	tlsCertFile := common.GetArg(common.OptTlsCertFile).(string)
+	tlsKeyFile := common.GetArg(common.OptTlsKeyFile).(string)
+	tlsClientCAFile := common.GetArg(common.OptTlsClientCAFile).(string)
 
 	if vers {
 		printVersion()
@@ -125,6 +177,7 @@ func main() {
 	// Initialize plugin common configuration.
 	var config common.PluginConfig
 	config.Version = version
+	config.StoreType = storeType
 
 	// Create a channel to receive unhandled errors from the plugins.
 	config.ErrChan = make(chan error, 1)
@@ -150,7 +203,7 @@ func main() {
 	}
 
 	// Create the key value store.
-	config.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + name + ".json")
+	config.Store, err = store.NewKeyValueStore(storeType, platform.CNMRuntimePath+name)
 	if err != nil {
 		fmt.Printf("Failed to create store: %v\n", err)
 		return
@@ -171,11 +224,16 @@ func main() {
 
 	// Set plugin options.
 	netPlugin.SetOption(common.OptAPIServerURL, url)
+	netPlugin.SetOption(common.OptTlsCertFile, tlsCertFile)
+	netPlugin.SetOption(common.OptTlsKeyFile, tlsKeyFile)
+	netPlugin.SetOption(common.OptTlsClientCAFile, tlsClientCAFile)
 
 	ipamPlugin.SetOption(common.OptEnvironment, environment)
 	ipamPlugin.SetOption(common.OptAPIServerURL, url)
 	ipamPlugin.SetOption(common.OptIpamQueryUrl, ipamQueryUrl)
 	ipamPlugin.SetOption(common.OptIpamQueryInterval, ipamQueryInterval)
+	ipamPlugin.SetOption(common.OptIpamAllocationStrategy, ipamAllocationStrategy)
+	ipamPlugin.SetOption(common.OptIpamQuarantinePeriod, ipamQuarantinePeriod)
 
 	// Start plugins.
 	if netPlugin != nil {
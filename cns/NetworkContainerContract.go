@@ -2,6 +2,7 @@ package cns
 
 import (
 	"encoding/json"
+	"time"
 )
 
 // Container Network Service DNC Contract
@@ -16,6 +17,9 @@ const (
 	GetNetworkContainerByOrchestratorContext = "/network/getnetworkcontainerbyorchestratorcontext"
 	AttachContainerToNetwork                 = "/network/attachcontainertonetwork"
 	DetachContainerFromNetwork               = "/network/detachcontainerfromnetwork"
+	ListNetworkContainers                    = "/network/listnetworkcontainers"
+	WatchNetworkContainers                   = "/network/watchnetworkcontainers"
+	GetNMAgentOperationStatus                = "/network/getnmagentoperationstatus"
 )
 
 // NetworkContainer Prefixes
@@ -119,14 +123,70 @@ type GetNetworkContainerStatusRequest struct {
 	NetworkContainerid string
 }
 
+// Sync states of a network container dataplane.
+const (
+	NetworkContainerSyncPending = "Pending"
+	NetworkContainerSynced      = "Synced"
+	NetworkContainerSyncFailed  = "Failed"
+	NetworkContainerNotVerified = "NotVerified"
+)
+
 // GetNetworkContainerStatusResponse specifies response of retriving a network container status.
 type GetNetworkContainerStatusResponse struct {
 	NetworkContainerid string
 	Version            string
 	AzureHostVersion   string
+	SyncStatus         string
+	LastSyncTime       time.Time
+	LastSyncError      string
+	RepairCount        int
 	Response           Response
 }
 
+// NetworkContainer event types
+const (
+	NetworkContainerAdded    = "Added"
+	NetworkContainerModified = "Modified"
+	NetworkContainerDeleted  = "Deleted"
+)
+
+// NetworkContainerInfo describes the goal state of a network container and the resource version of its last change.
+// The authorization token of the goal state is not returned.
+type NetworkContainerInfo struct {
+	ResourceVersion  uint64
+	NetworkContainer CreateNetworkContainerRequest
+}
+
+// ListNetworkContainersResponse specifies response of listing all network containers.
+// ResourceVersion is the version of the list and can be used to watch changes made after it.
+type ListNetworkContainersResponse struct {
+	NetworkContainers []NetworkContainerInfo
+	ResourceVersion   uint64
+	Response          Response
+}
+
+// NetworkContainerEvent describes the creation, update or deletion of a network container.
+// Deleted events carry the last goal state of the network container.
+type NetworkContainerEvent struct {
+	Type             string
+	NetworkContainer NetworkContainerInfo
+}
+
+// WatchNetworkContainersRequest specifies request to wait for network container changes made after a resource version.
+// The request returns when changes are available or after TimeoutSeconds, with a default of 30 and a maximum of 300.
+type WatchNetworkContainersRequest struct {
+	ResourceVersion uint64
+	TimeoutSeconds  int
+}
+
+// WatchNetworkContainersResponse specifies response of watching network containers.
+// ResourceVersion is the version to watch from in the next request.
+type WatchNetworkContainersResponse struct {
+	Events          []NetworkContainerEvent
+	ResourceVersion uint64
+	Response        Response
+}
+
 // GetNetworkContainerRequest specifies the details about the request to retrieve a specifc network container.
 type GetNetworkContainerRequest struct {
 	NetworkContainerid  string
@@ -188,12 +248,14 @@ type NetworkInterface struct {
 }
 
 // PublishNetworkContainerRequest specifies request to publish network container via NMAgent.
+// Async requests return once accepted, and their progress is reported by GetNMAgentOperationStatus.
 type PublishNetworkContainerRequest struct {
 	NetworkID                         string
 	NetworkContainerID                string
 	JoinNetworkURL                    string
 	CreateNetworkContainerURL         string
 	CreateNetworkContainerRequestBody []byte
+	Async                             bool
 }
 
 // PublishNetworkContainerResponse specifies the response to publish network container request.
@@ -205,11 +267,13 @@ type PublishNetworkContainerResponse struct {
 }
 
 // UnpublishNetworkContainerRequest specifies request to unpublish network container via NMAgent.
+// Async requests return once accepted, and their progress is reported by GetNMAgentOperationStatus.
 type UnpublishNetworkContainerRequest struct {
 	NetworkID                 string
 	NetworkContainerID        string
 	JoinNetworkURL            string
 	DeleteNetworkContainerURL string
+	Async                     bool
 }
 
 // UnpublishNetworkContainerResponse specifies the response to unpublish network container request.
@@ -219,3 +283,38 @@ type UnpublishNetworkContainerResponse struct {
 	UnpublishStatusCode   int
 	UnpublishResponseBody []byte
 }
+
+// NMAgent operations on network containers.
+const (
+	NMAgentPublish   = "Publish"
+	NMAgentUnpublish = "Unpublish"
+)
+
+// States of NMAgent operations.
+const (
+	NMAgentOperationInProgress = "InProgress"
+	NMAgentOperationSucceeded  = "Succeeded"
+	NMAgentOperationFailed     = "Failed"
+)
+
+// GetNMAgentOperationStatusRequest specifies request to retrieve the status of the last NMAgent operation on a network container.
+type GetNMAgentOperationStatusRequest struct {
+	NetworkContainerID string
+}
+
+// GetNMAgentOperationStatusResponse specifies the status of the last publish or unpublish of a network container.
+// ReturnCode and Message are the result the operation returned or would return synchronously.
+type GetNMAgentOperationStatusResponse struct {
+	NetworkContainerID string
+	Operation          string
+	State              string
+	Attempts           int
+	StartTime          time.Time
+	EndTime            time.Time
+	ReturnCode         int
+	Message            string
+	ErrorStr           string
+	StatusCode         int
+	ResponseBody       []byte
+	Response           Response
+}
@@ -19,6 +19,9 @@ const (
 	GetUnhealthyIPAddressesPath   = "/network/ipaddresses/unhealthy"
 	GetHealthReportPath           = "/network/health"
 	NumberOfCPUCoresPath          = "/hostcpucores"
+	MetricsPath                   = "/metrics"
+	ReadinessPath                 = "/readyz"
+	LivenessPath                  = "/healthz"
 	CreateHostNCApipaEndpointPath = "/network/createhostncapipaendpoint"
 	DeleteHostNCApipaEndpointPath = "/network/deletehostncapipaendpoint"
 	V1Prefix                      = "/v0.1"
@@ -2,9 +2,15 @@ package cnsclient
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/log"
@@ -13,10 +19,14 @@ import (
 // CNSClient specifies a client to connect to Ipam Plugin.
 type CNSClient struct {
 	connectionURL string
+	httpClient    *http.Client
 }
 
 const (
 	defaultCnsURL = "http://localhost:10090"
+
+	// Host name used in request URLs when CNS is reached over a unix socket.
+	unixSocketHost = "cns"
 )
 
 var (
@@ -25,14 +35,18 @@ var (
 
 // InitCnsClient initializes new cns client and returns the object
 func InitCnsClient(url string) (*CNSClient, error) {
+	return InitCnsClientWithTLS(url, nil)
+}
+
+// InitCnsClientWithTLS initializes new cns client connecting to CNS over TLS with the given configuration and returns the object
+func InitCnsClientWithTLS(url string, tlsConfig *tls.Config) (*CNSClient, error) {
 	if cnsClient == nil {
-		if url == "" {
-			url = defaultCnsURL
+		client, err := NewCnsClientWithTLS(url, 0, tlsConfig)
+		if err != nil {
+			return nil, err
 		}
 
-		cnsClient = &CNSClient{
-			connectionURL: url,
-		}
+		cnsClient = client
 	}
 
 	return cnsClient, nil
@@ -49,152 +63,395 @@ func GetCnsClient() (*CNSClient, error) {
 	return cnsClient, err
 }
 
-// GetNetworkConfiguration Request to get network config.
-func (cnsClient *CNSClient) GetNetworkConfiguration(orchestratorContext []byte) (*cns.GetNetworkContainerResponse, error) {
+// NewCnsClient creates a new cns client for the given URL.
+// The URL scheme selects the transport: http and tcp URLs connect over TCP, unix URLs connect to the given socket path.
+// A non-zero timeout limits the duration of each request, in addition to any deadline set on the request context.
+func NewCnsClient(cnsURL string, timeout time.Duration) (*CNSClient, error) {
+	return NewCnsClientWithTLS(cnsURL, timeout, nil)
+}
+
+// NewCnsClientWithTLS creates a new cns client connecting to CNS over TLS with the given configuration.
+// TLS is used over any transport if a configuration is given, and for https URLs with the default configuration otherwise.
+func NewCnsClientWithTLS(cnsURL string, timeout time.Duration, tlsConfig *tls.Config) (*CNSClient, error) {
+	if cnsURL == "" {
+		cnsURL = defaultCnsURL
+	}
+
+	u, err := url.Parse(cnsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if tlsConfig != nil || u.Scheme == "https" {
+		scheme = "https"
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+
+	// Any path in TCP URLs is kept as a prefix of request paths.
+	var pathPrefix string
+
+	switch u.Scheme {
+	case "http", "https", "tcp":
+		transport.Proxy = http.ProxyFromEnvironment
+		pathPrefix = strings.TrimSuffix(u.Path, "/")
+
+	case "unix":
+		socketPath := u.Host + u.Path
+		u.Host = unixSocketHost
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+
+	default:
+		return nil, fmt.Errorf("[Azure CNSClient] Unsupported CNS URL scheme %v", u.Scheme)
+	}
+
+	client := &CNSClient{
+		connectionURL: scheme + "://" + u.Host + pathPrefix,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+
+	return client, nil
+}
+
+// Request sends a request to the given CNS path and decodes the response.
+// The request body is omitted if payload is nil.
+func (cnsClient *CNSClient) request(ctx context.Context, method string, path string, payload interface{}, response interface{}) error {
 	var body bytes.Buffer
 
-	httpc := &http.Client{}
-	url := cnsClient.connectionURL + cns.GetNetworkContainerByOrchestratorContext
-	log.Printf("GetNetworkConfiguration url %v", url)
+	url := cnsClient.connectionURL + path
+	log.Printf("[Azure CNSClient] %v %v", method, url)
 
-	payload := &cns.GetNetworkContainerRequest{
-		OrchestratorContext: orchestratorContext,
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			log.Errorf("encoding json failed with %v", err)
+			return err
+		}
 	}
 
-	err := json.NewEncoder(&body).Encode(payload)
+	req, err := http.NewRequest(method, url, &body)
 	if err != nil {
-		log.Errorf("encoding json failed with %v", err)
-		return nil, err
+		return err
 	}
 
-	res, err := httpc.Post(url, "application/json", &body)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := cnsClient.httpClient.Do(req)
 	if err != nil {
-		log.Errorf("[Azure CNSClient] HTTP Post returned error %v", err.Error())
-		return nil, err
+		log.Errorf("[Azure CNSClient] HTTP %v returned error %v", method, err.Error())
+		return err
 	}
 
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("[Azure CNSClient] GetNetworkConfiguration invalid http status code: %v", res.StatusCode)
-		log.Errorf(errMsg)
-		return nil, fmt.Errorf(errMsg)
+		err = fmt.Errorf("[Azure CNSClient] %v: Invalid http status code: %v", path, res.StatusCode)
+		log.Errorf("%v", err)
+		return err
 	}
 
-	var resp cns.GetNetworkContainerResponse
+	if err = json.NewDecoder(res.Body).Decode(response); err != nil {
+		log.Errorf("[Azure CNSClient] Error parsing %v response err: %v", path, err.Error())
+		return err
+	}
 
-	err = json.NewDecoder(res.Body).Decode(&resp)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] Error received while parsing GetNetworkConfiguration response resp:%v err:%v", res.Body, err.Error())
-		return nil, err
+	return nil
+}
+
+// Post sends a POST request to the given CNS path and checks the CNS return code of the response.
+func (cnsClient *CNSClient) post(ctx context.Context, path string, payload interface{}, response interface{}, cnsResponse *cns.Response) error {
+	if err := cnsClient.request(ctx, http.MethodPost, path, payload, response); err != nil {
+		return err
 	}
 
-	if resp.Response.ReturnCode != 0 {
-		log.Errorf("[Azure CNSClient] GetNetworkConfiguration received error response :%v", resp.Response.Message)
-		return nil, fmt.Errorf(resp.Response.Message)
+	return checkResponse(path, cnsResponse)
+}
+
+// Get sends a GET request to the given CNS path and checks the CNS return code of the response.
+func (cnsClient *CNSClient) get(ctx context.Context, path string, response interface{}, cnsResponse *cns.Response) error {
+	if err := cnsClient.request(ctx, http.MethodGet, path, nil, response); err != nil {
+		return err
 	}
 
-	return &resp, nil
+	return checkResponse(path, cnsResponse)
+}
+
+// GetNetworkConfiguration Request to get network config.
+func (cnsClient *CNSClient) GetNetworkConfiguration(orchestratorContext []byte) (*cns.GetNetworkContainerResponse, error) {
+	return cnsClient.GetNetworkContainerByOrchestratorContext(context.Background(), orchestratorContext)
 }
 
 // CreateHostNCApipaEndpoint creates an endpoint in APIPA network for host container connectivity.
 func (cnsClient *CNSClient) CreateHostNCApipaEndpoint(
 	networkContainerID string) (string, error) {
-	var (
-		err  error
-		body bytes.Buffer
-	)
+	var resp cns.CreateHostNCApipaEndpointResponse
 
-	httpc := &http.Client{}
-	url := cnsClient.connectionURL + cns.CreateHostNCApipaEndpointPath
-	log.Printf("CreateHostNCApipaEndpoint url: %v for NC: %s", url, networkContainerID)
+	log.Printf("CreateHostNCApipaEndpoint for NC: %s", networkContainerID)
 
 	payload := &cns.CreateHostNCApipaEndpointRequest{
 		NetworkContainerID: networkContainerID,
 	}
 
-	if err = json.NewEncoder(&body).Encode(payload); err != nil {
-		log.Errorf("encoding json failed with %v", err)
+	err := cnsClient.post(context.Background(), cns.CreateHostNCApipaEndpointPath, payload, &resp, &resp.Response)
+	if err != nil {
 		return "", err
 	}
 
-	res, err := httpc.Post(url, "application/json", &body)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] HTTP Post returned error %v", err.Error())
-		return "", err
+	return resp.EndpointID, nil
+}
+
+// DeleteHostNCApipaEndpoint deletes the endpoint in APIPA network created for host container connectivity.
+func (cnsClient *CNSClient) DeleteHostNCApipaEndpoint(networkContainerID string) error {
+	var resp cns.DeleteHostNCApipaEndpointResponse
+
+	log.Printf("DeleteHostNCApipaEndpoint for NC: %s", networkContainerID)
+
+	payload := &cns.DeleteHostNCApipaEndpointRequest{
+		NetworkContainerID: networkContainerID,
 	}
 
-	defer res.Body.Close()
+	return cnsClient.post(context.Background(), cns.DeleteHostNCApipaEndpointPath, payload, &resp, &resp.Response)
+}
 
-	if res.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("[Azure CNSClient] CreateHostNCApipaEndpoint: Invalid http status code: %v",
-			res.StatusCode)
-		log.Errorf(errMsg)
-		return "", fmt.Errorf(errMsg)
+// SetEnvironment sets the location and network type of the node.
+func (cnsClient *CNSClient) SetEnvironment(ctx context.Context, req *cns.SetEnvironmentRequest) error {
+	var resp cns.Response
+	return cnsClient.post(ctx, cns.SetEnvironmentPath, req, &resp, &resp)
+}
+
+// CreateNetwork creates a network.
+func (cnsClient *CNSClient) CreateNetwork(ctx context.Context, req *cns.CreateNetworkRequest) error {
+	var resp cns.Response
+	return cnsClient.post(ctx, cns.CreateNetworkPath, req, &resp, &resp)
+}
+
+// DeleteNetwork deletes a network.
+func (cnsClient *CNSClient) DeleteNetwork(ctx context.Context, networkName string) error {
+	var resp cns.Response
+	req := &cns.DeleteNetworkRequest{NetworkName: networkName}
+	return cnsClient.post(ctx, cns.DeleteNetworkPath, req, &resp, &resp)
+}
+
+// CreateHnsNetwork creates an HNS network.
+func (cnsClient *CNSClient) CreateHnsNetwork(ctx context.Context, req *cns.CreateHnsNetworkRequest) error {
+	var resp cns.Response
+	return cnsClient.post(ctx, cns.CreateHnsNetworkPath, req, &resp, &resp)
+}
+
+// DeleteHnsNetwork deletes an HNS network.
+func (cnsClient *CNSClient) DeleteHnsNetwork(ctx context.Context, networkName string) error {
+	var resp cns.Response
+	req := &cns.DeleteHnsNetworkRequest{NetworkName: networkName}
+	return cnsClient.post(ctx, cns.DeleteHnsNetworkPath, req, &resp, &resp)
+}
+
+// ReserveIPAddress reserves an IP address for the given reservation and returns it.
+func (cnsClient *CNSClient) ReserveIPAddress(ctx context.Context, reservationID string) (string, error) {
+	var resp cns.ReserveIPAddressResponse
+
+	req := &cns.ReserveIPAddressRequest{ReservationID: reservationID}
+	if err := cnsClient.post(ctx, cns.ReserveIPAddressPath, req, &resp, &resp.Response); err != nil {
+		return "", err
 	}
 
-	var resp cns.CreateHostNCApipaEndpointResponse
+	return resp.IPAddress, nil
+}
+
+// ReleaseIPAddress releases the IP address of the given reservation.
+func (cnsClient *CNSClient) ReleaseIPAddress(ctx context.Context, reservationID string) error {
+	var resp cns.Response
+	req := &cns.ReleaseIPAddressRequest{ReservationID: reservationID}
+	return cnsClient.post(ctx, cns.ReleaseIPAddressPath, req, &resp, &resp)
+}
 
-	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil {
-		log.Errorf("[Azure CNSClient] Error parsing CreateHostNCApipaEndpoint response resp: %v err: %v",
-			res.Body, err.Error())
+// GetHostLocalIP returns the IP address containers use to reach the host.
+func (cnsClient *CNSClient) GetHostLocalIP(ctx context.Context) (string, error) {
+	var resp cns.HostLocalIPAddressResponse
+
+	if err := cnsClient.get(ctx, cns.GetHostLocalIPPath, &resp, &resp.Response); err != nil {
 		return "", err
 	}
 
-	if resp.Response.ReturnCode != 0 {
-		log.Errorf("[Azure CNSClient] CreateHostNCApipaEndpoint received error response :%v", resp.Response.Message)
-		return "", fmt.Errorf(resp.Response.Message)
+	return resp.IPAddress, nil
+}
+
+// GetIPAddressUtilization returns the number of available, reserved and unhealthy IP addresses.
+func (cnsClient *CNSClient) GetIPAddressUtilization(ctx context.Context) (*cns.IPAddressesUtilizationResponse, error) {
+	var resp cns.IPAddressesUtilizationResponse
+
+	if err := cnsClient.get(ctx, cns.GetIPAddressUtilizationPath, &resp, &resp.Response); err != nil {
+		return nil, err
 	}
 
-	return resp.EndpointID, nil
+	return &resp, nil
 }
 
-// DeleteHostNCApipaEndpoint deletes the endpoint in APIPA network created for host container connectivity.
-func (cnsClient *CNSClient) DeleteHostNCApipaEndpoint(networkContainerID string) error {
-	var body bytes.Buffer
+// GetUnhealthyIPAddresses returns the unhealthy IP addresses.
+func (cnsClient *CNSClient) GetUnhealthyIPAddresses(ctx context.Context) ([]string, error) {
+	var resp cns.GetIPAddressesResponse
 
-	httpc := &http.Client{}
-	url := cnsClient.connectionURL + cns.DeleteHostNCApipaEndpointPath
-	log.Printf("DeleteHostNCApipaEndpoint url: %v for NC: %s", url, networkContainerID)
+	if err := cnsClient.get(ctx, cns.GetUnhealthyIPAddressesPath, &resp, &resp.Response); err != nil {
+		return nil, err
+	}
 
-	payload := &cns.DeleteHostNCApipaEndpointRequest{
-		NetworkContainerID: networkContainerID,
+	return resp.IPAddresses, nil
+}
+
+// GetHealthReport returns an error if CNS is not healthy.
+func (cnsClient *CNSClient) GetHealthReport(ctx context.Context) error {
+	var resp cns.Response
+	return cnsClient.get(ctx, cns.GetHealthReportPath, &resp, &resp)
+}
+
+// GetNumberOfCPUCores returns the number of CPU cores of the host.
+func (cnsClient *CNSClient) GetNumberOfCPUCores(ctx context.Context) (int, error) {
+	var resp cns.NumOfCPUCoresResponse
+
+	if err := cnsClient.get(ctx, cns.NumberOfCPUCoresPath, &resp, &resp.Response); err != nil {
+		return 0, err
 	}
 
-	err := json.NewEncoder(&body).Encode(payload)
-	if err != nil {
-		log.Errorf("encoding json failed with %v", err)
-		return err
+	return resp.NumOfCPUCores, nil
+}
+
+// SetOrchestratorType sets the orchestrator type of the node.
+func (cnsClient *CNSClient) SetOrchestratorType(ctx context.Context, req *cns.SetOrchestratorTypeRequest) error {
+	var resp cns.Response
+	return cnsClient.post(ctx, cns.SetOrchestratorType, req, &resp, &resp)
+}
+
+// CreateOrUpdateNetworkContainer saves the goal state of a network container.
+func (cnsClient *CNSClient) CreateOrUpdateNetworkContainer(ctx context.Context, req *cns.CreateNetworkContainerRequest) error {
+	var resp cns.CreateNetworkContainerResponse
+	return cnsClient.post(ctx, cns.CreateOrUpdateNetworkContainer, req, &resp, &resp.Response)
+}
+
+// DeleteNetworkContainer deletes a network container.
+func (cnsClient *CNSClient) DeleteNetworkContainer(ctx context.Context, networkContainerID string) error {
+	var resp cns.DeleteNetworkContainerResponse
+	req := &cns.DeleteNetworkContainerRequest{NetworkContainerid: networkContainerID}
+	return cnsClient.post(ctx, cns.DeleteNetworkContainer, req, &resp, &resp.Response)
+}
+
+// GetNetworkContainerStatus returns the versions of a network container on the VM and on the host.
+func (cnsClient *CNSClient) GetNetworkContainerStatus(ctx context.Context, networkContainerID string) (*cns.GetNetworkContainerStatusResponse, error) {
+	var resp cns.GetNetworkContainerStatusResponse
+
+	req := &cns.GetNetworkContainerStatusRequest{NetworkContainerid: networkContainerID}
+	if err := cnsClient.post(ctx, cns.GetNetworkContainerStatus, req, &resp, &resp.Response); err != nil {
+		return nil, err
 	}
 
-	res, err := httpc.Post(url, "application/json", &body)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] HTTP Post returned error %v", err.Error())
-		return err
+	return &resp, nil
+}
+
+// GetNetworkContainerByOrchestratorContext returns the network container of the given orchestrator context.
+func (cnsClient *CNSClient) GetNetworkContainerByOrchestratorContext(ctx context.Context, orchestratorContext []byte) (*cns.GetNetworkContainerResponse, error) {
+	var resp cns.GetNetworkContainerResponse
+
+	req := &cns.GetNetworkContainerRequest{OrchestratorContext: orchestratorContext}
+	if err := cnsClient.post(ctx, cns.GetNetworkContainerByOrchestratorContext, req, &resp, &resp.Response); err != nil {
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	return &resp, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("[Azure CNSClient] DeleteHostNCApipaEndpoint: Invalid http status code: %v",
-			res.StatusCode)
-		log.Errorf(errMsg)
-		return fmt.Errorf(errMsg)
+// GetInterfaceForContainer returns the interface of a network container.
+func (cnsClient *CNSClient) GetInterfaceForContainer(ctx context.Context, networkContainerID string) (*cns.GetInterfaceForContainerResponse, error) {
+	var resp cns.GetInterfaceForContainerResponse
+
+	req := &cns.GetInterfaceForContainerRequest{NetworkContainerID: networkContainerID}
+	if err := cnsClient.post(ctx, cns.GetInterfaceForContainer, req, &resp, &resp.Response); err != nil {
+		return nil, err
 	}
 
-	var resp cns.DeleteHostNCApipaEndpointResponse
+	return &resp, nil
+}
 
-	err = json.NewDecoder(res.Body).Decode(&resp)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] Error parsing DeleteHostNCApipaEndpoint response resp: %v err: %v",
-			res.Body, err.Error())
-		return err
+// AttachContainerToNetwork attaches a container to the network of a network container.
+func (cnsClient *CNSClient) AttachContainerToNetwork(ctx context.Context, req *cns.ConfigureContainerNetworkingRequest) error {
+	var resp cns.AttachContainerToNetworkResponse
+	return cnsClient.post(ctx, cns.AttachContainerToNetwork, req, &resp, &resp.Response)
+}
+
+// DetachContainerFromNetwork detaches a container from the network of a network container.
+func (cnsClient *CNSClient) DetachContainerFromNetwork(ctx context.Context, req *cns.ConfigureContainerNetworkingRequest) error {
+	var resp cns.DetachContainerFromNetworkResponse
+	return cnsClient.post(ctx, cns.DetachContainerFromNetwork, req, &resp, &resp.Response)
+}
+
+// PublishNetworkContainer publishes a network container via NMAgent.
+// The response is returned along with the error so callers can inspect the NMAgent status.
+func (cnsClient *CNSClient) PublishNetworkContainer(ctx context.Context, req *cns.PublishNetworkContainerRequest) (*cns.PublishNetworkContainerResponse, error) {
+	var resp cns.PublishNetworkContainerResponse
+
+	if err := cnsClient.request(ctx, http.MethodPost, cns.PublishNetworkContainer, req, &resp); err != nil {
+		return nil, err
 	}
 
-	if resp.Response.ReturnCode != 0 {
-		log.Errorf("[Azure CNSClient] DeleteHostNCApipaEndpoint received error response :%v", resp.Response.Message)
-		return fmt.Errorf(resp.Response.Message)
+	return &resp, checkResponse(cns.PublishNetworkContainer, &resp.Response)
+}
+
+// UnpublishNetworkContainer unpublishes a network container via NMAgent.
+// The response is returned along with the error so callers can inspect the NMAgent status.
+func (cnsClient *CNSClient) UnpublishNetworkContainer(ctx context.Context, req *cns.UnpublishNetworkContainerRequest) (*cns.UnpublishNetworkContainerResponse, error) {
+	var resp cns.UnpublishNetworkContainerResponse
+
+	if err := cnsClient.request(ctx, http.MethodPost, cns.UnpublishNetworkContainer, req, &resp); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &resp, checkResponse(cns.UnpublishNetworkContainer, &resp.Response)
+}
+
+// GetNMAgentOperationStatus returns the status of the last publish or unpublish of a network container.
+func (cnsClient *CNSClient) GetNMAgentOperationStatus(ctx context.Context, networkContainerID string) (*cns.GetNMAgentOperationStatusResponse, error) {
+	var resp cns.GetNMAgentOperationStatusResponse
+
+	req := &cns.GetNMAgentOperationStatusRequest{NetworkContainerID: networkContainerID}
+	if err := cnsClient.post(ctx, cns.GetNMAgentOperationStatus, req, &resp, &resp.Response); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// ListNetworkContainers returns all network containers and the resource version of the list.
+func (cnsClient *CNSClient) ListNetworkContainers(ctx context.Context) (*cns.ListNetworkContainersResponse, error) {
+	var resp cns.ListNetworkContainersResponse
+
+	if err := cnsClient.get(ctx, cns.ListNetworkContainers, &resp, &resp.Response); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// WatchNetworkContainers waits for network container changes made after the given resource version and returns them,
+// or returns no events after the given timeout. The resource version of the response is the one to watch from next.
+// Errors satisfying IsResourceVersionExpired require listing network containers again. The client timeout, if any,
+// must be longer than the watch timeout.
+func (cnsClient *CNSClient) WatchNetworkContainers(ctx context.Context, resourceVersion uint64, timeout time.Duration) (*cns.WatchNetworkContainersResponse, error) {
+	var resp cns.WatchNetworkContainersResponse
+
+	req := &cns.WatchNetworkContainersRequest{
+		ResourceVersion: resourceVersion,
+		TimeoutSeconds:  int(timeout / time.Second),
+	}
+
+	if err := cnsClient.post(ctx, cns.WatchNetworkContainers, req, &resp, &resp.Response); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
 }
@@ -0,0 +1,423 @@
+package cnsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/common"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	acn "github.com/Azure/azure-container-networking/common"
+)
+
+var (
+	// Client connected to the in-process CNS over a unix socket.
+	client *CNSClient
+)
+
+// Wraps the test run with an in-process CNS listening on a unix socket.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "cnsclient")
+	if err != nil {
+		fmt.Printf("Failed to create temp dir, err:%v.\n", err)
+		os.Exit(1)
+	}
+
+	socketPath := filepath.Join(dir, "cns.sock")
+	u, _ := url.Parse("unix://" + socketPath)
+
+	listener, err := acn.NewListener(u)
+	if err != nil {
+		fmt.Printf("Failed to create listener, err:%v.\n", err)
+		os.Exit(1)
+	}
+
+	config := common.ServiceConfig{
+		Name:     "cns-client-test-server",
+		Listener: listener,
+		ErrChan:  make(chan error, 1),
+	}
+
+	if err = listener.Start(config.ErrChan); err != nil {
+		fmt.Printf("Failed to start listener, err:%v.\n", err)
+		os.Exit(1)
+	}
+
+	service, err := restserver.NewHTTPRestService(&config)
+	if err != nil {
+		fmt.Printf("Failed to create CNS, err:%v.\n", err)
+		os.Exit(1)
+	}
+
+	if err = service.Start(&config); err != nil {
+		fmt.Printf("Failed to start CNS, err:%v.\n", err)
+		os.Exit(2)
+	}
+
+	client, err = NewCnsClient(u.String(), 10*time.Second)
+	if err != nil {
+		fmt.Printf("Failed to create CNS client, err:%v.\n", err)
+		os.Exit(3)
+	}
+
+	exitCode := m.Run()
+
+	service.Stop()
+	os.RemoveAll(dir)
+
+	os.Exit(exitCode)
+}
+
+// Returns a request to create a network container for the given pod.
+func newNetworkContainerRequest(ncID string, podInfo cns.KubernetesPodInfo) *cns.CreateNetworkContainerRequest {
+	orchestratorContext, _ := json.Marshal(podInfo)
+
+	return &cns.CreateNetworkContainerRequest{
+		Version:              "0.1",
+		NetworkContainerType: cns.AzureContainerInstance,
+		NetworkContainerid:   ncID,
+		OrchestratorContext:  orchestratorContext,
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet:         cns.IPSubnet{IPAddress: "11.0.0.5", PrefixLength: 24},
+			DNSServers:       []string{"8.8.8.8"},
+			GatewayIPAddress: "11.0.0.1",
+		},
+		PrimaryInterfaceIdentifier: "11.0.0.7",
+	}
+}
+
+func TestNetworkContainerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	podInfo := cns.KubernetesPodInfo{PodName: "testpod", PodNamespace: "testpodnamespace"}
+	ncID := "ethClientTest"
+
+	err := client.SetOrchestratorType(ctx, &cns.SetOrchestratorTypeRequest{OrchestratorType: cns.Kubernetes})
+	if err != nil {
+		t.Fatalf("SetOrchestratorType failed, err:%v.", err)
+	}
+
+	if err = client.CreateOrUpdateNetworkContainer(ctx, newNetworkContainerRequest(ncID, podInfo)); err != nil {
+		t.Fatalf("CreateOrUpdateNetworkContainer failed, err:%v.", err)
+	}
+
+	orchestratorContext, _ := json.Marshal(podInfo)
+	nc, err := client.GetNetworkContainerByOrchestratorContext(ctx, orchestratorContext)
+	if err != nil {
+		t.Fatalf("GetNetworkContainerByOrchestratorContext failed, err:%v.", err)
+	}
+
+	if nc.NetworkContainerID != ncID || nc.IPConfiguration.IPSubnet.IPAddress != "11.0.0.5" {
+		t.Errorf("GetNetworkContainerByOrchestratorContext returned unexpected response %+v.", nc)
+	}
+
+	iface, err := client.GetInterfaceForContainer(ctx, ncID)
+	if err != nil {
+		t.Fatalf("GetInterfaceForContainer failed, err:%v.", err)
+	}
+
+	if iface.NetworkInterface.IPAddress != "11.0.0.5" || iface.NetworkContainerVersion != "0.1" {
+		t.Errorf("GetInterfaceForContainer returned unexpected response %+v.", iface)
+	}
+
+	if err = client.DeleteNetworkContainer(ctx, ncID); err != nil {
+		t.Fatalf("DeleteNetworkContainer failed, err:%v.", err)
+	}
+
+	_, err = client.GetInterfaceForContainer(ctx, ncID)
+	if GetReturnCode(err) != UnknownContainerID || !IsNotFound(err) {
+		t.Errorf("GetInterfaceForContainer of deleted container returned err:%v.", err)
+	}
+}
+
+// Watches network containers from the given resource version and returns the response.
+func watchNetworkContainers(t *testing.T, resourceVersion uint64, timeout time.Duration) *cns.WatchNetworkContainersResponse {
+	resp, err := client.WatchNetworkContainers(context.Background(), resourceVersion, timeout)
+	if err != nil {
+		t.Fatalf("WatchNetworkContainers from %v failed, err:%v.", resourceVersion, err)
+	}
+
+	return resp
+}
+
+func TestListAndWatchNetworkContainers(t *testing.T) {
+	ctx := context.Background()
+	ncID := "ethWatchTest"
+
+	err := client.SetOrchestratorType(ctx, &cns.SetOrchestratorTypeRequest{OrchestratorType: cns.Kubernetes})
+	if err != nil {
+		t.Fatalf("SetOrchestratorType failed, err:%v.", err)
+	}
+
+	list, err := client.ListNetworkContainers(ctx)
+	if err != nil {
+		t.Fatalf("ListNetworkContainers failed, err:%v.", err)
+	}
+
+	// A watch waits for the next change.
+	watch := make(chan *cns.WatchNetworkContainersResponse, 1)
+	go func() {
+		resp, _ := client.WatchNetworkContainers(ctx, list.ResourceVersion, 5*time.Second)
+		watch <- resp
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	req := newNetworkContainerRequest(ncID, cns.KubernetesPodInfo{PodName: "watchpod", PodNamespace: "watchns"})
+	req.AuthorizationToken = "secret"
+	if err = client.CreateOrUpdateNetworkContainer(ctx, req); err != nil {
+		t.Fatalf("CreateOrUpdateNetworkContainer failed, err:%v.", err)
+	}
+
+	resp := <-watch
+	if resp == nil || len(resp.Events) != 1 {
+		t.Fatalf("Watch returned unexpected response %+v.", resp)
+	}
+
+	event := resp.Events[0]
+	if event.Type != cns.NetworkContainerAdded || event.NetworkContainer.NetworkContainer.NetworkContainerid != ncID ||
+		event.NetworkContainer.ResourceVersion != resp.ResourceVersion || resp.ResourceVersion <= list.ResourceVersion {
+		t.Errorf("Watch returned unexpected event %+v at version %v.", event, resp.ResourceVersion)
+	}
+
+	if event.NetworkContainer.NetworkContainer.AuthorizationToken != "" {
+		t.Errorf("Watch returned the authorization token.")
+	}
+
+	list, err = client.ListNetworkContainers(ctx)
+	if err != nil || list.ResourceVersion != resp.ResourceVersion {
+		t.Fatalf("ListNetworkContainers returned %+v, err:%v.", list, err)
+	}
+
+	found := false
+	for _, nc := range list.NetworkContainers {
+		if nc.NetworkContainer.NetworkContainerid == ncID {
+			found = nc.ResourceVersion == resp.ResourceVersion && nc.NetworkContainer.AuthorizationToken == ""
+		}
+	}
+
+	if !found {
+		t.Errorf("ListNetworkContainers returned unexpected containers %+v.", list.NetworkContainers)
+	}
+
+	// Unchanged goal states do not generate events.
+	if err = client.CreateOrUpdateNetworkContainer(ctx, req); err != nil {
+		t.Fatalf("CreateOrUpdateNetworkContainer failed, err:%v.", err)
+	}
+
+	if resp = watchNetworkContainers(t, list.ResourceVersion, time.Second); len(resp.Events) != 0 || resp.ResourceVersion != list.ResourceVersion {
+		t.Errorf("Watch returned unexpected response %+v for an unchanged container.", resp)
+	}
+
+	req.IPConfiguration.DNSServers = []string{"8.8.4.4"}
+	if err = client.CreateOrUpdateNetworkContainer(ctx, req); err != nil {
+		t.Fatalf("CreateOrUpdateNetworkContainer failed, err:%v.", err)
+	}
+
+	if err = client.DeleteNetworkContainer(ctx, ncID); err != nil {
+		t.Fatalf("DeleteNetworkContainer failed, err:%v.", err)
+	}
+
+	resp = watchNetworkContainers(t, list.ResourceVersion, time.Second)
+	if len(resp.Events) != 2 || resp.Events[0].Type != cns.NetworkContainerModified || resp.Events[1].Type != cns.NetworkContainerDeleted ||
+		resp.Events[0].NetworkContainer.NetworkContainer.IPConfiguration.DNSServers[0] != "8.8.4.4" {
+		t.Errorf("Watch returned unexpected events %+v.", resp.Events)
+	}
+
+	// Watches from unknown versions must list again.
+	_, err = client.WatchNetworkContainers(ctx, resp.ResourceVersion+1, time.Second)
+	if !IsResourceVersionExpired(err) {
+		t.Errorf("Watch from a future version returned err:%v.", err)
+	}
+}
+
+func TestFailedRequestsReturnTypedErrors(t *testing.T) {
+	req := newNetworkContainerRequest("ethInvalidTest", cns.KubernetesPodInfo{})
+	req.NetworkContainerType = "invalid"
+
+	err := client.CreateOrUpdateNetworkContainer(context.Background(), req)
+
+	cnsErr, ok := err.(*CNSClientError)
+	if !ok {
+		t.Fatalf("Invalid request returned err:%v, expected a CNSClientError.", err)
+	}
+
+	if cnsErr.ReturnCode != UnsupportedNetworkContainerType || cnsErr.Path != cns.CreateOrUpdateNetworkContainer {
+		t.Errorf("Invalid request returned unexpected error %+v.", cnsErr)
+	}
+
+	if !IsInvalidRequest(err) || IsNotFound(err) {
+		t.Errorf("Invalid request error %v was not classified as invalid.", err)
+	}
+
+	err = client.SetOrchestratorType(context.Background(), &cns.SetOrchestratorTypeRequest{OrchestratorType: "invalid"})
+	if GetReturnCode(err) != UnsupportedOrchestratorType {
+		t.Errorf("SetOrchestratorType with invalid type returned err:%v.", err)
+	}
+}
+
+func TestGetHostInformation(t *testing.T) {
+	ctx := context.Background()
+
+	cores, err := client.GetNumberOfCPUCores(ctx)
+	if err != nil || cores <= 0 {
+		t.Errorf("GetNumberOfCPUCores returned %v, err:%v.", cores, err)
+	}
+
+	if err = client.GetHealthReport(ctx); err != nil {
+		t.Errorf("GetHealthReport failed, err:%v.", err)
+	}
+}
+
+func TestPublishNetworkContainer(t *testing.T) {
+	nmagent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer nmagent.Close()
+
+	ctx := context.Background()
+
+	publishResp, err := client.PublishNetworkContainer(ctx, &cns.PublishNetworkContainerRequest{
+		NetworkID:                         "vnet1",
+		NetworkContainerID:                "ethPublishTest",
+		JoinNetworkURL:                    nmagent.URL + "/joinNetwork",
+		CreateNetworkContainerURL:         nmagent.URL + "/networkContainers/ethPublishTest",
+		CreateNetworkContainerRequestBody: []byte("{}"),
+	})
+	if err != nil {
+		t.Fatalf("PublishNetworkContainer failed, err:%v.", err)
+	}
+
+	if publishResp.PublishStatusCode != http.StatusOK {
+		t.Errorf("PublishNetworkContainer returned unexpected response %+v.", publishResp)
+	}
+
+	unpublishResp, err := client.UnpublishNetworkContainer(ctx, &cns.UnpublishNetworkContainerRequest{
+		NetworkID:                 "vnet1",
+		NetworkContainerID:        "ethPublishTest",
+		JoinNetworkURL:            nmagent.URL + "/joinNetwork",
+		DeleteNetworkContainerURL: nmagent.URL + "/networkContainers/ethPublishTest",
+	})
+	if err != nil {
+		t.Fatalf("UnpublishNetworkContainer failed, err:%v.", err)
+	}
+
+	if unpublishResp.UnpublishStatusCode != http.StatusOK {
+		t.Errorf("UnpublishNetworkContainer returned unexpected response %+v.", unpublishResp)
+	}
+}
+
+func TestTCPTransportAndTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == cns.NumberOfCPUCoresPath {
+			time.Sleep(time.Second)
+		}
+
+		json.NewEncoder(w).Encode(&cns.Response{ReturnCode: Success})
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+
+	tcpClient, err := NewCnsClient("tcp://"+u.Host, 0)
+	if err != nil {
+		t.Fatalf("NewCnsClient failed, err:%v.", err)
+	}
+
+	if err = tcpClient.GetHealthReport(context.Background()); err != nil {
+		t.Errorf("GetHealthReport over TCP failed, err:%v.", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = tcpClient.GetNumberOfCPUCores(ctx); err == nil {
+		t.Errorf("Request exceeding its deadline succeeded.")
+	} else if _, ok := err.(*CNSClientError); ok {
+		t.Errorf("Request exceeding its deadline returned CNS error %v.", err)
+	}
+
+	timeoutClient, _ := NewCnsClient(server.URL, 50*time.Millisecond)
+	if _, err = timeoutClient.GetNumberOfCPUCores(context.Background()); err == nil {
+		t.Errorf("Request exceeding the client timeout succeeded.")
+	}
+}
+
+func TestTLSTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&cns.Response{ReturnCode: Success})
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	u, _ := url.Parse(server.URL)
+
+	for _, cnsURL := range []string{server.URL, "tcp://" + u.Host} {
+		tlsClient, err := NewCnsClientWithTLS(cnsURL, 0, &tls.Config{RootCAs: pool})
+		if err != nil {
+			t.Fatalf("NewCnsClientWithTLS failed, err:%v.", err)
+		}
+
+		if err = tlsClient.GetHealthReport(context.Background()); err != nil {
+			t.Errorf("GetHealthReport over TLS to %v failed, err:%v.", cnsURL, err)
+		}
+	}
+
+	// Servers are verified against the given CAs.
+	tlsClient, _ := NewCnsClientWithTLS(server.URL, 0, &tls.Config{RootCAs: x509.NewCertPool()})
+	if err := tlsClient.GetHealthReport(context.Background()); err == nil {
+		t.Errorf("GetHealthReport to an untrusted server succeeded.")
+	}
+}
+
+func TestUnsupportedURLScheme(t *testing.T) {
+	if _, err := NewCnsClient("ftp://localhost:10090", 0); err == nil {
+		t.Errorf("NewCnsClient accepted an unsupported URL scheme.")
+	}
+}
+
+func TestReturnCodesMatchService(t *testing.T) {
+	codes := [][2]int{
+		{Success, restserver.Success},
+		{UnsupportedNetworkType, restserver.UnsupportedNetworkType},
+		{InvalidParameter, restserver.InvalidParameter},
+		{UnsupportedEnvironment, restserver.UnsupportedEnvironment},
+		{UnreachableHost, restserver.UnreachableHost},
+		{ReservationNotFound, restserver.ReservationNotFound},
+		{MalformedSubnet, restserver.MalformedSubnet},
+		{UnreachableDockerDaemon, restserver.UnreachableDockerDaemon},
+		{UnspecifiedNetworkName, restserver.UnspecifiedNetworkName},
+		{NotFound, restserver.NotFound},
+		{AddressUnavailable, restserver.AddressUnavailable},
+		{NetworkContainerNotSpecified, restserver.NetworkContainerNotSpecified},
+		{CallToHostFailed, restserver.CallToHostFailed},
+		{UnknownContainerID, restserver.UnknownContainerID},
+		{UnsupportedOrchestratorType, restserver.UnsupportedOrchestratorType},
+		{DockerContainerNotSpecified, restserver.DockerContainerNotSpecified},
+		{UnsupportedVerb, restserver.UnsupportedVerb},
+		{UnsupportedNetworkContainerType, restserver.UnsupportedNetworkContainerType},
+		{InvalidRequest, restserver.InvalidRequest},
+		{NetworkJoinFailed, restserver.NetworkJoinFailed},
+		{NetworkContainerPublishFailed, restserver.NetworkContainerPublishFailed},
+		{NetworkContainerUnpublishFailed, restserver.NetworkContainerUnpublishFailed},
+		{ResourceVersionExpired, restserver.ResourceVersionExpired},
+		{UnexpectedError, restserver.UnexpectedError},
+	}
+
+	for _, code := range codes {
+		if code[0] != code[1] {
+			t.Errorf("Client return code %v does not match service return code %v.", code[0], code[1])
+		}
+	}
+}
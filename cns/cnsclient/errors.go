@@ -0,0 +1,104 @@
+package cnsclient
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// Return codes of CNS responses. These mirror the codes returned by cns/restserver.
+const (
+	Success                         = 0
+	UnsupportedNetworkType          = 1
+	InvalidParameter                = 2
+	UnsupportedEnvironment          = 3
+	UnreachableHost                 = 4
+	ReservationNotFound             = 5
+	MalformedSubnet                 = 8
+	UnreachableDockerDaemon         = 9
+	UnspecifiedNetworkName          = 10
+	NotFound                        = 14
+	AddressUnavailable              = 15
+	NetworkContainerNotSpecified    = 16
+	CallToHostFailed                = 17
+	UnknownContainerID              = 18
+	UnsupportedOrchestratorType     = 19
+	DockerContainerNotSpecified     = 20
+	UnsupportedVerb                 = 21
+	UnsupportedNetworkContainerType = 22
+	InvalidRequest                  = 23
+	NetworkJoinFailed               = 24
+	NetworkContainerPublishFailed   = 25
+	NetworkContainerUnpublishFailed = 26
+	ResourceVersionExpired          = 27
+	UnexpectedError                 = 99
+)
+
+// CNSClientError is returned when CNS fails a request with a non-zero return code.
+type CNSClientError struct {
+	Path       string
+	ReturnCode int
+	Message    string
+}
+
+// Error returns the message of the CNS response.
+func (e *CNSClientError) Error() string {
+	return fmt.Sprintf("%s failed with return code %d: %s", e.Path, e.ReturnCode, e.Message)
+}
+
+// Returns an error if the given CNS response has a non-zero return code.
+func checkResponse(path string, resp *cns.Response) error {
+	if resp.ReturnCode == Success {
+		return nil
+	}
+
+	log.Errorf("[Azure CNSClient] %v received error response :%v", path, resp.Message)
+
+	return &CNSClientError{
+		Path:       path,
+		ReturnCode: resp.ReturnCode,
+		Message:    resp.Message,
+	}
+}
+
+// GetReturnCode returns the CNS return code of the given error.
+// Errors not returned by CNS, such as transport errors, return UnexpectedError.
+func GetReturnCode(err error) int {
+	if err == nil {
+		return Success
+	}
+
+	if e, ok := err.(*CNSClientError); ok {
+		return e.ReturnCode
+	}
+
+	return UnexpectedError
+}
+
+// IsNotFound returns whether the given error reports a missing network container, reservation or address.
+func IsNotFound(err error) bool {
+	switch GetReturnCode(err) {
+	case NotFound, UnknownContainerID, ReservationNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsInvalidRequest returns whether the given error reports a request CNS rejected as invalid.
+func IsInvalidRequest(err error) bool {
+	switch GetReturnCode(err) {
+	case InvalidParameter, InvalidRequest, NetworkContainerNotSpecified, DockerContainerNotSpecified,
+		UnsupportedVerb, UnsupportedNetworkType, UnsupportedNetworkContainerType, UnsupportedOrchestratorType:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsResourceVersionExpired returns whether the given error reports a watch from a resource version CNS no longer
+// has events for. Network containers must be listed again to get a current resource version.
+func IsResourceVersionExpired(err error) bool {
+	return GetReturnCode(err) == ResourceVersionExpired
+}
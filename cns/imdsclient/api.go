@@ -8,13 +8,15 @@ import (
 )
 
 const (
-	hostQueryURL                     = "http://168.63.129.16/machine/plugins?comp=nmagent&type=getinterfaceinfov1"
-	hostQueryURLForProgrammedVersion = "http://168.63.129.16/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/%s/networkContainers/%s/authenticationToken/%s/api-version/%s"
+	defaultHostURL                    = "http://168.63.129.16"
+	hostQueryPath                     = "/machine/plugins?comp=nmagent&type=getinterfaceinfov1"
+	hostQueryPathForProgrammedVersion = "/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/%s/networkContainers/%s/authenticationToken/%s/api-version/%s"
 )
 
 // ImdsClient can be used to connect to VM Host agent in Azure.
 type ImdsClient struct {
 	primaryInterface *InterfaceInfo
+	hostURL          string
 }
 
 // InterfaceInfo specifies the information about an interface as returned by Host Agent.
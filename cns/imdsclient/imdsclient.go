@@ -13,10 +13,25 @@ import (
 	"github.com/Azure/azure-container-networking/log"
 )
 
+// SetHostURL sets the URL of the host agent, such as a local wireserver simulator.
+// An empty URL selects the Azure host agent.
+func (imdsClient *ImdsClient) SetHostURL(hostURL string) {
+	imdsClient.hostURL = strings.TrimSuffix(hostURL, "/")
+}
+
+// Returns the URL of the host agent.
+func (imdsClient *ImdsClient) getHostURL() string {
+	if imdsClient.hostURL == "" {
+		return defaultHostURL
+	}
+
+	return imdsClient.hostURL
+}
+
 // GetNetworkContainerInfoFromHost retrieves the programmed version of network container from Host.
 func (imdsClient *ImdsClient) GetNetworkContainerInfoFromHost(networkContainerID string, primaryAddress string, authToken string, apiVersion string) (*ContainerVersion, error) {
 	log.Printf("[Azure CNS] GetNetworkContainerInfoFromHost")
-	queryURL := fmt.Sprintf(hostQueryURLForProgrammedVersion,
+	queryURL := imdsClient.getHostURL() + fmt.Sprintf(hostQueryPathForProgrammedVersion,
 		primaryAddress, networkContainerID, authToken, apiVersion)
 
 	log.Printf("[Azure CNS] Going to query Azure Host for container version @\n %v\n", queryURL)
@@ -27,6 +42,10 @@ func (imdsClient *ImdsClient) GetNetworkContainerInfoFromHost(networkContainerID
 
 	defer jsonResponse.Body.Close()
 
+	if jsonResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Azure Host returned status %v for network container %v", jsonResponse.StatusCode, networkContainerID)
+	}
+
 	log.Printf("[Azure CNS] Response received from Azure Host for NetworkManagement/interfaces: %v", jsonResponse.Body)
 
 	var response containerVersionJsonResponse
@@ -48,7 +67,7 @@ func (imdsClient *ImdsClient) GetPrimaryInterfaceInfoFromHost() (*InterfaceInfo,
 	log.Printf("[Azure CNS] GetPrimaryInterfaceInfoFromHost")
 
 	interfaceInfo := &InterfaceInfo{}
-	resp, err := http.Get(hostQueryURL)
+	resp, err := http.Get(imdsClient.getHostURL() + hostQueryPath)
 	if err != nil {
 		return nil, err
 	}
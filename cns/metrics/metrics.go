@@ -0,0 +1,170 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// DefaultBuckets are the histogram buckets used for request latencies, in seconds.
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// Serves the metrics registered with the default Prometheus registry.
+	promHandler = promhttp.Handler()
+)
+
+// Counter is a metric whose value only increases.
+type Counter struct {
+	*prometheus.CounterVec
+	name string
+}
+
+// Gauge is a metric whose value can be set to any value.
+type Gauge struct {
+	*prometheus.GaugeVec
+	name string
+}
+
+// Histogram is a metric counting observations in buckets.
+type Histogram struct {
+	*prometheus.HistogramVec
+	name string
+}
+
+// NewCounter creates a new counter with the given label names and registers it.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+	prometheus.MustRegister(vec)
+
+	// A metric without labels has a single series, exposed from the start.
+	if len(labelNames) == 0 {
+		vec.WithLabelValues()
+	}
+
+	return &Counter{CounterVec: vec, name: name}
+}
+
+// NewGauge creates a new gauge with the given label names and registers it.
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+	prometheus.MustRegister(vec)
+
+	if len(labelNames) == 0 {
+		vec.WithLabelValues()
+	}
+
+	return &Gauge{GaugeVec: vec, name: name}
+}
+
+// NewHistogram creates a new histogram with the given upper bucket bounds and label names and registers it.
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: sorted}, labelNames)
+	prometheus.MustRegister(vec)
+
+	if len(labelNames) == 0 {
+		vec.WithLabelValues()
+	}
+
+	return &Histogram{HistogramVec: vec, name: name}
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by the given non-negative value.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+
+	counter, err := c.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		log.Printf("[metrics] Failed to update metric %v, err:%v.", c.name, err)
+		return
+	}
+
+	counter.Add(value)
+}
+
+// Set sets the gauge for the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	gauge, err := g.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		log.Printf("[metrics] Failed to update metric %v, err:%v.", g.name, err)
+		return
+	}
+
+	gauge.Set(value)
+}
+
+// Observe records an observation for the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	observer, err := h.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		log.Printf("[metrics] Failed to update metric %v, err:%v.", h.name, err)
+		return
+	}
+
+	observer.Observe(value)
+}
+
+// ObserveDuration records the time elapsed since the given start time, in seconds.
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Handler serves all registered metrics to Prometheus scrapers.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	promHandler.ServeHTTP(w, r)
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it to the underlying response writer.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends buffered data to the client if the underlying response writer supports it.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// InstrumentHandler returns a handler recording the number, status and latency of requests
+// served by the given handler.
+func InstrumentHandler(
+	name string,
+	requests *Counter,
+	latency *Histogram,
+	handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler(recorder, r)
+
+		requests.Inc(name, strconv.Itoa(recorder.status))
+		latency.ObserveDuration(start, name)
+	}
+}
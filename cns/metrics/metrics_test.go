@@ -0,0 +1,123 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Returns the exposition of all registered metrics.
+func writeMetrics(t *testing.T) string {
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Metrics request failed with HTTP status %d.", w.Code)
+	}
+
+	return w.Body.String()
+}
+
+// Checks that the exposition contains all expected lines.
+func checkLines(t *testing.T, exposition string, expected []string) {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(exposition, "\n") {
+		lines[line] = true
+	}
+
+	for _, line := range expected {
+		if !lines[line] {
+			t.Errorf("Exposition does not contain line %q:\n%s", line, exposition)
+		}
+	}
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Number of test requests.", "path", "code")
+	counter.Inc("/a", "200")
+	counter.Inc("/a", "200")
+	counter.Add(3, "/b", "500")
+	counter.Add(-1, "/b", "500")
+
+	gauge := NewGauge("test_containers", "Number of \"test\" containers.\nSecond line.", "type")
+	gauge.Set(2, "Docker")
+	gauge.Set(4, `We"ird\`)
+
+	checkLines(t, writeMetrics(t), []string{
+		"# HELP test_requests_total Number of test requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{code="200",path="/a"} 2`,
+		`test_requests_total{code="500",path="/b"} 3`,
+		`# HELP test_containers Number of "test" containers.\nSecond line.`,
+		"# TYPE test_containers gauge",
+		`test_containers{type="Docker"} 2`,
+		`test_containers{type="We\"ird\\"} 4`,
+	})
+
+	gauge.Reset()
+	if strings.Contains(writeMetrics(t), `test_containers{type="Docker"}`) {
+		t.Errorf("Gauge series were not removed by Reset.")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram("test_latency_seconds", "Test latency.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	checkLines(t, writeMetrics(t), []string{
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{le="0.1"} 1`,
+		`test_latency_seconds_bucket{le="1"} 2`,
+		`test_latency_seconds_bucket{le="+Inf"} 3`,
+		"test_latency_seconds_sum 2.55",
+		"test_latency_seconds_count 3",
+	})
+}
+
+func TestInvalidLabelValues(t *testing.T) {
+	counter := NewCounter("test_invalid_total", "Test counter with invalid label values.", "path")
+	counter.Inc("/a", "extra")
+	counter.Inc("/a")
+
+	checkLines(t, writeMetrics(t), []string{
+		`test_invalid_total{path="/a"} 1`,
+	})
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	requests := NewCounter("test_handler_requests_total", "Test handler requests.", "handler", "code")
+	latency := NewHistogram("test_handler_latency_seconds", "Test handler latency.", DefaultBuckets, "handler")
+
+	handler := InstrumentHandler("/fail", requests, latency, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", nil))
+
+	// Handlers streaming responses can flush through the instrumented response writer.
+	flushed := InstrumentHandler("/stream", requests, latency, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Errorf("Instrumented response writer does not implement http.Flusher.")
+		}
+	})
+
+	flushed(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Metrics served with content type %v.", contentType)
+	}
+
+	checkLines(t, w.Body.String(), []string{
+		`test_handler_requests_total{code="400",handler="/fail"} 1`,
+		`test_handler_latency_seconds_count{handler="/fail"} 1`,
+	})
+}
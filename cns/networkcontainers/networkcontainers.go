@@ -23,6 +23,7 @@ import (
 
 const (
 	versionStr              = "cniVersion"
+	versionsStr             = "cniVersions"
 	pluginsStr              = "plugins"
 	nameStr                 = "name"
 	k8sPodNamespaceStr      = "K8S_POD_NAMESPACE"
@@ -33,6 +34,9 @@ const (
 	cniUpdate               = "UPDATE"
 )
 
+// ErrVerifyNotSupported is returned by Verify when there is no dataplane check for a network container.
+var ErrVerifyNotSupported = errors.New("network container dataplane verification is not supported")
+
 // NetworkContainers can be used to perform operations on network containers.
 type NetworkContainers struct {
 	logpath string
@@ -85,6 +89,11 @@ func (cn *NetworkContainers) Update(createNetworkContainerRequest cns.CreateNetw
 	return err
 }
 
+// Verify returns an error if the dataplane of a network container does not match its goal state.
+func (cn *NetworkContainers) Verify(createNetworkContainerRequest cns.CreateNetworkContainerRequest) error {
+	return verifyInterface(createNetworkContainerRequest)
+}
+
 // Delete deletes a network container.
 func (cn *NetworkContainers) Delete(networkContainerID string) error {
 	log.Printf("[Azure CNS] NetworkContainers.Delete called for NC: %s", networkContainerID)
@@ -139,7 +148,11 @@ func getNetworkConfig(configFilePath string) ([]byte, error) {
 	}
 
 	// insert version and name fields
-	flatNetConfigMap[versionStr] = configMap[versionStr].(string)
+	if version, ok := configMap[versionStr]; ok {
+		flatNetConfigMap[versionStr] = version.(string)
+	} else if versions, ok := configMap[versionsStr]; ok {
+		flatNetConfigMap[versionsStr] = versions
+	}
 	flatNetConfigMap[nameStr] = configMap[nameStr].(string)
 
 	// convert into bytes format
@@ -18,6 +18,11 @@ func createOrUpdateInterface(createNetworkContainerRequest cns.CreateNetworkCont
 	return nil
 }
 
+func verifyInterface(createNetworkContainerRequest cns.CreateNetworkContainerRequest) error {
+	// CNS does not program routes or SNAT rules for network containers on Linux, so there is nothing to check.
+	return ErrVerifyNotSupported
+}
+
 func setWeakHostOnInterface(ipAddress, ncID string) error {
 	return nil
 }
@@ -50,6 +50,32 @@ func createOrUpdateInterface(createNetworkContainerRequest cns.CreateNetworkCont
 		"UPDATE")
 }
 
+func verifyInterface(createNetworkContainerRequest cns.CreateNetworkContainerRequest) error {
+	// Only WebApps network containers have an interface created by CNS.
+	if createNetworkContainerRequest.NetworkContainerType != cns.WebApps {
+		return ErrVerifyNotSupported
+	}
+
+	iface, err := net.InterfaceByName(createNetworkContainerRequest.NetworkContainerid)
+	if err != nil {
+		return fmt.Errorf("[Azure CNS] Interface %s not found: %v", createNetworkContainerRequest.NetworkContainerid, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+
+	ipAddress := net.ParseIP(createNetworkContainerRequest.IPConfiguration.IPSubnet.IPAddress)
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ipAddress) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("[Azure CNS] Interface %s does not have address %v", iface.Name, ipAddress)
+}
+
 func updateInterface(createNetworkContainerRequest cns.CreateNetworkContainerRequest, netpluginConfig *NetPluginConfiguration) error {
 	return nil
 }
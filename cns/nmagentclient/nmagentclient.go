@@ -9,6 +9,9 @@ import (
 	"github.com/Azure/azure-container-networking/log"
 )
 
+// WireserverIP is the address of the Azure wireserver, which proxies requests to NMAgent.
+const WireserverIP = "168.63.129.16"
+
 // JoinNetwork joins the given network
 func JoinNetwork(
 	networkID string,
@@ -0,0 +1,76 @@
+package nmagentclient
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// RetryPolicy retries NMAgent requests failing with transient errors, with exponential backoff and jitter.
+// The zero value sends requests once.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// IsTransient returns whether a request failed with a transport error or a status worth retrying.
+func IsTransient(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests
+}
+
+// Returns the backoff before the given retry, growing exponentially up to the maximum backoff.
+// The backoff is randomized between half and all of its value so that concurrent callers spread their retries.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Do sends a request until it succeeds, fails with an error that is not transient or runs out of attempts.
+// It returns the last response and error, and the number of attempts made.
+func (p *RetryPolicy) Do(operation string, request func() (*http.Response, error)) (*http.Response, int, error) {
+	attempt := 0
+
+	for {
+		attempt++
+		response, err := request()
+
+		if !IsTransient(response, err) || attempt >= p.MaxAttempts {
+			return response, attempt, err
+		}
+
+		backoff := p.backoff(attempt)
+		if err != nil {
+			log.Printf("[NMAgentClient] %s attempt %d failed with error %v, retrying in %v.", operation, attempt, err, backoff)
+		} else {
+			log.Printf("[NMAgentClient] %s attempt %d failed with status %d, retrying in %v.",
+				operation, attempt, response.StatusCode, backoff)
+
+			// Drain the failed response so its connection can be reused.
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		time.Sleep(backoff)
+	}
+}
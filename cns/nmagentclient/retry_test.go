@@ -0,0 +1,55 @@
+package nmagentclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientFailures(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	response, attempts, err := policy.Do("Test", func() (*http.Response, error) { return http.Get(server.URL) })
+	if err != nil || response.StatusCode != http.StatusOK || attempts != 3 {
+		t.Fatalf("Retried request returned %+v after %d attempts, err:%v.", response, attempts, err)
+	}
+
+	response.Body.Close()
+}
+
+func TestRetryStopsOnPermanentFailure(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	response, attempts, err := policy.Do("Test", func() (*http.Response, error) { return http.Get(server.URL) })
+	if err != nil || response.StatusCode != http.StatusBadRequest || attempts != 1 || requests != 1 {
+		t.Fatalf("Permanent failure returned %+v after %d attempts, err:%v.", response, attempts, err)
+	}
+
+	response.Body.Close()
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for retry, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if backoff := policy.backoff(retry + 1); backoff < max/2 || backoff > max {
+			t.Errorf("Backoff before retry %d is %v, expected between %v and %v.", retry+1, backoff, max/2, max)
+		}
+	}
+}
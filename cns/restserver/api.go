@@ -27,6 +27,7 @@ const (
 	NetworkJoinFailed               = 24
 	NetworkContainerPublishFailed   = 25
 	NetworkContainerUnpublishFailed = 26
+	ResourceVersionExpired          = 27
 	UnexpectedError                 = 99
 )
 
@@ -65,6 +66,8 @@ func ReturnCodeToString(returnCode int) (s string) {
 		s = "UnexpectedError"
 	case DockerContainerNotSpecified:
 		s = "DockerContainerNotSpecified"
+	case ResourceVersionExpired:
+		s = "ResourceVersionExpired"
 	default:
 		s = "UnknownError"
 	}
@@ -0,0 +1,199 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+)
+
+// Sends a request to CNS and decodes the response. Safe to call from any goroutine.
+func serveJSON(method, path string, request interface{}, response interface{}) error {
+	var body bytes.Buffer
+	if request != nil {
+		json.NewEncoder(&body).Encode(request)
+	}
+
+	req, err := http.NewRequest(method, path, &body)
+	if err != nil {
+		return err
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	return decodeResponse(w, response)
+}
+
+// Returns a request to create a network container with the given IP address.
+func newRaceNetworkContainerRequest(name, ip string) *cns.CreateNetworkContainerRequest {
+	podInfo, _ := json.Marshal(cns.KubernetesPodInfo{PodName: "pod-" + name, PodNamespace: "race"})
+
+	return &cns.CreateNetworkContainerRequest{
+		Version:              "0.1",
+		NetworkContainerType: cns.AzureContainerInstance,
+		NetworkContainerid:   name,
+		OrchestratorContext:  podInfo,
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet: cns.IPSubnet{IPAddress: ip, PrefixLength: 24},
+		},
+		PrimaryInterfaceIdentifier: "11.0.0.7",
+	}
+}
+
+func TestNetworkContainerLocks(t *testing.T) {
+	svc := service.(*HTTPRestService)
+
+	svc.lockNetworkContainer("ncLockA")
+
+	// Other network containers are not blocked.
+	done := make(chan struct{})
+	go func() {
+		svc.lockNetworkContainer("ncLockB")
+		svc.unlockNetworkContainer("ncLockB")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lock of another network container was blocked.")
+	}
+
+	// The same network container is blocked until unlocked.
+	acquired := make(chan struct{})
+	go func() {
+		svc.lockNetworkContainer("ncLockA")
+		close(acquired)
+		svc.unlockNetworkContainer("ncLockA")
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Lock of a locked network container was acquired.")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	svc.unlockNetworkContainer("ncLockA")
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lock of an unlocked network container was not acquired.")
+	}
+}
+
+func TestConcurrentNetworkContainerOperations(t *testing.T) {
+	const (
+		workers    = 4
+		iterations = 20
+	)
+
+	svc := service.(*HTTPRestService)
+	svc.ncDataplane = &fakeDataplane{programmed: make(map[string]bool)}
+	defer func() { svc.ncDataplane = svc.networkContainer }()
+
+	setOrchestratorType(t, cns.Kubernetes)
+
+	errs := make(chan error, workers*iterations*4)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			for j := 0; j < iterations; j++ {
+				var createResp cns.CreateNetworkContainerResponse
+				ip := fmt.Sprintf("12.0.%d.%d", j, j+1)
+				err := serveJSON(http.MethodPost, cns.CreateOrUpdateNetworkContainer, newRaceNetworkContainerRequest(name, ip), &createResp)
+				if err != nil || createResp.Response.ReturnCode != Success {
+					errs <- fmt.Errorf("Create of %v returned %+v, err:%v", name, createResp, err)
+					continue
+				}
+
+				var getResp cns.GetInterfaceForContainerResponse
+				err = serveJSON(http.MethodPost, cns.GetInterfaceForContainer, &cns.GetInterfaceForContainerRequest{NetworkContainerID: name}, &getResp)
+				if err != nil || getResp.Response.ReturnCode != Success || getResp.NetworkInterface.IPAddress != ip {
+					errs <- fmt.Errorf("Get of %v returned %+v, err:%v", name, getResp, err)
+				}
+
+				// Leave the network container created after the last iteration.
+				if j < iterations-1 {
+					var deleteResp cns.DeleteNetworkContainerResponse
+					err = serveJSON(http.MethodPost, cns.DeleteNetworkContainer, &cns.DeleteNetworkContainerRequest{NetworkContainerid: name}, &deleteResp)
+					if err != nil || deleteResp.Response.ReturnCode != Success {
+						errs <- fmt.Errorf("Delete of %v returned %+v, err:%v", name, deleteResp, err)
+					}
+				}
+			}
+		}(fmt.Sprintf("ncRace%d", i))
+	}
+
+	// Reconcile and list network containers while they are changing.
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			svc.reconcileNetworkContainers()
+
+			var listResp cns.ListNetworkContainersResponse
+			if err := serveJSON(http.MethodGet, cns.ListNetworkContainers, nil, &listResp); err != nil {
+				errs <- fmt.Errorf("List returned err:%v", err)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var listResp cns.ListNetworkContainersResponse
+	if err := serveJSON(http.MethodGet, cns.ListNetworkContainers, nil, &listResp); err != nil {
+		t.Fatalf("List returned err:%v.", err)
+	}
+
+	found := 0
+	lastIP := fmt.Sprintf("12.0.%d.%d", iterations-1, iterations)
+	for _, nc := range listResp.NetworkContainers {
+		for i := 0; i < workers; i++ {
+			if nc.NetworkContainer.NetworkContainerid == fmt.Sprintf("ncRace%d", i) {
+				found++
+				if ip := nc.NetworkContainer.IPConfiguration.IPSubnet.IPAddress; ip != lastIP {
+					t.Errorf("Network container %v has IP address %v, expected %v.", nc.NetworkContainer.NetworkContainerid, ip, lastIP)
+				}
+			}
+		}
+	}
+
+	if found != workers {
+		t.Errorf("Found %d of %d network containers after concurrent operations.", found, workers)
+	}
+
+	for i := 0; i < workers; i++ {
+		deleteNetworkAdapterWithName(t, fmt.Sprintf("ncRace%d", i))
+	}
+}
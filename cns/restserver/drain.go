@@ -0,0 +1,143 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// drainState tracks requests and NMAgent operations in progress so that CNS can complete them before shutting down.
+type drainState struct {
+	ready    bool
+	draining bool
+	stopping chan struct{}
+	inflight sync.WaitGroup
+	sync.Mutex
+}
+
+// trackRequests wraps a handler so that it counts as in progress until it returns.
+// Requests received while draining are rejected.
+func (service *HTTPRestService) trackRequests(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		drain := &service.drain
+
+		drain.Lock()
+		if drain.draining {
+			drain.Unlock()
+			http.Error(w, "CNS is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		drain.inflight.Add(1)
+		drain.Unlock()
+
+		defer drain.inflight.Done()
+		handler(w, r)
+	}
+}
+
+// setReady marks CNS as ready to serve requests.
+func (service *HTTPRestService) setReady() {
+	service.drain.Lock()
+	service.drain.ready = true
+	service.drain.Unlock()
+}
+
+// getStopping returns a channel closed when CNS starts draining, for handlers that wait to return early.
+func (service *HTTPRestService) getStopping() <-chan struct{} {
+	service.drain.Lock()
+	defer service.drain.Unlock()
+
+	if service.drain.stopping == nil {
+		service.drain.stopping = make(chan struct{})
+	}
+
+	return service.drain.stopping
+}
+
+// drainRequests stops accepting new requests and waits for requests and NMAgent operations in progress until the deadline.
+func (service *HTTPRestService) drainRequests(deadline time.Time) error {
+	drain := &service.drain
+
+	drain.Lock()
+	if !drain.draining {
+		drain.draining = true
+		if drain.stopping == nil {
+			drain.stopping = make(chan struct{})
+		}
+		close(drain.stopping)
+	}
+	drain.Unlock()
+
+	log.Printf("[Azure CNS] Draining requests in progress.")
+
+	done := make(chan struct{})
+	go func() {
+		drain.inflight.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		log.Printf("[Azure CNS] Drained requests and NMAgent operations in progress.")
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("Requests or NMAgent operations in progress did not complete before the shutdown deadline")
+	}
+}
+
+// shutdown drains requests in progress, persists the state and stops the listener.
+// The shutdown timeout option bounds the time spent waiting for requests in progress.
+func (service *HTTPRestService) shutdown() {
+	timeout, _ := service.GetOption(acn.OptShutdownTimeout).(int)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	if err := service.drainRequests(deadline); err != nil {
+		log.Errorf("[Azure CNS] %v.", err)
+	}
+
+	service.stopReconciler()
+
+	service.lock.Lock()
+	if err := service.saveState(); err != nil {
+		log.Errorf("[Azure CNS] Failed to save state on shutdown, err:%v.", err)
+	}
+	service.lock.Unlock()
+
+	if service.Listener != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		service.Listener.Shutdown(ctx)
+		cancel()
+	}
+}
+
+// Handles readiness probes. CNS is ready once started and until it starts draining.
+func (service *HTTPRestService) getReadiness(w http.ResponseWriter, r *http.Request) {
+	service.drain.Lock()
+	ready := service.drain.ready && !service.drain.draining
+	service.drain.Unlock()
+
+	if !ready {
+		http.Error(w, "CNS is not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	service.Listener.Encode(w, &cns.Response{ReturnCode: Success, Message: "Ready"})
+}
+
+// Handles liveness probes. CNS stays live while draining so that requests in progress can complete.
+func (service *HTTPRestService) getLiveness(w http.ResponseWriter, r *http.Request) {
+	service.Listener.Encode(w, &cns.Response{ReturnCode: Success, Message: "Live"})
+}
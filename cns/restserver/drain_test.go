@@ -0,0 +1,157 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	acn "github.com/Azure/azure-container-networking/common"
+)
+
+// Returns a service with a listener that is not started, for testing draining in isolation.
+func newDrainTestService(t *testing.T) *HTTPRestService {
+	u, _ := url.Parse("tcp://localhost:0")
+	listener, err := acn.NewListener(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &HTTPRestService{Service: &cns.Service{Listener: listener}}
+}
+
+// Serves a request with the given handler and returns the status code.
+func serveStatus(handler func(http.ResponseWriter, *http.Request), path string) int {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code
+}
+
+func TestDrainRequests(t *testing.T) {
+	svc := newDrainTestService(t)
+
+	if code := serveStatus(svc.getReadiness, cns.ReadinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness before start returned %v.", code)
+	}
+
+	svc.setReady()
+	if code := serveStatus(svc.getReadiness, cns.ReadinessPath); code != http.StatusOK {
+		t.Errorf("Readiness after start returned %v.", code)
+	}
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	calls := 0
+	handler := svc.trackRequests(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		entered <- struct{}{}
+		<-release
+	})
+
+	served := make(chan int, 1)
+	go func() { served <- serveStatus(handler, "/slow") }()
+	<-entered
+
+	drained := make(chan error, 1)
+	go func() { drained <- svc.drainRequests(time.Now().Add(5 * time.Second)) }()
+
+	// Wait for draining to start.
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if serveStatus(svc.getReadiness, cns.ReadinessPath) == http.StatusServiceUnavailable {
+			break
+		}
+	}
+
+	if code := serveStatus(svc.getReadiness, cns.ReadinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness while draining returned %v.", code)
+	}
+
+	if code := serveStatus(svc.getLiveness, cns.LivenessPath); code != http.StatusOK {
+		t.Errorf("Liveness while draining returned %v.", code)
+	}
+
+	if code := serveStatus(handler, "/slow"); code != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("Request while draining returned %v after %d calls.", code, calls)
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain completed with request in progress, err:%v.", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	if code := <-served; code != http.StatusOK {
+		t.Errorf("Request in progress returned %v.", code)
+	}
+
+	if err := <-drained; err != nil {
+		t.Errorf("Drain failed, err:%v.", err)
+	}
+
+	select {
+	case <-svc.getStopping():
+	default:
+		t.Errorf("Stopping channel was not closed by draining.")
+	}
+}
+
+func TestDrainRequestsDeadline(t *testing.T) {
+	svc := newDrainTestService(t)
+	release := make(chan struct{})
+	defer close(release)
+
+	entered := make(chan struct{})
+	handler := svc.trackRequests(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+
+	go serveStatus(handler, "/stuck")
+	<-entered
+
+	if err := svc.drainRequests(time.Now().Add(50 * time.Millisecond)); err == nil {
+		t.Errorf("Drain with request stuck in progress succeeded.")
+	}
+}
+
+func TestDrainRequestsWaitsForAsyncNMAgentOperations(t *testing.T) {
+	svc := newDrainTestService(t)
+	svc.state = &httpRestServiceState{}
+	svc.setNetworkStateJoined("vnetDrain")
+
+	release := make(chan struct{})
+	handler := svc.trackRequests(func(w http.ResponseWriter, r *http.Request) {
+		svc.runNMAgentOperation("publish", nmagentRequest{
+			operation:          cns.NMAgentPublish,
+			networkID:          "vnetDrain",
+			networkContainerID: "ncDrain",
+			send: func() (*http.Response, error) {
+				<-release
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+			},
+		})
+	})
+
+	// The request returns while its NMAgent operation is still in progress.
+	serveStatus(handler, "/async")
+
+	if err := svc.drainRequests(time.Now().Add(50 * time.Millisecond)); err == nil {
+		t.Errorf("Drain with NMAgent operation in progress succeeded.")
+	}
+
+	close(release)
+
+	if err := svc.drainRequests(time.Now().Add(5 * time.Second)); err != nil {
+		t.Errorf("Drain after NMAgent operation completed failed, err:%v.", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/metrics"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Outcomes of NMAgent requests.
+	nmagentResultSuccess = "success"
+	nmagentResultFailure = "failure"
+)
+
+var (
+	httpRequests = metrics.NewCounter(
+		"cns_http_requests_total",
+		"Number of requests served by CNS, by handler and HTTP status code.",
+		"handler", "code")
+
+	httpRequestLatency = metrics.NewHistogram(
+		"cns_http_request_duration_seconds",
+		"Latency of requests served by CNS, by handler.",
+		metrics.DefaultBuckets,
+		"handler")
+
+	networkContainers = metrics.NewGauge(
+		"cns_network_containers",
+		"Number of network containers, by network container type and orchestrator type.",
+		"type", "orchestrator")
+
+	ipAddresses = metrics.NewGauge(
+		"cns_ip_addresses",
+		"Number of IP addresses reported by the last IP address utilization request, by state.",
+		"state")
+
+	nmagentRequests = metrics.NewCounter(
+		"cns_nmagent_requests_total",
+		"Number of network container publish and unpublish requests sent to NMAgent, by operation and result.",
+		"operation", "result")
+
+	stateSaveLatency = metrics.NewHistogram(
+		"cns_state_save_duration_seconds",
+		"Latency of persisting CNS state.",
+		metrics.DefaultBuckets)
+)
+
+// addHandler registers a handler on the CNS listener and records request metrics for it.
+// Requests to the handler are drained when CNS stops.
+func (service *HTTPRestService) addHandler(path string, handler func(http.ResponseWriter, *http.Request)) {
+	service.Listener.AddHandler(path, metrics.InstrumentHandler(path, httpRequests, httpRequestLatency, service.trackRequests(handler)))
+}
+
+// startMetrics serves metrics on the CNS listener, or on a separate listener if a metrics port is configured.
+func (service *HTTPRestService) startMetrics(errChan chan error) error {
+	port, _ := service.GetOption(acn.OptCnsMetricsPort).(int)
+	if port <= 0 {
+		service.Listener.AddHandler(cns.MetricsPath, metrics.Handler)
+		return nil
+	}
+
+	u, err := url.Parse(fmt.Sprintf("tcp://:%d", port))
+	if err != nil {
+		return err
+	}
+
+	listener, err := acn.NewListener(u)
+	if err != nil {
+		return err
+	}
+
+	listener.AddHandler(cns.MetricsPath, metrics.Handler)
+
+	if err = listener.Start(errChan); err != nil {
+		log.Errorf("[Azure CNS] Failed to start metrics listener on port %d, err:%v.", port, err)
+		return err
+	}
+
+	service.metricsListener = listener
+	log.Printf("[Azure CNS] Serving metrics on port %d.", port)
+
+	return nil
+}
+
+// stopMetrics stops the separate metrics listener, if any.
+func (service *HTTPRestService) stopMetrics() {
+	if service.metricsListener != nil {
+		service.metricsListener.Stop()
+		service.metricsListener = nil
+	}
+}
+
+// updateNetworkContainerMetrics recomputes the network container counts from the service state.
+func (service *HTTPRestService) updateNetworkContainerMetrics() {
+	counts := make(map[string]int)
+	for _, containerStatus := range service.state.ContainerStatus {
+		counts[containerStatus.CreateNetworkContainerRequest.NetworkContainerType]++
+	}
+
+	networkContainers.Reset()
+	for containerType, count := range counts {
+		networkContainers.Set(float64(count), containerType, service.state.OrchestratorType)
+	}
+}
+
+// recordNMAgentRequest records the outcome of a publish or unpublish request.
+func recordNMAgentRequest(operation string, returnCode int) {
+	result := nmagentResultSuccess
+	if returnCode != Success {
+		result = nmagentResultFailure
+	}
+
+	nmagentRequests.Inc(operation, result)
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+)
+
+// Returns the metrics served by CNS.
+func getMetrics(t *testing.T) string {
+	req, err := http.NewRequest(http.MethodGet, cns.MetricsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Metrics request failed with HTTP status %d.", w.Code)
+	}
+
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	setOrchestratorType(t, cns.Kubernetes)
+
+	if err := creatOrUpdateNetworkContainerWithName(t, "ethMetrics", "11.0.0.5", cns.AzureContainerInstance); err != nil {
+		t.Fatal(err)
+	}
+
+	defer deleteNetworkAdapterWithName(t, "ethMetrics")
+
+	body := getMetrics(t)
+
+	expected := []string{
+		`cns_http_requests_total{code="200",handler="` + cns.CreateOrUpdateNetworkContainer + `"}`,
+		`cns_http_request_duration_seconds_count{handler="` + cns.CreateOrUpdateNetworkContainer + `"}`,
+		`cns_network_containers{orchestrator="Kubernetes",type="AzureContainerInstance"} 1`,
+		"# TYPE cns_state_save_duration_seconds histogram",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Metrics do not contain %q:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/metrics"
+	"github.com/Azure/azure-container-networking/cns/nmagentclient"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Maximum backoff between attempts of NMAgent requests.
+	nmagentMaxBackoff = 30 * time.Second
+)
+
+var (
+	nmagentRetries = metrics.NewCounter(
+		"cns_nmagent_retries_total",
+		"Number of NMAgent requests retried after transient failures, by operation.",
+		"operation")
+)
+
+// nmagentRequest describes a publish or unpublish of a network container through NMAgent.
+type nmagentRequest struct {
+	operation          string
+	networkID          string
+	networkContainerID string
+	joinNetworkURL     string
+	failureCode        int
+	send               func() (*http.Response, error)
+}
+
+// nmagentResult is the outcome of a publish or unpublish of a network container.
+type nmagentResult struct {
+	returnCode   int
+	message      string
+	errorStr     string
+	statusCode   int
+	responseBody []byte
+	attempts     int
+}
+
+// nmagentCall is an NMAgent operation shared by concurrent identical requests.
+type nmagentCall struct {
+	key    string
+	done   chan struct{}
+	result nmagentResult
+	status *cns.GetNMAgentOperationStatusResponse
+}
+
+// nmagentOperations tracks NMAgent operations in flight and the status of the last operation on each network container.
+// Both are keyed by network container ID.
+type nmagentOperations struct {
+	calls  map[string]*nmagentCall
+	status map[string]*cns.GetNMAgentOperationStatusResponse
+	sync.Mutex
+}
+
+// initNMAgentRetries configures retries of NMAgent requests from the CNS options.
+func (service *HTTPRestService) initNMAgentRetries() {
+	attempts, _ := service.GetOption(acn.OptNMAgentRetryAttempts).(int)
+	backoff, _ := service.GetOption(acn.OptNMAgentRetryBackoff).(int)
+
+	service.nmagentRetry = nmagentclient.RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Duration(backoff) * time.Millisecond,
+		MaxBackoff:     nmagentMaxBackoff,
+	}
+}
+
+// runNMAgentOperation starts an NMAgent operation and returns the call to wait on.
+// Operations on a network container are serialized. If an identical operation is the last one queued on
+// the network container, its call is returned instead of starting a new one. Otherwise the operation
+// starts once the previous one completes.
+func (service *HTTPRestService) runNMAgentOperation(key string, req nmagentRequest) *nmagentCall {
+	ops := &service.nmagentOps
+
+	ops.Lock()
+	defer ops.Unlock()
+
+	prev := ops.calls[req.networkContainerID]
+	if prev != nil && prev.key == key {
+		log.Printf("[Azure-CNS] %s of network container %s is already in progress.", req.operation, req.networkContainerID)
+		return prev
+	}
+
+	call := &nmagentCall{
+		key:  key,
+		done: make(chan struct{}),
+		status: &cns.GetNMAgentOperationStatusResponse{
+			NetworkContainerID: req.networkContainerID,
+			Operation:          req.operation,
+			State:              cns.NMAgentOperationInProgress,
+			StartTime:          time.Now(),
+		},
+	}
+
+	if ops.calls == nil {
+		ops.calls = make(map[string]*nmagentCall)
+		ops.status = make(map[string]*cns.GetNMAgentOperationStatusResponse)
+	}
+
+	ops.calls[req.networkContainerID] = call
+	ops.status[req.networkContainerID] = call.status
+
+	// Operations count as in progress until they complete, so that shutdown waits for async ones.
+	// This is called by a tracked request, so the count is never zero here.
+	service.drain.inflight.Add(1)
+
+	go func() {
+		defer service.drain.inflight.Done()
+
+		if prev != nil {
+			log.Printf("[Azure-CNS] %s of network container %s is waiting for %s to complete.",
+				req.operation, req.networkContainerID, prev.status.Operation)
+			<-prev.done
+
+			ops.Lock()
+			call.status.StartTime = time.Now()
+			ops.Unlock()
+		}
+
+		result := service.sendNMAgentRequest(req)
+
+		ops.Lock()
+		if ops.calls[req.networkContainerID] == call {
+			delete(ops.calls, req.networkContainerID)
+		}
+
+		call.result = result
+		call.status.State = cns.NMAgentOperationSucceeded
+		if result.returnCode != Success {
+			call.status.State = cns.NMAgentOperationFailed
+		}
+
+		call.status.Attempts = result.attempts
+		call.status.EndTime = time.Now()
+		call.status.ReturnCode = result.returnCode
+		call.status.Message = result.message
+		call.status.ErrorStr = result.errorStr
+		call.status.StatusCode = result.statusCode
+		call.status.ResponseBody = result.responseBody
+		ops.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// sendNMAgentRequest joins the network of a network container if needed, then sends the request.
+// Requests failing with transient errors are retried according to the retry policy.
+func (service *HTTPRestService) sendNMAgentRequest(req nmagentRequest) nmagentResult {
+	var (
+		result   nmagentResult
+		response *http.Response
+		err      error
+		attempts int
+	)
+
+	metricsOperation := strings.ToLower(req.operation)
+
+	// Join Network if not joined already
+	if !service.isNetworkJoined(req.networkID) {
+		response, attempts, err = service.nmagentRetry.Do("JoinNetwork", func() (*http.Response, error) {
+			return nmagentclient.JoinNetwork(req.networkID, service.getNMAgentURL(req.joinNetworkURL))
+		})
+
+		result.attempts += attempts
+		nmagentRetries.Add(float64(attempts-1), metricsOperation)
+
+		if err == nil && response.StatusCode == http.StatusOK {
+			// Network joined successfully
+			service.setNetworkStateJoined(req.networkID)
+			log.Printf("[Azure-CNS] setNetworkStateJoined for network: %s", req.networkID)
+		} else {
+			result.returnCode = NetworkJoinFailed
+			result.message = fmt.Sprintf("Failed to join network: %s", req.networkID)
+		}
+	}
+
+	if result.returnCode == Success {
+		response, attempts, err = service.nmagentRetry.Do(req.operation+"NetworkContainer", req.send)
+
+		result.attempts += attempts
+		nmagentRetries.Add(float64(attempts-1), metricsOperation)
+
+		if err != nil || response.StatusCode != http.StatusOK {
+			result.returnCode = req.failureCode
+			result.message = fmt.Sprintf("Failed to %s Network Container: %s", metricsOperation, req.networkContainerID)
+			log.Errorf("[Azure-CNS] %s", result.message)
+		}
+	}
+
+	if err != nil {
+		result.errorStr = err.Error()
+	}
+
+	if response != nil {
+		result.statusCode = response.StatusCode
+
+		var errParse error
+		result.responseBody, errParse = ioutil.ReadAll(response.Body)
+		if errParse != nil {
+			result.message = fmt.Sprintf("Failed to parse the %s body. Error: %v", metricsOperation, errParse)
+			result.returnCode = UnexpectedError
+			log.Errorf("[Azure-CNS] %s", result.message)
+		}
+
+		response.Body.Close()
+	}
+
+	recordNMAgentRequest(metricsOperation, result.returnCode)
+
+	return result
+}
+
+// forgetNMAgentOperations drops the status of the NMAgent operations on a network container.
+func (service *HTTPRestService) forgetNMAgentOperations(networkContainerID string) {
+	service.nmagentOps.Lock()
+	delete(service.nmagentOps.status, networkContainerID)
+	service.nmagentOps.Unlock()
+}
+
+// Returns the key identifying identical NMAgent operations.
+func getNMAgentOperationKey(operation string, parts ...string) string {
+	return operation + "\x00" + strings.Join(parts, "\x00")
+}
+
+// Handles requests for the status of the last NMAgent operation on a network container.
+func (service *HTTPRestService) getNMAgentOperationStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[Azure CNS] getNMAgentOperationStatus")
+
+	var req cns.GetNMAgentOperationStatusRequest
+
+	err := service.Listener.Decode(w, r, &req)
+	log.Request(service.Name, &req, err)
+	if err != nil {
+		return
+	}
+
+	var resp cns.GetNMAgentOperationStatusResponse
+
+	service.nmagentOps.Lock()
+	status, ok := service.nmagentOps.status[req.NetworkContainerID]
+	if ok {
+		resp = *status
+	}
+	service.nmagentOps.Unlock()
+
+	if !ok {
+		resp.NetworkContainerID = req.NetworkContainerID
+		resp.Response.ReturnCode = UnknownContainerID
+		resp.Response.Message = fmt.Sprintf("[Azure CNS] No NMAgent operation for network container %s.", req.NetworkContainerID)
+	}
+
+	err = service.Listener.Encode(w, &resp)
+	log.Response(service.Name, resp, resp.Response.ReturnCode, ReturnCodeToString(resp.Response.ReturnCode), err)
+}
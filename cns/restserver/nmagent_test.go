@@ -0,0 +1,215 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/nmagentclient"
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+)
+
+// Sets the retry policy of NMAgent requests until the returned function is called.
+func setNMAgentRetries(attempts int) func() {
+	svc := service.(*HTTPRestService)
+	retry := svc.nmagentRetry
+	svc.nmagentRetry = nmagentclient.RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond}
+
+	return func() { svc.nmagentRetry = retry }
+}
+
+// Returns the status of the last NMAgent operation on a network container.
+func getNMAgentOperationStatus(t *testing.T, ncID string) cns.GetNMAgentOperationStatusResponse {
+	var body bytes.Buffer
+	var resp cns.GetNMAgentOperationStatusResponse
+
+	json.NewEncoder(&body).Encode(&cns.GetNMAgentOperationStatusRequest{NetworkContainerID: ncID})
+	req, err := http.NewRequest(http.MethodPost, cns.GetNMAgentOperationStatus, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if err = decodeResponse(w, &resp); err != nil {
+		t.Fatalf("Failed to decode NMAgent operation status, err:%v.", err)
+	}
+
+	return resp
+}
+
+func TestPublishRetriesTransientFailures(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+	defer setNMAgentRetries(3)()
+
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.PublishNetworkContainer, StatusCode: http.StatusInternalServerError, Count: 2})
+
+	resp := publishViaWireserver(t, "vnetRetry", "ncRetry", "1")
+	if resp.Response.ReturnCode != Success || resp.PublishStatusCode != http.StatusOK {
+		t.Fatalf("Publish with transient failures returned %+v.", resp)
+	}
+
+	if requests := simulator.GetState().Requests; requests[wireserver.PublishNetworkContainer] != 3 {
+		t.Errorf("Unexpected wireserver requests %+v.", requests)
+	}
+
+	status := getNMAgentOperationStatus(t, "ncRetry")
+	if status.State != cns.NMAgentOperationSucceeded || status.Operation != cns.NMAgentPublish || status.Attempts != 4 {
+		t.Errorf("Unexpected status after retries %+v.", status)
+	}
+
+	// Requests failing after all attempts return the last failure.
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.PublishNetworkContainer, StatusCode: http.StatusServiceUnavailable, Count: 3})
+
+	resp = publishViaWireserver(t, "vnetRetry", "ncRetry", "2")
+	if resp.Response.ReturnCode != NetworkContainerPublishFailed || resp.PublishStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Publish failing after all attempts returned %+v.", resp)
+	}
+
+	status = getNMAgentOperationStatus(t, "ncRetry")
+	if status.State != cns.NMAgentOperationFailed || status.ReturnCode != NetworkContainerPublishFailed || status.Attempts != 3 {
+		t.Errorf("Unexpected status after failed retries %+v.", status)
+	}
+}
+
+func TestConcurrentPublishesAreDeduplicated(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.PublishNetworkContainer, DelayMilliseconds: 200, Count: 1})
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(newWireserverPublishRequest("vnetDedup", "ncDedup", "1"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(payload []byte) {
+			defer wg.Done()
+
+			var resp cns.PublishNetworkContainerResponse
+
+			req, _ := http.NewRequest(http.MethodPost, cns.PublishNetworkContainer, bytes.NewReader(payload))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if err := decodeResponse(w, &resp); err != nil || resp.Response.ReturnCode != Success {
+				errs <- fmt.Errorf("Concurrent publish returned %+v, err:%v", resp, err)
+			}
+		}(body.Bytes())
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if requests := simulator.GetState().Requests; requests[wireserver.PublishNetworkContainer] != 1 {
+		t.Errorf("Concurrent publishes sent %d wireserver requests.", requests[wireserver.PublishNetworkContainer])
+	}
+}
+
+func TestAsyncPublish(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	if status := getNMAgentOperationStatus(t, "ncAsync"); status.Response.ReturnCode != UnknownContainerID {
+		t.Errorf("Status of unknown network container returned %+v.", status)
+	}
+
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.PublishNetworkContainer, DelayMilliseconds: 200, Count: 1})
+
+	req := newWireserverPublishRequest("vnetAsync", "ncAsync", "1")
+	req.Async = true
+
+	resp := sendPublishRequest(t, req)
+	if resp.Response.ReturnCode != Success || resp.PublishStatusCode != http.StatusAccepted {
+		t.Fatalf("Async publish returned %+v.", resp)
+	}
+
+	if status := getNMAgentOperationStatus(t, "ncAsync"); status.State != cns.NMAgentOperationInProgress {
+		t.Errorf("Status of async publish in progress is %+v.", status)
+	}
+
+	var status cns.GetNMAgentOperationStatusResponse
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+		if status = getNMAgentOperationStatus(t, "ncAsync"); status.State != cns.NMAgentOperationInProgress {
+			break
+		}
+	}
+
+	if status.State != cns.NMAgentOperationSucceeded || status.ReturnCode != Success || status.StatusCode != http.StatusOK ||
+		status.EndTime.Before(status.StartTime) {
+		t.Errorf("Status of completed async publish is %+v.", status)
+	}
+
+	if nc := simulator.GetState().NetworkContainers["ncAsync"]; nc.PublishedVersion != "1" {
+		t.Errorf("Network container was not published by async publish.")
+	}
+}
+
+func TestConflictingOperationsAreSerialized(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.PublishNetworkContainer, DelayMilliseconds: 200, Count: 1})
+
+	req := newWireserverPublishRequest("vnetSerial", "ncSerial", "1")
+	req.Async = true
+
+	if resp := sendPublishRequest(t, req); resp.Response.ReturnCode != Success {
+		t.Fatalf("Async publish returned %+v.", resp)
+	}
+
+	// The unpublish waits for the publish in flight, so the network container ends up unpublished.
+	if resp := unpublishViaWireserver(t, "vnetSerial", "ncSerial"); resp.Response.ReturnCode != Success {
+		t.Fatalf("Unpublish returned %+v.", resp)
+	}
+
+	if _, ok := simulator.GetState().NetworkContainers["ncSerial"]; ok {
+		t.Errorf("Network container was published after it was unpublished.")
+	}
+
+	if status := getNMAgentOperationStatus(t, "ncSerial"); status.Operation != cns.NMAgentUnpublish ||
+		status.State != cns.NMAgentOperationSucceeded {
+		t.Errorf("Unexpected status after unpublish %+v.", status)
+	}
+}
+
+func TestDeleteNetworkContainerDropsNMAgentStatus(t *testing.T) {
+	_, stop := startWireserverSimulator(t)
+	defer stop()
+
+	setOrchestratorType(t, cns.Kubernetes)
+
+	if err := creatOrUpdateNetworkContainerWithName(t, "ethNMAgentStatus", "11.0.0.8", cns.AzureContainerInstance); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := publishViaWireserver(t, "vnetStatus", "ethNMAgentStatus", "1"); resp.Response.ReturnCode != Success {
+		t.Fatalf("Publish returned %+v.", resp)
+	}
+
+	if err := deleteNetworkAdapterWithName(t, "ethNMAgentStatus"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := getNMAgentOperationStatus(t, "ethNMAgentStatus"); status.Response.ReturnCode != UnknownContainerID {
+		t.Errorf("Status of deleted network container returned %+v.", status)
+	}
+}
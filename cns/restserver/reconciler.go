@@ -0,0 +1,174 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/metrics"
+	"github.com/Azure/azure-container-networking/cns/networkcontainers"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+var (
+	networkContainerRepairs = metrics.NewCounter(
+		"cns_network_container_repairs_total",
+		"Number of network container dataplane repairs by the reconciler, by result.",
+		"result")
+)
+
+// networkContainerDataplane verifies and repairs the dataplane of network containers.
+type networkContainerDataplane interface {
+	Verify(req cns.CreateNetworkContainerRequest) error
+	Create(req cns.CreateNetworkContainerRequest) error
+}
+
+// ncSyncStatus is the result of the last reconciliation of a network container.
+type ncSyncStatus struct {
+	status      string
+	lastSync    time.Time
+	lastError   string
+	repairCount int
+}
+
+// startReconciler starts reconciling network containers periodically in the background.
+// The reconciler is disabled if the configured interval is not positive.
+func (service *HTTPRestService) startReconciler() {
+	interval, _ := service.GetOption(acn.OptNetworkContainerReconcileInterval).(int)
+	if interval <= 0 {
+		log.Printf("[Azure CNS] Network container reconciliation is disabled.")
+		return
+	}
+
+	service.reconcileStop = make(chan struct{})
+	go service.runReconciler(time.Duration(interval)*time.Second, service.reconcileStop)
+}
+
+// stopReconciler stops the background reconciler.
+func (service *HTTPRestService) stopReconciler() {
+	if service.reconcileStop != nil {
+		close(service.reconcileStop)
+		service.reconcileStop = nil
+	}
+}
+
+// runReconciler reconciles network containers every interval until stopped.
+func (service *HTTPRestService) runReconciler(interval time.Duration, stop chan struct{}) {
+	log.Printf("[Azure CNS] Reconciling network containers every %v.", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			service.reconcileNetworkContainers()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reconcileNetworkContainers verifies the dataplane of all network containers against their goal state
+// and recreates the ones that diverged.
+func (service *HTTPRestService) reconcileNetworkContainers() {
+	service.lock.Lock()
+	networkContainerIDs := make([]string, 0, len(service.state.ContainerStatus))
+	for networkContainerID := range service.state.ContainerStatus {
+		networkContainerIDs = append(networkContainerIDs, networkContainerID)
+	}
+	service.lock.Unlock()
+
+	results := make(map[string]error)
+	repaired := make(map[string]bool)
+
+	for _, networkContainerID := range networkContainerIDs {
+		service.lockNetworkContainer(networkContainerID)
+
+		// Skip network containers deleted since they were listed.
+		if containerStatus, ok := service.getNetworkContainerDetails(networkContainerID); ok {
+			repaired[networkContainerID], results[networkContainerID] =
+				service.reconcileNetworkContainer(containerStatus.CreateNetworkContainerRequest)
+		}
+
+		service.unlockNetworkContainer(networkContainerID)
+	}
+
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	now := time.Now()
+	statuses := make(map[string]*ncSyncStatus)
+
+	for ncID, err := range results {
+		// Skip network containers deleted during the reconciliation.
+		if _, ok := service.state.ContainerStatus[ncID]; !ok {
+			continue
+		}
+
+		status := service.syncStatus[ncID]
+		if status == nil {
+			status = &ncSyncStatus{}
+		}
+
+		status.lastSync = now
+		if err == nil {
+			status.status = cns.NetworkContainerSynced
+			status.lastError = ""
+		} else if err == networkcontainers.ErrVerifyNotSupported {
+			status.status = cns.NetworkContainerNotVerified
+			status.lastError = ""
+		} else {
+			status.status = cns.NetworkContainerSyncFailed
+			status.lastError = err.Error()
+		}
+
+		if repaired[ncID] {
+			status.repairCount++
+		}
+
+		statuses[ncID] = status
+	}
+
+	service.syncStatus = statuses
+}
+
+// reconcileNetworkContainer verifies the dataplane of a network container and recreates it if it diverged.
+// It returns whether the network container was repaired. Must be called with the network container lock held.
+// Network containers without a dataplane check are left alone and reported as not verified.
+func (service *HTTPRestService) reconcileNetworkContainer(req cns.CreateNetworkContainerRequest) (bool, error) {
+	err := service.ncDataplane.Verify(req)
+	if err == nil || err == networkcontainers.ErrVerifyNotSupported {
+		return false, err
+	}
+
+	log.Printf("[Azure CNS] Network container %v diverged from its goal state, repairing, err:%v.",
+		req.NetworkContainerid, err)
+
+	err = service.ncDataplane.Create(req)
+	if err == nil {
+		err = service.ncDataplane.Verify(req)
+	}
+
+	if err != nil {
+		log.Errorf("[Azure CNS] Failed to repair network container %v, err:%v.", req.NetworkContainerid, err)
+		networkContainerRepairs.Inc("failure")
+		return false, err
+	}
+
+	networkContainerRepairs.Inc("success")
+	return true, nil
+}
+
+// getNetworkContainerSyncStatus returns the sync status of a network container.
+// Must be called with the service lock held.
+func (service *HTTPRestService) getNetworkContainerSyncStatus(networkContainerID string) ncSyncStatus {
+	if status, ok := service.syncStatus[networkContainerID]; ok {
+		return *status
+	}
+
+	return ncSyncStatus{status: cns.NetworkContainerSyncPending}
+}
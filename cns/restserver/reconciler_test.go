@@ -0,0 +1,128 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/networkcontainers"
+)
+
+// fakeDataplane is a network container dataplane programmed in memory.
+type fakeDataplane struct {
+	programmed  map[string]bool
+	failCreate  bool
+	creates     int
+	notVerified bool
+}
+
+func (d *fakeDataplane) Verify(req cns.CreateNetworkContainerRequest) error {
+	if d.notVerified {
+		return networkcontainers.ErrVerifyNotSupported
+	}
+
+	if !d.programmed[req.NetworkContainerid] {
+		return fmt.Errorf("Interface %v not found", req.NetworkContainerid)
+	}
+
+	return nil
+}
+
+func (d *fakeDataplane) Create(req cns.CreateNetworkContainerRequest) error {
+	d.creates++
+	if d.failCreate {
+		return fmt.Errorf("Failed to create interface %v", req.NetworkContainerid)
+	}
+
+	d.programmed[req.NetworkContainerid] = true
+	return nil
+}
+
+// Returns the status of a network container, ignoring failures to reach the host.
+func getNetworkContainerSyncStatus(t *testing.T, name string) cns.GetNetworkContainerStatusResponse {
+	var body bytes.Buffer
+	var resp cns.GetNetworkContainerStatusResponse
+
+	json.NewEncoder(&body).Encode(&cns.GetNetworkContainerStatusRequest{NetworkContainerid: name})
+	req, err := http.NewRequest(http.MethodPost, cns.GetNetworkContainerStatus, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	err = decodeResponse(w, &resp)
+	if err != nil || (resp.Response.ReturnCode != 0 && resp.Response.ReturnCode != CallToHostFailed) {
+		t.Fatalf("GetNetworkContainerStatus failed with response %+v Err:%+v", resp, err)
+	}
+
+	return resp
+}
+
+func TestReconcileNetworkContainers(t *testing.T) {
+	svc := service.(*HTTPRestService)
+	dataplane := &fakeDataplane{programmed: make(map[string]bool)}
+	svc.ncDataplane = dataplane
+	defer func() { svc.ncDataplane = svc.networkContainer }()
+
+	setOrchestratorType(t, cns.Kubernetes)
+
+	if err := creatOrUpdateNetworkContainerWithName(t, "ethReconcile", "11.0.0.6", cns.AzureContainerInstance); err != nil {
+		t.Fatal(err)
+	}
+
+	defer deleteNetworkAdapterWithName(t, "ethReconcile")
+
+	resp := getNetworkContainerSyncStatus(t, "ethReconcile")
+	if resp.SyncStatus != cns.NetworkContainerSyncPending {
+		t.Errorf("Unexpected sync status %v before reconciliation.", resp.SyncStatus)
+	}
+
+	// A network container missing from the dataplane is repaired.
+	svc.reconcileNetworkContainers()
+
+	resp = getNetworkContainerSyncStatus(t, "ethReconcile")
+	if resp.SyncStatus != cns.NetworkContainerSynced || resp.RepairCount != 1 || resp.LastSyncError != "" {
+		t.Errorf("Unexpected status after repair: %+v.", resp)
+	}
+
+	if resp.LastSyncTime.IsZero() {
+		t.Errorf("Last sync time was not recorded.")
+	}
+
+	// A network container in sync is left alone.
+	svc.reconcileNetworkContainers()
+
+	resp = getNetworkContainerSyncStatus(t, "ethReconcile")
+	if resp.SyncStatus != cns.NetworkContainerSynced || resp.RepairCount != 1 || dataplane.creates != 1 {
+		t.Errorf("Unexpected status after reconciling a synced container: %+v, creates:%d.", resp, dataplane.creates)
+	}
+
+	// A failed repair is reported with its error.
+	delete(dataplane.programmed, "ethReconcile")
+	dataplane.failCreate = true
+	svc.reconcileNetworkContainers()
+
+	resp = getNetworkContainerSyncStatus(t, "ethReconcile")
+	if resp.SyncStatus != cns.NetworkContainerSyncFailed || resp.LastSyncError == "" || resp.RepairCount != 1 {
+		t.Errorf("Unexpected status after failed repair: %+v.", resp)
+	}
+
+	// A network container without a dataplane check is reported as not verified, and not recreated.
+	dataplane.notVerified = true
+	dataplane.creates = 0
+	svc.reconcileNetworkContainers()
+
+	resp = getNetworkContainerSyncStatus(t, "ethReconcile")
+	if resp.SyncStatus != cns.NetworkContainerNotVerified || resp.LastSyncError != "" || dataplane.creates != 0 {
+		t.Errorf("Unexpected status of a container without dataplane check: %+v, creates:%d.", resp, dataplane.creates)
+	}
+}
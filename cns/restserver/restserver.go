@@ -6,9 +6,10 @@ package restserver
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"reflect"
 	"runtime"
 	"sync"
 	"time"
@@ -28,32 +29,45 @@ import (
 	"github.com/Azure/azure-container-networking/store"
 )
 
-var (
-	// Named Lock for accessing different states in httpRestServiceState
-	namedLock = acn.InitNamedLock()
-)
-
 const (
 	// Key against which CNS state is persisted.
-	storeKey        = "ContainerNetworkService"
+	storeKey = "ContainerNetworkService"
+	// Schema version of the persisted CNS state.
+	schemaVersion   = 1
 	swiftAPIVersion = "1"
 	attach          = "Attach"
 	detach          = "Detach"
-	// Rest service state identifier for named lock
-	stateJoinedNetworks = "JoinedNetworks"
 )
 
+func init() {
+	// Network containers and orchestrator state persisted before versioning load unchanged.
+	store.RegisterMigration(storeKey, 0, store.IdentityMigration)
+}
+
 // HTTPRestService represents http listener for CNS - Container Networking Service.
+// The service lock guards the service state. Operations on a network container are serialized by the lock
+// of the network container, so that operations on different network containers run in parallel. The service
+// lock may be acquired while holding a network container lock, but not the reverse.
 type HTTPRestService struct {
 	*cns.Service
 	dockerClient     *dockerclient.DockerClient
 	imdsClient       *imdsclient.ImdsClient
 	ipamClient       *ipamclient.IpamClient
 	networkContainer *networkcontainers.NetworkContainers
+	ncDataplane      networkContainerDataplane
+	syncStatus       map[string]*ncSyncStatus
+	reconcileStop    chan struct{}
+	ncEvents         ncEventLog
 	routingTable     *routes.RoutingTable
+	metricsListener  *acn.Listener
+	wireserverURL    *url.URL
+	nmagentRetry     nmagentclient.RetryPolicy
+	nmagentOps       nmagentOperations
+	drain            drainState
 	store            store.KeyValueStore
 	state            *httpRestServiceState
 	lock             sync.Mutex
+	ncLocks          *acn.NamedLock
 	dncPartitionKey  string
 }
 
@@ -62,6 +76,7 @@ type containerstatus struct {
 	ID                            string
 	VMVersion                     string
 	HostVersion                   string
+	ResourceVersion               uint64
 	CreateNetworkContainerRequest cns.CreateNetworkContainerRequest
 }
 
@@ -74,6 +89,7 @@ type httpRestServiceState struct {
 	ContainerIDByOrchestratorContext map[string]string          // OrchestratorContext is key and value is NetworkContainerID.
 	ContainerStatus                  map[string]containerstatus // NetworkContainerID is key.
 	Networks                         map[string]*networkInfo
+	ResourceVersion                  uint64 // Incremented on each network container change.
 	TimeStamp                        time.Time
 	joinedNetworks                   map[string]struct{}
 }
@@ -120,8 +136,11 @@ func NewHTTPRestService(config *common.ServiceConfig) (HTTPService, error) {
 		imdsClient:       imdsClient,
 		ipamClient:       ic,
 		networkContainer: nc,
+		ncDataplane:      nc,
+		syncStatus:       make(map[string]*ncSyncStatus),
 		routingTable:     routingTable,
 		state:            serviceState,
+		ncLocks:          acn.InitNamedLock(),
 	}, nil
 
 }
@@ -148,66 +167,94 @@ func (service *HTTPRestService) Start(config *common.ServiceConfig) error {
 	}
 
 	// Add handlers.
-	listener := service.Listener
 	// default handlers
-	listener.AddHandler(cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
-	listener.AddHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
-	listener.AddHandler(cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
-	listener.AddHandler(cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
-	listener.AddHandler(cns.PublishNetworkContainer, service.publishNetworkContainer)
-	listener.AddHandler(cns.UnpublishNetworkContainer, service.unpublishNetworkContainer)
+	service.addHandler(cns.SetEnvironmentPath, service.setEnvironment)
+	service.addHandler(cns.CreateNetworkPath, service.createNetwork)
+	service.addHandler(cns.DeleteNetworkPath, service.deleteNetwork)
+	service.addHandler(cns.ReserveIPAddressPath, service.reserveIPAddress)
+	service.addHandler(cns.ReleaseIPAddressPath, service.releaseIPAddress)
+	service.addHandler(cns.GetHostLocalIPPath, service.getHostLocalIP)
+	service.addHandler(cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
+	service.addHandler(cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
+	service.addHandler(cns.GetHealthReportPath, service.getHealthReport)
+	service.addHandler(cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
+	service.addHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
+	service.addHandler(cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
+	service.addHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
+	service.addHandler(cns.SetOrchestratorType, service.setOrchestratorType)
+	service.addHandler(cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
+	service.addHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
+	service.addHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
+	service.addHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
+	service.addHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
+	service.addHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	service.addHandler(cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
+	service.addHandler(cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
+	service.addHandler(cns.PublishNetworkContainer, service.publishNetworkContainer)
+	service.addHandler(cns.UnpublishNetworkContainer, service.unpublishNetworkContainer)
+	service.addHandler(cns.ListNetworkContainers, service.listNetworkContainers)
+	service.addHandler(cns.WatchNetworkContainers, service.watchNetworkContainers)
+	service.addHandler(cns.GetNMAgentOperationStatus, service.getNMAgentOperationStatus)
 
 	// handlers for v0.2
-	listener.AddHandler(cns.V2Prefix+cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.V2Prefix+cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.V2Prefix+cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.V2Prefix+cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.V2Prefix+cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
-	listener.AddHandler(cns.V2Prefix+cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.V2Prefix+cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.V2Prefix+cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.V2Prefix+cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
-	listener.AddHandler(cns.V2Prefix+cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
+	service.addHandler(cns.V2Prefix+cns.SetEnvironmentPath, service.setEnvironment)
+	service.addHandler(cns.V2Prefix+cns.CreateNetworkPath, service.createNetwork)
+	service.addHandler(cns.V2Prefix+cns.DeleteNetworkPath, service.deleteNetwork)
+	service.addHandler(cns.V2Prefix+cns.ReserveIPAddressPath, service.reserveIPAddress)
+	service.addHandler(cns.V2Prefix+cns.ReleaseIPAddressPath, service.releaseIPAddress)
+	service.addHandler(cns.V2Prefix+cns.GetHostLocalIPPath, service.getHostLocalIP)
+	service.addHandler(cns.V2Prefix+cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
+	service.addHandler(cns.V2Prefix+cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
+	service.addHandler(cns.V2Prefix+cns.GetHealthReportPath, service.getHealthReport)
+	service.addHandler(cns.V2Prefix+cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
+	service.addHandler(cns.V2Prefix+cns.DeleteNetworkContainer, service.deleteNetworkContainer)
+	service.addHandler(cns.V2Prefix+cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
+	service.addHandler(cns.V2Prefix+cns.GetInterfaceForContainer, service.getInterfaceForContainer)
+	service.addHandler(cns.V2Prefix+cns.SetOrchestratorType, service.setOrchestratorType)
+	service.addHandler(cns.V2Prefix+cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
+	service.addHandler(cns.V2Prefix+cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
+	service.addHandler(cns.V2Prefix+cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
+	service.addHandler(cns.V2Prefix+cns.CreateHnsNetworkPath, service.createHnsNetwork)
+	service.addHandler(cns.V2Prefix+cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
+	service.addHandler(cns.V2Prefix+cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	service.addHandler(cns.V2Prefix+cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
+	service.addHandler(cns.V2Prefix+cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
+	service.addHandler(cns.V2Prefix+cns.ListNetworkContainers, service.listNetworkContainers)
+	service.addHandler(cns.V2Prefix+cns.WatchNetworkContainers, service.watchNetworkContainers)
+	service.addHandler(cns.V2Prefix+cns.GetNMAgentOperationStatus, service.getNMAgentOperationStatus)
 
 	// Initialize HTTP client to be reused in CNS
 	connectionTimeout, _ := service.GetOption(acn.OptHttpConnectionTimeout).(int)
 	responseHeaderTimeout, _ := service.GetOption(acn.OptHttpResponseHeaderTimeout).(int)
 	acn.InitHttpClient(connectionTimeout, responseHeaderTimeout)
 
+	service.initNMAgentRetries()
+
+	if wireserverURL, _ := service.GetOption(acn.OptWireserverURL).(string); wireserverURL != "" {
+		if err = service.setWireserverURL(wireserverURL); err != nil {
+			return err
+		}
+	}
+
+	if err = service.startMetrics(config.ErrChan); err != nil {
+		return err
+	}
+
+	service.startReconciler()
+
+	// Probes are not tracked so that they are served while draining.
+	service.Listener.AddHandler(cns.ReadinessPath, service.getReadiness)
+	service.Listener.AddHandler(cns.LivenessPath, service.getLiveness)
+	service.setReady()
+
 	log.Printf("[Azure CNS]  Listening.")
 	return nil
 }
 
-// Stop stops the CNS.
+// Stop stops the CNS after completing requests in progress.
 func (service *HTTPRestService) Stop() {
+	service.shutdown()
+	service.stopMetrics()
 	service.Uninitialize()
 	log.Printf("[Azure CNS]  Service stopped.")
 }
@@ -775,6 +822,10 @@ func (service *HTTPRestService) getIPAddressUtilization(w http.ResponseWriter, r
 		}
 		log.Printf("[Azure CNS] Capacity %v Available %v UnhealthyAddrs %v", capacity, available, unhealthyAddrs)
 
+		ipAddresses.Set(float64(available), "available")
+		ipAddresses.Set(float64(capacity-available), "reserved")
+		ipAddresses.Set(float64(len(unhealthyAddrs)), "unhealthy")
+
 	default:
 		returnMessage = "[Azure CNS] Error. GetIPUtilization did not receive a GET."
 		returnCode = InvalidParameter
@@ -930,6 +981,8 @@ func (service *HTTPRestService) getHealthReport(w http.ResponseWriter, r *http.R
 func (service *HTTPRestService) saveState() error {
 	log.Printf("[Azure CNS] saveState")
 
+	service.updateNetworkContainerMetrics()
+
 	// Skip if a store is not provided.
 	if service.store == nil {
 		log.Printf("[Azure CNS]  store not initialized.")
@@ -938,7 +991,8 @@ func (service *HTTPRestService) saveState() error {
 
 	// Update time stamp.
 	service.state.TimeStamp = time.Now()
-	err := service.store.Write(storeKey, &service.state)
+	err := store.WriteVersioned(service.store, storeKey, schemaVersion, &service.state)
+	stateSaveLatency.ObserveDuration(service.state.TimeStamp)
 	if err == nil {
 		log.Printf("[Azure CNS]  State saved successfully.\n")
 	} else {
@@ -959,7 +1013,7 @@ func (service *HTTPRestService) restoreState() error {
 	}
 
 	// Read any persisted state.
-	err := service.store.Read(storeKey, &service.state)
+	err := store.ReadVersioned(service.store, storeKey, schemaVersion, &service.state)
 	if err != nil {
 		if err == store.ErrKeyNotFound {
 			// Nothing to restore.
@@ -971,6 +1025,11 @@ func (service *HTTPRestService) restoreState() error {
 		return err
 	}
 
+	service.updateNetworkContainerMetrics()
+
+	// Events before the restored version are lost, watchers from older versions must list again.
+	service.ncEvents.startVersion = service.state.ResourceVersion
+
 	log.Printf("[Azure CNS]  Restored state, %+v\n", service.state)
 	return nil
 }
@@ -1028,18 +1087,28 @@ func (service *HTTPRestService) saveNetworkContainerGoalState(req cns.CreateNetw
 
 	existing, ok := service.state.ContainerStatus[req.NetworkContainerid]
 	var hostVersion string
+	var resourceVersion uint64
 	if ok {
 		hostVersion = existing.HostVersion
+		resourceVersion = existing.ResourceVersion
 	}
 
 	if service.state.ContainerStatus == nil {
 		service.state.ContainerStatus = make(map[string]containerstatus)
 	}
 
+	// Only actual changes of the goal state are published to watchers.
+	if !ok {
+		resourceVersion = service.recordNetworkContainerEvent(cns.NetworkContainerAdded, req)
+	} else if !reflect.DeepEqual(existing.CreateNetworkContainerRequest, req) {
+		resourceVersion = service.recordNetworkContainerEvent(cns.NetworkContainerModified, req)
+	}
+
 	service.state.ContainerStatus[req.NetworkContainerid] =
 		containerstatus{
 			ID:                            req.NetworkContainerid,
 			VMVersion:                     req.Version,
+			ResourceVersion:               resourceVersion,
 			CreateNetworkContainerRequest: req,
 			HostVersion:                   hostVersion}
 
@@ -1118,6 +1187,9 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 
 	switch r.Method {
 	case "POST":
+		service.lockNetworkContainer(req.NetworkContainerid)
+		defer service.unlockNetworkContainer(req.NetworkContainerid)
+
 		if req.NetworkContainerType == cns.WebApps {
 			// try to get the saved nc state if it exists
 			existing, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
@@ -1295,6 +1367,9 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 		var containerStatus containerstatus
 		var ok bool
 
+		service.lockNetworkContainer(req.NetworkContainerid)
+		defer service.unlockNetworkContainer(req.NetworkContainerid)
+
 		containerStatus, ok = service.getNetworkContainerDetails(req.NetworkContainerid)
 
 		if !ok {
@@ -1314,10 +1389,13 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 		service.lock.Lock()
 		defer service.lock.Unlock()
 
-		if service.state.ContainerStatus != nil {
+		if _, ok = service.state.ContainerStatus[req.NetworkContainerid]; ok {
 			delete(service.state.ContainerStatus, req.NetworkContainerid)
+			service.recordNetworkContainerEvent(cns.NetworkContainerDeleted, containerStatus.CreateNetworkContainerRequest)
 		}
 
+		service.forgetNMAgentOperations(req.NetworkContainerid)
+
 		if service.state.ContainerIDByOrchestratorContext != nil {
 			for orchestratorContext, networkContainerID := range service.state.ContainerIDByOrchestratorContext {
 				if networkContainerID == req.NetworkContainerid {
@@ -1357,20 +1435,17 @@ func (service *HTTPRestService) getNetworkContainerStatus(w http.ResponseWriter,
 		return
 	}
 
-	service.lock.Lock()
-	defer service.lock.Unlock()
-	var ok bool
-	var containerDetails containerstatus
-
-	containerInfo := service.state.ContainerStatus
-	if containerInfo != nil {
-		containerDetails, ok = containerInfo[req.NetworkContainerid]
-	} else {
-		ok = false
-	}
-
 	var hostVersion string
 	var vmVersion string
+	var syncStatus ncSyncStatus
+
+	// The host is queried without holding the service lock.
+	service.lock.Lock()
+	containerDetails, ok := service.state.ContainerStatus[req.NetworkContainerid]
+	if ok {
+		syncStatus = service.getNetworkContainerSyncStatus(req.NetworkContainerid)
+	}
+	service.lock.Unlock()
 
 	if ok {
 		savedReq := containerDetails.CreateNetworkContainerRequest
@@ -1400,6 +1475,10 @@ func (service *HTTPRestService) getNetworkContainerStatus(w http.ResponseWriter,
 		NetworkContainerid: req.NetworkContainerid,
 		AzureHostVersion:   hostVersion,
 		Version:            vmVersion,
+		SyncStatus:         syncStatus.status,
+		LastSyncTime:       syncStatus.lastSync,
+		LastSyncError:      syncStatus.lastError,
+		RepairCount:        syncStatus.repairCount,
 	}
 
 	err = service.Listener.Encode(w, &networkContainerStatusReponse)
@@ -1419,8 +1498,7 @@ func (service *HTTPRestService) getInterfaceForContainer(w http.ResponseWriter,
 		return
 	}
 
-	containerInfo := service.state.ContainerStatus
-	containerDetails, ok := containerInfo[req.NetworkContainerID]
+	containerDetails, ok := service.getNetworkContainerDetails(req.NetworkContainerID)
 	var interfaceName string
 	var ipaddress string
 	var cnetSpace []cns.IPSubnet
@@ -1556,7 +1634,12 @@ func (service *HTTPRestService) attachOrDetachHelper(req cns.ConfigureContainerN
 			Message:    "[Azure CNS] Error. NetworkContainerid is empty"}
 	}
 
-	existing, ok := service.getNetworkContainerDetails(cns.SwiftPrefix + req.NetworkContainerid)
+	networkContainerID := cns.SwiftPrefix + req.NetworkContainerid
+
+	service.lockNetworkContainer(networkContainerID)
+	defer service.unlockNetworkContainer(networkContainerID)
+
+	existing, ok := service.getNetworkContainerDetails(networkContainerID)
 
 	if !ok {
 		return cns.Response{
@@ -1564,9 +1647,13 @@ func (service *HTTPRestService) attachOrDetachHelper(req cns.ConfigureContainerN
 			Message:    fmt.Sprintf("[Azure CNS] Error. Network Container %s does not exist.", req.NetworkContainerid)}
 	}
 
+	service.lock.Lock()
+	orchestratorType := service.state.OrchestratorType
+	service.lock.Unlock()
+
 	returnCode := 0
 	returnMessage := ""
-	switch service.state.OrchestratorType {
+	switch orchestratorType {
 	case cns.Batch:
 		var podInfo cns.KubernetesPodInfo
 		err := json.Unmarshal(existing.CreateNetworkContainerRequest.OrchestratorContext, &podInfo)
@@ -1589,7 +1676,7 @@ func (service *HTTPRestService) attachOrDetachHelper(req cns.ConfigureContainerN
 		}
 
 	default:
-		returnMessage = fmt.Sprintf("[Azure CNS] Invalid orchestrator type %v", service.state.OrchestratorType)
+		returnMessage = fmt.Sprintf("[Azure CNS] Invalid orchestrator type %v", orchestratorType)
 		returnCode = UnsupportedOrchestratorType
 	}
 
@@ -1635,6 +1722,16 @@ func (service *HTTPRestService) getNumberOfCPUCores(w http.ResponseWriter, r *ht
 	log.Response(service.Name, numOfCPUCoresResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
+// lockNetworkContainer serializes operations on a network container.
+func (service *HTTPRestService) lockNetworkContainer(networkContainerID string) {
+	service.ncLocks.LockAcquire(networkContainerID)
+}
+
+// unlockNetworkContainer releases the lock acquired by lockNetworkContainer.
+func (service *HTTPRestService) unlockNetworkContainer(networkContainerID string) {
+	service.ncLocks.LockRelease(networkContainerID)
+}
+
 func (service *HTTPRestService) getNetworkContainerDetails(networkContainerID string) (containerstatus, bool) {
 	service.lock.Lock()
 	defer service.lock.Unlock()
@@ -1663,6 +1760,9 @@ func (service *HTTPRestService) createHostNCApipaEndpoint(w http.ResponseWriter,
 
 	switch r.Method {
 	case "POST":
+		service.lockNetworkContainer(req.NetworkContainerID)
+		defer service.unlockNetworkContainer(req.NetworkContainerID)
+
 		networkContainerDetails, found := service.getNetworkContainerDetails(req.NetworkContainerID)
 		if found {
 			if !networkContainerDetails.CreateNetworkContainerRequest.AllowNCToHostCommunication &&
@@ -1720,6 +1820,9 @@ func (service *HTTPRestService) deleteHostNCApipaEndpoint(w http.ResponseWriter,
 
 	switch r.Method {
 	case "POST":
+		service.lockNetworkContainer(req.NetworkContainerID)
+		defer service.unlockNetworkContainer(req.NetworkContainerID)
+
 		if err = hnsclient.DeleteHostNCApipaEndpoint(req.NetworkContainerID); err != nil {
 			returnMessage = fmt.Sprintf("Failed to delete endpoint for Network Container: %s "+
 				"due to error: %v", req.NetworkContainerID, err)
@@ -1743,8 +1846,8 @@ func (service *HTTPRestService) deleteHostNCApipaEndpoint(w http.ResponseWriter,
 
 // Check if the network is joined
 func (service *HTTPRestService) isNetworkJoined(networkID string) bool {
-	namedLock.LockAcquire(stateJoinedNetworks)
-	defer namedLock.LockRelease(stateJoinedNetworks)
+	service.lock.Lock()
+	defer service.lock.Unlock()
 
 	if service.state.joinedNetworks == nil {
 		service.state.joinedNetworks = make(map[string]struct{})
@@ -1757,30 +1860,50 @@ func (service *HTTPRestService) isNetworkJoined(networkID string) bool {
 
 // Set the network as joined
 func (service *HTTPRestService) setNetworkStateJoined(networkID string) {
-	namedLock.LockAcquire(stateJoinedNetworks)
-	defer namedLock.LockRelease(stateJoinedNetworks)
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	if service.state.joinedNetworks == nil {
+		service.state.joinedNetworks = make(map[string]struct{})
+	}
 
 	service.state.joinedNetworks[networkID] = struct{}{}
 }
 
-// Join Network by calling nmagent
-func (service *HTTPRestService) joinNetwork(
-	networkID string,
-	joinNetworkURL string) (*http.Response, error, error) {
-	var err error
-	joinResponse, joinErr := nmagentclient.JoinNetwork(
-		networkID,
-		joinNetworkURL)
-
-	if joinErr == nil && joinResponse.StatusCode == http.StatusOK {
-		// Network joined successfully
-		service.setNetworkStateJoined(networkID)
-		log.Printf("[Azure-CNS] setNetworkStateJoined for network: %s", networkID)
-	} else {
-		err = fmt.Errorf("Failed to join network: %s", networkID)
+// setWireserverURL sends the requests for the Azure wireserver to the given URL, such as a local simulator.
+func (service *HTTPRestService) setWireserverURL(wireserverURL string) error {
+	u, err := url.Parse(wireserverURL)
+	if err != nil {
+		return err
 	}
 
-	return joinResponse, joinErr, err
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Invalid wireserver URL %v", wireserverURL)
+	}
+
+	log.Printf("[Azure CNS] Sending wireserver requests to %v.", wireserverURL)
+
+	service.imdsClient.SetHostURL(wireserverURL)
+	service.wireserverURL = u
+
+	return nil
+}
+
+// getNMAgentURL returns the given NMAgent URL, redirected to the configured wireserver URL if it targets the Azure wireserver.
+func (service *HTTPRestService) getNMAgentURL(rawURL string) string {
+	if service.wireserverURL == nil {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() != nmagentclient.WireserverIP {
+		return rawURL
+	}
+
+	u.Scheme = service.wireserverURL.Scheme
+	u.Host = service.wireserverURL.Host
+
+	return u.String()
 }
 
 // Publish Network Container by calling nmagent
@@ -1788,16 +1911,9 @@ func (service *HTTPRestService) publishNetworkContainer(w http.ResponseWriter, r
 	log.Printf("[Azure-CNS] PublishNetworkContainer")
 
 	var (
-		err                 error
-		req                 cns.PublishNetworkContainerRequest
-		returnCode          int
-		returnMessage       string
-		publishResponse     *http.Response
-		publishStatusCode   int
-		publishResponseBody []byte
-		publishError        error
-		publishErrorStr     string
-		isNetworkJoined     bool
+		err    error
+		req    cns.PublishNetworkContainerRequest
+		result nmagentResult
 	)
 
 	err = service.Listener.Decode(w, r, &req)
@@ -1808,61 +1924,44 @@ func (service *HTTPRestService) publishNetworkContainer(w http.ResponseWriter, r
 
 	switch r.Method {
 	case "POST":
-		// Join Network if not joined already
-		isNetworkJoined = service.isNetworkJoined(req.NetworkID)
-		if !isNetworkJoined {
-			publishResponse, publishError, err = service.joinNetwork(req.NetworkID, req.JoinNetworkURL)
-			if err == nil {
-				isNetworkJoined = true
-			} else {
-				returnMessage = err.Error()
-				returnCode = NetworkJoinFailed
-			}
-		}
-
-		if isNetworkJoined {
-			// Publish Network Container
-			publishResponse, publishError = nmagentclient.PublishNetworkContainer(
-				req.NetworkContainerID,
-				req.CreateNetworkContainerURL,
-				req.CreateNetworkContainerRequestBody)
-			if publishError != nil || publishResponse.StatusCode != http.StatusOK {
-				returnMessage = fmt.Sprintf("Failed to publish Network Container: %s", req.NetworkContainerID)
-				returnCode = NetworkContainerPublishFailed
-				log.Errorf("[Azure-CNS] %s", returnMessage)
-			}
+		createNetworkContainerURL := service.getNMAgentURL(req.CreateNetworkContainerURL)
+		key := getNMAgentOperationKey(cns.NMAgentPublish, req.NetworkContainerID, req.NetworkID,
+			req.JoinNetworkURL, req.CreateNetworkContainerURL, string(req.CreateNetworkContainerRequestBody))
+
+		call := service.runNMAgentOperation(key, nmagentRequest{
+			operation:          cns.NMAgentPublish,
+			networkID:          req.NetworkID,
+			networkContainerID: req.NetworkContainerID,
+			joinNetworkURL:     req.JoinNetworkURL,
+			failureCode:        NetworkContainerPublishFailed,
+			send: func() (*http.Response, error) {
+				return nmagentclient.PublishNetworkContainer(
+					req.NetworkContainerID,
+					createNetworkContainerURL,
+					req.CreateNetworkContainerRequestBody)
+			},
+		})
+
+		if req.Async {
+			result.message = fmt.Sprintf("Publish of Network Container %s accepted", req.NetworkContainerID)
+			result.statusCode = http.StatusAccepted
+		} else {
+			<-call.done
+			result = call.result
 		}
 	default:
-		returnMessage = "PublishNetworkContainer API expects a POST"
-		returnCode = UnsupportedVerb
-	}
-
-	if publishError != nil {
-		publishErrorStr = publishError.Error()
-	}
-
-	if publishResponse != nil {
-		publishStatusCode = publishResponse.StatusCode
-
-		var errParse error
-		publishResponseBody, errParse = ioutil.ReadAll(publishResponse.Body)
-		if errParse != nil {
-			returnMessage = fmt.Sprintf("Failed to parse the publish body. Error: %v", errParse)
-			returnCode = UnexpectedError
-			log.Errorf("[Azure-CNS] %s", returnMessage)
-		}
-
-		publishResponse.Body.Close()
+		result.message = "PublishNetworkContainer API expects a POST"
+		result.returnCode = UnsupportedVerb
 	}
 
 	response := cns.PublishNetworkContainerResponse{
 		Response: cns.Response{
-			ReturnCode: returnCode,
-			Message:    returnMessage,
+			ReturnCode: result.returnCode,
+			Message:    result.message,
 		},
-		PublishErrorStr:     publishErrorStr,
-		PublishStatusCode:   publishStatusCode,
-		PublishResponseBody: publishResponseBody,
+		PublishErrorStr:     result.errorStr,
+		PublishStatusCode:   result.statusCode,
+		PublishResponseBody: result.responseBody,
 	}
 
 	err = service.Listener.Encode(w, &response)
@@ -1874,16 +1973,9 @@ func (service *HTTPRestService) unpublishNetworkContainer(w http.ResponseWriter,
 	log.Printf("[Azure-CNS] UnpublishNetworkContainer")
 
 	var (
-		err                   error
-		req                   cns.UnpublishNetworkContainerRequest
-		returnCode            int
-		returnMessage         string
-		unpublishResponse     *http.Response
-		unpublishStatusCode   int
-		unpublishResponseBody []byte
-		unpublishError        error
-		unpublishErrorStr     string
-		isNetworkJoined       bool
+		err    error
+		req    cns.UnpublishNetworkContainerRequest
+		result nmagentResult
 	)
 
 	err = service.Listener.Decode(w, r, &req)
@@ -1894,62 +1986,43 @@ func (service *HTTPRestService) unpublishNetworkContainer(w http.ResponseWriter,
 
 	switch r.Method {
 	case "POST":
-		// Join Network if not joined already
-		isNetworkJoined = service.isNetworkJoined(req.NetworkID)
-		if !isNetworkJoined {
-			unpublishResponse, unpublishError, err = service.joinNetwork(req.NetworkID, req.JoinNetworkURL)
-			if err == nil {
-				isNetworkJoined = true
-			} else {
-				returnMessage = err.Error()
-				returnCode = NetworkJoinFailed
-			}
-		}
-
-		if isNetworkJoined {
-			// Unpublish Network Container
-			unpublishResponse, unpublishError = nmagentclient.UnpublishNetworkContainer(
-				req.NetworkContainerID,
-				req.DeleteNetworkContainerURL)
-			if unpublishError != nil || unpublishResponse.StatusCode != http.StatusOK {
-				returnMessage = fmt.Sprintf("Failed to unpublish Network Container: %s", req.NetworkContainerID)
-				returnCode = NetworkContainerUnpublishFailed
-				log.Errorf("[Azure-CNS] %s", returnMessage)
-			}
-
-			if unpublishResponse != nil {
-				var errParse error
-				unpublishResponseBody, errParse = ioutil.ReadAll(unpublishResponse.Body)
-				if errParse != nil {
-					returnMessage = fmt.Sprintf("Failed to parse the unpublish body. Error: %v", errParse)
-					returnCode = UnexpectedError
-					log.Errorf("[Azure-CNS] %s", returnMessage)
-				}
+		deleteNetworkContainerURL := service.getNMAgentURL(req.DeleteNetworkContainerURL)
+		key := getNMAgentOperationKey(cns.NMAgentUnpublish, req.NetworkContainerID, req.NetworkID,
+			req.JoinNetworkURL, req.DeleteNetworkContainerURL)
+
+		call := service.runNMAgentOperation(key, nmagentRequest{
+			operation:          cns.NMAgentUnpublish,
+			networkID:          req.NetworkID,
+			networkContainerID: req.NetworkContainerID,
+			joinNetworkURL:     req.JoinNetworkURL,
+			failureCode:        NetworkContainerUnpublishFailed,
+			send: func() (*http.Response, error) {
+				return nmagentclient.UnpublishNetworkContainer(
+					req.NetworkContainerID,
+					deleteNetworkContainerURL)
+			},
+		})
 
-				unpublishResponse.Body.Close()
-			}
+		if req.Async {
+			result.message = fmt.Sprintf("Unpublish of Network Container %s accepted", req.NetworkContainerID)
+			result.statusCode = http.StatusAccepted
+		} else {
+			<-call.done
+			result = call.result
 		}
 	default:
-		returnMessage = "UnpublishNetworkContainer API expects a POST"
-		returnCode = UnsupportedVerb
-	}
-
-	if unpublishError != nil {
-		unpublishErrorStr = unpublishError.Error()
-	}
-
-	if unpublishResponse != nil {
-		unpublishStatusCode = unpublishResponse.StatusCode
+		result.message = "UnpublishNetworkContainer API expects a POST"
+		result.returnCode = UnsupportedVerb
 	}
 
 	response := cns.UnpublishNetworkContainerResponse{
 		Response: cns.Response{
-			ReturnCode: returnCode,
-			Message:    returnMessage,
+			ReturnCode: result.returnCode,
+			Message:    result.message,
 		},
-		UnpublishErrorStr:     unpublishErrorStr,
-		UnpublishStatusCode:   unpublishStatusCode,
-		UnpublishResponseBody: unpublishResponseBody,
+		UnpublishErrorStr:     result.errorStr,
+		UnpublishStatusCode:   result.statusCode,
+		UnpublishResponseBody: result.responseBody,
 	}
 
 	err = service.Listener.Encode(w, &response)
@@ -0,0 +1,193 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Number of network container events kept for watchers.
+	maxNetworkContainerEvents = 1024
+
+	// Default and maximum duration of a watch request.
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// ncEventLog holds the latest network container events for watchers.
+// It is guarded by the service lock.
+type ncEventLog struct {
+	events []cns.NetworkContainerEvent
+
+	// Resource version before the oldest event. Watches from older versions must list again.
+	startVersion uint64
+
+	// Closed and replaced when an event is recorded.
+	notify chan struct{}
+}
+
+// Returns the goal state of a network container as returned to watchers.
+func getNetworkContainerInfo(resourceVersion uint64, req cns.CreateNetworkContainerRequest) cns.NetworkContainerInfo {
+	req.AuthorizationToken = ""
+	return cns.NetworkContainerInfo{ResourceVersion: resourceVersion, NetworkContainer: req}
+}
+
+// recordNetworkContainerEvent increments the resource version, records an event for watchers and returns the new version.
+// Must be called with the service lock held.
+func (service *HTTPRestService) recordNetworkContainerEvent(eventType string, req cns.CreateNetworkContainerRequest) uint64 {
+	service.state.ResourceVersion++
+
+	log.Printf("[Azure CNS] Network container %v %v at resource version %v.",
+		req.NetworkContainerid, eventType, service.state.ResourceVersion)
+
+	ncEvents := &service.ncEvents
+	ncEvents.events = append(ncEvents.events, cns.NetworkContainerEvent{
+		Type:             eventType,
+		NetworkContainer: getNetworkContainerInfo(service.state.ResourceVersion, req),
+	})
+
+	if len(ncEvents.events) > maxNetworkContainerEvents {
+		ncEvents.startVersion = ncEvents.events[0].NetworkContainer.ResourceVersion
+		ncEvents.events = append([]cns.NetworkContainerEvent(nil), ncEvents.events[1:]...)
+	}
+
+	if ncEvents.notify != nil {
+		close(ncEvents.notify)
+		ncEvents.notify = nil
+	}
+
+	return service.state.ResourceVersion
+}
+
+// getNetworkContainerEvents returns the events after the given resource version, and a channel closed on the next event.
+// Must be called with the service lock held.
+func (service *HTTPRestService) getNetworkContainerEvents(resourceVersion uint64) ([]cns.NetworkContainerEvent, <-chan struct{}, error) {
+	ncEvents := &service.ncEvents
+
+	if resourceVersion < ncEvents.startVersion || resourceVersion > service.state.ResourceVersion {
+		return nil, nil, fmt.Errorf("Resource version %v is not in the range of watchable versions [%v, %v]",
+			resourceVersion, ncEvents.startVersion, service.state.ResourceVersion)
+	}
+
+	i := sort.Search(len(ncEvents.events), func(i int) bool {
+		return ncEvents.events[i].NetworkContainer.ResourceVersion > resourceVersion
+	})
+
+	if i < len(ncEvents.events) {
+		return append([]cns.NetworkContainerEvent(nil), ncEvents.events[i:]...), nil, nil
+	}
+
+	if ncEvents.notify == nil {
+		ncEvents.notify = make(chan struct{})
+	}
+
+	return nil, ncEvents.notify, nil
+}
+
+// Handles requests to list all network containers.
+func (service *HTTPRestService) listNetworkContainers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[Azure CNS] listNetworkContainers")
+	log.Request(service.Name, "listNetworkContainers", nil)
+
+	var resp cns.ListNetworkContainersResponse
+
+	switch r.Method {
+	case "GET":
+		service.lock.Lock()
+		resp.ResourceVersion = service.state.ResourceVersion
+		resp.NetworkContainers = make([]cns.NetworkContainerInfo, 0, len(service.state.ContainerStatus))
+		for _, containerStatus := range service.state.ContainerStatus {
+			resp.NetworkContainers = append(resp.NetworkContainers,
+				getNetworkContainerInfo(containerStatus.ResourceVersion, containerStatus.CreateNetworkContainerRequest))
+		}
+		service.lock.Unlock()
+
+		sort.Slice(resp.NetworkContainers, func(i, j int) bool {
+			return resp.NetworkContainers[i].ResourceVersion < resp.NetworkContainers[j].ResourceVersion
+		})
+
+	default:
+		resp.Response.ReturnCode = UnsupportedVerb
+		resp.Response.Message = "[Azure CNS] Error. ListNetworkContainers expects a GET."
+	}
+
+	err := service.Listener.Encode(w, &resp)
+	log.Response(service.Name, resp, resp.Response.ReturnCode, ReturnCodeToString(resp.Response.ReturnCode), err)
+}
+
+// Handles requests to watch network container changes.
+// The request waits until events after the requested resource version are available or the watch times out.
+func (service *HTTPRestService) watchNetworkContainers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[Azure CNS] watchNetworkContainers")
+
+	var req cns.WatchNetworkContainersRequest
+	var resp cns.WatchNetworkContainersResponse
+
+	err := service.Listener.Decode(w, r, &req)
+	log.Request(service.Name, &req, err)
+	if err != nil {
+		return
+	}
+
+	if r.Method != "POST" {
+		resp.Response.ReturnCode = UnsupportedVerb
+		resp.Response.Message = "[Azure CNS] Error. WatchNetworkContainers expects a POST."
+	} else {
+		timeout := defaultWatchTimeout
+		if req.TimeoutSeconds > 0 {
+			timeout = time.Duration(req.TimeoutSeconds) * time.Second
+			if timeout > maxWatchTimeout {
+				timeout = maxWatchTimeout
+			}
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		// Watches return early when CNS stops so that they do not hold up draining.
+		stopping := service.getStopping()
+
+		resp.ResourceVersion = req.ResourceVersion
+
+	wait:
+		for {
+			service.lock.Lock()
+			events, notify, err := service.getNetworkContainerEvents(req.ResourceVersion)
+			service.lock.Unlock()
+
+			if err != nil {
+				resp.Response.ReturnCode = ResourceVersionExpired
+				resp.Response.Message = err.Error()
+				break
+			}
+
+			if len(events) > 0 {
+				resp.Events = events
+				resp.ResourceVersion = events[len(events)-1].NetworkContainer.ResourceVersion
+				break
+			}
+
+			select {
+			case <-notify:
+			case <-timer.C:
+				break wait
+			case <-stopping:
+				break wait
+			case <-r.Context().Done():
+				log.Printf("[Azure CNS] Watch from resource version %v cancelled.", req.ResourceVersion)
+				return
+			}
+		}
+	}
+
+	err = service.Listener.Encode(w, &resp)
+	log.Response(service.Name, resp, resp.Response.ReturnCode, ReturnCodeToString(resp.Response.ReturnCode), err)
+}
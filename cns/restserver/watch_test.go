@@ -0,0 +1,41 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+)
+
+func TestNetworkContainerEventLogExpiresOldVersions(t *testing.T) {
+	svc := service.(*HTTPRestService)
+	req := cns.CreateNetworkContainerRequest{NetworkContainerid: "ethEvents"}
+
+	svc.lock.Lock()
+	defer svc.lock.Unlock()
+
+	first := svc.recordNetworkContainerEvent(cns.NetworkContainerAdded, req)
+	for i := 0; i < maxNetworkContainerEvents; i++ {
+		svc.recordNetworkContainerEvent(cns.NetworkContainerModified, req)
+	}
+
+	if len(svc.ncEvents.events) != maxNetworkContainerEvents {
+		t.Errorf("Event log holds %d events, expected %d.", len(svc.ncEvents.events), maxNetworkContainerEvents)
+	}
+
+	if _, _, err := svc.getNetworkContainerEvents(first - 1); err == nil {
+		t.Errorf("Watch from evicted version %v succeeded.", first-1)
+	}
+
+	events, _, err := svc.getNetworkContainerEvents(first)
+	if err != nil || len(events) != maxNetworkContainerEvents || events[0].NetworkContainer.ResourceVersion != first+1 {
+		t.Errorf("Watch from oldest version %v returned %d events, err:%v.", first, len(events), err)
+	}
+
+	events, notify, err := svc.getNetworkContainerEvents(svc.state.ResourceVersion)
+	if err != nil || len(events) != 0 || notify == nil {
+		t.Errorf("Watch from current version returned %d events, err:%v.", len(events), err)
+	}
+}
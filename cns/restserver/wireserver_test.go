@@ -0,0 +1,207 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+)
+
+const (
+	wireserverPluginsURL = "http://168.63.129.16/machine/plugins/?comp=nmagent&type=NetworkManagement/"
+)
+
+// Starts a wireserver simulator and sends the wireserver requests of CNS to it until the returned function is called.
+func startWireserverSimulator(t *testing.T) (*wireserver.Simulator, func()) {
+	simulator := wireserver.NewSimulator()
+	server := httptest.NewServer(simulator)
+
+	svc := service.(*HTTPRestService)
+	if err := svc.setWireserverURL(server.URL); err != nil {
+		t.Fatalf("Failed to set wireserver URL, err:%v.", err)
+	}
+
+	return simulator, func() {
+		svc.wireserverURL = nil
+		svc.imdsClient.SetHostURL("")
+		server.Close()
+	}
+}
+
+// Returns a request to publish a network container with wireserver URLs as sent by DNC.
+func newWireserverPublishRequest(networkID, ncID string, version string) *cns.PublishNetworkContainerRequest {
+	return &cns.PublishNetworkContainerRequest{
+		NetworkID:          networkID,
+		NetworkContainerID: ncID,
+		JoinNetworkURL:     wireserverPluginsURL + "joinedVirtualNetworks/" + networkID + "/api-version/1",
+		CreateNetworkContainerURL: wireserverPluginsURL + "interfaces/10.0.0.4/networkContainers/" + ncID +
+			"/authenticationToken/token/api-version/1",
+		CreateNetworkContainerRequestBody: []byte(`{"version":"` + version + `"}`),
+	}
+}
+
+// Publishes a network container through CNS.
+func sendPublishRequest(t *testing.T, publishReq *cns.PublishNetworkContainerRequest) cns.PublishNetworkContainerResponse {
+	var body bytes.Buffer
+	var resp cns.PublishNetworkContainerResponse
+
+	json.NewEncoder(&body).Encode(publishReq)
+
+	req, err := http.NewRequest(http.MethodPost, cns.PublishNetworkContainer, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if err = decodeResponse(w, &resp); err != nil {
+		t.Fatalf("Failed to decode publish response, err:%v.", err)
+	}
+
+	return resp
+}
+
+// Publishes a network container through CNS with wireserver URLs as sent by DNC.
+func publishViaWireserver(t *testing.T, networkID, ncID string, version string) cns.PublishNetworkContainerResponse {
+	return sendPublishRequest(t, newWireserverPublishRequest(networkID, ncID, version))
+}
+
+// Unpublishes a network container through CNS with wireserver URLs as sent by DNC.
+func unpublishViaWireserver(t *testing.T, networkID, ncID string) cns.UnpublishNetworkContainerResponse {
+	var body bytes.Buffer
+	var resp cns.UnpublishNetworkContainerResponse
+
+	json.NewEncoder(&body).Encode(&cns.UnpublishNetworkContainerRequest{
+		NetworkID:          networkID,
+		NetworkContainerID: ncID,
+		JoinNetworkURL:     wireserverPluginsURL + "joinedVirtualNetworks/" + networkID + "/api-version/1",
+		DeleteNetworkContainerURL: wireserverPluginsURL + "interfaces/10.0.0.4/networkContainers/" + ncID +
+			"/authenticationToken/token/api-version/1/method/DELETE",
+	})
+
+	req, err := http.NewRequest(http.MethodPost, cns.UnpublishNetworkContainer, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if err = decodeResponse(w, &resp); err != nil {
+		t.Fatalf("Failed to decode unpublish response, err:%v.", err)
+	}
+
+	return resp
+}
+
+func TestPublishViaWireserverSimulator(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	resp := publishViaWireserver(t, "vnetSimPublish", "ncSimPublish", "1")
+	if resp.Response.ReturnCode != Success || resp.PublishStatusCode != http.StatusOK {
+		t.Fatalf("Publish failed with response %+v.", resp)
+	}
+
+	state := simulator.GetState()
+	if len(state.JoinedNetworks) != 1 || state.JoinedNetworks[0] != "vnetSimPublish" {
+		t.Errorf("Network was not joined, state %+v.", state)
+	}
+
+	if nc := state.NetworkContainers["ncSimPublish"]; nc.PublishedVersion != "1" || nc.AuthenticationToken != "token" {
+		t.Errorf("Network container was not published, state %+v.", state)
+	}
+
+	// Joined networks are not joined again.
+	if resp = publishViaWireserver(t, "vnetSimPublish", "ncSimPublish", "2"); resp.Response.ReturnCode != Success {
+		t.Fatalf("Publish failed with response %+v.", resp)
+	}
+
+	if requests := simulator.GetState().Requests; requests[wireserver.JoinNetwork] != 1 || requests[wireserver.PublishNetworkContainer] != 2 {
+		t.Errorf("Unexpected wireserver requests %+v.", requests)
+	}
+
+	if unpublishResp := unpublishViaWireserver(t, "vnetSimPublish", "ncSimPublish"); unpublishResp.Response.ReturnCode != Success {
+		t.Fatalf("Unpublish failed with response %+v.", unpublishResp)
+	}
+
+	if _, ok := simulator.GetState().NetworkContainers["ncSimPublish"]; ok {
+		t.Errorf("Network container was not unpublished.")
+	}
+}
+
+func TestPublishFailuresViaWireserverSimulator(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	simulator.AddResponse(wireserver.Response{Operation: wireserver.JoinNetwork, StatusCode: http.StatusInternalServerError, Count: 1})
+	simulator.AddResponse(wireserver.Response{
+		Operation:  wireserver.PublishNetworkContainer,
+		StatusCode: http.StatusConflict,
+		Body:       `{"httpStatusCode":"409"}`,
+		Count:      1,
+	})
+
+	resp := publishViaWireserver(t, "vnetSimFailure", "ncSimFailure", "1")
+	if resp.Response.ReturnCode != NetworkJoinFailed {
+		t.Errorf("Publish with failed join returned %+v.", resp)
+	}
+
+	resp = publishViaWireserver(t, "vnetSimFailure", "ncSimFailure", "1")
+	if resp.Response.ReturnCode != NetworkContainerPublishFailed || resp.PublishStatusCode != http.StatusConflict ||
+		string(resp.PublishResponseBody) != `{"httpStatusCode":"409"}` {
+		t.Errorf("Failed publish returned %+v.", resp)
+	}
+
+	if resp = publishViaWireserver(t, "vnetSimFailure", "ncSimFailure", "1"); resp.Response.ReturnCode != Success {
+		t.Errorf("Publish after failures returned %+v.", resp)
+	}
+}
+
+func TestProgrammedVersionViaWireserverSimulator(t *testing.T) {
+	simulator, stop := startWireserverSimulator(t)
+	defer stop()
+
+	setOrchestratorType(t, cns.Kubernetes)
+
+	if err := creatOrUpdateNetworkContainerWithName(t, "ncSimVersion", "11.0.0.8", cns.AzureContainerInstance); err != nil {
+		t.Fatal(err)
+	}
+
+	defer deleteNetworkAdapterWithName(t, "ncSimVersion")
+
+	// Network containers not published to the host cannot be queried.
+	if resp := getNetworkContainerSyncStatus(t, "ncSimVersion"); resp.Response.ReturnCode != CallToHostFailed {
+		t.Errorf("Status of unpublished network container returned %+v.", resp)
+	}
+
+	simulator.SetProgrammingDelay(100 * time.Millisecond)
+	simulator.SetProgrammedVersion("ncSimVersion", "0")
+	if resp := publishViaWireserver(t, "vnetSimVersion", "ncSimVersion", "1"); resp.Response.ReturnCode != Success {
+		t.Fatalf("Publish failed with response %+v.", resp)
+	}
+
+	if resp := getNetworkContainerSyncStatus(t, "ncSimVersion"); resp.Response.ReturnCode != Success || resp.AzureHostVersion != "0" {
+		t.Errorf("Status before programming returned %+v.", resp)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if resp := getNetworkContainerSyncStatus(t, "ncSimVersion"); resp.AzureHostVersion != "1" {
+		t.Errorf("Status after programming returned %+v.", resp)
+	}
+
+	simulator.SetProgrammedVersion("ncSimVersion", "2")
+	if resp := getNetworkContainerSyncStatus(t, "ncSimVersion"); resp.AzureHostVersion != "2" {
+		t.Errorf("Status after version bump returned %+v.", resp)
+	}
+}
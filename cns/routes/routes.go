@@ -7,15 +7,6 @@ import (
 	"github.com/Azure/azure-container-networking/log"
 )
 
-// Route describes a single route in the routing table.
-type Route struct {
-	destination string
-	mask        string
-	gateway     string
-	metric      string
-	ifaceIndex  int
-}
-
 // RoutingTable describes the routing table on the node.
 type RoutingTable struct {
 	Routes []Route
@@ -5,12 +5,119 @@
 
 package routes
 
-const ()
+import (
+	"fmt"
+	"sort"
 
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+
+	"golang.org/x/sys/unix"
+)
+
+// Route describes a single route in the routing table.
+type Route struct {
+	netlink.Route
+}
+
+// Returns whether a route is saved in the routing table.
+// Routes of the local table and routes added by the kernel for interface addresses are
+// maintained by the kernel and are not saved.
+func isSavedRoute(route *netlink.Route) bool {
+	if route.Table == unix.RT_TABLE_LOCAL || route.Protocol == netlink.RTPROT_KERNEL {
+		return false
+	}
+
+	switch route.Type {
+	case unix.RTN_LOCAL, unix.RTN_BROADCAST, unix.RTN_ANYCAST, unix.RTN_MULTICAST:
+		return false
+	}
+
+	return true
+}
+
+// Returns the key identifying a route in a routing table.
+func (route *Route) key() string {
+	dst := "default"
+	if route.Dst != nil {
+		dst = route.Dst.String()
+	}
+
+	return fmt.Sprintf("%d/%d/%s/%v/%d/%d/%d/%d",
+		route.Family, route.Table, dst, route.Gw, route.LinkIndex, route.Priority, route.Tos, route.Type)
+}
+
+// getRoutes returns the routes of the main table and of the policy routing tables.
 func getRoutes() ([]Route, error) {
-	return nil, nil
+	log.Printf("[Azure CNS] getRoutes")
+
+	var routes []Route
+
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		nlRoutes, err := netlink.GetIpRoute(&netlink.Route{Family: family, Table: netlink.RT_TABLE_ALL})
+		if err != nil {
+			log.Printf("[Azure CNS] Failed to get routes of family %d, err:%v.", family, err)
+			return nil, err
+		}
+
+		for _, nlRoute := range nlRoutes {
+			if isSavedRoute(nlRoute) {
+				routes = append(routes, Route{Route: *nlRoute})
+			}
+		}
+	}
+
+	log.Debugf("[Azure CNS] Received route count: %d", len(routes))
+
+	return routes, nil
+}
+
+// getMissingRoutes returns the saved routes that are not in the current routes.
+func getMissingRoutes(savedRoutes []Route, currentRoutes []Route) []Route {
+	current := make(map[string]bool)
+	for i := range currentRoutes {
+		current[currentRoutes[i].key()] = true
+	}
+
+	var missing []Route
+	for i := range savedRoutes {
+		if !current[savedRoutes[i].key()] {
+			missing = append(missing, savedRoutes[i])
+		}
+	}
+
+	return missing
 }
 
+// putRoutes adds the saved routes missing from the routing table.
+// All missing routes are attempted, and the last failure is returned.
 func putRoutes(routes []Route) error {
-	return nil
+	log.Printf("[Azure CNS] putRoutes")
+
+	log.Printf("[Azure CNS] Going to get current routes")
+	currentRoutes, err := getRoutes()
+	if err != nil {
+		return err
+	}
+
+	// Routes without gateways are added first, as they may be needed to reach the gateways of other routes.
+	missingRoutes := getMissingRoutes(routes, currentRoutes)
+	sort.SliceStable(missingRoutes, func(i, j int) bool {
+		return missingRoutes[i].Gw == nil && missingRoutes[j].Gw != nil
+	})
+
+	for _, route := range missingRoutes {
+		nlRoute := route.Route
+
+		// Flags such as linkdown are reported by the kernel and cannot be set.
+		nlRoute.Flags = 0
+
+		log.Printf("[Azure CNS] Adding missing route: %+v", nlRoute)
+		if addErr := netlink.AddIpRoute(&nlRoute); addErr != nil {
+			log.Errorf("[Azure CNS] Failed to add route %+v, err:%v.", nlRoute, addErr)
+			err = addErr
+		}
+	}
+
+	return err
 }
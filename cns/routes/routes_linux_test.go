@@ -0,0 +1,178 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package routes
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netlink"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	testIfName      = "rttest"
+	testPeerName    = "rttest2"
+	testPolicyTable = 1000
+)
+
+// Moves the test into a new network namespace until the returned function is called.
+// The thread of the test is never unlocked so that the namespace is discarded with it when the test returns.
+func enterTestNamespace(t *testing.T) func() {
+	runtime.LockOSThread()
+
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		t.Skipf("Failed to create network namespace, err:%v.", err)
+	}
+
+	// Recycle the netlink socket for the new network namespace, and again for the next user.
+	netlink.ResetSocket()
+
+	return netlink.ResetSocket
+}
+
+// Adds a veth pair with an address in 10.10.0.0/24 to the current network namespace.
+func addTestInterface(t *testing.T) *net.Interface {
+	err := netlink.AddLink(&netlink.VEthLink{
+		LinkInfo: netlink.LinkInfo{
+			Type: netlink.LINK_TYPE_VETH,
+			Name: testIfName,
+		},
+		PeerName: testPeerName,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add interface, err:%v.", err)
+	}
+
+	for _, name := range []string{testIfName, testPeerName} {
+		if err = netlink.SetLinkState(name, true); err != nil {
+			t.Fatalf("Failed to set interface %v up, err:%v.", name, err)
+		}
+	}
+
+	ip, ipNet, _ := net.ParseCIDR("10.10.0.2/24")
+	if err = netlink.AddIpAddress(testIfName, ip, ipNet); err != nil {
+		t.Fatalf("Failed to add address, err:%v.", err)
+	}
+
+	iface, err := net.InterfaceByName(testIfName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return iface
+}
+
+// Returns a static IPv4 route to the given destination through the test gateway.
+func newTestRoute(dst string, table int, linkIndex int) *netlink.Route {
+	route := &netlink.Route{
+		Family:    unix.AF_INET,
+		Gw:        net.ParseIP("10.10.0.1").To4(),
+		Table:     table,
+		LinkIndex: linkIndex,
+	}
+
+	if dst != "" {
+		_, route.Dst, _ = net.ParseCIDR(dst)
+	}
+
+	return route
+}
+
+// Returns whether the routes contain a route to the given destination in the given table.
+func containsRoute(routes []Route, dst string, table int) bool {
+	for _, route := range routes {
+		if route.Table != table {
+			continue
+		}
+
+		if (dst == "" && route.Dst == nil) || (route.Dst != nil && route.Dst.String() == dst) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestRestoreMissingRoutes(t *testing.T) {
+	defer enterTestNamespace(t)()
+
+	iface := addTestInterface(t)
+
+	routes := []*netlink.Route{
+		newTestRoute("", unix.RT_TABLE_MAIN, iface.Index),
+		newTestRoute("192.168.5.0/24", unix.RT_TABLE_MAIN, iface.Index),
+		newTestRoute("172.16.0.0/16", testPolicyTable, iface.Index),
+	}
+
+	for _, route := range routes {
+		if err := netlink.AddIpRoute(route); err != nil {
+			t.Fatalf("Failed to add route %+v, err:%v.", route, err)
+		}
+	}
+
+	rt := &RoutingTable{}
+	if err := rt.GetRoutingTable(); err != nil {
+		t.Fatalf("Failed to get routing table, err:%v.", err)
+	}
+
+	if !containsRoute(rt.Routes, "", unix.RT_TABLE_MAIN) || !containsRoute(rt.Routes, "192.168.5.0/24", unix.RT_TABLE_MAIN) ||
+		!containsRoute(rt.Routes, "172.16.0.0/16", testPolicyTable) {
+		t.Fatalf("Routing table is missing routes: %+v.", rt.Routes)
+	}
+
+	// Routes maintained by the kernel are not saved.
+	if containsRoute(rt.Routes, "10.10.0.0/24", unix.RT_TABLE_MAIN) || containsRoute(rt.Routes, "10.10.0.2/32", unix.RT_TABLE_LOCAL) {
+		t.Errorf("Routing table contains kernel routes: %+v.", rt.Routes)
+	}
+
+	// Delete the default route and the policy route so that they go missing.
+	for _, route := range []*netlink.Route{routes[0], routes[2]} {
+		if err := netlink.DeleteIpRoute(route); err != nil {
+			t.Fatalf("Failed to delete route %+v, err:%v.", route, err)
+		}
+	}
+
+	// Only missing routes are restored, so existing routes do not fail the restore.
+	if err := rt.RestoreRoutingTable(); err != nil {
+		t.Fatalf("Failed to restore routing table, err:%v.", err)
+	}
+
+	current, err := getRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(current) != len(rt.Routes) || len(getMissingRoutes(rt.Routes, current)) != 0 {
+		t.Errorf("Restored routes %+v differ from saved routes %+v.", current, rt.Routes)
+	}
+
+	// Restoring again is a no-op.
+	if err = rt.RestoreRoutingTable(); err != nil {
+		t.Errorf("Restoring an intact routing table failed, err:%v.", err)
+	}
+}
+
+func TestGetMissingRoutes(t *testing.T) {
+	saved := []Route{
+		{Route: *newTestRoute("", unix.RT_TABLE_MAIN, 2)},
+		{Route: *newTestRoute("192.168.5.0/24", unix.RT_TABLE_MAIN, 2)},
+		{Route: *newTestRoute("192.168.5.0/24", testPolicyTable, 2)},
+	}
+
+	current := []Route{
+		{Route: *newTestRoute("", unix.RT_TABLE_MAIN, 2)},
+		{Route: *newTestRoute("192.168.5.0/24", unix.RT_TABLE_MAIN, 3)},
+		{Route: *newTestRoute("192.168.5.0/24", testPolicyTable, 2)},
+	}
+
+	missing := getMissingRoutes(saved, current)
+	if len(missing) != 1 || missing[0].Dst.String() != "192.168.5.0/24" || missing[0].LinkIndex != 2 || missing[0].Table != unix.RT_TABLE_MAIN {
+		t.Errorf("Unexpected missing routes %+v.", missing)
+	}
+}
@@ -19,6 +19,15 @@ const (
 	activeRoutesStart     = "Active Routes:"
 )
 
+// Route describes a single route in the routing table.
+type Route struct {
+	destination string
+	mask        string
+	gateway     string
+	metric      string
+	ifaceIndex  int
+}
+
 func getInterfaceByAddress(address string) (int, error) {
 	log.Printf("[Azure CNS] getInterfaceByAddress")
 
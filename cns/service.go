@@ -70,6 +70,15 @@ func (service *Service) Initialize(config *common.ServiceConfig) error {
 			return err
 		}
 
+		// Serve HTTPS if a certificate is configured.
+		if certFile, _ := service.GetOption(acn.OptTlsCertFile).(string); certFile != "" {
+			keyFile, _ := service.GetOption(acn.OptTlsKeyFile).(string)
+			clientCAFile, _ := service.GetOption(acn.OptTlsClientCAFile).(string)
+			if err = listener.EnableTLS(certFile, keyFile, clientCAFile); err != nil {
+				return err
+			}
+		}
+
 		// Start the listener.
 		err = listener.Start(config.ErrChan)
 		if err != nil {
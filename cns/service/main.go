@@ -110,6 +110,13 @@ var args = acn.ArgumentList{
 		Type:         "string",
 		DefaultValue: "",
 	},
+	{
+		Name:         acn.OptCnsMetricsPort,
+		Shorthand:    acn.OptCnsMetricsPortAlias,
+		Description:  "Serve metrics on this port instead of the CNS URL",
+		Type:         "int",
+		DefaultValue: "0",
+	},
 	{
 		Name:         acn.OptStartAzureCNM,
 		Shorthand:    acn.OptStartAzureCNMAlias,
@@ -166,6 +173,73 @@ var args = acn.ArgumentList{
 		Type:         "int",
 		DefaultValue: "120",
 	},
+	{
+		Name:         acn.OptTlsCertFile,
+		Shorthand:    acn.OptTlsCertFileAlias,
+		Description:  "Serve HTTPS with this certificate file",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         acn.OptTlsKeyFile,
+		Shorthand:    acn.OptTlsKeyFileAlias,
+		Description:  "Set the key file of the HTTPS certificate",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         acn.OptTlsClientCAFile,
+		Shorthand:    acn.OptTlsClientCAFileAlias,
+		Description:  "Require client certificates signed by a CA in this file",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         acn.OptNetworkContainerReconcileInterval,
+		Shorthand:    acn.OptNetworkContainerReconcileIntervalAlias,
+		Description:  "Set the interval in seconds between network container reconciliations, 0 to disable",
+		Type:         "int",
+		DefaultValue: "60",
+	},
+	{
+		Name:         acn.OptWireserverURL,
+		Shorthand:    acn.OptWireserverURLAlias,
+		Description:  "Send wireserver requests to this URL, such as a local wireserver simulator",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         acn.OptNMAgentRetryAttempts,
+		Shorthand:    acn.OptNMAgentRetryAttemptsAlias,
+		Description:  "Set the number of attempts of NMAgent requests failing with transient errors",
+		Type:         "int",
+		DefaultValue: "3",
+	},
+	{
+		Name:         acn.OptNMAgentRetryBackoff,
+		Shorthand:    acn.OptNMAgentRetryBackoffAlias,
+		Description:  "Set the initial backoff in milliseconds between attempts of NMAgent requests",
+		Type:         "int",
+		DefaultValue: "500",
+	},
+	{
+		Name:         acn.OptShutdownTimeout,
+		Shorthand:    acn.OptShutdownTimeoutAlias,
+		Description:  "Set the time in seconds to wait for requests in progress when shutting down",
+		Type:         "int",
+		DefaultValue: "30",
+	},
+	{
+		Name:         acn.OptStoreType,
+		Shorthand:    acn.OptStoreTypeAlias,
+		Description:  "Set the key value store backend",
+		Type:         "string",
+		DefaultValue: store.StoreTypeJsonFile,
+		ValueMap: map[string]interface{}{
+			store.StoreTypeJsonFile: 0,
+			store.StoreTypeBolt:     0,
+		},
+	},
 }
 
 // Prints description and version information.
@@ -184,6 +258,7 @@ func main() {
 	cniPath := acn.GetArg(acn.OptNetPluginPath).(string)
 	cniConfigFile := acn.GetArg(acn.OptNetPluginConfigFile).(string)
 	cnsURL := acn.GetArg(acn.OptCnsURL).(string)
+	cnsMetricsPort, _ := acn.GetArg(acn.OptCnsMetricsPort).(int)
 	logLevel := acn.GetArg(acn.OptLogLevel).(int)
 	logTarget := acn.GetArg(acn.OptLogTarget).(int)
 	logDirectory := acn.GetArg(acn.OptLogLocation).(string)
@@ -195,6 +270,15 @@ func main() {
 	telemetryEnabled := acn.GetArg(acn.OptTelemetry).(bool)
 	httpConnectionTimeout := acn.GetArg(acn.OptHttpConnectionTimeout).(int)
 	httpResponseHeaderTimeout := acn.GetArg(acn.OptHttpResponseHeaderTimeout).(int)
+	ncReconcileInterval := acn.GetArg(acn.OptNetworkContainerReconcileInterval).(int)
+	wireserverURL := acn.GetArg(acn.OptWireserverURL).(string)
+	nmagentRetryAttempts := acn.GetArg(acn.OptNMAgentRetryAttempts).(int)
+	nmagentRetryBackoff := acn.GetArg(acn.OptNMAgentRetryBackoff).(int)
+	shutdownTimeout := acn.GetArg(acn.OptShutdownTimeout).(int)
+	storeType := acn.GetArg(acn.OptStoreType).(string)
+	tlsCertFile := acn.GetArg(acn.OptTlsCertFile).(string)
+	tlsKeyFile := acn.GetArg(acn.OptTlsKeyFile).(string)
+	tlsClientCAFile := acn.GetArg(acn.OptTlsClientCAFile).(string)
 
 	if vers {
 		printVersion()
@@ -238,7 +322,7 @@ func main() {
 	}
 
 	// Create the key value store.
-	config.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + name + ".json")
+	config.Store, err = store.NewKeyValueStore(storeType, platform.CNMRuntimePath+name)
 	if err != nil {
 		log.Errorf("Failed to create store: %v\n", err)
 		return
@@ -253,11 +337,20 @@ func main() {
 
 	// Set CNS options.
 	httpRestService.SetOption(acn.OptCnsURL, cnsURL)
+	httpRestService.SetOption(acn.OptCnsMetricsPort, cnsMetricsPort)
 	httpRestService.SetOption(acn.OptNetPluginPath, cniPath)
 	httpRestService.SetOption(acn.OptNetPluginConfigFile, cniConfigFile)
 	httpRestService.SetOption(acn.OptCreateDefaultExtNetworkType, createDefaultExtNetworkType)
 	httpRestService.SetOption(acn.OptHttpConnectionTimeout, httpConnectionTimeout)
 	httpRestService.SetOption(acn.OptHttpResponseHeaderTimeout, httpResponseHeaderTimeout)
+	httpRestService.SetOption(acn.OptTlsCertFile, tlsCertFile)
+	httpRestService.SetOption(acn.OptTlsKeyFile, tlsKeyFile)
+	httpRestService.SetOption(acn.OptTlsClientCAFile, tlsClientCAFile)
+	httpRestService.SetOption(acn.OptNetworkContainerReconcileInterval, ncReconcileInterval)
+	httpRestService.SetOption(acn.OptWireserverURL, wireserverURL)
+	httpRestService.SetOption(acn.OptNMAgentRetryAttempts, nmagentRetryAttempts)
+	httpRestService.SetOption(acn.OptNMAgentRetryBackoff, nmagentRetryBackoff)
+	httpRestService.SetOption(acn.OptShutdownTimeout, shutdownTimeout)
 
 	// Create default ext network if commandline option is set
 	if len(strings.TrimSpace(createDefaultExtNetworkType)) > 0 {
@@ -291,6 +384,7 @@ func main() {
 	if startCNM {
 		var pluginConfig acn.PluginConfig
 		pluginConfig.Version = version
+		pluginConfig.StoreType = storeType
 
 		// Create a channel to receive unhandled errors from the plugins.
 		pluginConfig.ErrChan = make(chan error, 1)
@@ -310,7 +404,7 @@ func main() {
 		}
 
 		// Create the key value store.
-		pluginConfig.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + pluginName + ".json")
+		pluginConfig.Store, err = store.NewKeyValueStore(storeType, platform.CNMRuntimePath+pluginName)
 		if err != nil {
 			log.Errorf("Failed to create store: %v\n", err)
 			return
@@ -346,6 +440,11 @@ func main() {
 		log.Printf("CNS Received unhandled error %v, shutting down.", err)
 	}
 
+	// Complete requests in progress before cleaning up.
+	if httpRestService != nil {
+		httpRestService.Stop()
+	}
+
 	if len(strings.TrimSpace(createDefaultExtNetworkType)) > 0 {
 		if err := hnsclient.DeleteDefaultExtNetwork(); err == nil {
 			log.Printf("[Azure CNS] Successfully deleted default ext network")
@@ -354,11 +453,6 @@ func main() {
 		}
 	}
 
-	// Cleanup.
-	if httpRestService != nil {
-		httpRestService.Stop()
-	}
-
 	telemetryStopProcessing <- true
 
 	if startCNM {
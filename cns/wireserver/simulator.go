@@ -0,0 +1,461 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package wireserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// Wireserver operations served by the simulator.
+const (
+	GetInterfaceInfo           = "GetInterfaceInfo"
+	JoinNetwork                = "JoinNetwork"
+	PublishNetworkContainer    = "PublishNetworkContainer"
+	UnpublishNetworkContainer  = "UnpublishNetworkContainer"
+	GetNetworkContainerVersion = "GetNetworkContainerVersion"
+)
+
+// Paths of the simulator control API.
+const (
+	ResponsesPath = "/simulator/responses"
+	VersionsPath  = "/simulator/versions"
+	StatePath     = "/simulator/state"
+	ResetPath     = "/simulator/reset"
+)
+
+const (
+	pluginsPath          = "/machine/plugins"
+	networkManagement    = "NetworkManagement/"
+	interfaceInfoType    = "getinterfaceinfov1"
+	successResponseBody  = `{"httpStatusCode":"200"}`
+	notFoundResponseBody = `{"httpStatusCode":"404"}`
+)
+
+// Response is a scripted response to a wireserver operation.
+type Response struct {
+	Operation         string
+	StatusCode        int    // HTTP status code returned instead of the simulated one.
+	Body              string // Body returned instead of the simulated one.
+	DelayMilliseconds int    // Delay before the request is handled.
+	Count             int    // Number of requests the response applies to, all following requests if zero.
+}
+
+// Interface describes a VM interface returned to interface info requests.
+type Interface struct {
+	MacAddress  string
+	IsPrimary   bool
+	Subnet      string
+	IPAddresses []string // The first address is the primary address.
+}
+
+// NetworkContainer is the state of a network container published to the simulator.
+type NetworkContainer struct {
+	NetworkContainerID  string
+	InterfaceID         string
+	AuthenticationToken string
+	PublishedVersion    string
+	ProgrammedVersion   string
+	RequestBody         json.RawMessage
+}
+
+// VersionRequest sets the programmed version of a network container through the control API.
+type VersionRequest struct {
+	NetworkContainerID string
+	Version            string
+}
+
+// State is the state of the simulator returned by the control API.
+type State struct {
+	JoinedNetworks    []string
+	NetworkContainers map[string]NetworkContainer
+	Requests          map[string]int
+}
+
+// Simulator simulates the wireserver endpoints proxying to NMAgent that CNS depends on.
+type Simulator struct {
+	interfaces        []Interface
+	joinedNetworks    map[string]bool
+	networkContainers map[string]*NetworkContainer
+	responses         map[string][]*Response
+	requests          map[string]int
+	programmingDelay  time.Duration
+	sync.Mutex
+}
+
+// wireserver interface info XML document format.
+type xmlInterfaces struct {
+	XMLName   xml.Name       `xml:"Interfaces"`
+	Interface []xmlInterface `xml:"Interface"`
+}
+
+type xmlInterface struct {
+	MacAddress string        `xml:"MacAddress,attr"`
+	IsPrimary  bool          `xml:"IsPrimary,attr"`
+	IPSubnet   []xmlIPSubnet `xml:"IPSubnet"`
+}
+
+type xmlIPSubnet struct {
+	Prefix    string         `xml:"Prefix,attr"`
+	IPAddress []xmlIPAddress `xml:"IPAddress"`
+}
+
+type xmlIPAddress struct {
+	Address   string `xml:"Address,attr"`
+	IsPrimary bool   `xml:"IsPrimary,attr"`
+}
+
+// NewSimulator creates a new wireserver simulator with a primary interface in 10.0.0.0/16.
+func NewSimulator() *Simulator {
+	s := &Simulator{}
+	s.Reset()
+	return s
+}
+
+// Reset removes all state and scripted responses.
+func (s *Simulator) Reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.interfaces = []Interface{
+		{MacAddress: "000D3A000001", IsPrimary: true, Subnet: "10.0.0.0/16", IPAddresses: []string{"10.0.0.4"}},
+	}
+	s.joinedNetworks = make(map[string]bool)
+	s.networkContainers = make(map[string]*NetworkContainer)
+	s.responses = make(map[string][]*Response)
+	s.requests = make(map[string]int)
+	s.programmingDelay = 0
+}
+
+// SetInterfaces sets the interfaces returned to interface info requests.
+func (s *Simulator) SetInterfaces(interfaces []Interface) {
+	s.Lock()
+	s.interfaces = interfaces
+	s.Unlock()
+}
+
+// SetProgrammingDelay sets the time it takes for published network containers to be programmed.
+func (s *Simulator) SetProgrammingDelay(delay time.Duration) {
+	s.Lock()
+	s.programmingDelay = delay
+	s.Unlock()
+}
+
+// AddResponse scripts a response to the next requests for an operation.
+// Responses for the same operation are used in the order they were added.
+func (s *Simulator) AddResponse(resp Response) {
+	s.Lock()
+	s.responses[resp.Operation] = append(s.responses[resp.Operation], &resp)
+	s.Unlock()
+}
+
+// SetProgrammedVersion sets the version of a network container returned to programmed version requests.
+// Network containers that were not published are created.
+func (s *Simulator) SetProgrammedVersion(networkContainerID, version string) {
+	s.Lock()
+	defer s.Unlock()
+
+	nc, ok := s.networkContainers[networkContainerID]
+	if !ok {
+		nc = &NetworkContainer{NetworkContainerID: networkContainerID}
+		s.networkContainers[networkContainerID] = nc
+	}
+
+	nc.ProgrammedVersion = version
+}
+
+// GetState returns a copy of the state of the simulator.
+func (s *Simulator) GetState() State {
+	s.Lock()
+	defer s.Unlock()
+
+	state := State{
+		NetworkContainers: make(map[string]NetworkContainer),
+		Requests:          make(map[string]int),
+	}
+
+	for networkID := range s.joinedNetworks {
+		state.JoinedNetworks = append(state.JoinedNetworks, networkID)
+	}
+
+	for ncID, nc := range s.networkContainers {
+		state.NetworkContainers[ncID] = *nc
+	}
+
+	for operation, count := range s.requests {
+		state.Requests[operation] = count
+	}
+
+	return state
+}
+
+// ServeHTTP handles wireserver and control API requests.
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case ResponsesPath:
+		s.handleResponses(w, r)
+	case VersionsPath:
+		s.handleVersions(w, r)
+	case StatePath:
+		writeJSON(w, http.StatusOK, s.GetState())
+	case ResetPath:
+		s.Reset()
+		w.WriteHeader(http.StatusOK)
+	default:
+		if strings.TrimSuffix(r.URL.Path, "/") != pluginsPath || r.URL.Query().Get("comp") != "nmagent" {
+			http.NotFound(w, r)
+			return
+		}
+
+		s.handleNMAgent(w, r)
+	}
+}
+
+// Parses the NMAgent request type into its operation and path parameters.
+func parseRequestType(method, requestType string) (string, map[string]string) {
+	if requestType == interfaceInfoType {
+		return GetInterfaceInfo, nil
+	}
+
+	if !strings.HasPrefix(requestType, networkManagement) {
+		return "", nil
+	}
+
+	// Request types are a list of name/value pairs, such as interfaces/{id}/networkContainers/{id}/...
+	params := make(map[string]string)
+	segments := strings.Split(strings.TrimPrefix(requestType, networkManagement), "/")
+	for i := 0; i+1 < len(segments); i += 2 {
+		params[segments[i]] = segments[i+1]
+	}
+
+	switch {
+	case params["joinedVirtualNetworks"] != "":
+		return JoinNetwork, params
+	case params["networkContainers"] != "" && params["method"] == "DELETE":
+		return UnpublishNetworkContainer, params
+	case params["networkContainers"] != "" && method == http.MethodGet:
+		return GetNetworkContainerVersion, params
+	case params["networkContainers"] != "":
+		return PublishNetworkContainer, params
+	}
+
+	return "", nil
+}
+
+// Returns the scripted response to the next request for an operation, if any.
+func (s *Simulator) nextResponse(operation string) *Response {
+	queue := s.responses[operation]
+	if len(queue) == 0 {
+		return nil
+	}
+
+	resp := queue[0]
+	if resp.Count > 0 {
+		resp.Count--
+		if resp.Count == 0 {
+			s.responses[operation] = queue[1:]
+		}
+	}
+
+	return resp
+}
+
+// Handles requests proxied to NMAgent.
+func (s *Simulator) handleNMAgent(w http.ResponseWriter, r *http.Request) {
+	operation, params := parseRequestType(r.Method, r.URL.Query().Get("type"))
+	if operation == "" {
+		log.Printf("[wireserver] Unsupported request %v %v.", r.Method, r.URL)
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	s.requests[operation]++
+	scripted := s.nextResponse(operation)
+	s.Unlock()
+
+	log.Printf("[wireserver] %v %v.", operation, params)
+
+	if scripted != nil && scripted.DelayMilliseconds > 0 {
+		time.Sleep(time.Duration(scripted.DelayMilliseconds) * time.Millisecond)
+	}
+
+	// Scripted failures do not change the state.
+	if scripted != nil && scripted.StatusCode != 0 && scripted.StatusCode != http.StatusOK {
+		writeBody(w, scripted.StatusCode, "application/json", scripted.Body)
+		return
+	}
+
+	contentType := "application/json"
+	statusCode, respBody := http.StatusOK, successResponseBody
+
+	switch operation {
+	case GetInterfaceInfo:
+		contentType = "application/xml"
+		respBody = s.getInterfaceInfo()
+	case JoinNetwork:
+		s.Lock()
+		s.joinedNetworks[params["joinedVirtualNetworks"]] = true
+		s.Unlock()
+	case PublishNetworkContainer:
+		s.publish(params, body)
+	case UnpublishNetworkContainer:
+		s.Lock()
+		delete(s.networkContainers, params["networkContainers"])
+		s.Unlock()
+	case GetNetworkContainerVersion:
+		statusCode, respBody = s.getProgrammedVersion(params["networkContainers"])
+	}
+
+	if scripted != nil && scripted.Body != "" {
+		respBody = scripted.Body
+	}
+
+	writeBody(w, statusCode, contentType, respBody)
+}
+
+// Returns the interface info XML document.
+func (s *Simulator) getInterfaceInfo() string {
+	s.Lock()
+	defer s.Unlock()
+
+	var doc xmlInterfaces
+	for _, iface := range s.interfaces {
+		subnet := xmlIPSubnet{Prefix: iface.Subnet}
+		for i, address := range iface.IPAddresses {
+			subnet.IPAddress = append(subnet.IPAddress, xmlIPAddress{Address: address, IsPrimary: i == 0})
+		}
+
+		doc.Interface = append(doc.Interface, xmlInterface{
+			MacAddress: iface.MacAddress,
+			IsPrimary:  iface.IsPrimary,
+			IPSubnet:   []xmlIPSubnet{subnet},
+		})
+	}
+
+	output, _ := xml.Marshal(&doc)
+	return string(output)
+}
+
+// Records a published network container and programs it after the programming delay.
+// The programmed version is the version in the request body, if any.
+func (s *Simulator) publish(params map[string]string, body []byte) {
+	var request struct {
+		Version interface{} `json:"version"`
+	}
+
+	version := ""
+	if json.Unmarshal(body, &request) == nil && request.Version != nil {
+		version = fmt.Sprint(request.Version)
+	}
+
+	ncID := params["networkContainers"]
+
+	s.Lock()
+	defer s.Unlock()
+
+	nc, ok := s.networkContainers[ncID]
+	if !ok {
+		nc = &NetworkContainer{NetworkContainerID: ncID}
+		s.networkContainers[ncID] = nc
+	}
+
+	nc.InterfaceID = params["interfaces"]
+	nc.AuthenticationToken = params["authenticationToken"]
+	nc.PublishedVersion = version
+	if json.Valid(body) {
+		nc.RequestBody = json.RawMessage(body)
+	}
+
+	if s.programmingDelay == 0 {
+		nc.ProgrammedVersion = version
+		return
+	}
+
+	time.AfterFunc(s.programmingDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		// Skip network containers unpublished or republished in the meantime.
+		if current, ok := s.networkContainers[ncID]; ok && current == nc && nc.PublishedVersion == version {
+			nc.ProgrammedVersion = version
+		}
+	})
+}
+
+// Returns the programmed version response of a network container.
+// Until a published network container is programmed, its previous programmed version is returned.
+func (s *Simulator) getProgrammedVersion(ncID string) (int, string) {
+	s.Lock()
+	defer s.Unlock()
+
+	nc, ok := s.networkContainers[ncID]
+	if !ok {
+		return http.StatusNotFound, notFoundResponseBody
+	}
+
+	output, _ := json.Marshal(map[string]string{
+		"httpResponseCode":   "200",
+		"networkContainerId": ncID,
+		"version":            nc.ProgrammedVersion,
+	})
+
+	return http.StatusOK, string(output)
+}
+
+// Handles control API requests scripting responses.
+func (s *Simulator) handleResponses(w http.ResponseWriter, r *http.Request) {
+	var resp Response
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&resp) != nil || resp.Operation == "" {
+		http.Error(w, "Expected a POST with a response", http.StatusBadRequest)
+		return
+	}
+
+	s.AddResponse(resp)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Handles control API requests setting programmed versions.
+func (s *Simulator) handleVersions(w http.ResponseWriter, r *http.Request) {
+	var req VersionRequest
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil || req.NetworkContainerID == "" {
+		http.Error(w, "Expected a POST with a network container version", http.StatusBadRequest)
+		return
+	}
+
+	s.SetProgrammedVersion(req.NetworkContainerID, req.Version)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Writes a response body with the given status code.
+func writeBody(w http.ResponseWriter, statusCode int, contentType string, body string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write([]byte(body))
+}
+
+// Writes a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	output, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeBody(w, statusCode, "application/json", string(output))
+}
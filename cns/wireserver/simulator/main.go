@@ -0,0 +1,172 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Service name.
+	name = "azure-wireserver-simulator"
+
+	// Simulator options.
+	optListenURL             = "listen-url"
+	optListenURLAlias        = "u"
+	optScriptFile            = "script"
+	optScriptFileAlias       = "s"
+	optProgrammingDelay      = "programming-delay"
+	optProgrammingDelayAlias = "d"
+)
+
+// Version is populated by make during build.
+var version string
+
+// Command line arguments for the wireserver simulator.
+var args = acn.ArgumentList{
+	{
+		Name:         optListenURL,
+		Shorthand:    optListenURLAlias,
+		Description:  "Listen on this URL, pass its HTTP URL to CNS with --wireserver-url",
+		Type:         "string",
+		DefaultValue: "tcp://localhost:10091",
+	},
+	{
+		Name:         optScriptFile,
+		Shorthand:    optScriptFileAlias,
+		Description:  "Load a JSON list of scripted responses from this file",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         optProgrammingDelay,
+		Shorthand:    optProgrammingDelayAlias,
+		Description:  "Set the delay in milliseconds before published network containers are programmed",
+		Type:         "int",
+		DefaultValue: "0",
+	},
+	{
+		Name:         acn.OptLogLevel,
+		Shorthand:    acn.OptLogLevelAlias,
+		Description:  "Set the logging level",
+		Type:         "int",
+		DefaultValue: acn.OptLogLevelInfo,
+		ValueMap: map[string]interface{}{
+			acn.OptLogLevelInfo:  log.LevelInfo,
+			acn.OptLogLevelDebug: log.LevelDebug,
+		},
+	},
+	{
+		Name:         acn.OptVersion,
+		Shorthand:    acn.OptVersionAlias,
+		Description:  "Print version information",
+		Type:         "bool",
+		DefaultValue: false,
+	},
+}
+
+// Prints description and version information.
+func printVersion() {
+	fmt.Printf("Azure Wireserver Simulator\n")
+	fmt.Printf("Version %v\n", version)
+}
+
+// Loads scripted responses from a file.
+func loadScript(simulator *wireserver.Simulator, scriptFile string) error {
+	content, err := ioutil.ReadFile(scriptFile)
+	if err != nil {
+		return err
+	}
+
+	var responses []wireserver.Response
+	if err = json.Unmarshal(content, &responses); err != nil {
+		return err
+	}
+
+	for _, resp := range responses {
+		simulator.AddResponse(resp)
+	}
+
+	return nil
+}
+
+// Main is the entry point for the wireserver simulator.
+func main() {
+	// Initialize and parse command line arguments.
+	acn.ParseArgs(&args, printVersion)
+
+	listenURL := acn.GetArg(optListenURL).(string)
+	scriptFile := acn.GetArg(optScriptFile).(string)
+	programmingDelay := acn.GetArg(optProgrammingDelay).(int)
+	logLevel := acn.GetArg(acn.OptLogLevel).(int)
+	vers := acn.GetArg(acn.OptVersion).(bool)
+
+	if vers {
+		printVersion()
+		os.Exit(0)
+	}
+
+	log.SetName(name)
+	log.SetLevel(logLevel)
+	if err := log.SetTarget(log.TargetStderr); err != nil {
+		fmt.Printf("Failed to configure logging: %v\n", err)
+		return
+	}
+
+	simulator := wireserver.NewSimulator()
+	simulator.SetProgrammingDelay(time.Duration(programmingDelay) * time.Millisecond)
+
+	if scriptFile != "" {
+		if err := loadScript(simulator, scriptFile); err != nil {
+			log.Errorf("Failed to load script %v, err:%v.", scriptFile, err)
+			return
+		}
+	}
+
+	u, err := url.Parse(listenURL)
+	if err != nil {
+		log.Errorf("Invalid listen URL %v, err:%v.", listenURL, err)
+		return
+	}
+
+	listener, err := acn.NewListener(u)
+	if err != nil {
+		log.Errorf("Failed to create listener, err:%v.", err)
+		return
+	}
+
+	listener.AddHandler("/", simulator.ServeHTTP)
+
+	errChan := make(chan error, 1)
+	if err = listener.Start(errChan); err != nil {
+		log.Errorf("Failed to start listener, err:%v.", err)
+		return
+	}
+
+	// Relay these incoming signals to OS signal channel.
+	osSignalChannel := make(chan os.Signal, 1)
+	signal.Notify(osSignalChannel, os.Interrupt, syscall.SIGTERM)
+
+	// Wait until receiving a signal.
+	select {
+	case sig := <-osSignalChannel:
+		log.Printf("Wireserver simulator received OS signal <%v>, shutting down.", sig)
+	case err := <-errChan:
+		log.Printf("Wireserver simulator received unhandled error %v, shutting down.", err)
+	}
+
+	listener.Stop()
+	log.Close()
+}
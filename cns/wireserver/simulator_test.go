@@ -0,0 +1,183 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package wireserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	publishType   = "NetworkManagement/interfaces/10.0.0.4/networkContainers/nc1/authenticationToken/token1/api-version/1"
+	unpublishType = publishType + "/method/DELETE"
+	joinType      = "NetworkManagement/joinedVirtualNetworks/vnet1/api-version/1"
+)
+
+// Sends a request to the simulator and returns the status code and body of the response.
+func send(t *testing.T, server *httptest.Server, method, requestType string, body string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+"/machine/plugins/?comp=nmagent&type="+requestType, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v %v failed, err:%v.", method, requestType, err)
+	}
+
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(respBody)
+}
+
+// Returns the programmed version of a network container.
+func getVersion(t *testing.T, server *httptest.Server) string {
+	code, body := send(t, server, http.MethodGet, publishType, "")
+	if code != http.StatusOK {
+		t.Fatalf("Get version returned status %v.", code)
+	}
+
+	var resp struct {
+		NetworkContainerID string `json:"networkContainerId"`
+		Version            string `json:"version"`
+	}
+
+	if err := json.Unmarshal([]byte(body), &resp); err != nil || resp.NetworkContainerID != "nc1" {
+		t.Fatalf("Get version returned %v, err:%v.", body, err)
+	}
+
+	return resp.Version
+}
+
+func TestPublishAndProgrammedVersion(t *testing.T) {
+	simulator := NewSimulator()
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+
+	if code, _ := send(t, server, http.MethodGet, publishType, ""); code != http.StatusNotFound {
+		t.Errorf("Get version of unknown network container returned status %v.", code)
+	}
+
+	if code, _ := send(t, server, http.MethodPost, joinType, `""`); code != http.StatusOK {
+		t.Errorf("Join returned status %v.", code)
+	}
+
+	if code, _ := send(t, server, http.MethodPost, publishType, `{"version":"5"}`); code != http.StatusOK {
+		t.Errorf("Publish returned status %v.", code)
+	}
+
+	state := simulator.GetState()
+	nc := state.NetworkContainers["nc1"]
+	if len(state.JoinedNetworks) != 1 || state.JoinedNetworks[0] != "vnet1" ||
+		nc.InterfaceID != "10.0.0.4" || nc.AuthenticationToken != "token1" || nc.PublishedVersion != "5" {
+		t.Errorf("Unexpected state after publish %+v.", state)
+	}
+
+	if version := getVersion(t, server); version != "5" {
+		t.Errorf("Programmed version is %v after publish.", version)
+	}
+
+	simulator.SetProgrammedVersion("nc1", "6")
+	if version := getVersion(t, server); version != "6" {
+		t.Errorf("Programmed version is %v after bump.", version)
+	}
+
+	if code, _ := send(t, server, http.MethodPost, unpublishType, `""`); code != http.StatusOK {
+		t.Errorf("Unpublish returned status %v.", code)
+	}
+
+	if _, ok := simulator.GetState().NetworkContainers["nc1"]; ok {
+		t.Errorf("Network container exists after unpublish.")
+	}
+
+	if requests := simulator.GetState().Requests; requests[PublishNetworkContainer] != 1 || requests[GetNetworkContainerVersion] != 3 {
+		t.Errorf("Unexpected request counts %+v.", requests)
+	}
+}
+
+func TestProgrammingDelay(t *testing.T) {
+	simulator := NewSimulator()
+	simulator.SetProgrammingDelay(100 * time.Millisecond)
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+
+	simulator.SetProgrammedVersion("nc1", "1")
+	send(t, server, http.MethodPost, publishType, `{"version":2}`)
+
+	if version := getVersion(t, server); version != "1" {
+		t.Errorf("Programmed version is %v before programming.", version)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if version := getVersion(t, server); version != "2" {
+		t.Errorf("Programmed version is %v after programming.", version)
+	}
+}
+
+func TestScriptedResponses(t *testing.T) {
+	simulator := NewSimulator()
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+
+	// Scripted responses are added through the control API.
+	for _, resp := range []Response{
+		{Operation: JoinNetwork, StatusCode: http.StatusInternalServerError, Body: "failed", Count: 1},
+		{Operation: JoinNetwork, DelayMilliseconds: 100, Count: 1},
+	} {
+		body, _ := json.Marshal(resp)
+		r, err := http.Post(server.URL+ResponsesPath, "application/json", bytes.NewBuffer(body))
+		if err != nil || r.StatusCode != http.StatusOK {
+			t.Fatalf("Adding response failed with %+v, err:%v.", r, err)
+		}
+	}
+
+	code, body := send(t, server, http.MethodPost, joinType, `""`)
+	if code != http.StatusInternalServerError || body != "failed" || len(simulator.GetState().JoinedNetworks) != 0 {
+		t.Errorf("Scripted failure returned %v %v.", code, body)
+	}
+
+	start := time.Now()
+	if code, _ = send(t, server, http.MethodPost, joinType, `""`); code != http.StatusOK || time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Scripted delay returned %v after %v.", code, time.Since(start))
+	}
+
+	if code, _ = send(t, server, http.MethodPost, joinType, `""`); code != http.StatusOK {
+		t.Errorf("Join returned %v after scripted responses were used.", code)
+	}
+
+	if len(simulator.GetState().JoinedNetworks) != 1 {
+		t.Errorf("Network was not joined.")
+	}
+}
+
+func TestInterfaceInfo(t *testing.T) {
+	simulator := NewSimulator()
+	simulator.SetInterfaces([]Interface{
+		{MacAddress: "000D3A000002", IsPrimary: true, Subnet: "10.1.0.0/24", IPAddresses: []string{"10.1.0.4", "10.1.0.5"}},
+	})
+
+	server := httptest.NewServer(simulator)
+	defer server.Close()
+
+	code, body := send(t, server, http.MethodGet, interfaceInfoType, "")
+
+	var doc xmlInterfaces
+	if err := xml.Unmarshal([]byte(body), &doc); err != nil || code != http.StatusOK {
+		t.Fatalf("Interface info returned %v %v, err:%v.", code, body, err)
+	}
+
+	iface := doc.Interface[0]
+	if !iface.IsPrimary || iface.IPSubnet[0].Prefix != "10.1.0.0/24" || len(iface.IPSubnet[0].IPAddress) != 2 ||
+		!iface.IPSubnet[0].IPAddress[0].IsPrimary || iface.IPSubnet[0].IPAddress[1].IsPrimary {
+		t.Errorf("Unexpected interface info %v.", body)
+	}
+}
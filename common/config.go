@@ -17,6 +17,10 @@ const (
 	OptCnsURL            = "cns-url"
 	OptCnsURLAlias       = "c"
 
+	// Port serving CNS metrics separately from the CNS URL.
+	OptCnsMetricsPort      = "cns-metrics-port"
+	OptCnsMetricsPortAlias = "metricsport"
+
 	// Logging level.
 	OptLogLevel      = "log-level"
 	OptLogLevelAlias = "l"
@@ -44,6 +48,14 @@ const (
 	OptIpamQueryInterval      = "ipam-query-interval"
 	OptIpamQueryIntervalAlias = "i"
 
+	// IPAM address allocation strategy.
+	OptIpamAllocationStrategy      = "ipam-allocation-strategy"
+	OptIpamAllocationStrategyAlias = "ipamstrategy"
+
+	// IPAM quarantine period of released addresses, in seconds.
+	OptIpamQuarantinePeriod      = "ipam-quarantine-period"
+	OptIpamQuarantinePeriodAlias = "ipamquarantine"
+
 	// Start CNM
 	OptStartAzureCNM      = "start-azure-cnm"
 	OptStartAzureCNMAlias = "startcnm"
@@ -87,4 +99,36 @@ const (
 	// HTTP response header timeout
 	OptHttpResponseHeaderTimeout      = "http-response-header-timeout"
 	OptHttpResponseHeaderTimeoutAlias = "httprespheadertimeout"
+
+	// TLS server certificate and key files
+	OptTlsCertFile      = "tls-cert-file"
+	OptTlsCertFileAlias = "tlscert"
+	OptTlsKeyFile       = "tls-key-file"
+	OptTlsKeyFileAlias  = "tlskey"
+
+	// CA bundle verifying TLS client certificates
+	OptTlsClientCAFile      = "tls-client-ca-file"
+	OptTlsClientCAFileAlias = "tlsclientca"
+
+	// Interval in seconds between network container reconciliations
+	OptNetworkContainerReconcileInterval      = "nc-reconcile-interval"
+	OptNetworkContainerReconcileIntervalAlias = "ncreconcile"
+
+	// URL of the Azure wireserver, for running against a local simulator
+	OptWireserverURL      = "wireserver-url"
+	OptWireserverURLAlias = "wireserver"
+
+	// Retries of NMAgent requests, and initial backoff between them in milliseconds
+	OptNMAgentRetryAttempts      = "nmagent-retry-attempts"
+	OptNMAgentRetryAttemptsAlias = "nmagentretries"
+	OptNMAgentRetryBackoff       = "nmagent-retry-backoff"
+	OptNMAgentRetryBackoffAlias  = "nmagentbackoff"
+
+	// Time in seconds to wait for requests in progress when shutting down
+	OptShutdownTimeout      = "shutdown-timeout"
+	OptShutdownTimeoutAlias = "shutdowntimeout"
+
+	// Key value store backend
+	OptStoreType      = "store-type"
+	OptStoreTypeAlias = "st"
 )
@@ -4,6 +4,8 @@
 package common
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -23,6 +25,8 @@ type Listener struct {
 	active       bool
 	l            net.Listener
 	mux          *http.ServeMux
+	server       *http.Server
+	tlsConfig    *tls.Config
 }
 
 // NewListener creates a new Listener.
@@ -53,11 +57,21 @@ func (listener *Listener) Start(errChan chan error) error {
 		return err
 	}
 
-	log.Printf("[Listener] Started listening on %s.", listener.localAddress)
+	if listener.tlsConfig != nil {
+		listener.l = tls.NewListener(listener.l, listener.tlsConfig)
+		log.Printf("[Listener] Started listening with TLS on %s.", listener.localAddress)
+	} else {
+		log.Printf("[Listener] Started listening on %s.", listener.localAddress)
+	}
 
 	// Launch goroutine for servicing requests.
+	// Graceful shutdowns are not reported as errors.
+	server := &http.Server{Handler: listener.mux}
+	listener.server = server
 	go func() {
-		errChan <- http.Serve(listener.l, listener.mux)
+		if err := server.Serve(listener.l); err != http.ErrServerClosed {
+			errChan <- err
+		}
 	}()
 
 	listener.active = true
@@ -83,6 +97,44 @@ func (listener *Listener) Stop() {
 	log.Printf("[Listener] Stopped listening on %s", listener.localAddress)
 }
 
+// Shutdown stops listening for requests and waits for requests in progress to complete.
+// If the context expires first, the remaining connections are closed and the context error is returned.
+func (listener *Listener) Shutdown(ctx context.Context) error {
+	// Ignore if not active.
+	if !listener.active {
+		return nil
+	}
+	listener.active = false
+
+	err := listener.server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("[Listener] Requests in progress did not complete before shutdown: %v", err)
+		listener.server.Close()
+	}
+
+	// Delete the unix socket.
+	if listener.protocol == "unix" {
+		os.Remove(listener.localAddress)
+	}
+
+	log.Printf("[Listener] Shut down listening on %s", listener.localAddress)
+	return err
+}
+
+// EnableTLS configures the listener to serve HTTPS with the given certificate.
+// If a client CA file is given, clients must present a certificate signed by one of its CAs.
+// Must be called before the listener is started.
+func (listener *Listener) EnableTLS(certFile, keyFile, clientCAFile string) error {
+	config, err := NewServerTLSConfig(certFile, keyFile, clientCAFile)
+	if err != nil {
+		log.Printf("[Listener] Failed to configure TLS: %v", err)
+		return err
+	}
+
+	listener.tlsConfig = config
+	return nil
+}
+
 // GetMux returns the HTTP mux for the listener.
 func (listener *Listener) GetMux() *http.ServeMux {
 	return listener.mux
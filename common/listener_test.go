@@ -0,0 +1,64 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestListenerShutdownWaitsForRequests(t *testing.T) {
+	u, _ := url.Parse("tcp://localhost:0")
+	listener, err := NewListener(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entered := make(chan struct{})
+	listener.AddHandler("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	errChan := make(chan error, 1)
+	if err = listener.Start(errChan); err != nil {
+		t.Fatalf("Failed to start listener, err:%v.", err)
+	}
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.l.Addr().String() + "/slow")
+		results <- result{resp, err}
+	}()
+
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = listener.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed, err:%v.", err)
+	}
+
+	r := <-results
+	if r.err != nil || r.resp.StatusCode != http.StatusOK {
+		t.Fatalf("Request in progress during shutdown returned %+v, err:%v.", r.resp, r.err)
+	}
+	r.resp.Body.Close()
+
+	select {
+	case err = <-errChan:
+		t.Errorf("Shutdown was reported as error %v.", err)
+	default:
+	}
+}
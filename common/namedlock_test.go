@@ -0,0 +1,42 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package common
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNamedLockConcurrentAcquire(t *testing.T) {
+	namedLock := InitNamedLock()
+	counters := make([]int, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("lock%d", i%len(counters))
+			for j := 0; j < 100; j++ {
+				namedLock.LockAcquire(name)
+				counters[i%len(counters)]++
+				namedLock.LockRelease(name)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, count := range counters {
+		if count != 800 {
+			t.Errorf("Counter %d is %d, expected 800.", i, count)
+		}
+	}
+
+	if len(namedLock.lockMap) != 0 {
+		t.Errorf("Locks were not removed after release: %v.", namedLock.lockMap)
+	}
+}
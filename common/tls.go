@@ -0,0 +1,220 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// certificateReloader loads a certificate and reloads it when its files are modified.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	sync.Mutex
+}
+
+// caReloader loads a CA bundle and reloads it when its file is modified.
+type caReloader struct {
+	caFile  string
+	pool    *x509.CertPool
+	modTime time.Time
+	sync.Mutex
+}
+
+// Returns the latest modification time of the given files.
+func getModTime(files ...string) (time.Time, error) {
+	var modTime time.Time
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, err
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
+
+// Creates a new certificate reloader and loads the certificate.
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.getCertificate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Returns the certificate, reloading it if its files were modified.
+// The previous certificate is kept if the modified files cannot be loaded.
+func (r *certificateReloader) getCertificate() (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	modTime, err := getModTime(r.certFile, r.keyFile)
+	if err == nil && (r.cert == nil || modTime.After(r.modTime)) {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err == nil {
+			log.Printf("[tls] Loaded certificate %v.", r.certFile)
+			r.cert = &cert
+			r.modTime = modTime
+		}
+	}
+
+	if err != nil {
+		if r.cert == nil {
+			return nil, err
+		}
+
+		log.Printf("[tls] Failed to reload certificate %v, keeping the previous one, err:%v.", r.certFile, err)
+	}
+
+	return r.cert, nil
+}
+
+// Creates a new CA reloader and loads the CA bundle.
+func newCAReloader(caFile string) (*caReloader, error) {
+	r := &caReloader{caFile: caFile}
+	if _, err := r.getPool(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Returns the CA pool, reloading it if its file was modified.
+// The previous pool is kept if the modified file cannot be loaded.
+func (r *caReloader) getPool() (*x509.CertPool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	modTime, err := getModTime(r.caFile)
+	if err == nil && (r.pool == nil || modTime.After(r.modTime)) {
+		var pool *x509.CertPool
+		pool, err = loadCertPool(r.caFile)
+		if err == nil {
+			log.Printf("[tls] Loaded CA bundle %v.", r.caFile)
+			r.pool = pool
+			r.modTime = modTime
+		}
+	}
+
+	if err != nil {
+		if r.pool == nil {
+			return nil, err
+		}
+
+		log.Printf("[tls] Failed to reload CA bundle %v, keeping the previous one, err:%v.", r.caFile, err)
+	}
+
+	return r.pool, nil
+}
+
+// Loads a pool of certificates from a PEM file.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %v", caFile)
+	}
+
+	return pool, nil
+}
+
+// NewServerTLSConfig returns a TLS configuration serving the given certificate.
+// If a client CA file is given, clients must present a certificate signed by one of its CAs.
+// Modified certificate and CA files are reloaded for new connections without restarting the listener.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS requires both a certificate and a key file")
+	}
+
+	certs, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.getCertificate()
+		},
+	}
+
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	cas, err := newCAReloader(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Client CAs are not looked up per handshake, so a new configuration is returned for each client.
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := cas.getPool()
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{
+			MinVersion:     config.MinVersion,
+			GetCertificate: config.GetCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      pool,
+		}, nil
+	}
+
+	return config, nil
+}
+
+// NewClientTLSConfig returns a TLS configuration verifying servers against the given CA file.
+// The system CAs are used if no CA file is given. If a certificate and key file are given, they are
+// presented to servers requesting a client certificate and reloaded when modified.
+func NewClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		certs, err := newCertificateReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.getCertificate()
+		}
+	}
+
+	return config, nil
+}
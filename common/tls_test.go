@@ -0,0 +1,194 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate is a certificate and its key generated for testing.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// Creates a certificate with the given serial number, signed by the given CA or self-signed if none is given.
+func newTestCertificate(t *testing.T, serial int64, ca *testCertificate, usage x509.ExtKeyUsage) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key, err:%v.", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "acn-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Failed to create certificate, err:%v.", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &testCertificate{cert: cert, key: key, der: der}
+}
+
+// Writes the certificate and key to PEM files in the given directory and returns their paths.
+func (c *testCertificate) write(t *testing.T, dir, name string) (string, string) {
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key, err:%v.", err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certFile, keyFile
+}
+
+// Starts a TLS listener on a free local port and returns its HTTPS URL.
+func startTLSListener(t *testing.T, certFile, keyFile, clientCAFile string) (*Listener, string) {
+	u, _ := url.Parse("tcp://127.0.0.1:0")
+	listener, _ := NewListener(u)
+
+	if err := listener.EnableTLS(certFile, keyFile, clientCAFile); err != nil {
+		t.Fatalf("EnableTLS failed, err:%v.", err)
+	}
+
+	listener.AddHandler("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if err := listener.Start(make(chan error, 1)); err != nil {
+		t.Fatalf("Failed to start listener, err:%v.", err)
+	}
+
+	return listener, "https://" + listener.l.Addr().String() + "/test"
+}
+
+// Sends a request with a new connection and returns the serial number of the server certificate.
+func getServerSerial(url string, config *tls.Config) (int64, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+
+	resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestListenerRequiresClientCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "acn-tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, 1, nil, 0)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCertFile, serverKeyFile := newTestCertificate(t, 2, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	clientCertFile, clientKeyFile := newTestCertificate(t, 3, ca, x509.ExtKeyUsageClientAuth).write(t, dir, "client")
+
+	listener, url := startTLSListener(t, serverCertFile, serverKeyFile, caFile)
+	defer listener.Stop()
+
+	config, err := NewClientTLSConfig(caFile, clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatalf("NewClientTLSConfig failed, err:%v.", err)
+	}
+
+	if _, err = getServerSerial(url, config); err != nil {
+		t.Errorf("Request with client certificate failed, err:%v.", err)
+	}
+
+	config, _ = NewClientTLSConfig(caFile, "", "")
+	if _, err = getServerSerial(url, config); err == nil {
+		t.Errorf("Request without client certificate succeeded.")
+	}
+
+	// A client certificate signed by another CA is rejected.
+	otherCA := newTestCertificate(t, 4, nil, 0)
+	otherCertFile, otherKeyFile := newTestCertificate(t, 5, otherCA, x509.ExtKeyUsageClientAuth).write(t, dir, "other")
+	config, _ = NewClientTLSConfig(caFile, otherCertFile, otherKeyFile)
+	if _, err = getServerSerial(url, config); err == nil {
+		t.Errorf("Request with untrusted client certificate succeeded.")
+	}
+}
+
+func TestListenerReloadsCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "acn-tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, 1, nil, 0)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCertificate(t, 2, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	listener, url := startTLSListener(t, certFile, keyFile, "")
+	defer listener.Stop()
+
+	config, _ := NewClientTLSConfig(caFile, "", "")
+	if serial, err := getServerSerial(url, config); err != nil || serial != 2 {
+		t.Fatalf("Server presented serial %v, err:%v.", serial, err)
+	}
+
+	// A broken certificate file is ignored and the previous certificate is still served.
+	ioutil.WriteFile(certFile, []byte("invalid"), 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	if serial, err := getServerSerial(url, config); err != nil || serial != 2 {
+		t.Errorf("Server presented serial %v after invalid update, err:%v.", serial, err)
+	}
+
+	// A rotated certificate is served to new connections.
+	newTestCertificate(t, 6, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	if serial, err := getServerSerial(url, config); err != nil || serial != 6 {
+		t.Errorf("Server presented serial %v after rotation, err:%v.", serial, err)
+	}
+}
+
+func TestTLSConfigRequiresCertificateAndKey(t *testing.T) {
+	if _, err := NewServerTLSConfig("server.crt", "", ""); err == nil {
+		t.Errorf("NewServerTLSConfig without key file succeeded.")
+	}
+
+	if _, err := NewServerTLSConfig("/nonexistent.crt", "/nonexistent.key", ""); err == nil {
+		t.Errorf("NewServerTLSConfig with missing files succeeded.")
+	}
+}
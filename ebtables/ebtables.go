@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
 )
 
 const (
@@ -44,13 +45,23 @@ func SetSnatForInterface(interfaceName string, macAddress net.HardwareAddr, acti
 
 // SetArpReply sets an ARP reply rule for the given target IP address and MAC address.
 func SetArpReply(ipAddress net.IP, macAddress net.HardwareAddr, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -p ARP --arp-op Request --arp-ip-dst %s -j arpreply --arpreply-mac %s --arpreply-target DROP",
-		action, ipAddress, macAddress.String())
+	command := fmt.Sprintf("ebtables -t nat %s PREROUTING %s", action, arpReplyRule(ipAddress, macAddress))
 
 	return executeShellCommand(command)
 }
 
+// ArpReplyExists checks whether an ARP reply rule exists for the given target IP address and MAC address.
+func ArpReplyExists(ipAddress net.IP, macAddress net.HardwareAddr) (bool, error) {
+	return ruleExists("nat", "PREROUTING", arpReplyRule(ipAddress, macAddress))
+}
+
+// arpReplyRule returns the ARP reply rule specification for the given IP address and MAC address.
+func arpReplyRule(ipAddress net.IP, macAddress net.HardwareAddr) string {
+	return fmt.Sprintf(
+		"-p ARP --arp-op Request --arp-ip-dst %s -j arpreply --arpreply-mac %s --arpreply-target DROP",
+		ipAddress, macAddress.String())
+}
+
 // SetDnatForArpReplies sets a MAC DNAT rule for ARP replies received on an interface.
 func SetDnatForArpReplies(interfaceName string, action string) error {
 	command := fmt.Sprintf(
@@ -82,13 +93,46 @@ func SetVepaMode(bridgeName string, downstreamIfNamePrefix string, upstreamMacAd
 
 // SetDnatForIPAddress sets a MAC DNAT rule for an IP address.
 func SetDnatForIPAddress(interfaceName string, ipAddress net.IP, macAddress net.HardwareAddr, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -p IPv4 -i %s --ip-dst %s -j dnat --to-dst %s --dnat-target ACCEPT",
-		action, interfaceName, ipAddress.String(), macAddress.String())
+	command := fmt.Sprintf("ebtables -t nat %s PREROUTING %s", action, dnatForIPAddressRule(interfaceName, ipAddress, macAddress))
 
 	return executeShellCommand(command)
 }
 
+// DnatForIPAddressExists checks whether a MAC DNAT rule exists for an IP address.
+func DnatForIPAddressExists(interfaceName string, ipAddress net.IP, macAddress net.HardwareAddr) (bool, error) {
+	return ruleExists("nat", "PREROUTING", dnatForIPAddressRule(interfaceName, ipAddress, macAddress))
+}
+
+// dnatForIPAddressRule returns the MAC DNAT rule specification for an IP address.
+func dnatForIPAddressRule(interfaceName string, ipAddress net.IP, macAddress net.HardwareAddr) string {
+	protocol, dstOption := "IPv4", "--ip-dst"
+	if ipAddress.To4() == nil {
+		protocol, dstOption = "IPv6", "--ip6-dst"
+	}
+
+	return fmt.Sprintf(
+		"-p %s -i %s %s %s -j dnat --to-dst %s --dnat-target ACCEPT",
+		protocol, interfaceName, dstOption, ipAddress.String(), macAddress.String())
+}
+
+// ruleExists checks whether the given rule specification is present in a chain.
+// Rules are listed with two-digit MAC addresses to match the format of net.HardwareAddr.
+func ruleExists(tableName string, chainName string, rule string) (bool, error) {
+	command := fmt.Sprintf("ebtables -t %s -L %s --Lmac2", tableName, chainName)
+	out, err := platform.ExecuteCommand(command)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == rule {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func executeShellCommand(command string) error {
 	log.Debugf("[ebtables] %s", command)
 	cmd := exec.Command("sh", "-c", command)
@@ -0,0 +1,136 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"bytes"
+	"math/rand"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Address allocation strategies.
+	AllocationStrategySequential            = "sequential"
+	AllocationStrategyLeastRecentlyReleased = "lru"
+	AllocationStrategyRandom                = "random"
+
+	// Default address allocation strategy.
+	defaultAllocationStrategy = AllocationStrategyLeastRecentlyReleased
+)
+
+// AllocationStrategy selects the address returned for requests that do not ask for a specific address.
+type allocationStrategy interface {
+	selectAddress(ap *addressPool, now time.Time) *addressRecord
+}
+
+// SequentialStrategy returns the lowest available address in the pool.
+type sequentialStrategy struct{}
+
+// LeastRecentlyReleasedStrategy returns the available address that was released the longest time ago.
+// Addresses released less than the quarantine period ago are not returned.
+type leastRecentlyReleasedStrategy struct {
+	quarantine time.Duration
+}
+
+// RandomStrategy returns any available address in the pool.
+type randomStrategy struct {
+	rand *rand.Rand
+}
+
+// Creates a new allocation strategy with the given name.
+func newAllocationStrategy(name string, quarantine time.Duration) (allocationStrategy, error) {
+	if quarantine < 0 {
+		return nil, errInvalidConfiguration
+	}
+
+	switch name {
+	case AllocationStrategySequential:
+		return &sequentialStrategy{}, nil
+
+	case AllocationStrategyLeastRecentlyReleased, "":
+		return &leastRecentlyReleasedStrategy{quarantine: quarantine}, nil
+
+	case AllocationStrategyRandom:
+		return &randomStrategy{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+
+	default:
+		return nil, errInvalidStrategy
+	}
+}
+
+// Returns whether an address record can be handed out by an allocation strategy.
+func (ar *addressRecord) isAvailable() bool {
+	return !ar.InUse && ar.ID == ""
+}
+
+// Returns whether an address record sorts before another one by address.
+func (ar *addressRecord) isLowerThan(other *addressRecord) bool {
+	return bytes.Compare(ar.Addr.To16(), other.Addr.To16()) < 0
+}
+
+// Returns the lowest available address in the pool.
+func (s *sequentialStrategy) selectAddress(ap *addressPool, now time.Time) *addressRecord {
+	var selected *addressRecord
+
+	for _, ar := range ap.Addresses {
+		if !ar.isAvailable() {
+			continue
+		}
+
+		if selected == nil || ar.isLowerThan(selected) {
+			selected = ar
+		}
+	}
+
+	return selected
+}
+
+// Returns the least recently released address outside of the quarantine period.
+// Addresses that were never released are preferred, and ties are broken by address.
+func (s *leastRecentlyReleasedStrategy) selectAddress(ap *addressPool, now time.Time) *addressRecord {
+	var selected *addressRecord
+	var quarantined int
+
+	for _, ar := range ap.Addresses {
+		if !ar.isAvailable() {
+			continue
+		}
+
+		if !ar.ReleaseTime.IsZero() && now.Sub(ar.ReleaseTime) < s.quarantine {
+			quarantined++
+			continue
+		}
+
+		if selected == nil ||
+			ar.ReleaseTime.Before(selected.ReleaseTime) ||
+			(ar.ReleaseTime.Equal(selected.ReleaseTime) && ar.isLowerThan(selected)) {
+			selected = ar
+		}
+	}
+
+	if selected == nil && quarantined > 0 {
+		log.Printf("[ipam] All %d available addresses in pool %v are in quarantine.", quarantined, ap.Id)
+	}
+
+	return selected
+}
+
+// Returns a randomly selected available address in the pool.
+func (s *randomStrategy) selectAddress(ap *addressPool, now time.Time) *addressRecord {
+	var available []*addressRecord
+
+	for _, ar := range ap.Addresses {
+		if ar.isAvailable() {
+			available = append(available, ar)
+		}
+	}
+
+	if len(available) == 0 {
+		return nil
+	}
+
+	return available[s.rand.Intn(len(available))]
+}
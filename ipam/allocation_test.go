@@ -0,0 +1,214 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/common"
+)
+
+// createTestAddressPool creates an address pool with the given addresses.
+func createTestAddressPool(t *testing.T, addrs ...net.IP) *addressPool {
+	am := &addressManager{AddrSpaces: make(map[string]*addressSpace)}
+
+	as, err := am.newAddressSpace(LocalDefaultAddressSpaceId, LocalScope)
+	if err != nil {
+		t.Fatalf("newAddressSpace failed, err:%v.", err)
+	}
+
+	ap, err := as.newAddressPool(anyInterface, anyPriority, &subnet1)
+	if err != nil {
+		t.Fatalf("newAddressPool failed, err:%v.", err)
+	}
+
+	for i := range addrs {
+		if _, err = ap.newAddressRecord(&addrs[i]); err != nil {
+			t.Fatalf("newAddressRecord failed, err:%v.", err)
+		}
+	}
+
+	return ap
+}
+
+// requestTestAddress requests an address from the pool and returns it without its prefix length.
+func requestTestAddress(t *testing.T, ap *addressPool, strategy allocationStrategy) string {
+	address, err := ap.requestAddress("", nil, strategy)
+	if err != nil {
+		t.Fatalf("requestAddress failed, err:%v.", err)
+	}
+
+	addr, _, _ := net.ParseCIDR(address)
+	return addr.String()
+}
+
+// Tests the sequential strategy returns the lowest available address.
+func TestSequentialStrategyReturnsLowestAddress(t *testing.T) {
+	ap := createTestAddressPool(t, addr13, addr11, addr12)
+	strategy, _ := newAllocationStrategy(AllocationStrategySequential, 0)
+
+	for _, expected := range []net.IP{addr11, addr12, addr13} {
+		if addr := requestTestAddress(t, ap, strategy); addr != expected.String() {
+			t.Errorf("Sequential strategy returned %v, expected %v.", addr, expected)
+		}
+	}
+
+	if _, err := ap.requestAddress("", nil, strategy); err != errNoAvailableAddresses {
+		t.Errorf("Request from exhausted pool returned err:%v.", err)
+	}
+
+	// A released address is returned again if it is the lowest one.
+	ap.releaseAddress(addr12.String(), nil)
+	if addr := requestTestAddress(t, ap, strategy); addr != addr12.String() {
+		t.Errorf("Sequential strategy returned %v, expected %v.", addr, addr12)
+	}
+}
+
+// Tests the least recently released strategy returns addresses in release order.
+func TestLeastRecentlyReleasedStrategyReturnsOldestAddress(t *testing.T) {
+	ap := createTestAddressPool(t, addr11, addr12, addr13)
+	strategy, _ := newAllocationStrategy(AllocationStrategyLeastRecentlyReleased, 0)
+
+	// Addresses never released are returned first, in address order.
+	for _, expected := range []net.IP{addr11, addr12} {
+		if addr := requestTestAddress(t, ap, strategy); addr != expected.String() {
+			t.Errorf("LRU strategy returned %v, expected %v.", addr, expected)
+		}
+	}
+
+	// A just released address is not returned while an older one is available.
+	ap.releaseAddress(addr11.String(), nil)
+	if addr := requestTestAddress(t, ap, strategy); addr != addr13.String() {
+		t.Errorf("LRU strategy returned %v, expected %v.", addr, addr13)
+	}
+
+	// Release the other addresses and check they are returned in release order.
+	ap.requestAddress(addr11.String(), nil, strategy)
+	ap.releaseAddress(addr13.String(), nil)
+	ap.releaseAddress(addr12.String(), nil)
+	ap.Addresses[addr13.String()].ReleaseTime = time.Now().Add(-2 * time.Minute)
+	ap.Addresses[addr12.String()].ReleaseTime = time.Now().Add(-time.Minute)
+
+	for _, expected := range []net.IP{addr13, addr12} {
+		if addr := requestTestAddress(t, ap, strategy); addr != expected.String() {
+			t.Errorf("LRU strategy returned %v, expected %v.", addr, expected)
+		}
+	}
+}
+
+// Tests addresses in quarantine are not returned until the quarantine period expires.
+func TestLeastRecentlyReleasedStrategyQuarantinesAddresses(t *testing.T) {
+	ap := createTestAddressPool(t, addr11, addr12)
+	strategy, _ := newAllocationStrategy(AllocationStrategyLeastRecentlyReleased, time.Hour)
+
+	requestTestAddress(t, ap, strategy)
+	requestTestAddress(t, ap, strategy)
+
+	if err := ap.releaseAddress(addr11.String(), nil); err != nil {
+		t.Fatalf("releaseAddress failed, err:%v.", err)
+	}
+
+	ar := ap.Addresses[addr11.String()]
+	if ar.ReleaseTime.IsZero() {
+		t.Fatalf("Release time of %v was not recorded.", addr11)
+	}
+
+	// The only available address is in quarantine.
+	if _, err := ap.requestAddress("", nil, strategy); err != errNoAvailableAddresses {
+		t.Errorf("Address in quarantine was returned, err:%v.", err)
+	}
+
+	// Addresses in quarantine can still be requested specifically.
+	if _, err := ap.requestAddress(addr11.String(), nil, strategy); err != nil {
+		t.Errorf("Specific request for address in quarantine failed, err:%v.", err)
+	}
+
+	ap.releaseAddress(addr11.String(), nil)
+
+	// The address is returned after the quarantine period.
+	ar.ReleaseTime = time.Now().Add(-time.Hour)
+	if addr := requestTestAddress(t, ap, strategy); addr != addr11.String() {
+		t.Errorf("LRU strategy returned %v, expected %v.", addr, addr11)
+	}
+}
+
+// Tests the random strategy returns each available address exactly once.
+func TestRandomStrategyReturnsAvailableAddresses(t *testing.T) {
+	ap := createTestAddressPool(t, addr11, addr12, addr13)
+	strategy, _ := newAllocationStrategy(AllocationStrategyRandom, 0)
+
+	ap.requestAddress(addr12.String(), nil, strategy)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		seen[requestTestAddress(t, ap, strategy)] = true
+	}
+
+	if !seen[addr11.String()] || !seen[addr13.String()] {
+		t.Errorf("Random strategy returned %v, expected %v and %v.", seen, addr11, addr13)
+	}
+
+	if _, err := ap.requestAddress("", nil, strategy); err != errNoAvailableAddresses {
+		t.Errorf("Request from exhausted pool returned err:%v.", err)
+	}
+}
+
+// Tests allocation strategies are selected from options.
+func TestAllocationStrategyIsSelected(t *testing.T) {
+	am := &addressManager{AddrSpaces: make(map[string]*addressSpace)}
+
+	options := map[string]interface{}{
+		common.OptIpamAllocationStrategy: AllocationStrategySequential,
+	}
+
+	if err := am.StartSource(options); err != nil {
+		t.Fatalf("StartSource failed, err:%v.", err)
+	}
+
+	if _, ok := am.allocator.(*sequentialStrategy); !ok {
+		t.Errorf("Selected strategy %T, expected sequential.", am.allocator)
+	}
+
+	options = map[string]interface{}{
+		common.OptIpamQuarantinePeriod: 30,
+	}
+
+	if err := am.StartSource(options); err != nil {
+		t.Fatalf("StartSource failed, err:%v.", err)
+	}
+
+	if s, ok := am.allocator.(*leastRecentlyReleasedStrategy); !ok || s.quarantine != 30*time.Second {
+		t.Errorf("Selected strategy %+v, expected lru with quarantine.", am.allocator)
+	}
+
+	options[common.OptIpamAllocationStrategy] = "invalid"
+	if err := am.StartSource(options); err != errInvalidStrategy {
+		t.Errorf("Invalid strategy was accepted, err:%v.", err)
+	}
+}
+
+// Tests release times are persisted with address records.
+func TestAddressRecordReleaseTimeIsPersisted(t *testing.T) {
+	ap := createTestAddressPool(t, addr11)
+	ap.requestAddress(addr11.String(), nil, nil)
+	ap.releaseAddress(addr11.String(), nil)
+
+	data, err := json.Marshal(ap)
+	if err != nil {
+		t.Fatalf("Failed to marshal pool, err:%v.", err)
+	}
+
+	var restored addressPool
+	if err = json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal pool, err:%v.", err)
+	}
+
+	expected := ap.Addresses[addr11.String()].ReleaseTime
+	if actual := restored.Addresses[addr11.String()].ReleaseTime; !actual.Equal(expected) {
+		t.Errorf("Restored release time %v, expected %v.", actual, expected)
+	}
+}
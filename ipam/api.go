@@ -24,6 +24,7 @@ var (
 	errAddressInUse            = fmt.Errorf("Address already in use")
 	errAddressNotInUse         = fmt.Errorf("Address not in use")
 	errNoAvailableAddresses    = fmt.Errorf("No available addresses")
+	errInvalidStrategy         = fmt.Errorf("Invalid address allocation strategy")
 
 	// Options used by AddressManager.
 	OptInterfaceName      = "azure.interface.name"
@@ -16,8 +16,17 @@ import (
 const (
 	// IPAM store key.
 	storeKey = "IPAM"
+	// Schema version of the persisted address manager state.
+	schemaVersion = 2
 )
 
+func init() {
+	// Address spaces persisted before versioning load unchanged.
+	store.RegisterMigration(storeKey, 0, store.IdentityMigration)
+	// Version 2 added address release times. Records persisted before default to never released.
+	store.RegisterMigration(storeKey, 1, store.IdentityMigration)
+}
+
 // AddressManager manages the set of address spaces and pools allocated to containers.
 type addressManager struct {
 	Version    string
@@ -26,6 +35,7 @@ type addressManager struct {
 	store      store.KeyValueStore
 	source     addressConfigSource
 	netApi     common.NetApi
+	allocator  allocationStrategy
 	sync.Mutex
 }
 
@@ -45,6 +55,16 @@ type AddressManager interface {
 
 	RequestAddress(asId, poolId, address string, options map[string]string) (string, error)
 	ReleaseAddress(asId, poolId, address string, options map[string]string) error
+
+	Reconcile(liveIDs map[string]bool) ([]*ReleasedAddressInfo, error)
+}
+
+// ReleasedAddressInfo describes an address released by reconciliation.
+type ReleasedAddressInfo struct {
+	AsId    string
+	PoolId  string
+	Address string
+	ID      string
 }
 
 // AddressConfigSource configures the address pools managed by AddressManager.
@@ -64,6 +84,7 @@ type addressConfigSink interface {
 func NewAddressManager() (AddressManager, error) {
 	am := &addressManager{
 		AddrSpaces: make(map[string]*addressSpace),
+		allocator:  &leastRecentlyReleasedStrategy{},
 	}
 
 	return am, nil
@@ -115,7 +136,7 @@ func (am *addressManager) restore() error {
 	}
 
 	// Read any persisted state.
-	err = am.store.Read(storeKey, am)
+	err = store.ReadVersioned(am.store, storeKey, schemaVersion, am)
 	if err != nil {
 		if err == store.ErrKeyNotFound {
 			log.Printf("[ipam] store key not found")
@@ -170,7 +191,7 @@ func (am *addressManager) save() error {
 	// Update time stamp.
 	am.TimeStamp = time.Now()
 
-	err := am.store.Write(storeKey, am)
+	err := store.WriteVersioned(am.store, storeKey, schemaVersion, am)
 	if err == nil {
 		log.Printf("[ipam] Save succeeded.\n")
 	} else {
@@ -183,6 +204,15 @@ func (am *addressManager) save() error {
 func (am *addressManager) StartSource(options map[string]interface{}) error {
 	var err error
 
+	// Select the address allocation strategy.
+	strategy, _ := options[common.OptIpamAllocationStrategy].(string)
+	quarantine, _ := options[common.OptIpamQuarantinePeriod].(int)
+	am.allocator, err = newAllocationStrategy(strategy, time.Duration(quarantine)*time.Second)
+	if err != nil {
+		log.Printf("[ipam] Failed to select allocation strategy %v, err:%v.", strategy, err)
+		return err
+	}
+
 	environment, _ := options[common.OptEnvironment].(string)
 
 	switch environment {
@@ -346,7 +376,7 @@ func (am *addressManager) RequestAddress(asId, poolId, address string, options m
 		return "", err
 	}
 
-	addr, err := ap.requestAddress(address, options)
+	addr, err := ap.requestAddress(address, options, am.allocator)
 	if err != nil {
 		return "", err
 	}
@@ -388,3 +418,50 @@ func (am *addressManager) ReleaseAddress(asId string, poolId string, address str
 
 	return nil
 }
+
+// Reconcile releases the addresses reserved for identifiers that are not in the given set of live IDs.
+// Addresses reserved without an identifier cannot be reconciled and are left untouched.
+func (am *addressManager) Reconcile(liveIDs map[string]bool) ([]*ReleasedAddressInfo, error) {
+	released := make([]*ReleasedAddressInfo, 0)
+
+	am.Lock()
+	defer am.Unlock()
+
+	log.Printf("[ipam] Reconciling addresses with %d live IDs.", len(liveIDs))
+
+	for _, as := range am.AddrSpaces {
+		for _, ap := range as.Pools {
+			for _, ar := range ap.Addresses {
+				if !ar.InUse || ar.ID == "" || liveIDs[ar.ID] {
+					continue
+				}
+
+				info := &ReleasedAddressInfo{
+					AsId:    as.Id,
+					PoolId:  ap.Id,
+					Address: ar.Addr.String(),
+					ID:      ar.ID,
+				}
+
+				log.Printf("[ipam] Releasing orphaned address %+v.", *info)
+
+				err := ap.releaseAddress(info.Address, map[string]string{OptAddressID: info.ID})
+				if err != nil {
+					return released, err
+				}
+
+				released = append(released, info)
+			}
+		}
+	}
+
+	if len(released) > 0 {
+		if err := am.save(); err != nil {
+			return released, err
+		}
+	}
+
+	log.Printf("[ipam] Reconciliation released %d addresses.", len(released))
+
+	return released, nil
+}
@@ -203,17 +203,17 @@ func TestAddressSpaceUpdate(t *testing.T) {
 		t.Errorf("Cannot find subnet1, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr11.String(), nil)
+	_, err = ap.requestAddress(addr11.String(), nil, nil)
 	if err != nil {
 		t.Errorf("Cannot find addr11, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr12.String(), nil)
+	_, err = ap.requestAddress(addr12.String(), nil, nil)
 	if err == nil {
 		t.Errorf("Found addr12.")
 	}
 
-	_, err = ap.requestAddress(addr13.String(), nil)
+	_, err = ap.requestAddress(addr13.String(), nil, nil)
 	if err != nil {
 		t.Errorf("Cannot find addr13, err:%+v.", err)
 	}
@@ -230,12 +230,12 @@ func TestAddressSpaceUpdate(t *testing.T) {
 		t.Errorf("Cannot find subnet3, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr31.String(), nil)
+	_, err = ap.requestAddress(addr31.String(), nil, nil)
 	if err != nil {
 		t.Errorf("Cannot find addr31, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr32.String(), nil)
+	_, err = ap.requestAddress(addr32.String(), nil, nil)
 	if err == nil {
 		t.Errorf("Found addr32.")
 	}
@@ -371,3 +371,67 @@ func TestAddressRequestsFromTheSamePool(t *testing.T) {
 		t.Errorf("ReleasePool failed, err:%v", err)
 	}
 }
+
+// Tests reconciliation releases only the addresses of IDs that are no longer live.
+func TestReconcileReleasesOrphanedAddresses(t *testing.T) {
+	// Start with the test address space.
+	am, err := createAddressManager()
+	if err != nil {
+		t.Fatalf("createAddressManager failed, err:%+v.", err)
+	}
+
+	poolId, _, err := am.RequestPool(LocalDefaultAddressSpaceId, subnet1.String(), "", nil, false)
+	if err != nil {
+		t.Fatalf("RequestPool failed, err:%v", err)
+	}
+
+	// Reserve one address for a live ID and one for an orphaned ID.
+	addresses := make(map[string]string)
+	for _, id := range []string{"live", "orphaned"} {
+		address, err := am.RequestAddress(LocalDefaultAddressSpaceId, poolId, "", map[string]string{OptAddressID: id})
+		if err != nil {
+			t.Fatalf("RequestAddress failed, err:%v", err)
+		}
+
+		addr, _, _ := net.ParseCIDR(address)
+		addresses[id] = addr.String()
+	}
+
+	released, err := am.Reconcile(map[string]bool{"live": true})
+	if err != nil {
+		t.Fatalf("Reconcile failed, err:%v", err)
+	}
+
+	if len(released) != 1 || released[0].ID != "orphaned" || released[0].Address != addresses["orphaned"] {
+		t.Fatalf("Reconcile released %+v, expected only %v.", released, addresses["orphaned"])
+	}
+
+	if released[0].AsId != LocalDefaultAddressSpaceId || released[0].PoolId != poolId {
+		t.Errorf("Reconcile reported %+v in the wrong pool.", released[0])
+	}
+
+	info, err := am.GetPoolInfo(LocalDefaultAddressSpaceId, poolId)
+	if err != nil {
+		t.Fatalf("GetPoolInfo failed, err:%v", err)
+	}
+
+	if info.Available != 1 {
+		t.Errorf("Pool has %d available addresses after reconcile, expected 1.", info.Available)
+	}
+
+	// The live address is still reserved for its ID.
+	address, err := am.RequestAddress(LocalDefaultAddressSpaceId, poolId, "", map[string]string{OptAddressID: "live"})
+	if err != nil {
+		t.Fatalf("RequestAddress failed, err:%v", err)
+	}
+
+	if addr, _, _ := net.ParseCIDR(address); addr.String() != addresses["live"] {
+		t.Errorf("Live ID got address %v, expected %v.", addr, addresses["live"])
+	}
+
+	// A second reconcile has nothing left to release.
+	released, err = am.Reconcile(map[string]bool{"live": true})
+	if err != nil || len(released) != 0 {
+		t.Errorf("Second reconcile released %+v, err:%v.", released, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
@@ -66,6 +67,7 @@ type addressPool struct {
 
 // AddressPoolInfo contains information about an address pool.
 type AddressPoolInfo struct {
+	IfName         string
 	Subnet         net.IPNet
 	Gateway        net.IP
 	DnsServers     []net.IP
@@ -77,11 +79,12 @@ type AddressPoolInfo struct {
 
 // Represents an IP address in a pool.
 type addressRecord struct {
-	ID        string
-	Addr      net.IP
-	InUse     bool
-	unhealthy bool
-	epoch     int
+	ID          string
+	Addr        net.IP
+	InUse       bool
+	ReleaseTime time.Time
+	unhealthy   bool
+	epoch       int
 }
 
 //
@@ -406,6 +409,7 @@ func (ap *addressPool) getInfo() *AddressPoolInfo {
 	}
 
 	info := &AddressPoolInfo{
+		IfName:         ap.IfName,
 		Subnet:         ap.Subnet,
 		Gateway:        ap.Gateway,
 		DnsServers:     []net.IP{dnsHostProxyAddress},
@@ -447,7 +451,8 @@ func (ap *addressPool) newAddressRecord(addr *net.IP) (*addressRecord, error) {
 }
 
 // Requests a new address from the address pool.
-func (ap *addressPool) requestAddress(address string, options map[string]string) (string, error) {
+// Addresses not requested specifically are selected by the given allocation strategy.
+func (ap *addressPool) requestAddress(address string, options map[string]string, strategy allocationStrategy) (string, error) {
 	var ar *addressRecord
 	var addr *net.IPNet
 	var err error
@@ -481,27 +486,22 @@ func (ap *addressPool) requestAddress(address string, options map[string]string)
 		ar = ap.addrsByID[id]
 	}
 
-	// If no address was found, return any available address.
+	// If no address was found, return an available address selected by the allocation strategy.
 	if ar == nil {
-		for _, ar = range ap.Addresses {
-			if !ar.InUse && ar.ID == "" {
-				break
-			}
-			ar = nil
-		}
-
+		ar = strategy.selectAddress(ap, time.Now())
 		if ar == nil {
-			return "", errNoAvailableAddresses
+			err = errNoAvailableAddresses
+			return "", err
 		}
 	}
 
 	if id != "" {
 		ap.addrsByID[id] = ar
 		ar.ID = id
-	} else {
-		ar.InUse = true
 	}
 
+	ar.InUse = true
+
 	// Return address in CIDR notation.
 	addr = &net.IPNet{
 		IP:   ar.Addr,
@@ -552,8 +552,10 @@ func (ap *addressPool) releaseAddress(address string, options map[string]string)
 	}
 
 	ar.InUse = false
+	ar.ReleaseTime = time.Now()
 
-	if id != "" && ar.ID == id {
+	// Addresses released by address alone drop their identifier too.
+	if ar.ID != "" {
 		delete(ap.addrsByID, ar.ID)
 		ar.ID = ""
 	}
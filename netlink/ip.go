@@ -22,6 +22,9 @@ const (
 	RTPROT_KERNEL = 2
 )
 
+// RT_TABLE_ALL selects the routes of all tables when used in a route filter.
+const RT_TABLE_ALL = -1
+
 // GetIpAddressFamily returns the address family of an IP address.
 func GetIpAddressFamily(ip net.IP) int {
 	if len(ip) <= net.IPv4len {
@@ -51,8 +54,9 @@ func setIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet, add bool) e
 		msgType = unix.RTM_NEWADDR
 		flags = unix.NLM_F_CREATE | unix.NLM_F_EXCL | unix.NLM_F_ACK
 	} else {
+		// NLM_F_EXCL is not set on deletes as newer kernels interpret it as a bulk delete.
 		msgType = unix.RTM_DELADDR
-		flags = unix.NLM_F_EXCL | unix.NLM_F_ACK
+		flags = unix.NLM_F_ACK
 	}
 
 	req := newRequest(msgType, flags)
@@ -182,7 +186,7 @@ func GetIpRoute(filter *Route) ([]*Route, error) {
 
 		// Filter by table.
 		if (filter.Table == 0 && route.Table != unix.RT_TABLE_MAIN) ||
-			(filter.Table != 0 && filter.Table != route.Table) {
+			(filter.Table != 0 && filter.Table != RT_TABLE_ALL && filter.Table != route.Table) {
 			continue
 		}
 
@@ -233,15 +237,22 @@ func setIpRoute(route *Route, add bool) error {
 		msgType = unix.RTM_NEWROUTE
 		flags = unix.NLM_F_CREATE | unix.NLM_F_EXCL | unix.NLM_F_ACK
 	} else {
+		// NLM_F_EXCL is not set on deletes as newer kernels interpret it as a bulk delete.
 		msgType = unix.RTM_DELROUTE
-		flags = unix.NLM_F_EXCL | unix.NLM_F_ACK
+		flags = unix.NLM_F_ACK
 	}
 
 	req := newRequest(msgType, flags)
 
 	msg := newRtMsg(route.Family)
 	msg.Tos = uint8(route.Tos)
-	msg.Table = uint8(route.Table)
+
+	// Tables above 255 do not fit in the route message and are passed as an attribute.
+	if route.Table < 256 {
+		msg.Table = uint8(route.Table)
+	} else {
+		msg.Table = unix.RT_TABLE_UNSPEC
+	}
 
 	if route.Protocol != 0 {
 		msg.Protocol = uint8(route.Protocol)
@@ -285,6 +296,10 @@ func setIpRoute(route *Route, add bool) error {
 		req.addPayload(newAttributeUint32(unix.RTA_IIF, uint32(route.ILinkIndex)))
 	}
 
+	if route.Table >= 256 {
+		req.addPayload(newAttributeUint32(unix.RTA_TABLE, uint32(route.Table)))
+	}
+
 	return s.sendAndWaitForAck(req)
 }
 
@@ -19,6 +19,7 @@ const (
 	LINK_TYPE_VETH   = "veth"
 	LINK_TYPE_IPVLAN = "ipvlan"
 	LINK_TYPE_DUMMY  = "dummy"
+	LINK_TYPE_IFB    = "ifb"
 )
 
 // IPVLAN link attributes.
@@ -77,6 +78,11 @@ type DummyLink struct {
 	LinkInfo
 }
 
+// IFBLink represents an intermediate functional block network interface.
+type IFBLink struct {
+	LinkInfo
+}
+
 // AddLink adds a new network interface of a specified type.
 func AddLink(link Link) error {
 	var info *LinkInfo
@@ -412,15 +418,15 @@ func AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.Hardware
 		return err
 	}
 
+	family := GetIpAddressFamily(ipaddr)
 	msg := neighMsg{
-		Family: uint8(unix.AF_INET),
+		Family: uint8(family),
 		Index:  uint32(iface.Index),
 		State:  uint16(state),
 	}
 	req.addPayload(&msg)
 
-	ipData := ipaddr.To4()
-	dstData := newRtAttr(NDA_DST, ipData)
+	dstData := newRtAttr(NDA_DST, getNeighborAddress(family, ipaddr))
 	req.addPayload(dstData)
 
 	hwData := newRtAttr(NDA_LLADDR, []byte(mac))
@@ -428,3 +434,46 @@ func AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.Hardware
 
 	return s.sendAndWaitForAck(req)
 }
+
+// AddOrRemoveNeighborProxy sets/removes a proxy neighbor entry based on mode.
+// The kernel answers neighbor solicitations for proxied addresses on the interface.
+func AddOrRemoveNeighborProxy(mode int, name string, ipaddr net.IP) error {
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	var req *message
+	if mode == ADD {
+		req = newRequest(unix.RTM_NEWNEIGH, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	} else {
+		req = newRequest(unix.RTM_DELNEIGH, unix.NLM_F_ACK)
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	family := GetIpAddressFamily(ipaddr)
+	msg := neighMsg{
+		Family: uint8(family),
+		Index:  uint32(iface.Index),
+		Flags:  NTF_PROXY,
+	}
+	req.addPayload(&msg)
+
+	dstData := newRtAttr(NDA_DST, getNeighborAddress(family, ipaddr))
+	req.addPayload(dstData)
+
+	return s.sendAndWaitForAck(req)
+}
+
+// getNeighborAddress returns the neighbor address in the length of its family.
+func getNeighborAddress(family int, ipaddr net.IP) []byte {
+	if family == unix.AF_INET {
+		return ipaddr.To4()
+	}
+
+	return ipaddr.To16()
+}
@@ -19,4 +19,29 @@ var (
 	errMultipleEndpointsFound = fmt.Errorf("Multiple endpoints found")
 	errEndpointInUse          = fmt.Errorf("Endpoint is already joined to a sandbox")
 	errEndpointNotInUse       = fmt.Errorf("Endpoint is not joined to a sandbox")
+
+	// Divergences between an endpoint and the dataplane reported by CheckEndpoint.
+	ErrContainerInterfaceNotFound = fmt.Errorf("Container interface not found")
+	ErrContainerAddressNotFound   = fmt.Errorf("Container interface address not found")
+	ErrContainerRouteNotFound     = fmt.Errorf("Container route not found")
+	ErrHostInterfaceNotFound      = fmt.Errorf("Host interface not found")
+	ErrHostInterfaceNotAttached   = fmt.Errorf("Host interface is not attached to the bridge")
+	ErrHostRouteNotFound          = fmt.Errorf("Host route not found")
+	ErrEndpointRuleNotFound       = fmt.Errorf("Endpoint rule not found")
 )
+
+// CheckError describes a divergence between an endpoint and the dataplane.
+type CheckError struct {
+	Err    error
+	Detail string
+}
+
+// newCheckError creates a CheckError for the given divergence.
+func newCheckError(err error, format string, args ...interface{}) *CheckError {
+	return &CheckError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the description of the divergence.
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Err, e.Detail)
+}
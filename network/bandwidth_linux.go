@@ -0,0 +1,128 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+const (
+	// Prefix for ifb interface names redirecting container egress traffic.
+	ifbInterfacePrefix = commonInterfacePrefix + "b"
+
+	// Maximum time a packet may wait in a token bucket filter.
+	tbfLatency = "25ms"
+
+	// Handle of the ingress qdisc on the host interface.
+	ingressQdiscHandle = "ffff:"
+)
+
+var (
+	errInvalidBandwidth = fmt.Errorf("Invalid bandwidth limit")
+)
+
+// validateBandwidth returns an error if the given bandwidth limits cannot be programmed.
+func validateBandwidth(bw *BandwidthInfo) error {
+	if bw == nil {
+		return nil
+	}
+
+	if bw.IngressRate > 0 && bw.IngressBurst/8 == 0 {
+		return fmt.Errorf("%v: ingress burst %v is too small", errInvalidBandwidth, bw.IngressBurst)
+	}
+
+	if bw.EgressRate > 0 && bw.EgressBurst/8 == 0 {
+		return fmt.Errorf("%v: egress burst %v is too small", errInvalidBandwidth, bw.EgressBurst)
+	}
+
+	return nil
+}
+
+// getIfbName returns the name of the ifb interface for the given host interface.
+func getIfbName(hostIfName string) string {
+	return ifbInterfacePrefix + strings.TrimPrefix(hostIfName, hostVEthInterfacePrefix)
+}
+
+// tbfCommand returns the tc command adding a token bucket filter on the given interface.
+func tbfCommand(ifName string, rate uint64, burst uint64) string {
+	return fmt.Sprintf("tc qdisc add dev %s root tbf rate %dbit burst %db latency %s", ifName, rate, burst/8, tbfLatency)
+}
+
+// addBandwidth programs the bandwidth limits of the given endpoint.
+// Traffic to the container is shaped on the host interface.
+// Traffic from the container is redirected to an ifb interface and shaped there.
+func addBandwidth(ep *endpoint) error {
+	bw := ep.Bandwidth
+	if bw == nil {
+		return nil
+	}
+
+	if err := validateBandwidth(bw); err != nil {
+		return err
+	}
+
+	log.Printf("[net] Adding bandwidth limits %+v for endpoint %v.", *bw, ep.Id)
+
+	if bw.IngressRate > 0 {
+		if _, err := platform.ExecuteCommand(tbfCommand(ep.HostIfName, bw.IngressRate, bw.IngressBurst)); err != nil {
+			log.Printf("[net] Failed to add ingress shaping on %v, err:%v.", ep.HostIfName, err)
+			return err
+		}
+	}
+
+	if bw.EgressRate > 0 {
+		ifbName := getIfbName(ep.HostIfName)
+
+		link := netlink.IFBLink{
+			LinkInfo: netlink.LinkInfo{
+				Type:  netlink.LINK_TYPE_IFB,
+				Name:  ifbName,
+				Flags: net.FlagUp,
+			},
+		}
+
+		log.Printf("[net] Creating ifb interface %v.", ifbName)
+		if err := netlink.AddLink(&link); err != nil {
+			log.Printf("[net] Failed to create ifb interface %v, err:%v.", ifbName, err)
+			return err
+		}
+
+		cmds := []string{
+			fmt.Sprintf("tc qdisc add dev %s handle %s ingress", ep.HostIfName, ingressQdiscHandle),
+			fmt.Sprintf("tc filter add dev %s parent %s protocol all u32 match u32 0 0 action mirred egress redirect dev %s",
+				ep.HostIfName, ingressQdiscHandle, ifbName),
+			tbfCommand(ifbName, bw.EgressRate, bw.EgressBurst),
+		}
+
+		for _, cmd := range cmds {
+			if _, err := platform.ExecuteCommand(cmd); err != nil {
+				log.Printf("[net] Failed to add egress shaping for %v, err:%v.", ep.HostIfName, err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteBandwidth removes the bandwidth limits of the given endpoint.
+// Qdiscs on the host interface are removed along with the interface itself.
+func deleteBandwidth(ep *endpoint) {
+	if ep.Bandwidth == nil || ep.Bandwidth.EgressRate == 0 {
+		return
+	}
+
+	ifbName := getIfbName(ep.HostIfName)
+
+	log.Printf("[net] Deleting ifb interface %v.", ifbName)
+	if err := netlink.DeleteLink(ifbName); err != nil {
+		log.Printf("[net] Failed to delete ifb interface %v, err:%v.", ifbName, err)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"testing"
+)
+
+func TestValidateBandwidth(t *testing.T) {
+	testData := map[string]struct {
+		bw    *BandwidthInfo
+		valid bool
+	}{
+		"none":          {nil, true},
+		"ingress":       {&BandwidthInfo{IngressRate: 1000000, IngressBurst: 80000}, true},
+		"egress":        {&BandwidthInfo{EgressRate: 1000000, EgressBurst: 80000}, true},
+		"ingress burst": {&BandwidthInfo{IngressRate: 1000000, IngressBurst: 7}, false},
+		"egress burst":  {&BandwidthInfo{EgressRate: 1000000}, false},
+		"unused burst":  {&BandwidthInfo{IngressBurst: 80000}, true},
+	}
+
+	for name, test := range testData {
+		err := validateBandwidth(test.bw)
+		if test.valid && err != nil {
+			t.Errorf("Valid bandwidth %v was rejected: %v", name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("Invalid bandwidth %v was accepted", name)
+		}
+	}
+}
+
+func TestTbfCommand(t *testing.T) {
+	expected := "tc qdisc add dev azv1234 root tbf rate 1000000bit burst 10000b latency 25ms"
+
+	if cmd := tbfCommand("azv1234", 1000000, 80000); cmd != expected {
+		t.Errorf("Got tc command %v, expected %v", cmd, expected)
+	}
+}
+
+func TestGetIfbName(t *testing.T) {
+	if name := getIfbName("azv0123456789a"); name != "azb0123456789a" {
+		t.Errorf("Got ifb name %v", name)
+	}
+}
@@ -1,7 +1,10 @@
 package network
 
 import (
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/Azure/azure-container-networking/ebtables"
 	"github.com/Azure/azure-container-networking/log"
@@ -61,10 +64,22 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 	}
 
 	for _, ipAddr := range epInfo.IPAddresses {
-		// Add ARP reply rule.
-		log.Printf("[net] Adding ARP reply rule for IP address %v", ipAddr.String())
-		if err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(client.containerMac), ebtables.Append); err != nil {
-			return err
+		if ipAddr.IP.To4() != nil {
+			// Add ARP reply rule.
+			log.Printf("[net] Adding ARP reply rule for IP address %v", ipAddr.String())
+			if err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(client.containerMac), ebtables.Append); err != nil {
+				return err
+			}
+		} else {
+			// Add neighbor proxy entry, the IPv6 equivalent of the ARP reply rule.
+			log.Printf("[net] Adding neighbor proxy for IP address %v", ipAddr.String())
+			if err = setNdpProxy(client.bridgeName); err != nil {
+				return err
+			}
+
+			if err = netlink.AddOrRemoveNeighborProxy(netlink.ADD, client.bridgeName, ipAddr.IP); err != nil {
+				return err
+			}
 		}
 
 		// Add MAC address translation rule.
@@ -93,11 +108,21 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	// Delete rules for IP addresses on the container interface.
 	for _, ipAddr := range ep.IPAddresses {
-		// Delete ARP reply rule.
-		log.Printf("[net] Deleting ARP reply rule for IP address %v on %v.", ipAddr.String(), ep.Id)
-		err := ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(ep.MacAddress), ebtables.Delete)
-		if err != nil {
-			log.Printf("[net] Failed to delete ARP reply rule for IP address %v: %v.", ipAddr.String(), err)
+		var err error
+		if ipAddr.IP.To4() != nil {
+			// Delete ARP reply rule.
+			log.Printf("[net] Deleting ARP reply rule for IP address %v on %v.", ipAddr.String(), ep.Id)
+			err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(ep.MacAddress), ebtables.Delete)
+			if err != nil {
+				log.Printf("[net] Failed to delete ARP reply rule for IP address %v: %v.", ipAddr.String(), err)
+			}
+		} else {
+			// Delete neighbor proxy entry.
+			log.Printf("[net] Deleting neighbor proxy for IP address %v on %v.", ipAddr.String(), ep.Id)
+			err = netlink.AddOrRemoveNeighborProxy(netlink.REMOVE, client.bridgeName, ipAddr.IP)
+			if err != nil {
+				log.Printf("[net] Failed to delete neighbor proxy for IP address %v: %v.", ipAddr.String(), err)
+			}
 		}
 
 		// Delete MAC address translation rule.
@@ -117,6 +142,42 @@ func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	}
 }
 
+func (client *LinuxBridgeEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	master, err := getLinkMaster(client.hostVethName)
+	if err != nil || master != client.bridgeName {
+		return newCheckError(ErrHostInterfaceNotAttached, "%v master is %q, expected %v", client.hostVethName, master, client.bridgeName)
+	}
+
+	for _, ipAddr := range ep.IPAddresses {
+		if ipAddr.IP.To4() != nil {
+			arpReplyMac := client.getArpReplyAddress(ep.MacAddress)
+			if exists, err := ebtables.ArpReplyExists(ipAddr.IP, arpReplyMac); err != nil {
+				return err
+			} else if !exists {
+				return newCheckError(ErrEndpointRuleNotFound, "ebtables ARP reply for %v to %v", ipAddr.IP.String(), arpReplyMac.String())
+			}
+		}
+
+		if exists, err := ebtables.DnatForIPAddressExists(client.hostPrimaryIfName, ipAddr.IP, ep.MacAddress); err != nil {
+			return err
+		} else if !exists {
+			return newCheckError(ErrEndpointRuleNotFound, "ebtables MAC DNAT for %v to %v", ipAddr.IP.String(), ep.MacAddress.String())
+		}
+	}
+
+	return nil
+}
+
+// getLinkMaster returns the name of the master device the given interface is attached to.
+func getLinkMaster(ifName string) (string, error) {
+	master, err := os.Readlink(fmt.Sprintf("/sys/class/net/%s/master", ifName))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Base(master), nil
+}
+
 // getArpReplyAddress returns the MAC address to use in ARP replies.
 func (client *LinuxBridgeEndpointClient) getArpReplyAddress(epMacAddress net.HardwareAddr) net.HardwareAddr {
 	var macAddress net.HardwareAddr
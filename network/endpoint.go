@@ -38,10 +38,12 @@ type endpoint struct {
 	NetworkContainerID       string
 	NetworkNameSpace         string `json:",omitempty"`
 	ContainerID              string
-	PODName                  string `json:",omitempty"`
-	PODNameSpace             string `json:",omitempty"`
-	InfraVnetAddressSpace    string `json:",omitempty"`
-	NetNs                    string `json:",omitempty"`
+	PODName                  string               `json:",omitempty"`
+	PODNameSpace             string               `json:",omitempty"`
+	InfraVnetAddressSpace    string               `json:",omitempty"`
+	NetNs                    string               `json:",omitempty"`
+	PortMappings             []policy.PortMapping `json:",omitempty"`
+	Bandwidth                *BandwidthInfo       `json:",omitempty"`
 }
 
 // EndpointInfo contains read-only information about an endpoint.
@@ -71,6 +73,16 @@ type EndpointInfo struct {
 	Data                     map[string]interface{}
 	InfraVnetAddressSpace    string
 	SkipHotAttachEp          bool
+	Bandwidth                *BandwidthInfo
+}
+
+// BandwidthInfo contains the bandwidth limits of an endpoint.
+// Rates are in bits per second and bursts in bits.
+type BandwidthInfo struct {
+	IngressRate  uint64
+	IngressBurst uint64
+	EgressRate   uint64
+	EgressBurst  uint64
 }
 
 // RouteInfo contains information about an IP route.
@@ -139,6 +151,27 @@ func (nw *network) deleteEndpoint(endpointId string) error {
 	return nil
 }
 
+// CheckEndpoint verifies that the dataplane of an existing endpoint matches its persisted state.
+func (nw *network) checkEndpoint(endpointId string, netNsPath string, ifName string) error {
+	log.Printf("[net] Checking endpoint %v in network %v.", endpointId, nw.Id)
+
+	ep, err := nw.getEndpoint(endpointId)
+	if err != nil {
+		return err
+	}
+
+	// Call the platform implementation.
+	err = nw.checkEndpointImpl(ep, netNsPath, ifName)
+	if err != nil {
+		log.Printf("[net] Endpoint %v failed check, err:%v.", endpointId, err)
+		return err
+	}
+
+	log.Printf("[net] Checked endpoint %v.", endpointId)
+
+	return nil
+}
+
 // GetEndpoint returns the endpoint with the given ID.
 func (nw *network) getEndpoint(endpointId string) (*endpoint, error) {
 	log.Printf("Trying to retrieve endpoint id %v", endpointId)
@@ -205,12 +238,13 @@ func (ep *endpoint) getInfo() *EndpointInfo {
 		EnableMultiTenancy:       ep.EnableMultitenancy,
 		AllowInboundFromHostToNC: ep.AllowInboundFromHostToNC,
 		AllowInboundFromNCToHost: ep.AllowInboundFromNCToHost,
-		IfName:             ep.IfName,
-		ContainerID:        ep.ContainerID,
-		NetNsPath:          ep.NetworkNameSpace,
-		PODName:            ep.PODName,
-		PODNameSpace:       ep.PODNameSpace,
-		NetworkContainerID: ep.NetworkContainerID,
+		IfName:                   ep.IfName,
+		ContainerID:              ep.ContainerID,
+		NetNsPath:                ep.NetworkNameSpace,
+		PODName:                  ep.PODName,
+		PODNameSpace:             ep.PODNameSpace,
+		NetworkContainerID:       ep.NetworkContainerID,
+		Bandwidth:                ep.Bandwidth,
 	}
 
 	for _, route := range ep.Routes {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/policy"
 )
 
 const (
@@ -55,6 +56,7 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 	var localIP string
 	var epClient EndpointClient
 	var vlanid int = 0
+	var portMappings = policy.GetPortMappings(epInfo.Policies)
 
 	if nw.Endpoints[epInfo.Id] != nil {
 		log.Printf("[net] Endpoint alreday exists.")
@@ -62,6 +64,10 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		return nil, err
 	}
 
+	if err = validateBandwidth(epInfo.Bandwidth); err != nil {
+		return nil, err
+	}
+
 	if epInfo.Data != nil {
 		if _, ok := epInfo.Data[VlanIDKey]; ok {
 			vlanid = epInfo.Data[VlanIDKey].(int)
@@ -123,10 +129,14 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 				EnableMultitenancy:       epInfo.EnableMultiTenancy,
 				AllowInboundFromHostToNC: epInfo.AllowInboundFromHostToNC,
 				AllowInboundFromNCToHost: epInfo.AllowInboundFromNCToHost,
+				PortMappings:             portMappings,
+				Bandwidth:                epInfo.Bandwidth,
 			}
 
 			if containerIf != nil {
 				endpt.MacAddress = containerIf.HardwareAddr
+				deleteBandwidth(endpt)
+				deletePortMappings(endpt)
 				epClient.DeleteEndpointRules(endpt)
 			}
 
@@ -148,6 +158,22 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		return nil, err
 	}
 
+	// Setup port mappings while still in the host network namespace.
+	localnetIfName := hostIfName
+	if nw.Mode != opModeTransparent && vlanid == 0 {
+		localnetIfName = nw.extIf.BridgeName
+	}
+
+	err = addPortMappings(&endpoint{Id: epInfo.Id, IPAddresses: epInfo.IPAddresses, PortMappings: portMappings}, localnetIfName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup bandwidth limits on the host interface.
+	if err = addBandwidth(&endpoint{Id: epInfo.Id, HostIfName: hostIfName, Bandwidth: epInfo.Bandwidth}); err != nil {
+		return nil, err
+	}
+
 	// If a network namespace for the container interface is specified...
 	if epInfo.NetNsPath != "" {
 		// Open the network namespace.
@@ -209,6 +235,8 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
 		PODNameSpace:             epInfo.PODNameSpace,
+		PortMappings:             portMappings,
+		Bandwidth:                epInfo.Bandwidth,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -234,16 +262,157 @@ func (nw *network) deleteEndpointImpl(ep *endpoint) error {
 		epClient = NewTransparentEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode)
 	}
 
+	deleteBandwidth(ep)
+	deletePortMappings(ep)
 	epClient.DeleteEndpointRules(ep)
 	epClient.DeleteEndpoints(ep)
 
 	return nil
 }
 
+// checkEndpointImpl verifies that the host and container interfaces, addresses, routes and
+// rules of an existing endpoint are present in the dataplane.
+func (nw *network) checkEndpointImpl(ep *endpoint, netNsPath string, ifName string) error {
+	var epClient EndpointClient
+
+	if _, err := net.InterfaceByName(ep.HostIfName); err != nil {
+		return newCheckError(ErrHostInterfaceNotFound, "%v: %v", ep.HostIfName, err)
+	}
+
+	if ep.VlanID != 0 {
+		epInfo := ep.getInfo()
+		epClient = NewOVSEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP)
+	} else if nw.Mode != opModeTransparent {
+		epClient = NewLinuxBridgeEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode)
+	} else {
+		epClient = NewTransparentEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode)
+	}
+
+	if err := epClient.CheckEndpointRules(ep); err != nil {
+		return err
+	}
+
+	if err := checkPortMappings(ep); err != nil {
+		return err
+	}
+
+	// If a network namespace for the container interface is specified...
+	if netNsPath != "" {
+		log.Printf("[net] Opening netns %v.", netNsPath)
+		ns, err := OpenNamespace(netNsPath)
+		if err != nil {
+			return err
+		}
+		defer ns.Close()
+
+		// Enter the container network namespace.
+		log.Printf("[net] Entering netns %v.", netNsPath)
+		if err = ns.Enter(); err != nil {
+			return err
+		}
+
+		// Return to host network namespace.
+		defer func() {
+			log.Printf("[net] Exiting netns %v.", netNsPath)
+			if err := ns.Exit(); err != nil {
+				log.Printf("[net] Failed to exit netns, err:%v.", err)
+			}
+		}()
+	}
+
+	return checkContainerInterface(ifName, ep.IPAddresses, ep.Routes)
+}
+
+// checkContainerInterface verifies that the interface in the current namespace carries the given addresses and routes.
+func checkContainerInterface(ifName string, ipAddresses []net.IPNet, routes []RouteInfo) error {
+	containerIf, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return newCheckError(ErrContainerInterfaceNotFound, "%v: %v", ifName, err)
+	}
+
+	addrs, err := containerIf.Addrs()
+	if err != nil {
+		return err
+	}
+
+	for _, ipAddr := range ipAddresses {
+		found := false
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.String() == ipAddr.String() {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return newCheckError(ErrContainerAddressNotFound, "%v on %v", ipAddr.String(), ifName)
+		}
+	}
+
+	for _, route := range routes {
+		family := netlink.GetIpAddressFamily(route.Dst.IP)
+		ifRoutes, err := netlink.GetIpRoute(&netlink.Route{Family: family, LinkIndex: containerIf.Index})
+		if err != nil {
+			return err
+		}
+
+		if !routeExists(ifRoutes, route) {
+			return newCheckError(ErrContainerRouteNotFound, "%v via %v on %v", route.Dst.String(), route.Gw, ifName)
+		}
+	}
+
+	return nil
+}
+
+// routeExists checks whether the given route is in the list of netlink routes.
+func routeExists(routes []*netlink.Route, route RouteInfo) bool {
+	ones, bits := route.Dst.Mask.Size()
+
+	for _, r := range routes {
+		if r.Dst == nil {
+			// Netlink omits the destination of default routes.
+			if ones != 0 {
+				continue
+			}
+		} else {
+			rOnes, rBits := r.Dst.Mask.Size()
+			if !r.Dst.IP.Equal(route.Dst.IP) || rOnes != ones || rBits != bits {
+				continue
+			}
+		}
+
+		if route.Gw != nil && !route.Gw.Equal(r.Gw) {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
 // getInfoImpl returns information about the endpoint.
 func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
 }
 
+// getRouteFamily returns the address family of the given route.
+func getRouteFamily(route RouteInfo) int {
+	if route.Gw != nil {
+		return netlink.GetIpAddressFamily(route.Gw)
+	}
+
+	return netlink.GetIpAddressFamily(route.Dst.IP)
+}
+
+// getHostPrefix returns the single-address prefix of the given IP address.
+func getHostPrefix(ip net.IP) net.IPNet {
+	if ip.To4() != nil {
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+	}
+
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
 func addRoutes(interfaceName string, routes []RouteInfo) error {
 	ifIndex := 0
 	interfaceIf, _ := net.InterfaceByName(interfaceName)
@@ -259,7 +428,7 @@ func addRoutes(interfaceName string, routes []RouteInfo) error {
 		}
 
 		nlRoute := &netlink.Route{
-			Family:    netlink.GetIpAddressFamily(route.Gw),
+			Family:    getRouteFamily(route),
 			Dst:       &route.Dst,
 			Gw:        route.Gw,
 			LinkIndex: ifIndex,
@@ -302,7 +471,7 @@ func deleteRoutes(interfaceName string, routes []RouteInfo) error {
 		}
 
 		nlRoute := &netlink.Route{
-			Family:    netlink.GetIpAddressFamily(route.Gw),
+			Family:    getRouteFamily(route),
 			Dst:       &route.Dst,
 			Gw:        route.Gw,
 			LinkIndex: ifIndex,
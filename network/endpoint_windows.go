@@ -409,6 +409,28 @@ func (nw *network) deleteEndpointImplHnsV2(ep *endpoint) error {
 	return nil
 }
 
+// checkEndpointImpl verifies that the HNS endpoint of an existing endpoint still exists.
+// Container interfaces are managed by HNS, so netNsPath and ifName are not used.
+func (nw *network) checkEndpointImpl(ep *endpoint, netNsPath string, ifName string) error {
+	if useHnsV2, err := UseHnsV2(ep.NetNs); useHnsV2 {
+		if err != nil {
+			return err
+		}
+
+		if _, err = hcn.GetEndpointByID(ep.HnsId); err != nil {
+			return newCheckError(ErrHostInterfaceNotFound, "hcn endpoint %v: %v", ep.HnsId, err)
+		}
+
+		return nil
+	}
+
+	if _, err := hcsshim.GetHNSEndpointByID(ep.HnsId); err != nil {
+		return newCheckError(ErrHostInterfaceNotFound, "hns endpoint %v: %v", ep.HnsId, err)
+	}
+
+	return nil
+}
+
 // getInfoImpl returns information about the endpoint.
 func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
 	epInfo.Data["hnsid"] = ep.HnsId
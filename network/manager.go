@@ -15,9 +15,11 @@ import (
 
 const (
 	// Network store key.
-	storeKey    = "Network"
-	VlanIDKey   = "VlanID"
-	genericData = "com.docker.network.generic"
+	storeKey = "Network"
+	// Schema version of the persisted network manager state.
+	schemaVersion = 1
+	VlanIDKey     = "VlanID"
+	genericData   = "com.docker.network.generic"
 )
 
 type NetworkClient interface {
@@ -37,6 +39,7 @@ type EndpointClient interface {
 	SetupContainerInterfaces(epInfo *EndpointInfo) error
 	ConfigureContainerInterfacesAndRoutes(epInfo *EndpointInfo) error
 	DeleteEndpoints(ep *endpoint) error
+	CheckEndpointRules(ep *endpoint) error
 }
 
 // NetworkManager manages the set of container networking resources.
@@ -61,6 +64,7 @@ type NetworkManager interface {
 
 	CreateEndpoint(networkId string, epInfo *EndpointInfo) error
 	DeleteEndpoint(networkId string, endpointId string) error
+	CheckEndpoint(networkId string, endpointId string, netNsPath string, ifName string) error
 	GetEndpointInfo(networkId string, endpointId string) (*EndpointInfo, error)
 	GetEndpointInfoBasedOnPODDetails(networkId string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error)
 	AttachEndpoint(networkId string, endpointId string, sandboxKey string) (*endpoint, error)
@@ -69,6 +73,11 @@ type NetworkManager interface {
 	GetNumberOfEndpoints(ifName string, networkId string) int
 }
 
+func init() {
+	// External interfaces and networks persisted before versioning load unchanged.
+	store.RegisterMigration(storeKey, 0, store.IdentityMigration)
+}
+
 // Creates a new network manager.
 func NewNetworkManager() (NetworkManager, error) {
 	nm := &networkManager{
@@ -78,6 +87,27 @@ func NewNetworkManager() (NetworkManager, error) {
 	return nm, nil
 }
 
+// GetEndpointIDs returns the IDs of all endpoints in the network manager state persisted in the given store.
+// The state is only read, so no networks are restored or modified.
+func GetEndpointIDs(kvs store.KeyValueStore) (map[string]bool, error) {
+	nm := &networkManager{}
+
+	if err := store.ReadVersioned(kvs, storeKey, schemaVersion, nm); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			for _, ep := range nw.Endpoints {
+				ids[ep.Id] = true
+			}
+		}
+	}
+
+	return ids, nil
+}
+
 // Initialize configures network manager.
 func (nm *networkManager) Initialize(config *common.PluginConfig) error {
 	nm.Version = config.Version
@@ -105,7 +135,7 @@ func (nm *networkManager) restore() error {
 	// Ignore the persisted state if it is older than the last reboot time.
 
 	// Read any persisted state.
-	err := nm.store.Read(storeKey, nm)
+	err := store.ReadVersioned(nm.store, storeKey, schemaVersion, nm)
 	if err != nil {
 		if err == store.ErrKeyNotFound {
 			log.Printf("[net] network store key not found")
@@ -199,7 +229,7 @@ func (nm *networkManager) save() error {
 	// Update time stamp.
 	nm.TimeStamp = time.Now()
 
-	err := nm.store.Write(storeKey, nm)
+	err := store.WriteVersioned(nm.store, storeKey, schemaVersion, nm)
 	if err == nil {
 		log.Printf("[net] Save succeeded.\n")
 	} else {
@@ -349,6 +379,19 @@ func (nm *networkManager) DeleteEndpoint(networkId string, endpointId string) er
 	return nil
 }
 
+// CheckEndpoint verifies that the dataplane of the given endpoint matches its persisted state.
+func (nm *networkManager) CheckEndpoint(networkId string, endpointId string, netNsPath string, ifName string) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkId)
+	if err != nil {
+		return err
+	}
+
+	return nw.checkEndpoint(endpointId, netNsPath, ifName)
+}
+
 // GetEndpointInfo returns information about the given endpoint.
 func (nm *networkManager) GetEndpointInfo(networkId string, endpointId string) (*EndpointInfo, error) {
 	nm.Lock()
@@ -0,0 +1,61 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/store"
+)
+
+// Tests endpoint IDs are read from a persisted network manager state.
+func TestGetEndpointIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvs, err := store.NewJsonFileStore(filepath.Join(dir, "azure-vnet.json"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if _, err = GetEndpointIDs(kvs); err != store.ErrKeyNotFound {
+		t.Errorf("Reading an empty store returned err:%v.", err)
+	}
+
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{
+			"eth0": {
+				Name: "eth0",
+				Networks: map[string]*network{
+					"azure": {
+						Id: "azure",
+						Endpoints: map[string]*endpoint{
+							"12345678-eth0": {Id: "12345678-eth0"},
+							"abcdefgh-eth0": {Id: "abcdefgh-eth0"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err = store.WriteVersioned(kvs, storeKey, schemaVersion, nm); err != nil {
+		t.Fatalf("Failed to write network state: %v", err)
+	}
+
+	ids, err := GetEndpointIDs(kvs)
+	if err != nil {
+		t.Fatalf("GetEndpointIDs failed: %v", err)
+	}
+
+	if len(ids) != 2 || !ids["12345678-eth0"] || !ids["abcdefgh-eth0"] {
+		t.Errorf("GetEndpointIDs returned %v.", ids)
+	}
+}
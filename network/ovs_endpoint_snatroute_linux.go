@@ -3,6 +3,7 @@ package network
 import (
 	"fmt"
 
+	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network/epcommon"
 	"github.com/Azure/azure-container-networking/network/ovssnat"
 )
@@ -102,3 +103,15 @@ func DeleteSnatEndpointRules(client *OVSEndpointClient) {
 		client.snatClient.DeleteInboundFromNCToHost()
 	}
 }
+
+func CheckSnatEndpointRules(client *OVSEndpointClient) error {
+	if client.allowInboundFromHostToNC && !client.snatClient.InboundFromHostToNCRuleExists() {
+		return newCheckError(ErrEndpointRuleNotFound, "iptables rule allowing host to NC in %v", iptables.CNIOutputChain)
+	}
+
+	if client.allowInboundFromNCToHost && !client.snatClient.InboundFromNCToHostRuleExists() {
+		return newCheckError(ErrEndpointRuleNotFound, "iptables rule allowing NC to host in %v", iptables.CNIInputChain)
+	}
+
+	return nil
+}
@@ -168,6 +168,14 @@ func (client *OVSEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	DeleteInfraVnetEndpointRules(client, ep, hostPort)
 }
 
+func (client *OVSEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	if _, err := ovsctl.GetOVSPortNumber(client.hostVethName); err != nil {
+		return newCheckError(ErrHostInterfaceNotAttached, "%v is not a port of %v: %v", client.hostVethName, client.bridgeName, err)
+	}
+
+	return CheckSnatEndpointRules(client)
+}
+
 func (client *OVSEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
 	// Move the container interface to container's network namespace.
 	log.Printf("[ovs] Setting link %v netns %v.", client.containerVethName, epInfo.NetNsPath)
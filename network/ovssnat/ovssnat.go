@@ -290,6 +290,22 @@ func (client *OVSSnatClient) DeleteInboundFromNCToHost() error {
 	return err
 }
 
+// InboundFromHostToNCRuleExists checks whether the rule allowing host to NC communication is programmed.
+func (client *OVSSnatClient) InboundFromHostToNCRuleExists() bool {
+	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
+	matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
+
+	return iptables.RuleExists(iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
+}
+
+// InboundFromNCToHostRuleExists checks whether the rule allowing NC to host communication is programmed.
+func (client *OVSSnatClient) InboundFromNCToHostRuleExists() bool {
+	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
+	matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
+
+	return iptables.RuleExists(iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
+}
+
 /**
 	Configures Local IP Address for container Veth
 **/
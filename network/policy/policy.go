@@ -18,3 +18,32 @@ type Policy struct {
 	Type CNIPolicyType
 	Data json.RawMessage
 }
+
+// PortMapping is the data of a port mapping endpoint policy.
+type PortMapping struct {
+	Type         CNIPolicyType `json:"Type"`
+	ExternalPort uint16        `json:"ExternalPort"`
+	InternalPort uint16        `json:"InternalPort"`
+	Protocol     string        `json:"Protocol"`
+	HostIP       string        `json:"HostIP,omitempty"`
+}
+
+// GetPortMappings returns the port mappings contained in the given endpoint policies.
+func GetPortMappings(policies []Policy) []PortMapping {
+	var portMappings []PortMapping
+
+	for _, policy := range policies {
+		if policy.Type != EndpointPolicy {
+			continue
+		}
+
+		var portMapping PortMapping
+		if err := json.Unmarshal(policy.Data, &portMapping); err != nil || portMapping.Type != PortMappingPolicy {
+			continue
+		}
+
+		portMappings = append(portMappings, portMapping)
+	}
+
+	return portMappings
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+const (
+	// Chain in the nat table holding the DNAT rules of all port mappings.
+	hostPortChain = "AZURECNIHOSTPORT"
+
+	// Chain in the nat table holding the SNAT rules of all port mappings.
+	hostPortSnatChain = "AZURECNIHOSTPORTSNAT"
+
+	// Source address of connections to host ports from the host itself.
+	localhostAddress = "127.0.0.1"
+)
+
+// Protocols supported by port mappings.
+var portMappingProtocols = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"sctp": true,
+}
+
+// iptablesRule is an iptables rule programmed for a port mapping.
+type iptablesRule struct {
+	table  string
+	chain  string
+	match  string
+	target string
+}
+
+// hostPortJumpRules returns the rules sending traffic to the port mapping chains.
+func hostPortJumpRules() []iptablesRule {
+	localDst := "-m addrtype --dst-type LOCAL"
+
+	return []iptablesRule{
+		{iptables.Nat, iptables.Prerouting, localDst, hostPortChain},
+		{iptables.Nat, iptables.Output, localDst, hostPortChain},
+		{iptables.Nat, iptables.Postrouting, "", hostPortSnatChain},
+	}
+}
+
+// portMappingRules returns the rules implementing the port mappings of the given endpoint.
+func portMappingRules(ep *endpoint) ([]iptablesRule, error) {
+	var rules []iptablesRule
+
+	if len(ep.PortMappings) == 0 {
+		return nil, nil
+	}
+
+	// Port mappings are forwarded to the first IPv4 address of the endpoint.
+	var containerIP net.IP
+	for _, ipAddr := range ep.IPAddresses {
+		if ipAddr.IP.To4() != nil {
+			containerIP = ipAddr.IP.To4()
+			break
+		}
+	}
+
+	if containerIP == nil {
+		return nil, fmt.Errorf("Endpoint %v has no IPv4 address for port mappings", ep.Id)
+	}
+
+	for _, pm := range ep.PortMappings {
+		protocol := strings.ToLower(pm.Protocol)
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		if !portMappingProtocols[protocol] {
+			return nil, fmt.Errorf("Unsupported port mapping protocol %v", pm.Protocol)
+		}
+
+		dnatMatch := fmt.Sprintf("-p %s --dport %d", protocol, pm.ExternalPort)
+		if pm.HostIP != "" {
+			hostIP := net.ParseIP(pm.HostIP)
+			if hostIP == nil || hostIP.To4() == nil {
+				return nil, fmt.Errorf("Unsupported port mapping host IP %v", pm.HostIP)
+			}
+
+			if !hostIP.IsUnspecified() {
+				dnatMatch = fmt.Sprintf("-d %s/32 %s", hostIP, dnatMatch)
+			}
+		}
+
+		containerDst := fmt.Sprintf("-d %s/32 -p %s --dport %d", containerIP, protocol, pm.InternalPort)
+
+		rules = append(rules,
+			// Forward traffic to the host port to the container port.
+			iptablesRule{
+				iptables.Nat, hostPortChain, dnatMatch,
+				fmt.Sprintf("DNAT --to-destination %s:%d", containerIP, pm.InternalPort),
+			},
+			// Hairpin traffic from the container to its own host port.
+			iptablesRule{
+				iptables.Nat, hostPortSnatChain,
+				fmt.Sprintf("-s %s/32 %s", containerIP, containerDst), iptables.Masquerade,
+			},
+			// Traffic from the host to the host port on localhost.
+			iptablesRule{
+				iptables.Nat, hostPortSnatChain,
+				fmt.Sprintf("-s %s/32 %s", localhostAddress, containerDst), iptables.Masquerade,
+			})
+	}
+
+	return rules, nil
+}
+
+// addPortMappings programs the port mappings of the given endpoint.
+func addPortMappings(ep *endpoint, localnetIfName string) error {
+	rules, err := portMappingRules(ep)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	log.Printf("[net] Adding port mappings %+v for endpoint %v.", ep.PortMappings, ep.Id)
+
+	for _, chain := range []string{hostPortChain, hostPortSnatChain} {
+		if err := iptables.CreateChain(iptables.Nat, chain); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range hostPortJumpRules() {
+		if err := iptables.InsertIptableRule(rule.table, rule.chain, rule.match, rule.target); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range rules {
+		if err := iptables.AppendIptableRule(rule.table, rule.chain, rule.match, rule.target); err != nil {
+			log.Printf("[net] Failed to add port mapping rule %+v, err:%v.", rule, err)
+			return err
+		}
+	}
+
+	// Connections from localhost are routed to the container only if route_localnet is enabled.
+	cmd := fmt.Sprintf("echo 1 > /proc/sys/net/ipv4/conf/%v/route_localnet", localnetIfName)
+	if _, err := platform.ExecuteCommand(cmd); err != nil {
+		log.Printf("[net] Failed to enable route_localnet on %v, err:%v.", localnetIfName, err)
+		return err
+	}
+
+	return nil
+}
+
+// deletePortMappings removes the port mappings of the given endpoint.
+func deletePortMappings(ep *endpoint) {
+	rules, err := portMappingRules(ep)
+	if err != nil {
+		log.Printf("[net] Failed to get port mapping rules for endpoint %v, err:%v.", ep.Id, err)
+		return
+	}
+
+	for _, rule := range rules {
+		if err := iptables.DeleteIptableRule(rule.table, rule.chain, rule.match, rule.target); err != nil {
+			log.Printf("[net] Failed to delete port mapping rule %+v, err:%v.", rule, err)
+		}
+	}
+}
+
+// checkPortMappings verifies that the port mappings of the given endpoint are programmed.
+func checkPortMappings(ep *endpoint) error {
+	rules, err := portMappingRules(ep)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if !iptables.RuleExists(rule.table, rule.chain, rule.match, rule.target) {
+			return newCheckError(ErrEndpointRuleNotFound, "%v %v: %v -j %v", rule.table, rule.chain, rule.match, rule.target)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/network/policy"
+)
+
+// Returns an endpoint with the given port mappings for testing.
+func newPortMappingTestEndpoint(portMappings ...policy.PortMapping) *endpoint {
+	_, v6, _ := net.ParseCIDR("fd00::5/64")
+	return &endpoint{
+		Id: "test",
+		IPAddresses: []net.IPNet{
+			*v6,
+			{IP: net.ParseIP("10.240.0.5"), Mask: net.CIDRMask(16, 32)},
+		},
+		PortMappings: portMappings,
+	}
+}
+
+func TestPortMappingRules(t *testing.T) {
+	ep := newPortMappingTestEndpoint(
+		policy.PortMapping{Type: policy.PortMappingPolicy, ExternalPort: 8080, InternalPort: 80, Protocol: "TCP"},
+		policy.PortMapping{Type: policy.PortMappingPolicy, ExternalPort: 5353, InternalPort: 53, Protocol: "udp", HostIP: "10.0.0.4"},
+		policy.PortMapping{Type: policy.PortMappingPolicy, ExternalPort: 3868, InternalPort: 3868, Protocol: "sctp", HostIP: "0.0.0.0"},
+	)
+
+	expected := []iptablesRule{
+		{iptables.Nat, hostPortChain, "-p tcp --dport 8080", "DNAT --to-destination 10.240.0.5:80"},
+		{iptables.Nat, hostPortSnatChain, "-s 10.240.0.5/32 -d 10.240.0.5/32 -p tcp --dport 80", iptables.Masquerade},
+		{iptables.Nat, hostPortSnatChain, "-s 127.0.0.1/32 -d 10.240.0.5/32 -p tcp --dport 80", iptables.Masquerade},
+		{iptables.Nat, hostPortChain, "-d 10.0.0.4/32 -p udp --dport 5353", "DNAT --to-destination 10.240.0.5:53"},
+		{iptables.Nat, hostPortSnatChain, "-s 10.240.0.5/32 -d 10.240.0.5/32 -p udp --dport 53", iptables.Masquerade},
+		{iptables.Nat, hostPortSnatChain, "-s 127.0.0.1/32 -d 10.240.0.5/32 -p udp --dport 53", iptables.Masquerade},
+		{iptables.Nat, hostPortChain, "-p sctp --dport 3868", "DNAT --to-destination 10.240.0.5:3868"},
+		{iptables.Nat, hostPortSnatChain, "-s 10.240.0.5/32 -d 10.240.0.5/32 -p sctp --dport 3868", iptables.Masquerade},
+		{iptables.Nat, hostPortSnatChain, "-s 127.0.0.1/32 -d 10.240.0.5/32 -p sctp --dport 3868", iptables.Masquerade},
+	}
+
+	rules, err := portMappingRules(ep)
+	if err != nil {
+		t.Fatalf("Failed to get port mapping rules: %v", err)
+	}
+
+	if len(rules) != len(expected) {
+		t.Fatalf("Got %d rules, expected %d: %+v", len(rules), len(expected), rules)
+	}
+
+	for i := range rules {
+		if rules[i] != expected[i] {
+			t.Errorf("Rule %d is %+v, expected %+v", i, rules[i], expected[i])
+		}
+	}
+}
+
+func TestPortMappingRulesAreRejected(t *testing.T) {
+	testData := map[string]*endpoint{
+		"protocol": newPortMappingTestEndpoint(
+			policy.PortMapping{Type: policy.PortMappingPolicy, ExternalPort: 8080, InternalPort: 80, Protocol: "icmp"}),
+		"host IP": newPortMappingTestEndpoint(
+			policy.PortMapping{Type: policy.PortMappingPolicy, ExternalPort: 8080, InternalPort: 80, HostIP: "fd00::1"}),
+		"no IPv4 address": {
+			Id:           "test",
+			PortMappings: []policy.PortMapping{{Type: policy.PortMappingPolicy, ExternalPort: 8080, InternalPort: 80}},
+		},
+	}
+
+	for name, ep := range testData {
+		if _, err := portMappingRules(ep); err == nil {
+			t.Errorf("Port mapping with invalid %v was accepted", name)
+		}
+	}
+}
@@ -51,6 +51,12 @@ func setArpProxy(ifName string) error {
 	return err
 }
 
+func setNdpProxy(ifName string) error {
+	cmd := fmt.Sprintf("echo 1 > /proc/sys/net/ipv6/conf/%v/proxy_ndp", ifName)
+	_, err := platform.ExecuteCommand(cmd)
+	return err
+}
+
 func (client *TransparentEndpointClient) AddEndpoints(epInfo *EndpointInfo) error {
 
 	if _, err := net.InterfaceByName(client.hostVethName); err == nil {
@@ -89,7 +95,7 @@ func (client *TransparentEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 	// This route is needed for incoming packets to pod to route via hostveth
 	for _, ipAddr := range epInfo.IPAddresses {
 		var routeInfo RouteInfo
-		ipNet := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(32, 32)}
+		ipNet := getHostPrefix(ipAddr.IP)
 		log.Printf("[net] Adding route for the ip %v", ipNet.String())
 		routeInfo.Dst = ipNet
 		routeInfoList = append(routeInfoList, routeInfo)
@@ -104,6 +110,25 @@ func (client *TransparentEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		return err
 	}
 
+	// IPv6 has no proxy ARP equivalent for all addresses.
+	// Answer neighbor solicitations for IPv6 gateways explicitly.
+	for _, route := range epInfo.Routes {
+		if route.Gw == nil || route.Gw.To4() != nil {
+			continue
+		}
+
+		log.Printf("calling setNdpProxy for %v", client.hostVethName)
+		if err := setNdpProxy(client.hostVethName); err != nil {
+			log.Printf("setNdpProxy failed with: %v", err)
+			return err
+		}
+
+		log.Printf("[net] Adding neighbor proxy for gateway %v on %v", route.Gw.String(), client.hostVethName)
+		if err := netlink.AddOrRemoveNeighborProxy(netlink.ADD, client.hostVethName, route.Gw); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -114,7 +139,7 @@ func (client *TransparentEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	// Deleting the route set up for routing the incoming packets to pod
 	for _, ipAddr := range ep.IPAddresses {
 		var routeInfo RouteInfo
-		ipNet := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(32, 32)}
+		ipNet := getHostPrefix(ipAddr.IP)
 		log.Printf("[net] Deleting route for the ip %v", ipNet.String())
 		routeInfo.Dst = ipNet
 		routeInfoList = append(routeInfoList, routeInfo)
@@ -122,6 +147,28 @@ func (client *TransparentEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	}
 }
 
+func (client *TransparentEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	hostVethIf, err := net.InterfaceByName(client.hostVethName)
+	if err != nil {
+		return newCheckError(ErrHostInterfaceNotFound, "%v: %v", client.hostVethName, err)
+	}
+
+	// Check the route to each pod IP via hostveth.
+	for _, ipAddr := range ep.IPAddresses {
+		routes, err := netlink.GetIpRoute(&netlink.Route{Family: netlink.GetIpAddressFamily(ipAddr.IP), LinkIndex: hostVethIf.Index})
+		if err != nil {
+			return err
+		}
+
+		routeInfo := RouteInfo{Dst: getHostPrefix(ipAddr.IP)}
+		if !routeExists(routes, routeInfo) {
+			return newCheckError(ErrHostRouteNotFound, "%v dev %v", routeInfo.Dst.String(), client.hostVethName)
+		}
+	}
+
+	return nil
+}
+
 func (client *TransparentEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
 	// Move the container interface to container's network namespace.
 	log.Printf("[net] Setting link %v netns %v.", client.containerVethName, epInfo.NetNsPath)
@@ -17,17 +17,22 @@ type ipsEntry struct {
 	name          string
 	set           string
 	spec          string
+	kind          string
 }
 
 // IpsetManager stores ipset states.
+// Changes are applied to setMap/listMap immediately and to ipset on Flush.
 type IpsetManager struct {
 	listMap map[string]*Ipset //tracks all set lists.
 	setMap  map[string]*Ipset //label -> []ip
+	pending []*ipsEntry       //operations not yet applied to ipset.
+	synced  bool              //whether ipset is known to match setMap/listMap.
 }
 
 // Ipset represents one ipset entry.
 type Ipset struct {
 	name       string
+	setType    string
 	elements   []string
 	referCount int
 }
@@ -44,10 +49,11 @@ func NewIpsetManager() *IpsetManager {
 	return &IpsetManager{
 		listMap: make(map[string]*Ipset),
 		setMap:  make(map[string]*Ipset),
+		synced:  true,
 	}
 }
 
-// Exists checks if an element exists in setMap/listMap.
+// Exists checks if an element exists in setMap/listMap, without running ipset.
 func (ipsMgr *IpsetManager) Exists(key string, val string, kind string) bool {
 	m := ipsMgr.setMap
 	if kind == util.IpsetSetListFlag {
@@ -71,6 +77,18 @@ func isNsSet(setName string) bool {
 	return !strings.Contains(setName, "-") && !strings.Contains(setName, ":")
 }
 
+// Removes an element from an ipset. Returns whether the ipset contained the element.
+func (set *Ipset) removeElement(val string) bool {
+	for i, elem := range set.elements {
+		if elem == val {
+			set.elements = append(set.elements[:i], set.elements[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
 // CreateList creates an ipset list. npm maintains one setlist per namespace label.
 func (ipsMgr *IpsetManager) CreateList(listName string) error {
 	if _, exists := ipsMgr.listMap[listName]; exists {
@@ -84,10 +102,7 @@ func (ipsMgr *IpsetManager) CreateList(listName string) error {
 		spec:          util.IpsetSetListFlag,
 	}
 	log.Printf("Creating List: %+v", entry)
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset list %s.", listName)
-		return err
-	}
+	ipsMgr.queue(entry)
 
 	ipsMgr.listMap[listName] = NewIpset(listName)
 
@@ -98,19 +113,11 @@ func (ipsMgr *IpsetManager) CreateList(listName string) error {
 func (ipsMgr *IpsetManager) DeleteList(listName string) error {
 	entry := &ipsEntry{
 		operationFlag: util.IpsetDestroyFlag,
+		name:          listName,
 		set:           util.GetHashedName(listName),
+		kind:          util.IpsetSetListFlag,
 	}
-
-	errCode, err := ipsMgr.Run(entry)
-	if err != nil {
-		if errCode == 1 {
-			log.Printf("Error: Cannot delete list %s as it's being referred or doesn't exist.", listName)
-			return nil
-		}
-
-		log.Errorf("Error: failed to delete ipset %s %+v", listName, entry)
-		return err
-	}
+	ipsMgr.queue(entry)
 
 	delete(ipsMgr.listMap, listName)
 
@@ -136,11 +143,7 @@ func (ipsMgr *IpsetManager) AddToList(listName string, setName string) error {
 		set:           util.GetHashedName(listName),
 		spec:          util.GetHashedName(setName),
 	}
-
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset rules. rule: %+v", entry)
-		return err
-	}
+	ipsMgr.queue(entry)
 
 	ipsMgr.listMap[listName].elements = append(ipsMgr.listMap[listName].elements, setName)
 
@@ -154,22 +157,14 @@ func (ipsMgr *IpsetManager) DeleteFromList(listName string, setName string) erro
 		return nil
 	}
 
-	for i, val := range ipsMgr.listMap[listName].elements {
-		if val == setName {
-			ipsMgr.listMap[listName].elements = append(ipsMgr.listMap[listName].elements[:i], ipsMgr.listMap[listName].elements[i+1:]...)
+	if ipsMgr.listMap[listName].removeElement(setName) {
+		hashedListName, hashedSetName := util.GetHashedName(listName), util.GetHashedName(setName)
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDeletionFlag,
+			set:           hashedListName,
+			spec:          hashedSetName,
 		}
-	}
-
-	hashedListName, hashedSetName := util.GetHashedName(listName), util.GetHashedName(setName)
-	entry := &ipsEntry{
-		operationFlag: util.IpsetDeletionFlag,
-		set:           hashedListName,
-		spec:          hashedSetName,
-	}
-	errCode, err := ipsMgr.Run(entry)
-	if errCode > 1 && err != nil {
-		log.Errorf("Error: failed to delete ipset entry. %+v", entry)
-		return err
+		ipsMgr.queue(entry)
 	}
 
 	if len(ipsMgr.listMap[listName].elements) == 0 {
@@ -182,6 +177,15 @@ func (ipsMgr *IpsetManager) DeleteFromList(listName string, setName string) erro
 	return nil
 }
 
+// Returns the type of an ipset. Sets of named ports hold ip,port pairs, other sets hold ips.
+func getSetType(setName string) string {
+	if util.IsNamedPortSet(setName) {
+		return util.IpsetIPPortHashFlag
+	}
+
+	return util.IpsetNetHashFlag
+}
+
 // CreateSet creates an ipset.
 func (ipsMgr *IpsetManager) CreateSet(setName string) error {
 	if _, exists := ipsMgr.setMap[setName]; exists {
@@ -193,15 +197,13 @@ func (ipsMgr *IpsetManager) CreateSet(setName string) error {
 		operationFlag: util.IpsetCreationFlag,
 		// Use hashed string for set name to avoid string length limit of ipset.
 		set:  util.GetHashedName(setName),
-		spec: util.IpsetNetHashFlag,
+		spec: getSetType(setName),
 	}
 	log.Printf("Creating Set: %+v", entry)
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset.")
-		return err
-	}
+	ipsMgr.queue(entry)
 
 	ipsMgr.setMap[setName] = NewIpset(setName)
+	ipsMgr.setMap[setName].setType = entry.spec
 
 	return nil
 }
@@ -219,20 +221,31 @@ func (ipsMgr *IpsetManager) DeleteSet(setName string) error {
 
 	entry := &ipsEntry{
 		operationFlag: util.IpsetDestroyFlag,
+		name:          setName,
 		set:           util.GetHashedName(setName),
+		kind:          ipsMgr.setMap[setName].setType,
 	}
-	errCode, err := ipsMgr.Run(entry)
-	if err != nil {
-		if errCode == 1 {
-			log.Printf("Cannot delete set %s as it's being referred.", setName)
-			return nil
-		}
+	ipsMgr.queue(entry)
 
-		log.Errorf("Error: failed to delete ipset %s. Entry: %+v", setName, entry)
-		return err
+	delete(ipsMgr.setMap, setName)
+
+	return nil
+}
+
+// EmptySet removes all the elements of a set, keeping the set.
+func (ipsMgr *IpsetManager) EmptySet(setName string) error {
+	set, exists := ipsMgr.setMap[setName]
+	if !exists || len(set.elements) == 0 {
+		return nil
 	}
 
-	delete(ipsMgr.setMap, setName)
+	entry := &ipsEntry{
+		operationFlag: util.IpsetFlushFlag,
+		set:           util.GetHashedName(setName),
+	}
+	ipsMgr.queue(entry)
+
+	set.elements = nil
 
 	return nil
 }
@@ -252,11 +265,7 @@ func (ipsMgr *IpsetManager) AddToSet(setName string, ip string) error {
 		set:           util.GetHashedName(setName),
 		spec:          ip,
 	}
-
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Printf("Error: failed to create ipset rules. %+v", entry)
-		return err
-	}
+	ipsMgr.queue(entry)
 
 	ipsMgr.setMap[setName].elements = append(ipsMgr.setMap[setName].elements, ip)
 
@@ -270,20 +279,13 @@ func (ipsMgr *IpsetManager) DeleteFromSet(setName string, ip string) error {
 		return nil
 	}
 
-	for i, val := range ipsMgr.setMap[setName].elements {
-		if val == ip {
-			ipsMgr.setMap[setName].elements = append(ipsMgr.setMap[setName].elements[:i], ipsMgr.setMap[setName].elements[i+1:]...)
+	if ipsMgr.setMap[setName].removeElement(ip) {
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDeletionFlag,
+			set:           util.GetHashedName(setName),
+			spec:          ip,
 		}
-	}
-
-	entry := &ipsEntry{
-		operationFlag: util.IpsetDeletionFlag,
-		set:           util.GetHashedName(setName),
-		spec:          ip,
-	}
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to delete ipset entry. Entry: %+v", entry)
-		return err
+		ipsMgr.queue(entry)
 	}
 
 	return nil
@@ -313,6 +315,11 @@ func (ipsMgr *IpsetManager) Clean() error {
 		}
 	}
 
+	if err := ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to clean ipset")
+		return err
+	}
+
 	return nil
 }
 
@@ -332,6 +339,11 @@ func (ipsMgr *IpsetManager) Destroy() error {
 		return err
 	}
 
+	ipsMgr.listMap = make(map[string]*Ipset)
+	ipsMgr.setMap = make(map[string]*Ipset)
+	ipsMgr.pending = nil
+	ipsMgr.synced = true
+
 	return nil
 }
 
@@ -42,6 +42,10 @@ func TestCreateList(t *testing.T) {
 	if err := ipsMgr.CreateList("test-list"); err != nil {
 		t.Errorf("TestCreateList failed @ ipsMgr.CreateList")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestCreateList failed @ ipsMgr.Flush")
+	}
 }
 
 func TestDeleteList(t *testing.T) {
@@ -63,6 +67,10 @@ func TestDeleteList(t *testing.T) {
 	if err := ipsMgr.DeleteList("test-list"); err != nil {
 		t.Errorf("TestDeleteList failed @ ipsMgr.DeleteList")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestDeleteList failed @ ipsMgr.Flush")
+	}
 }
 
 func TestAddToList(t *testing.T) {
@@ -84,6 +92,10 @@ func TestAddToList(t *testing.T) {
 	if err := ipsMgr.AddToList("test-list", "test-set"); err != nil {
 		t.Errorf("TestAddToList failed @ ipsMgr.AddToList")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestAddToList failed @ ipsMgr.Flush")
+	}
 }
 
 func TestDeleteFromList(t *testing.T) {
@@ -113,6 +125,10 @@ func TestDeleteFromList(t *testing.T) {
 	if err := ipsMgr.DeleteSet("test-set"); err != nil {
 		t.Errorf("TestDeleteSet failed @ ipsMgr.DeleteSet")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestDeleteFromList failed @ ipsMgr.Flush")
+	}
 }
 
 func TestCreateSet(t *testing.T) {
@@ -130,6 +146,10 @@ func TestCreateSet(t *testing.T) {
 	if err := ipsMgr.CreateSet("test-set"); err != nil {
 		t.Errorf("TestCreateSet failed @ ipsMgr.CreateSet")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestCreateSet failed @ ipsMgr.Flush")
+	}
 }
 
 func TestDeleteSet(t *testing.T) {
@@ -151,6 +171,10 @@ func TestDeleteSet(t *testing.T) {
 	if err := ipsMgr.DeleteSet("test-set"); err != nil {
 		t.Errorf("TestDeleteSet failed @ ipsMgr.DeleteSet")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestDeleteSet failed @ ipsMgr.Flush")
+	}
 }
 
 func TestAddToSet(t *testing.T) {
@@ -168,6 +192,10 @@ func TestAddToSet(t *testing.T) {
 	if err := ipsMgr.AddToSet("test-set", "1.2.3.4"); err != nil {
 		t.Errorf("TestAddToSet failed @ ipsMgr.AddToSet")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestAddToSet failed @ ipsMgr.Flush")
+	}
 }
 
 func TestDeleteFromSet(t *testing.T) {
@@ -189,6 +217,10 @@ func TestDeleteFromSet(t *testing.T) {
 	if err := ipsMgr.DeleteFromSet("test-set", "1.2.3.4"); err != nil {
 		t.Errorf("TestDeleteFromSet failed @ ipsMgr.DeleteFromSet")
 	}
+
+	if err := ipsMgr.Flush(); err != nil {
+		t.Errorf("TestDeleteFromSet failed @ ipsMgr.Flush")
+	}
 }
 
 func TestClean(t *testing.T) {
@@ -0,0 +1,303 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package ipsm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// Type of list ipsets in ipset save output.
+const listSetType = "list:set"
+
+// restoreCommands maps ipset operation flags to ipset restore commands.
+var restoreCommands = map[string]string{
+	util.IpsetCreationFlag: "create",
+	util.IpsetAppendFlag:   "add",
+	util.IpsetDeletionFlag: "del",
+	util.IpsetFlushFlag:    "flush",
+	util.IpsetDestroyFlag:  "destroy",
+}
+
+// Matches the line of the first failed command in ipset restore errors.
+var restoreErrorLine = regexp.MustCompile(`Error in line (\d+):`)
+
+// savedSet is an ipset read from ipset list output.
+type savedSet struct {
+	setType  string
+	elements map[string]bool
+}
+
+// queue adds an operation to be applied on the next Flush.
+func (ipsMgr *IpsetManager) queue(entry *ipsEntry) {
+	ipsMgr.pending = append(ipsMgr.pending, entry)
+}
+
+// Returns the ipset restore command of an entry.
+func formatEntry(entry *ipsEntry) string {
+	fields := []string{restoreCommands[entry.operationFlag], entry.set}
+	if len(entry.spec) > 0 {
+		fields = append(fields, entry.spec)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// parseSavedSets parses ipset list output in save format. Returns the ipsets created by NPM by name.
+func parseSavedSets(save []byte) map[string]*savedSet {
+	sets := make(map[string]*savedSet)
+
+	scanner := bufio.NewScanner(bytes.NewReader(save))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[1], util.AzureNpmPrefix) {
+			continue
+		}
+
+		switch fields[0] {
+		case restoreCommands[util.IpsetCreationFlag]:
+			sets[fields[1]] = &savedSet{setType: fields[2], elements: make(map[string]bool)}
+		case restoreCommands[util.IpsetAppendFlag]:
+			if set, ok := sets[fields[1]]; ok {
+				set.elements[fields[2]] = true
+			}
+		}
+	}
+
+	return sets
+}
+
+// getSavedSets reads the ipsets created by NPM from ipset.
+func getSavedSets() (map[string]*savedSet, error) {
+	out, err := exec.Command(util.Ipset, util.IpsetListFlag, util.IpsetOutputFlag, util.IpsetSaveFlag).Output()
+	if err != nil {
+		log.Errorf("Error: failed to list ipsets, err:%v.", err)
+		return nil, err
+	}
+
+	return parseSavedSets(out), nil
+}
+
+// Returns the entries that make an ipset match the elements of an ipset in setMap/listMap.
+func reconcileSet(hashedName string, kind string, elements []string, saved *savedSet) []*ipsEntry {
+	var entries []*ipsEntry
+
+	if saved == nil {
+		saved = &savedSet{elements: make(map[string]bool)}
+		entries = append(entries, &ipsEntry{operationFlag: util.IpsetCreationFlag, set: hashedName, spec: kind})
+	}
+
+	desired := make(map[string]bool)
+	for _, elem := range elements {
+		desired[elem] = true
+		if !saved.elements[elem] {
+			entries = append(entries, &ipsEntry{operationFlag: util.IpsetAppendFlag, set: hashedName, spec: elem})
+		}
+	}
+
+	var stale []string
+	for elem := range saved.elements {
+		if !desired[elem] {
+			stale = append(stale, elem)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, elem := range stale {
+		entries = append(entries, &ipsEntry{operationFlag: util.IpsetDeletionFlag, set: hashedName, spec: elem})
+	}
+
+	return entries
+}
+
+// Returns the names of the ipsets in a map, sorted for a stable order of operations.
+func sortedNames(m map[string]*Ipset) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// reconcileEntries returns the entries that make ipset match setMap/listMap.
+// Ipsets created by NPM that are in neither map are flushed and destroyed if removeStale is set.
+func (ipsMgr *IpsetManager) reconcileEntries(saved map[string]*savedSet, removeStale bool) []*ipsEntry {
+	var entries []*ipsEntry
+	known := make(map[string]bool)
+
+	// Sets are reconciled first as they are the elements of lists.
+	for _, setName := range sortedNames(ipsMgr.setMap) {
+		hashedName := util.GetHashedName(setName)
+		known[hashedName] = true
+		set := ipsMgr.setMap[setName]
+		entries = append(entries, reconcileSet(hashedName, set.setType, set.elements, saved[hashedName])...)
+	}
+
+	for _, listName := range sortedNames(ipsMgr.listMap) {
+		hashedName := util.GetHashedName(listName)
+		known[hashedName] = true
+
+		var elements []string
+		for _, setName := range ipsMgr.listMap[listName].elements {
+			elements = append(elements, util.GetHashedName(setName))
+		}
+		entries = append(entries, reconcileSet(hashedName, util.IpsetSetListFlag, elements, saved[hashedName])...)
+	}
+
+	if !removeStale {
+		return entries
+	}
+
+	var staleLists, staleSets []string
+	for hashedName, set := range saved {
+		if known[hashedName] {
+			continue
+		}
+
+		if set.setType == listSetType {
+			staleLists = append(staleLists, hashedName)
+		} else {
+			staleSets = append(staleSets, hashedName)
+		}
+	}
+	sort.Strings(staleLists)
+	sort.Strings(staleSets)
+
+	// Stale lists are flushed first so that the sets they contain can be destroyed.
+	for _, hashedName := range staleLists {
+		entries = append(entries, &ipsEntry{operationFlag: util.IpsetFlushFlag, set: hashedName})
+	}
+
+	for _, hashedName := range append(staleLists, staleSets...) {
+		entries = append(entries, &ipsEntry{operationFlag: util.IpsetDestroyFlag, set: hashedName})
+	}
+
+	return entries
+}
+
+// restoreEntries applies entries with ipset restore.
+// ipset restore stops at the first failed command. Destroying an ipset that is referred or doesn't exist
+// is not an error, in which case the ipset is kept in setMap/listMap and the remaining entries are applied.
+func (ipsMgr *IpsetManager) restoreEntries(entries []*ipsEntry) error {
+	for len(entries) > 0 {
+		var payload bytes.Buffer
+		for _, entry := range entries {
+			fmt.Fprintf(&payload, "%s\n", formatEntry(entry))
+		}
+
+		cmdArgs := []string{util.IpsetRestoreFlag, util.IpsetExistFlag}
+		log.Printf("Executing ipset command %s %v with payload:\n%s", util.Ipset, cmdArgs, payload.String())
+
+		cmd := exec.Command(util.Ipset, cmdArgs...)
+		cmd.Stdin = &payload
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+
+		msg := strings.TrimSpace(string(out))
+		match := restoreErrorLine.FindStringSubmatch(msg)
+		if match == nil {
+			log.Errorf("Error: failed to run ipset restore, err:%v output:%s.", err, msg)
+			return err
+		}
+
+		line, _ := strconv.Atoi(match[1])
+		if line < 1 || line > len(entries) || entries[line-1].operationFlag != util.IpsetDestroyFlag {
+			log.Errorf("Error: failed to run ipset restore, err:%v output:%s.", err, msg)
+			return err
+		}
+
+		failed := entries[line-1]
+		log.Printf("Cannot delete ipset %s as it's being referred or doesn't exist. %s", failed.set, msg)
+
+		switch failed.kind {
+		case util.IpsetSetListFlag:
+			if _, exists := ipsMgr.listMap[failed.name]; !exists {
+				ipsMgr.listMap[failed.name] = NewIpset(failed.name)
+			}
+		case "":
+			// Stale ipsets destroyed by reconcile are not tracked.
+		default:
+			if _, exists := ipsMgr.setMap[failed.name]; !exists {
+				ipsMgr.setMap[failed.name] = NewIpset(failed.name)
+				ipsMgr.setMap[failed.name].setType = failed.kind
+			}
+		}
+
+		entries = entries[line:]
+	}
+
+	return nil
+}
+
+// Flush applies the pending operations with a single ipset restore.
+// If a previous flush failed, ipset is reconciled with setMap/listMap instead.
+func (ipsMgr *IpsetManager) Flush() error {
+	if len(ipsMgr.pending) == 0 && ipsMgr.synced {
+		return nil
+	}
+
+	log.Printf("Flushing %d ipset operations.", len(ipsMgr.pending))
+
+	entries := ipsMgr.pending
+	if !ipsMgr.synced {
+		saved, err := getSavedSets()
+		if err != nil {
+			return err
+		}
+
+		// setMap/listMap already reflect the pending operations, except for destroyed ipsets.
+		entries = ipsMgr.reconcileEntries(saved, false)
+		for _, entry := range ipsMgr.pending {
+			if entry.operationFlag == util.IpsetDestroyFlag {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	ipsMgr.pending = nil
+
+	if err := ipsMgr.restoreEntries(entries); err != nil {
+		ipsMgr.synced = false
+		return err
+	}
+
+	ipsMgr.synced = true
+
+	return nil
+}
+
+// Reconcile makes ipset match setMap/listMap, including the pending operations.
+// Ipsets created by NPM that are in neither map, e.g. left over by a previous instance, are destroyed.
+func (ipsMgr *IpsetManager) Reconcile() error {
+	log.Printf("Reconciling ipsets.")
+
+	saved, err := getSavedSets()
+	if err != nil {
+		return err
+	}
+
+	entries := ipsMgr.reconcileEntries(saved, true)
+	ipsMgr.pending = nil
+
+	if err = ipsMgr.restoreEntries(entries); err != nil {
+		ipsMgr.synced = false
+		return err
+	}
+
+	ipsMgr.synced = true
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package ipsm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// Returns the ipset restore commands of entries.
+func formatEntries(entries []*ipsEntry) []string {
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, formatEntry(entry))
+	}
+
+	return lines
+}
+
+func TestPendingOperations(t *testing.T) {
+	ipsMgr := NewIpsetManager()
+	set, list := util.GetHashedName("test-set"), util.GetHashedName("test-list")
+
+	ipsMgr.AddToSet("test-set", "1.2.3.4")
+	ipsMgr.AddToSet("test-set", "1.2.3.4")
+	ipsMgr.AddToSet("test-set", "1.2.3.5")
+	ipsMgr.AddToList("test-list", "test-set")
+	ipsMgr.DeleteFromSet("test-set", "1.2.3.4")
+	ipsMgr.DeleteFromSet("test-set", "1.2.3.6")
+
+	expectedLines := []string{
+		"create " + set + " nethash",
+		"add " + set + " 1.2.3.4",
+		"add " + set + " 1.2.3.5",
+		"create " + list + " setlist",
+		"add " + list + " " + set,
+		"del " + set + " 1.2.3.4",
+	}
+	if lines := formatEntries(ipsMgr.pending); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("TestPendingOperations failed @ pending operations comparison")
+		t.Errorf("lines: %v", lines)
+		t.Errorf("expectedLines: %v", expectedLines)
+	}
+
+	if !ipsMgr.Exists("test-set", "1.2.3.5", util.IpsetNetHashFlag) || ipsMgr.Exists("test-set", "1.2.3.4", util.IpsetNetHashFlag) ||
+		!ipsMgr.Exists("test-list", "test-set", util.IpsetSetListFlag) {
+		t.Errorf("TestPendingOperations failed @ ipsMgr.Exists")
+	}
+
+	// Removing the last element of a list destroys it.
+	ipsMgr.pending = nil
+	ipsMgr.DeleteFromList("test-list", "test-set")
+
+	expectedLines = []string{
+		"del " + list + " " + set,
+		"destroy " + list,
+	}
+	if lines := formatEntries(ipsMgr.pending); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("TestPendingOperations failed @ list deletion comparison")
+		t.Errorf("lines: %v", lines)
+		t.Errorf("expectedLines: %v", expectedLines)
+	}
+
+	if _, exists := ipsMgr.listMap["test-list"]; exists {
+		t.Errorf("TestPendingOperations failed @ deleted list in listMap")
+	}
+}
+
+func TestEmptySet(t *testing.T) {
+	ipsMgr := NewIpsetManager()
+	set := util.GetHashedName("test-set")
+
+	ipsMgr.AddToSet("test-set", "1.2.3.4")
+	ipsMgr.pending = nil
+
+	ipsMgr.EmptySet("test-set")
+	ipsMgr.EmptySet("test-set")
+	ipsMgr.EmptySet("missing-set")
+
+	expectedLines := []string{"flush " + set}
+	if lines := formatEntries(ipsMgr.pending); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("TestEmptySet failed @ pending operations comparison")
+		t.Errorf("lines: %v", lines)
+		t.Errorf("expectedLines: %v", expectedLines)
+	}
+
+	if ipsMgr.Exists("test-set", "1.2.3.4", util.IpsetNetHashFlag) {
+		t.Errorf("TestEmptySet failed @ ipsMgr.Exists")
+	}
+}
+
+func TestParseSavedSets(t *testing.T) {
+	save := "create azure-npm-1 hash:net family inet hashsize 1024 maxelem 65536\n" +
+		"add azure-npm-1 10.0.0.1\n" +
+		"add azure-npm-1 10.0.0.2\n" +
+		"create azure-npm-2 list:set size 8\n" +
+		"add azure-npm-2 azure-npm-1\n" +
+		"create KUBE-CLUSTER-IP hash:ip,port family inet hashsize 1024 maxelem 65536\n" +
+		"add KUBE-CLUSTER-IP 10.0.0.10,udp:53\n"
+
+	expectedSets := map[string]*savedSet{
+		"azure-npm-1": &savedSet{setType: "hash:net", elements: map[string]bool{"10.0.0.1": true, "10.0.0.2": true}},
+		"azure-npm-2": &savedSet{setType: listSetType, elements: map[string]bool{"azure-npm-1": true}},
+	}
+	if sets := parseSavedSets([]byte(save)); !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("TestParseSavedSets failed @ sets comparison")
+		t.Errorf("sets: %+v", sets)
+		t.Errorf("expectedSets: %+v", expectedSets)
+	}
+}
+
+func TestReconcileEntries(t *testing.T) {
+	ipsMgr := NewIpsetManager()
+	ipsMgr.AddToSet("test-set", "10.0.0.1")
+	ipsMgr.AddToSet("test-set", "10.0.0.3")
+	ipsMgr.AddToSet("test-new-set", "10.0.0.4")
+	ipsMgr.AddToList("test-list", "test-set")
+	ipsMgr.pending = nil
+
+	set, newSet, list := util.GetHashedName("test-set"), util.GetHashedName("test-new-set"), util.GetHashedName("test-list")
+	saved := map[string]*savedSet{
+		set:           &savedSet{setType: "hash:net", elements: map[string]bool{"10.0.0.1": true, "10.0.0.2": true}},
+		list:          &savedSet{setType: listSetType, elements: map[string]bool{}},
+		"azure-npm-1": &savedSet{setType: "hash:net", elements: map[string]bool{"10.0.0.5": true}},
+		"azure-npm-2": &savedSet{setType: listSetType, elements: map[string]bool{"azure-npm-1": true}},
+	}
+
+	expectedLines := []string{
+		"create " + newSet + " nethash",
+		"add " + newSet + " 10.0.0.4",
+		"add " + set + " 10.0.0.3",
+		"del " + set + " 10.0.0.2",
+		"add " + list + " " + set,
+	}
+	if lines := formatEntries(ipsMgr.reconcileEntries(saved, false)); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("TestReconcileEntries failed @ known sets comparison")
+		t.Errorf("lines: %v", lines)
+		t.Errorf("expectedLines: %v", expectedLines)
+	}
+
+	// Stale lists are flushed before stale ipsets are destroyed.
+	expectedLines = append(expectedLines,
+		"flush azure-npm-2",
+		"destroy azure-npm-2",
+		"destroy azure-npm-1",
+	)
+	if lines := formatEntries(ipsMgr.reconcileEntries(saved, true)); !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("TestReconcileEntries failed @ stale sets comparison")
+		t.Errorf("lines: %v", lines)
+		t.Errorf("expectedLines: %v", expectedLines)
+	}
+}
@@ -38,6 +38,8 @@ type IptEntry struct {
 // IptablesManager stores iptables entries.
 type IptablesManager struct {
 	OperationFlag string
+	chains        Chains
+	synced        bool
 }
 
 // NewIptablesManager creates a new instance for IptablesManager object.
@@ -50,156 +52,31 @@ func NewIptablesManager() *IptablesManager {
 }
 
 // InitNpmChains initializes Azure NPM chains in iptables.
+// The chains, their default rules and the jump from FORWARD chain are programmed with a single iptables-restore.
 func (iptMgr *IptablesManager) InitNpmChains() error {
 	log.Printf("Initializing AZURE-NPM chains.")
 
-	if err := iptMgr.AddChain(util.IptablesAzureChain); err != nil {
+	current, hasForwardJump, err := getNpmChains()
+	if err != nil {
 		return err
 	}
 
 	// Insert AZURE-NPM chain to FORWARD chain.
-	entry := &IptEntry{
-		Chain: util.IptablesForwardChain,
-		Specs: []string{
+	var rules []string
+	if !hasForwardJump {
+		rules = append(rules, strings.Join([]string{
+			util.IptablesInsertionFlag,
+			util.IptablesForwardChain,
 			util.IptablesJumpFlag,
 			util.IptablesAzureChain,
-		},
-	}
-	exists, err := iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesInsertionFlag
-		if _, err = iptMgr.Run(entry); err != nil {
-			log.Errorf("Error: failed to add AZURE-NPM chain to FORWARD chain.")
-			return err
-		}
-	}
-
-	// Add default allow CONNECTED/RELATED rule to AZURE-NPM chain.
-	entry.Chain = util.IptablesAzureChain
-	entry.Specs = []string{
-		util.IptablesModuleFlag,
-		util.IptablesStateModuleFlag,
-		util.IptablesStateFlag,
-		util.IptablesRelatedState + "," + util.IptablesEstablishedState,
-		util.IptablesJumpFlag,
-		util.IptablesAccept,
-	}
-	exists, err = iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesInsertionFlag
-		if _, err = iptMgr.Run(entry); err != nil {
-			log.Printf("Error: failed to add default allow CONNECTED/RELATED rule to AZURE-NPM chain.")
-			return err
-		}
-	}
-
-	// Create AZURE-NPM-KUBE-SYSTEM chain.
-	if err := iptMgr.AddChain(util.IptablesAzureKubeSystemChain); err != nil {
-		return err
-	}
-
-	// Append AZURE-NPM-KUBE-SYSTEM chain to AZURE-NPM chain.
-	entry = &IptEntry{
-		Chain: util.IptablesAzureChain,
-		Specs: []string{
-			util.IptablesJumpFlag,
-			util.IptablesAzureKubeSystemChain,
-		},
-	}
-	exists, err = iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesAppendFlag
-		if _, err = iptMgr.Run(entry); err != nil {
-			log.Errorf("Error: failed to add AZURE-NPM-KUBE-SYSTEM chain to AZURE-NPM chain.")
-			return err
-		}
+		}, " "))
 	}
 
-	// Create AZURE-NPM-INGRESS-PORT chain.
-	if err := iptMgr.AddChain(util.IptablesAzureIngressPortChain); err != nil {
+	if err = iptMgr.apply(NewNpmChains(), current, rules); err != nil {
+		log.Errorf("Error: failed to initialize AZURE-NPM chains.")
 		return err
 	}
 
-	// Append AZURE-NPM-INGRESS-PORT chain to AZURE-NPM chain.
-	entry.Chain = util.IptablesAzureChain
-	entry.Specs = []string{util.IptablesJumpFlag, util.IptablesAzureIngressPortChain}
-	exists, err = iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesAppendFlag
-		if _, err := iptMgr.Run(entry); err != nil {
-			log.Errorf("Error: failed to add AZURE-NPM-INGRESS-PORT chain to AZURE-NPM chain.")
-			return err
-		}
-	}
-
-	// Create AZURE-NPM-INGRESS-FROM chain.
-	if err = iptMgr.AddChain(util.IptablesAzureIngressFromChain); err != nil {
-		return err
-	}
-
-	// Create AZURE-NPM-EGRESS-PORT chain.
-	if err := iptMgr.AddChain(util.IptablesAzureEgressPortChain); err != nil {
-		return err
-	}
-
-	// Insert AZURE-NPM-EGRESS-PORT chain to AZURE-NPM chain.
-	entry.Chain = util.IptablesAzureChain
-	entry.Specs = []string{util.IptablesJumpFlag, util.IptablesAzureEgressPortChain}
-	exists, err = iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesAppendFlag
-		if _, err := iptMgr.Run(entry); err != nil {
-			log.Errorf("Error: failed to add AZURE-NPM-EGRESS-PORT chain to AZURE-NPM chain.")
-			return err
-		}
-	}
-
-	// Create AZURE-NPM-EGRESS-TO chain.
-	if err = iptMgr.AddChain(util.IptablesAzureEgressToChain); err != nil {
-		return err
-	}
-
-	// Create AZURE-NPM-TARGET-SETS chain.
-	if err := iptMgr.AddChain(util.IptablesAzureTargetSetsChain); err != nil {
-		return err
-	}
-
-	// Append AZURE-NPM-TARGET-SETS chain to AZURE-NPM chain.
-	entry.Chain = util.IptablesAzureChain
-	entry.Specs = []string{util.IptablesJumpFlag, util.IptablesAzureTargetSetsChain}
-	exists, err = iptMgr.Exists(entry)
-	if err != nil {
-		return err
-	}
-
-	if !exists {
-		iptMgr.OperationFlag = util.IptablesAppendFlag
-		if _, err := iptMgr.Run(entry); err != nil {
-			log.Errorf("Error: failed to add AZURE-NPM-TARGET-SETS chain to AZURE-NPM chain.")
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -221,6 +98,10 @@ func (iptMgr *IptablesManager) UninitNpmChains() error {
 		util.IptablesAzureEgressToPodChain,
 	}
 
+	// Discard the in-memory chains, which are read back from iptables once initialized again.
+	iptMgr.chains = nil
+	iptMgr.synced = false
+
 	// Remove AZURE-NPM chain from FORWARD chain.
 	entry := &IptEntry{
 		Chain: util.IptablesForwardChain,
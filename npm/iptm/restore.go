@@ -0,0 +1,356 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package iptm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// Chains holds the rules of AZURE-NPM chains in memory, in the order they are programmed.
+// Rules are kept in iptables-restore syntax, without the chain.
+type Chains map[string][]string
+
+// npmChains lists the chains created by NPM, in the order they are written to iptables.
+var npmChains = []string{
+	util.IptablesAzureChain,
+	util.IptablesAzureKubeSystemChain,
+	util.IptablesAzureIngressPortChain,
+	util.IptablesAzureIngressFromChain,
+	util.IptablesAzureEgressPortChain,
+	util.IptablesAzureEgressToChain,
+	util.IptablesAzureTargetSetsChain,
+}
+
+// NewNpmChains returns the AZURE-NPM chains with their default rules.
+func NewNpmChains() Chains {
+	chains := make(Chains)
+	for _, chain := range npmChains {
+		chains[chain] = []string{}
+	}
+
+	// Allow CONNECTED/RELATED traffic before evaluating policies.
+	chains.Add(&IptEntry{
+		Chain: util.IptablesAzureChain,
+		Specs: []string{
+			util.IptablesModuleFlag,
+			util.IptablesStateModuleFlag,
+			util.IptablesStateFlag,
+			util.IptablesRelatedState + "," + util.IptablesEstablishedState,
+			util.IptablesJumpFlag,
+			util.IptablesAccept,
+		},
+	})
+
+	// AZURE-NPM-INGRESS-FROM and AZURE-NPM-EGRESS-TO are jumped to from the port chains.
+	for _, chain := range []string{
+		util.IptablesAzureKubeSystemChain,
+		util.IptablesAzureIngressPortChain,
+		util.IptablesAzureEgressPortChain,
+		util.IptablesAzureTargetSetsChain,
+	} {
+		chains.Add(&IptEntry{
+			Chain: util.IptablesAzureChain,
+			Specs: []string{util.IptablesJumpFlag, chain},
+		})
+	}
+
+	return chains
+}
+
+// Returns whether a chain is created by NPM, including chains of previous versions.
+func isNpmChain(chain string) bool {
+	return strings.HasPrefix(chain, util.IptablesAzureChain)
+}
+
+// Returns an iptables-restore argument, quoted if it contains whitespace or quotes.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"\\") {
+		return arg
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// Returns the rule of an entry in iptables-restore syntax.
+func formatRule(entry *IptEntry) string {
+	args := make([]string, 0, len(entry.Specs))
+	for _, spec := range entry.Specs {
+		args = append(args, quoteArg(spec))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// Returns the index of a rule in a chain, or -1 if the chain doesn't contain it.
+func (chains Chains) index(chain, rule string) int {
+	for i, r := range chains[chain] {
+		if r == rule {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Add appends the rule of an entry to its chain, unless the chain already contains it.
+// Returns whether the chains changed.
+func (chains Chains) Add(entry *IptEntry) bool {
+	rule := formatRule(entry)
+	if chains.index(entry.Chain, rule) >= 0 {
+		return false
+	}
+
+	chains[entry.Chain] = append(chains[entry.Chain], rule)
+	return true
+}
+
+// Delete removes the rule of an entry from its chain.
+// Returns whether the chains changed.
+func (chains Chains) Delete(entry *IptEntry) bool {
+	rule := formatRule(entry)
+	i := chains.index(entry.Chain, rule)
+	if i < 0 {
+		return false
+	}
+
+	rules := chains[entry.Chain]
+	chains[entry.Chain] = append(rules[:i:i], rules[i+1:]...)
+	return true
+}
+
+// Copy returns a copy of the chains that can be changed independently.
+func (chains Chains) Copy() Chains {
+	c := make(Chains, len(chains))
+	for chain, rules := range chains {
+		c[chain] = append([]string{}, rules...)
+	}
+
+	return c
+}
+
+// Returns the names of the chains, chains of the current NPM version first.
+func (chains Chains) names() []string {
+	var names, others []string
+	current := make(map[string]bool)
+	for _, chain := range npmChains {
+		current[chain] = true
+		if _, ok := chains[chain]; ok {
+			names = append(names, chain)
+		}
+	}
+
+	for chain := range chains {
+		if !current[chain] {
+			others = append(others, chain)
+		}
+	}
+	sort.Strings(others)
+
+	return append(names, others...)
+}
+
+// Returns whether a chain has the same rules in both chains.
+func (chains Chains) equal(other Chains, chain string) bool {
+	rules, ok := chains[chain]
+	otherRules, otherOk := other[chain]
+	if ok != otherOk || len(rules) != len(otherRules) {
+		return false
+	}
+
+	for i := range rules {
+		if rules[i] != otherRules[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RestorePayload returns the iptables-restore input that rewrites the chains which differ from the current chains.
+// Returns nil if no chain differs.
+func (chains Chains) RestorePayload(current Chains) []byte {
+	return chains.restorePayload(current, nil)
+}
+
+// restorePayload is RestorePayload with additional rules for chains not owned by NPM.
+func (chains Chains) restorePayload(current Chains, rules []string) []byte {
+	var changed []string
+	for _, chain := range chains.names() {
+		if !chains.equal(current, chain) {
+			changed = append(changed, chain)
+		}
+	}
+
+	if len(changed) == 0 && len(rules) == 0 {
+		return nil
+	}
+
+	var payload bytes.Buffer
+	fmt.Fprintf(&payload, "*%s\n", util.IptablesFilterTable)
+
+	// Declaring a chain with --noflush flushes it, so changed chains are rewritten as a whole.
+	for _, chain := range changed {
+		fmt.Fprintf(&payload, ":%s - [0:0]\n", chain)
+	}
+
+	for _, chain := range changed {
+		for _, rule := range chains[chain] {
+			fmt.Fprintf(&payload, "%s %s %s\n", util.IptablesAppendFlag, chain, rule)
+		}
+	}
+
+	for _, rule := range rules {
+		fmt.Fprintf(&payload, "%s\n", rule)
+	}
+
+	fmt.Fprintf(&payload, "%s\n", util.IptablesCommitFlag)
+
+	return payload.Bytes()
+}
+
+// parseNpmChains parses iptables-save output of the filter table.
+// Returns the AZURE-NPM chains, and whether the FORWARD chain jumps to AZURE-NPM.
+func parseNpmChains(save []byte) (Chains, bool) {
+	chains := make(Chains)
+	forwardJump := util.IptablesAppendFlag + " " + util.IptablesForwardChain + " " +
+		util.IptablesJumpFlag + " " + util.IptablesAzureChain
+	hasForwardJump := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(save))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, ":"):
+			fields := strings.Fields(line[1:])
+			if len(fields) > 0 && isNpmChain(fields[0]) {
+				if _, ok := chains[fields[0]]; !ok {
+					chains[fields[0]] = []string{}
+				}
+			}
+
+		case line == forwardJump:
+			hasForwardJump = true
+
+		case strings.HasPrefix(line, util.IptablesAppendFlag+" "):
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) == 3 && isNpmChain(fields[1]) {
+				chains[fields[1]] = append(chains[fields[1]], fields[2])
+			}
+		}
+	}
+
+	return chains, hasForwardJump
+}
+
+// getNpmChains reads the AZURE-NPM chains from iptables.
+// Returns the chains, and whether the FORWARD chain jumps to AZURE-NPM.
+func getNpmChains() (Chains, bool, error) {
+	out, err := exec.Command(util.IptablesSave, util.IptablesTableFlag, util.IptablesFilterTable).Output()
+	if err != nil {
+		log.Errorf("Error: failed to run iptables-save, err:%v.", err)
+		return nil, false, err
+	}
+
+	chains, hasForwardJump := parseNpmChains(out)
+	return chains, hasForwardJump, nil
+}
+
+// restoreNoFlush applies an iptables-restore payload without flushing chains it doesn't declare.
+// iptables-restore applies the payload in a single transaction and waits for the xtables lock itself.
+func restoreNoFlush(payload []byte) error {
+	cmdArgs := []string{util.IptablesWaitFlag, defaultlockWaitTimeInSeconds, util.IptablesNoFlushFlag}
+	log.Printf("Executing iptables-restore %v with payload:\n%s", cmdArgs, payload)
+
+	cmd := exec.Command(util.IptablesRestore, cmdArgs...)
+	cmd.Stdin = bytes.NewReader(payload)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Errorf("Error: failed to run iptables-restore, err:%v output:%s.", err, strings.TrimSpace(string(out)))
+		return err
+	}
+
+	return nil
+}
+
+// Returns the chains currently programmed in iptables.
+// The in-memory chains are used unless they are out of sync, e.g. after a failed iptables-restore.
+func (iptMgr *IptablesManager) getCurrentChains() (Chains, error) {
+	if iptMgr.synced {
+		return iptMgr.chains, nil
+	}
+
+	chains, _, err := getNpmChains()
+	return chains, err
+}
+
+// apply rewrites the chains that differ between the desired and the current chains, and adds rules
+// to chains not owned by NPM, with a single iptables-restore.
+func (iptMgr *IptablesManager) apply(desired, current Chains, rules []string) error {
+	if payload := desired.restorePayload(current, rules); payload != nil {
+		if err := restoreNoFlush(payload); err != nil {
+			// iptables-restore is transactional, but the current chains are read back to be safe.
+			iptMgr.synced = false
+			return err
+		}
+	}
+
+	iptMgr.chains = desired
+	iptMgr.synced = true
+
+	return nil
+}
+
+// AddEntries adds entries to the AZURE-NPM chains with a single iptables-restore.
+// Entries already in their chain are skipped.
+func (iptMgr *IptablesManager) AddEntries(entries []*IptEntry) error {
+	log.Printf("Adding %d iptables entries.", len(entries))
+
+	current, err := iptMgr.getCurrentChains()
+	if err != nil {
+		return err
+	}
+
+	var desired Chains
+	if iptMgr.chains == nil {
+		desired = NewNpmChains()
+	} else {
+		desired = iptMgr.chains.Copy()
+	}
+
+	for _, entry := range entries {
+		desired.Add(entry)
+	}
+
+	return iptMgr.apply(desired, current, nil)
+}
+
+// DeleteEntries deletes entries from the AZURE-NPM chains with a single iptables-restore.
+// Entries not in their chain are skipped.
+func (iptMgr *IptablesManager) DeleteEntries(entries []*IptEntry) error {
+	log.Printf("Deleting %d iptables entries.", len(entries))
+
+	if iptMgr.chains == nil {
+		log.Printf("AZURE-NPM chains are not initialized, no entries to delete.")
+		return nil
+	}
+
+	current, err := iptMgr.getCurrentChains()
+	if err != nil {
+		return err
+	}
+
+	desired := iptMgr.chains.Copy()
+	for _, entry := range entries {
+		desired.Delete(entry)
+	}
+
+	return iptMgr.apply(desired, current, nil)
+}
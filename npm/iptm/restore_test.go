@@ -0,0 +1,161 @@
+package iptm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+var testEntries = []*IptEntry{
+	&IptEntry{
+		Chain: util.IptablesAzureIngressPortChain,
+		Specs: []string{
+			util.IptablesProtFlag,
+			"TCP",
+			util.IptablesDstPortFlag,
+			"8000",
+			util.IptablesJumpFlag,
+			util.IptablesAccept,
+			util.IptablesModuleFlag,
+			util.IptablesCommentModuleFlag,
+			util.IptablesCommentFlag,
+			"ALLOW-ALL-TO-TCP-PORT-8000",
+		},
+	},
+	&IptEntry{
+		Chain: util.IptablesAzureTargetSetsChain,
+		Specs: []string{
+			util.IptablesModuleFlag,
+			util.IptablesSetModuleFlag,
+			util.IptablesMatchSetFlag,
+			"azure-npm-123",
+			util.IptablesDstFlag,
+			util.IptablesJumpFlag,
+			util.IptablesDrop,
+		},
+	},
+}
+
+func TestRestorePayload(t *testing.T) {
+	current := NewNpmChains()
+	chains := current.Copy()
+
+	if payload := chains.RestorePayload(current); payload != nil {
+		t.Errorf("TestRestorePayload failed @ unchanged chains payload: %s", payload)
+	}
+
+	for _, entry := range testEntries {
+		if !chains.Add(entry) {
+			t.Errorf("TestRestorePayload failed @ chains.Add")
+		}
+	}
+
+	// Adding an existing entry is a no-op.
+	if chains.Add(testEntries[0]) {
+		t.Errorf("TestRestorePayload failed @ chains.Add of existing entry")
+	}
+
+	expectedPayload := "*filter\n" +
+		":AZURE-NPM-INGRESS-PORT - [0:0]\n" +
+		":AZURE-NPM-TARGET-SETS - [0:0]\n" +
+		"-A AZURE-NPM-INGRESS-PORT -p TCP --dport 8000 -j ACCEPT -m comment --comment ALLOW-ALL-TO-TCP-PORT-8000\n" +
+		"-A AZURE-NPM-TARGET-SETS -m set --match-set azure-npm-123 dst -j DROP\n" +
+		"COMMIT\n"
+	if payload := string(chains.RestorePayload(current)); payload != expectedPayload {
+		t.Errorf("TestRestorePayload failed @ payload comparison")
+		t.Errorf("payload: %s", payload)
+		t.Errorf("expectedPayload: %s", expectedPayload)
+	}
+
+	// Deleting the entries rewrites the chains empty.
+	current = chains.Copy()
+	for _, entry := range testEntries {
+		if !chains.Delete(entry) {
+			t.Errorf("TestRestorePayload failed @ chains.Delete")
+		}
+	}
+
+	if chains.Delete(testEntries[0]) {
+		t.Errorf("TestRestorePayload failed @ chains.Delete of missing entry")
+	}
+
+	expectedPayload = "*filter\n" +
+		":AZURE-NPM-INGRESS-PORT - [0:0]\n" +
+		":AZURE-NPM-TARGET-SETS - [0:0]\n" +
+		"COMMIT\n"
+	if payload := string(chains.RestorePayload(current)); payload != expectedPayload {
+		t.Errorf("TestRestorePayload failed @ payload comparison after delete")
+		t.Errorf("payload: %s", payload)
+		t.Errorf("expectedPayload: %s", expectedPayload)
+	}
+
+	if !reflect.DeepEqual(chains, NewNpmChains()) {
+		t.Errorf("TestRestorePayload failed @ chains comparison after delete: %+v", chains)
+	}
+}
+
+func TestRestorePayloadQuotesArgs(t *testing.T) {
+	chains := make(Chains)
+	chains.Add(&IptEntry{
+		Chain: util.IptablesAzureChain,
+		Specs: []string{util.IptablesModuleFlag, util.IptablesCommentModuleFlag, util.IptablesCommentFlag, `allow "all" pods`},
+	})
+
+	expectedPayload := "*filter\n" +
+		":AZURE-NPM - [0:0]\n" +
+		`-A AZURE-NPM -m comment --comment "allow \"all\" pods"` + "\n" +
+		"COMMIT\n"
+	if payload := string(chains.RestorePayload(Chains{})); payload != expectedPayload {
+		t.Errorf("TestRestorePayloadQuotesArgs failed @ payload comparison")
+		t.Errorf("payload: %s", payload)
+		t.Errorf("expectedPayload: %s", expectedPayload)
+	}
+}
+
+func TestParseNpmChains(t *testing.T) {
+	save := "# Generated by iptables-save v1.6.1\n" +
+		"*filter\n" +
+		":INPUT ACCEPT [0:0]\n" +
+		":FORWARD ACCEPT [0:0]\n" +
+		":AZURE-NPM - [0:0]\n" +
+		":AZURE-NPM-KUBE-SYSTEM - [0:0]\n" +
+		":AZURE-NPM-INGRESS-PORT - [0:0]\n" +
+		":AZURE-NPM-INGRESS-FROM - [0:0]\n" +
+		":AZURE-NPM-EGRESS-PORT - [0:0]\n" +
+		":AZURE-NPM-EGRESS-TO - [0:0]\n" +
+		":AZURE-NPM-TARGET-SETS - [0:0]\n" +
+		":KUBE-FORWARD - [0:0]\n" +
+		"-A FORWARD -j AZURE-NPM\n" +
+		"-A FORWARD -j KUBE-FORWARD\n" +
+		"-A AZURE-NPM -m state --state RELATED,ESTABLISHED -j ACCEPT\n" +
+		"-A AZURE-NPM -j AZURE-NPM-KUBE-SYSTEM\n" +
+		"-A AZURE-NPM -j AZURE-NPM-INGRESS-PORT\n" +
+		"-A AZURE-NPM -j AZURE-NPM-EGRESS-PORT\n" +
+		"-A AZURE-NPM -j AZURE-NPM-TARGET-SETS\n" +
+		"-A AZURE-NPM-TARGET-SETS -m set --match-set azure-npm-123 dst -j DROP\n" +
+		"-A KUBE-FORWARD -j ACCEPT\n" +
+		"COMMIT\n"
+
+	chains, hasForwardJump := parseNpmChains([]byte(save))
+	if !hasForwardJump {
+		t.Errorf("TestParseNpmChains failed @ FORWARD chain jump")
+	}
+
+	expectedChains := NewNpmChains()
+	expectedChains.Add(testEntries[1])
+	if !reflect.DeepEqual(chains, expectedChains) {
+		t.Errorf("TestParseNpmChains failed @ chains comparison")
+		t.Errorf("chains: %+v", chains)
+		t.Errorf("expectedChains: %+v", expectedChains)
+	}
+
+	if payload := expectedChains.RestorePayload(chains); payload != nil {
+		t.Errorf("TestParseNpmChains failed @ payload of parsed chains: %s", payload)
+	}
+
+	chains, hasForwardJump = parseNpmChains([]byte("*filter\n:FORWARD ACCEPT [0:0]\nCOMMIT\n"))
+	if hasForwardJump || len(chains) != 0 {
+		t.Errorf("TestParseNpmChains failed @ empty filter table: %+v", chains)
+	}
+}
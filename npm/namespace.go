@@ -55,6 +55,10 @@ func (ns *namespace) policyExists(npObj *networkingv1.NetworkPolicy) bool {
 // InitAllNsList syncs all-namespace ipset list.
 func (npMgr *NetworkPolicyManager) InitAllNsList() error {
 	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	if allNs == nil {
+		return nil
+	}
+
 	for ns:= range npMgr.nsMap {
 		if ns == util.KubeAllNamespacesFlag {
 			continue
@@ -66,12 +70,16 @@ func (npMgr *NetworkPolicyManager) InitAllNsList() error {
 		}
 	}
 
-	return nil
+	return allNs.ipsMgr.Flush()
 }
 
 // UninitAllNsList cleans all-namespace ipset list.
 func (npMgr *NetworkPolicyManager) UninitAllNsList() error {
 	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	if allNs == nil {
+		return nil
+	}
+
 	for ns := range npMgr.nsMap {
 		if ns == util.KubeAllNamespacesFlag {
 			continue
@@ -83,7 +91,7 @@ func (npMgr *NetworkPolicyManager) UninitAllNsList() error {
 		}
 	}
 
-	return nil
+	return allNs.ipsMgr.Flush()
 }
 
 // AddNamespace handles adding namespace to ipset.
@@ -126,6 +134,11 @@ func (npMgr *NetworkPolicyManager) AddNamespace(nsObj *corev1.Namespace) error {
 		}
 	}
 
+	if err = ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to add namespace %s to ipsets.", nsName)
+		return err
+	}
+
 	ns, err := newNs(nsName)
 	if err != nil {
 		log.Errorf("Error: failed to create namespace %s", nsName)
@@ -205,6 +218,11 @@ func (npMgr *NetworkPolicyManager) DeleteNamespace(nsObj *corev1.Namespace) erro
 		return err
 	}
 
+	if err = ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to delete namespace %s from ipsets.", nsName)
+		return err
+	}
+
 	delete(npMgr.nsMap, nsName)
 
 	return nil
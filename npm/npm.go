@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	networkinginformers "k8s.io/client-go/informers/networking/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 const (
@@ -30,6 +32,12 @@ const (
 	backupWaitTimeInSeconds       = 60
 	telemetryRetryTimeInSeconds   = 60
 	heartbeatIntervalInMinutes    = 30
+
+	workQueueMaxRetries              = 10
+	workQueueInitialBackoffInSeconds = 1
+	workQueueMaxBackoffInSeconds     = 300
+	workQueueRetryQPS                = 10
+	workQueueRetryBurst              = 100
 )
 
 // reports channel
@@ -45,8 +53,14 @@ type NetworkPolicyManager struct {
 	nsInformer      coreinformers.NamespaceInformer
 	npInformer      networkinginformers.NetworkPolicyInformer
 
+	podQueue *workQueue
+	nsQueue  *workQueue
+	npQueue  *workQueue
+
 	nodeName                     string
 	nsMap                        map[string]*namespace
+	podSetRefs                   map[string]int      // Number of applied network policies using each pod ipset, in node-local mode.
+	policyPodSets                map[string][]string // Pod ipsets used by each applied network policy, in node-local mode.
 	isAzureNpmChainCreated       bool
 	isSafeToCleanUpAzureNpmChain bool
 
@@ -166,6 +180,11 @@ func (npMgr *NetworkPolicyManager) backup() {
 
 // Start starts shared informers and waits for the shared informer cache to sync.
 func (npMgr *NetworkPolicyManager) Start(stopCh <-chan struct{}) error {
+	// Starts handling the events queued by the informers.
+	go npMgr.podQueue.run(stopCh)
+	go npMgr.nsQueue.run(stopCh)
+	go npMgr.npQueue.run(stopCh)
+
 	// Starts all informers manufactured by npMgr's informerFactory.
 	npMgr.informerFactory.Start(stopCh)
 
@@ -187,6 +206,36 @@ func (npMgr *NetworkPolicyManager) Start(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// newNpmWorkQueue creates a work queue for the events of a resource.
+func newNpmWorkQueue(name string) *workQueue {
+	return newWorkQueue(
+		name,
+		workQueueMaxRetries,
+		flowcontrol.NewBackOff(workQueueInitialBackoffInSeconds*time.Second, workQueueMaxBackoffInSeconds*time.Second),
+		flowcontrol.NewTokenBucketRateLimiter(workQueueRetryQPS, workQueueRetryBurst),
+	)
+}
+
+// Returns the key of an object of an informer event.
+func getObjectKey(obj interface{}) string {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Errorf("Error: failed to get key of object %+v, err:%v.", obj, err)
+	}
+
+	return key
+}
+
+// Returns the object of an informer delete event.
+// Objects whose deletion was missed by the informer are wrapped in a tombstone.
+func getDeletedObject(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+
+	return obj
+}
+
 // NewNetworkPolicyManager creates a NetworkPolicyManager
 func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory informers.SharedInformerFactory, npmVersion string) *NetworkPolicyManager {
 	// Clear out left over iptables states
@@ -210,14 +259,27 @@ func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory in
 		panic(err.Error)
 	}
 
+	// In node-local mode, only the pods on this node populate the ipsets of the pods selected by network policies,
+	// while the pods of all nodes populate the ipsets of peers. Pod label and named port ipsets not used by any
+	// network policy are left empty, so that pods of other nodes only update the ipsets of peers.
+	if nodeLocalMode, err := strconv.ParseBool(os.Getenv(util.NodeLocalModeEnv)); err == nil {
+		util.IsNodeLocalModeFlag = nodeLocalMode
+	}
+	log.Logf("Node-local mode: %v", util.IsNodeLocalModeFlag)
+
 	npMgr := &NetworkPolicyManager{
 		clientset:                    clientset,
 		informerFactory:              informerFactory,
 		podInformer:                  podInformer,
 		nsInformer:                   nsInformer,
 		npInformer:                   npInformer,
+		podQueue:                     newNpmWorkQueue("pod"),
+		nsQueue:                      newNpmWorkQueue("namespace"),
+		npQueue:                      newNpmWorkQueue("network policy"),
 		nodeName:                     os.Getenv("HOSTNAME"),
 		nsMap:                        make(map[string]*namespace),
+		podSetRefs:                   make(map[string]int),
+		policyPodSets:                make(map[string][]string),
 		isAzureNpmChainCreated:       false,
 		isSafeToCleanUpAzureNpmChain: false,
 		clusterState: telemetry.ClusterState{
@@ -251,17 +313,36 @@ func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory in
 		log.Logf("Error: failed to create ipset for namespace %s.", kubeSystemNs)
 	}
 
+	// Clear out left over ipsets, which are no longer referred once iptables is cleaned.
+	if err := allNs.ipsMgr.Reconcile(); err != nil {
+		log.Logf("Error: failed to reconcile ipsets.")
+	}
+
+	// Events are handled by work queues, so that failed events are retried.
 	podInformer.Informer().AddEventHandler(
 		// Pod event handlers
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				npMgr.AddPod(obj.(*corev1.Pod))
+				podObj := obj.(*corev1.Pod)
+				npMgr.podQueue.add(getObjectKey(obj), "add", func() error {
+					return npMgr.AddPod(podObj)
+				})
 			},
 			UpdateFunc: func(old, new interface{}) {
-				npMgr.UpdatePod(old.(*corev1.Pod), new.(*corev1.Pod))
+				oldPodObj, newPodObj := old.(*corev1.Pod), new.(*corev1.Pod)
+				npMgr.podQueue.add(getObjectKey(new), "update", func() error {
+					return npMgr.UpdatePod(oldPodObj, newPodObj)
+				})
 			},
 			DeleteFunc: func(obj interface{}) {
-				npMgr.DeletePod(obj.(*corev1.Pod))
+				podObj, ok := getDeletedObject(obj).(*corev1.Pod)
+				if !ok {
+					log.Errorf("Error: unexpected object in pod delete event %+v.", obj)
+					return
+				}
+				npMgr.podQueue.add(getObjectKey(obj), "delete", func() error {
+					return npMgr.DeletePod(podObj)
+				})
 			},
 		},
 	)
@@ -270,13 +351,26 @@ func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory in
 		// Namespace event handlers
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				npMgr.AddNamespace(obj.(*corev1.Namespace))
+				nsObj := obj.(*corev1.Namespace)
+				npMgr.nsQueue.add(getObjectKey(obj), "add", func() error {
+					return npMgr.AddNamespace(nsObj)
+				})
 			},
 			UpdateFunc: func(old, new interface{}) {
-				npMgr.UpdateNamespace(old.(*corev1.Namespace), new.(*corev1.Namespace))
+				oldNsObj, newNsObj := old.(*corev1.Namespace), new.(*corev1.Namespace)
+				npMgr.nsQueue.add(getObjectKey(new), "update", func() error {
+					return npMgr.UpdateNamespace(oldNsObj, newNsObj)
+				})
 			},
 			DeleteFunc: func(obj interface{}) {
-				npMgr.DeleteNamespace(obj.(*corev1.Namespace))
+				nsObj, ok := getDeletedObject(obj).(*corev1.Namespace)
+				if !ok {
+					log.Errorf("Error: unexpected object in namespace delete event %+v.", obj)
+					return
+				}
+				npMgr.nsQueue.add(getObjectKey(obj), "delete", func() error {
+					return npMgr.DeleteNamespace(nsObj)
+				})
 			},
 		},
 	)
@@ -285,13 +379,26 @@ func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory in
 		// Network policy event handlers
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				npMgr.AddNetworkPolicy(obj.(*networkingv1.NetworkPolicy))
+				npObj := obj.(*networkingv1.NetworkPolicy)
+				npMgr.npQueue.add(getObjectKey(obj), "add", func() error {
+					return npMgr.AddNetworkPolicy(npObj)
+				})
 			},
 			UpdateFunc: func(old, new interface{}) {
-				npMgr.UpdateNetworkPolicy(old.(*networkingv1.NetworkPolicy), new.(*networkingv1.NetworkPolicy))
+				oldNpObj, newNpObj := old.(*networkingv1.NetworkPolicy), new.(*networkingv1.NetworkPolicy)
+				npMgr.npQueue.add(getObjectKey(new), "update", func() error {
+					return npMgr.UpdateNetworkPolicy(oldNpObj, newNpObj)
+				})
 			},
 			DeleteFunc: func(obj interface{}) {
-				npMgr.DeleteNetworkPolicy(obj.(*networkingv1.NetworkPolicy))
+				npObj, ok := getDeletedObject(obj).(*networkingv1.NetworkPolicy)
+				if !ok {
+					log.Errorf("Error: unexpected object in network policy delete event %+v.", obj)
+					return
+				}
+				npMgr.npQueue.add(getObjectKey(obj), "delete", func() error {
+					return npMgr.DeleteNetworkPolicy(npObj)
+				})
 			},
 		},
 	)
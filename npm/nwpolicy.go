@@ -3,12 +3,19 @@
 package npm
 
 import (
+	"strings"
+
 	"github.com/Azure/azure-container-networking/log"
-	"github.com/Azure/azure-container-networking/npm/iptm"
 	"github.com/Azure/azure-container-networking/npm/util"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+// Reason of the events recorded on network policies that cannot be translated.
+const invalidPolicyEventReason = "InvalidNetworkPolicy"
+
 func (npMgr *NetworkPolicyManager) canCleanUpNpmChains() bool {
 	if !npMgr.isSafeToCleanUpAzureNpmChain {
 		return false
@@ -23,6 +30,41 @@ func (npMgr *NetworkPolicyManager) canCleanUpNpmChains() bool {
 	return true
 }
 
+// recordInvalidPolicyEvent records a warning event on a network policy that cannot be translated.
+func (npMgr *NetworkPolicyManager) recordInvalidPolicyEvent(npObj *networkingv1.NetworkPolicy, message string) {
+	if npMgr.clientset == nil {
+		return
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: npObj.ObjectMeta.Name + ".",
+			Namespace:    npObj.ObjectMeta.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "NetworkPolicy",
+			APIVersion:      networkingv1.SchemeGroupVersion.String(),
+			Namespace:       npObj.ObjectMeta.Namespace,
+			Name:            npObj.ObjectMeta.Name,
+			UID:             npObj.ObjectMeta.UID,
+			ResourceVersion: npObj.ObjectMeta.ResourceVersion,
+		},
+		Reason:         invalidPolicyEventReason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: util.AzureNpmFlag, Host: npMgr.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+	}
+
+	if _, err := npMgr.clientset.CoreV1().Events(npObj.ObjectMeta.Namespace).Create(event); err != nil {
+		log.Errorf("Error: failed to record event on network policy %s/%s, err:%v.",
+			npObj.ObjectMeta.Namespace, npObj.ObjectMeta.Name, err)
+	}
+}
+
 // AddNetworkPolicy handles adding network policy to iptables.
 func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkPolicy) error {
 	npMgr.Lock()
@@ -36,6 +78,14 @@ func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkP
 	npNs, npName := "ns-"+npObj.ObjectMeta.Namespace, npObj.ObjectMeta.Name
 	log.Printf("NETWORK POLICY CREATING: %v", npObj)
 
+	// Invalid policies are not programmed, so that they don't affect other policies selecting the same pods.
+	// Retrying cannot make the policy valid, so the error is permanent.
+	if err = validatePolicy(npObj); err != nil {
+		log.Errorf("Error: network policy %s/%s cannot be translated, err:%v.", npObj.ObjectMeta.Namespace, npName, err)
+		npMgr.recordInvalidPolicyEvent(npObj, err.Error())
+		return newPermanentError(err)
+	}
+
 	var exists bool
 	if ns, exists = npMgr.nsMap[npNs]; !exists {
 		ns, err = newNs(npNs)
@@ -69,7 +119,8 @@ func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkP
 
 	var addedPolicy *networkingv1.NetworkPolicy
 	addedPolicy = nil
-	if oldPolicy, oldPolicyExists := ns.processedNpMap[hashedSelector]; oldPolicyExists {
+	oldPolicy, oldPolicyExists := ns.processedNpMap[hashedSelector]
+	if oldPolicyExists {
 		addedPolicy, err = addPolicy(oldPolicy, npObj)
 		if err != nil {
 			log.Printf("Error adding policy %s to %s", npName, oldPolicy.ObjectMeta.Name)
@@ -79,17 +130,36 @@ func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkP
 		npMgr.DeleteNetworkPolicy(oldPolicy)
 		npMgr.Lock()
 		npMgr.isSafeToCleanUpAzureNpmChain = true
-	} else {
-		ns.processedNpMap[hashedSelector] = npObj
 	}
 
-	var sets, lists []string
-	var iptEntries []*iptm.IptEntry
 	if addedPolicy != nil {
-		sets, lists, iptEntries = translatePolicy(addedPolicy)
+		err = npMgr.applyPolicy(addedPolicy)
 	} else {
-		sets, lists, iptEntries = translatePolicy(npObj)
+		err = npMgr.applyPolicy(npObj)
+	}
+
+	// The processed policies are only updated once the policy is applied, so that a retry starts over.
+	if err != nil {
+		if oldPolicyExists {
+			ns.processedNpMap[hashedSelector] = oldPolicy
+		}
+		return err
+	}
+
+	if !oldPolicyExists {
+		ns.processedNpMap[hashedSelector] = npObj
 	}
+
+	return nil
+}
+
+// applyPolicy creates the ipsets of a network policy and applies its iptables rules.
+// Must be called with the network policy manager locked.
+func (npMgr *NetworkPolicyManager) applyPolicy(npObj *networkingv1.NetworkPolicy) error {
+	var err error
+
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	sets, lists, iptEntries := translatePolicy(npObj)
 	ipsMgr := allNs.ipsMgr
 	for _, set := range sets {
 		log.Printf("Creating set: %v, hashedSet: %v", set, util.GetHashedName(set))
@@ -104,18 +174,123 @@ func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkP
 			return err
 		}
 	}
+	if err = npMgr.updatePolicyPodSets(npObj, sets); err != nil {
+		log.Errorf("Error: failed to populate pod ipsets of network policy %s.", npObj.ObjectMeta.Name)
+		return err
+	}
+	// Applies the ipsets before the iptables rules referring to them.
 	if err = npMgr.InitAllNsList(); err != nil {
 		log.Printf("Error initializing all-namespace ipset list.")
 		return err
 	}
-	iptMgr := allNs.iptMgr
-	for _, iptEntry := range iptEntries {
-		if err = iptMgr.Add(iptEntry); err != nil {
-			log.Errorf("Error: failed to apply iptables rule. Rule: %+v", iptEntry)
+	if err = allNs.iptMgr.AddEntries(iptEntries); err != nil {
+		log.Errorf("Error: failed to apply iptables rules of network policy %s.", npObj.ObjectMeta.Name)
+		return err
+	}
+
+	return nil
+}
+
+// Returns whether an ipset of a network policy is populated by pod labels or named ports.
+func isPodSet(setName string) bool {
+	return !strings.HasPrefix(setName, "ns-") && !strings.HasPrefix(setName, util.NodeLocalIPSetPrefix)
+}
+
+// updatePolicyPodSets records the pod ipsets used by a network policy, or releases them if sets is nil.
+// In node-local mode, pod ipsets used for the first time are populated with the pods of the cluster,
+// and pod ipsets no longer used are emptied. Must be called with the network policy manager locked.
+func (npMgr *NetworkPolicyManager) updatePolicyPodSets(npObj *networkingv1.NetworkPolicy, sets []string) error {
+	if !util.IsNodeLocalModeFlag {
+		return nil
+	}
+
+	if npMgr.podSetRefs == nil {
+		npMgr.podSetRefs = make(map[string]int)
+		npMgr.policyPodSets = make(map[string][]string)
+	}
+
+	key := npObj.ObjectMeta.Namespace + "/" + npObj.ObjectMeta.Name
+	ipsMgr := npMgr.nsMap[util.KubeAllNamespacesFlag].ipsMgr
+
+	var podSets []string
+	newSets := make(map[string]bool)
+	for _, set := range sets {
+		if !isPodSet(set) {
+			continue
+		}
+
+		podSets = append(podSets, set)
+		npMgr.podSetRefs[set]++
+		if npMgr.podSetRefs[set] == 1 {
+			newSets[set] = true
+		}
+	}
+
+	// References are taken before the previous ones are released, so that ipsets still used are kept.
+	for _, set := range npMgr.policyPodSets[key] {
+		npMgr.podSetRefs[set]--
+		if npMgr.podSetRefs[set] > 0 {
+			continue
+		}
+
+		delete(npMgr.podSetRefs, set)
+		delete(newSets, set)
+		log.Printf("Emptying ipset %s no longer used by network policies", set)
+		if err := ipsMgr.EmptySet(set); err != nil {
 			return err
 		}
 	}
 
+	if sets == nil {
+		delete(npMgr.policyPodSets, key)
+	} else {
+		npMgr.policyPodSets[key] = podSets
+	}
+
+	return npMgr.populatePodSets(newSets)
+}
+
+// populatePodSets adds the pods of the cluster to the given pod label and named port ipsets.
+func (npMgr *NetworkPolicyManager) populatePodSets(sets map[string]bool) error {
+	if len(sets) == 0 || npMgr.podInformer == nil {
+		return nil
+	}
+
+	pods, err := npMgr.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	ipsMgr := npMgr.nsMap[util.KubeAllNamespacesFlag].ipsMgr
+	for _, podObj := range pods {
+		if !isValidPod(podObj) {
+			continue
+		}
+
+		podIP := podObj.Status.PodIP
+		for _, setName := range getPodLabelSets(podObj) {
+			if !sets[setName] {
+				continue
+			}
+
+			log.Printf("Adding pod %s to ipset %s", podIP, setName)
+			if err = ipsMgr.AddToSet(setName, podIP); err != nil {
+				return err
+			}
+		}
+
+		for setName, element := range getNamedPortSetElements(podObj) {
+			if !sets[setName] {
+				continue
+			}
+
+			log.Printf("Adding %s to ipset %s", element, setName)
+			if err = ipsMgr.AddToSet(setName, element); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -165,11 +340,18 @@ func (npMgr *NetworkPolicyManager) DeleteNetworkPolicy(npObj *networkingv1.Netwo
 	_, _, iptEntries := translatePolicy(npObj)
 
 	iptMgr := allNs.iptMgr
-	for _, iptEntry := range iptEntries {
-		if err = iptMgr.Delete(iptEntry); err != nil {
-			log.Errorf("Error: failed to apply iptables rule. Rule: %+v", iptEntry)
-			return err
-		}
+	if err = iptMgr.DeleteEntries(iptEntries); err != nil {
+		log.Errorf("Error: failed to delete iptables rules of network policy %s.", npName)
+		return err
+	}
+
+	if err = npMgr.updatePolicyPodSets(npObj, nil); err != nil {
+		log.Errorf("Error: failed to release pod ipsets of network policy %s.", npName)
+		return err
+	}
+	if err = allNs.ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to empty pod ipsets of network policy %s.", npName)
+		return err
 	}
 
 	hashedSelector := HashSelector(&npObj.Spec.PodSelector)
@@ -3,6 +3,7 @@
 package npm
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/npm/ipsm"
@@ -14,8 +15,23 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
+// fakePodInformer lists pods from an indexer, without an API server.
+type fakePodInformer struct {
+	indexer cache.Indexer
+}
+
+func (informer *fakePodInformer) Informer() cache.SharedIndexInformer {
+	return nil
+}
+
+func (informer *fakePodInformer) Lister() corelisters.PodLister {
+	return corelisters.NewPodLister(informer.indexer)
+}
+
 func TestAddNetworkPolicy(t *testing.T) {
 	npMgr := &NetworkPolicyManager{
 		nsMap:            make(map[string]*namespace),
@@ -326,3 +342,71 @@ func TestDeleteNetworkPolicy(t *testing.T) {
 		t.Errorf("TestDeleteNetworkPolicy failed @ DeleteNetworkPolicy")
 	}
 }
+
+func TestUpdatePolicyPodSets(t *testing.T) {
+	util.IsNodeLocalModeFlag = true
+	defer func() { util.IsNodeLocalModeFlag = false }()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, labels := range map[string]map[string]string{"frontend": {"app": "frontend"}, "backend": {"app": "backend"}} {
+		indexer.Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test-nwpolicy",
+				Labels:    labels,
+			},
+			Status: corev1.PodStatus{
+				PodIP: "10.0.0." + strconv.Itoa(len(name)),
+			},
+		})
+	}
+
+	npMgr := &NetworkPolicyManager{
+		nsMap:       make(map[string]*namespace),
+		podInformer: &fakePodInformer{indexer: indexer},
+	}
+
+	allNs, err := newNs(util.KubeAllNamespacesFlag)
+	if err != nil {
+		t.Fatalf("TestUpdatePolicyPodSets failed @ newNs")
+	}
+	npMgr.nsMap[util.KubeAllNamespacesFlag] = allNs
+	ipsMgr := allNs.ipsMgr
+
+	policy := func(name string) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-nwpolicy"}}
+	}
+
+	// Pod ipsets used by a network policy are populated with the pods of all nodes.
+	sets := []string{"ns-test-nwpolicy", "local:app:backend", "app:frontend"}
+	if err := npMgr.updatePolicyPodSets(policy("first"), sets); err != nil {
+		t.Errorf("TestUpdatePolicyPodSets failed @ updatePolicyPodSets of first policy")
+	}
+	if err := npMgr.updatePolicyPodSets(policy("second"), []string{"app:frontend"}); err != nil {
+		t.Errorf("TestUpdatePolicyPodSets failed @ updatePolicyPodSets of second policy")
+	}
+
+	if !npMgr.isPodSetUsed("app:frontend") || !ipsMgr.Exists("app:frontend", "10.0.0.8", util.IpsetNetHashFlag) {
+		t.Errorf("TestUpdatePolicyPodSets failed @ ipset used by network policies")
+	}
+
+	// Pod ipsets not used by network policies are not populated.
+	if npMgr.isPodSetUsed("app:backend") || ipsMgr.Exists("app:backend", "10.0.0.7", util.IpsetNetHashFlag) {
+		t.Errorf("TestUpdatePolicyPodSets failed @ ipset not used by network policies")
+	}
+
+	// Pod ipsets are emptied once no network policy uses them.
+	if err := npMgr.updatePolicyPodSets(policy("first"), nil); err != nil {
+		t.Errorf("TestUpdatePolicyPodSets failed @ updatePolicyPodSets release of first policy")
+	}
+	if !ipsMgr.Exists("app:frontend", "10.0.0.8", util.IpsetNetHashFlag) {
+		t.Errorf("TestUpdatePolicyPodSets failed @ ipset still used by second policy")
+	}
+
+	if err := npMgr.updatePolicyPodSets(policy("second"), nil); err != nil {
+		t.Errorf("TestUpdatePolicyPodSets failed @ updatePolicyPodSets release of second policy")
+	}
+	if npMgr.isPodSetUsed("app:frontend") || ipsMgr.Exists("app:frontend", "10.0.0.8", util.IpsetNetHashFlag) {
+		t.Errorf("TestUpdatePolicyPodSets failed @ ipset no longer used by network policies")
+	}
+}
@@ -17,6 +17,60 @@ func isSystemPod(podObj *corev1.Pod) bool {
 	return podObj.ObjectMeta.Namespace == util.KubeSystemFlag
 }
 
+// Returns the elements of the pod in the named port ipsets, by ipset.
+func getNamedPortSetElements(podObj *corev1.Pod) map[string]string {
+	elements := make(map[string]string)
+	for _, container := range podObj.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == "" {
+				continue
+			}
+
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = corev1.ProtocolTCP
+			}
+
+			setName := util.NamedPortIPSetPrefix + port.Name
+			elements[setName] = util.GetNamedPortSetElement(podObj.Status.PodIP, string(protocol), port.ContainerPort)
+		}
+	}
+
+	return elements
+}
+
+// Returns the ipsets of the labels of a pod.
+func getPodLabelSets(podObj *corev1.Pod) []string {
+	var sets []string
+	podLabelKeys, podLabelVals := util.SortMap(&podObj.ObjectMeta.Labels)
+	for i := range podLabelKeys {
+		sets = append(sets, podLabelKeys[i], podLabelKeys[i]+":"+podLabelVals[i])
+	}
+
+	return sets
+}
+
+// Returns whether pods populate a pod label or named port ipset.
+// In node-local mode, only the ipsets used by network policies are populated.
+func (npMgr *NetworkPolicyManager) isPodSetUsed(setName string) bool {
+	return !util.IsNodeLocalModeFlag || npMgr.podSetRefs[setName] > 0
+}
+
+// Returns whether a pod populates the node-local ipsets, which hold the pods on this node in node-local mode.
+func (npMgr *NetworkPolicyManager) isNodeLocalPod(podObj *corev1.Pod) bool {
+	return util.IsNodeLocalModeFlag && podObj.Spec.NodeName == npMgr.nodeName
+}
+
+// Returns the node-local ipsets of the namespace and labels of a pod.
+func getNodeLocalSets(podObj *corev1.Pod) []string {
+	sets := []string{util.GetNodeLocalSetName("ns-" + podObj.ObjectMeta.Namespace)}
+	for _, setName := range getPodLabelSets(podObj) {
+		sets = append(sets, util.GetNodeLocalSetName(setName))
+	}
+
+	return sets
+}
+
 // AddPod handles adding pod ip to its label's ipset.
 func (npMgr *NetworkPolicyManager) AddPod(podObj *corev1.Pod) error {
 	npMgr.Lock()
@@ -45,21 +99,47 @@ func (npMgr *NetworkPolicyManager) AddPod(podObj *corev1.Pod) error {
 	}
 
 	// Add the pod to its label's ipset.
-	for podLabelKey, podLabelVal := range podLabels {
-		log.Printf("Adding pod %s to ipset %s", podIP, podLabelKey)
-		if err = ipsMgr.AddToSet(podLabelKey, podIP); err != nil {
+	for _, setName := range getPodLabelSets(podObj) {
+		if !npMgr.isPodSetUsed(setName) {
+			continue
+		}
+
+		log.Printf("Adding pod %s to ipset %s", podIP, setName)
+		if err = ipsMgr.AddToSet(setName, podIP); err != nil {
 			log.Errorf("Error: failed to add pod to label ipset.")
 			return err
 		}
+	}
 
-		label := podLabelKey + ":" + podLabelVal
-		log.Printf("Adding pod %s to ipset %s", podIP, label)
-		if err = ipsMgr.AddToSet(label, podIP); err != nil {
-			log.Errorf("Error: failed to add pod to label ipset.")
+	// Add the pod on this node to the ipsets of the pods selected by network policies.
+	if npMgr.isNodeLocalPod(podObj) {
+		for _, setName := range getNodeLocalSets(podObj) {
+			log.Printf("Adding pod %s to ipset %s", podIP, setName)
+			if err = ipsMgr.AddToSet(setName, podIP); err != nil {
+				log.Errorf("Error: failed to add pod to node-local ipset.")
+				return err
+			}
+		}
+	}
+
+	// Add the pod to its named ports' ipsets.
+	for setName, element := range getNamedPortSetElements(podObj) {
+		if !npMgr.isPodSetUsed(setName) {
+			continue
+		}
+
+		log.Printf("Adding %s to ipset %s", element, setName)
+		if err = ipsMgr.AddToSet(setName, element); err != nil {
+			log.Errorf("Error: failed to add pod to named port ipset.")
 			return err
 		}
 	}
 
+	if err = ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to add pod %s to ipsets.", podIP)
+		return err
+	}
+
 	ns, err := newNs(podNs)
 	if err != nil {
 		log.Errorf("Error: failed to create namespace %s", podNs)
@@ -134,20 +214,46 @@ func (npMgr *NetworkPolicyManager) DeletePod(podObj *corev1.Pod) error {
 		return err
 	}
 	// Delete the pod from its label's ipset.
-	for podLabelKey, podLabelVal := range podLabels {
-		log.Printf("Deleting pod %s from ipset %s", podIP, podLabelKey)
-		if err = ipsMgr.DeleteFromSet(podLabelKey, podIP); err != nil {
+	for _, setName := range getPodLabelSets(podObj) {
+		if !npMgr.isPodSetUsed(setName) {
+			continue
+		}
+
+		log.Printf("Deleting pod %s from ipset %s", podIP, setName)
+		if err = ipsMgr.DeleteFromSet(setName, podIP); err != nil {
 			log.Errorf("Error: failed to delete pod from label ipset.")
 			return err
 		}
+	}
 
-		label := podLabelKey + ":" + podLabelVal
-		log.Printf("Deleting pod %s from ipset %s", podIP, label)
-		if err = ipsMgr.DeleteFromSet(label, podIP); err != nil {
-			log.Errorf("Error: failed to delete pod from label ipset.")
+	// Delete the pod on this node from the ipsets of the pods selected by network policies.
+	if npMgr.isNodeLocalPod(podObj) {
+		for _, setName := range getNodeLocalSets(podObj) {
+			log.Printf("Deleting pod %s from ipset %s", podIP, setName)
+			if err = ipsMgr.DeleteFromSet(setName, podIP); err != nil {
+				log.Errorf("Error: failed to delete pod from node-local ipset.")
+				return err
+			}
+		}
+	}
+
+	// Delete the pod from its named ports' ipsets.
+	for setName, element := range getNamedPortSetElements(podObj) {
+		if !npMgr.isPodSetUsed(setName) {
+			continue
+		}
+
+		log.Printf("Deleting %s from ipset %s", element, setName)
+		if err = ipsMgr.DeleteFromSet(setName, element); err != nil {
+			log.Errorf("Error: failed to delete pod from named port ipset.")
 			return err
 		}
 	}
 
+	if err = ipsMgr.Flush(); err != nil {
+		log.Errorf("Error: failed to delete pod %s from ipsets.", podIP)
+		return err
+	}
+
 	return nil
 }
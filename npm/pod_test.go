@@ -3,6 +3,7 @@
 package npm
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/npm/ipsm"
@@ -35,6 +36,104 @@ func TestisSystemPod(t *testing.T) {
 	}
 }
 
+func TestGetNamedPortSetElements(t *testing.T) {
+	podObj := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				corev1.Container{
+					Ports: []corev1.ContainerPort{
+						corev1.ContainerPort{
+							Name:          "http",
+							ContainerPort: 8080,
+						},
+						corev1.ContainerPort{
+							ContainerPort: 8081,
+						},
+					},
+				},
+				corev1.Container{
+					Ports: []corev1.ContainerPort{
+						corev1.ContainerPort{
+							Name:          "dns",
+							ContainerPort: 53,
+							Protocol:      corev1.ProtocolUDP,
+						},
+						corev1.ContainerPort{
+							Name:          "s1ap",
+							ContainerPort: 36412,
+							Protocol:      corev1.ProtocolSCTP,
+						},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			PodIP: "1.2.3.4",
+		},
+	}
+
+	elements := getNamedPortSetElements(podObj)
+	expectedElements := map[string]string{
+		"namedport:http": "1.2.3.4,tcp:8080",
+		"namedport:dns":  "1.2.3.4,udp:53",
+		"namedport:s1ap": "1.2.3.4,sctp:36412",
+	}
+	if !reflect.DeepEqual(elements, expectedElements) {
+		t.Errorf("TestGetNamedPortSetElements failed @ elements comparison")
+		t.Errorf("elements: %v", elements)
+		t.Errorf("expectedElements: %v", expectedElements)
+	}
+}
+
+func TestGetNodeLocalSets(t *testing.T) {
+	npMgr := &NetworkPolicyManager{
+		nodeName: "test-node",
+	}
+
+	podObj := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test-namespace",
+			Labels: map[string]string{
+				"app":  "test-pod",
+				"tier": "frontend",
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "test-node",
+		},
+	}
+
+	if npMgr.isNodeLocalPod(podObj) {
+		t.Errorf("TestGetNodeLocalSets failed @ isNodeLocalPod without node-local mode")
+	}
+
+	util.IsNodeLocalModeFlag = true
+	defer func() { util.IsNodeLocalModeFlag = false }()
+
+	if !npMgr.isNodeLocalPod(podObj) {
+		t.Errorf("TestGetNodeLocalSets failed @ isNodeLocalPod of pod on this node")
+	}
+
+	sets := getNodeLocalSets(podObj)
+	expectedSets := []string{
+		"local:ns-test-namespace",
+		"local:app",
+		"local:app:test-pod",
+		"local:tier",
+		"local:tier:frontend",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("TestGetNodeLocalSets failed @ sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
+
+	podObj.Spec.NodeName = "other-node"
+	if npMgr.isNodeLocalPod(podObj) {
+		t.Errorf("TestGetNodeLocalSets failed @ isNodeLocalPod of pod on other node")
+	}
+}
+
 func TestAddPod(t *testing.T) {
 	npMgr := &NetworkPolicyManager{
 		nsMap:            make(map[string]*namespace),
@@ -3,11 +3,15 @@
 package npm
 
 import (
+	"fmt"
+
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/npm/iptm"
 	"github.com/Azure/azure-container-networking/npm/util"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type portsInfo struct {
@@ -15,6 +19,62 @@ type portsInfo struct {
 	port     string
 }
 
+// Returns the ipset of the named port of a port rule, or an empty string if the port isn't named.
+func getNamedPortSetFromPort(portRule networkingv1.NetworkPolicyPort) string {
+	if portRule.Port == nil || portRule.Port.Type != intstr.String {
+		return ""
+	}
+
+	return util.NamedPortIPSetPrefix + portRule.Port.StrVal
+}
+
+// validatePortRule returns an error if a port rule cannot be translated to iptables rules.
+// Port ranges are not supported yet, see docs/npm.md.
+func validatePortRule(portRule networkingv1.NetworkPolicyPort) error {
+	if portRule.Protocol != nil {
+		switch *portRule.Protocol {
+		case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		default:
+			return fmt.Errorf("protocol %s is not supported", *portRule.Protocol)
+		}
+	}
+
+	if portRule.Port == nil {
+		return nil
+	}
+
+	if portRule.Port.Type == intstr.Int {
+		if portRule.Port.IntVal < util.MinPort || portRule.Port.IntVal > util.MaxPort {
+			return fmt.Errorf("port %d is out of range %d-%d", portRule.Port.IntVal, util.MinPort, util.MaxPort)
+		}
+	} else if portRule.Port.StrVal == "" {
+		return fmt.Errorf("named port is empty")
+	}
+
+	return nil
+}
+
+// validatePolicy returns an error if a network policy has port rules that cannot be translated to iptables rules.
+func validatePolicy(npObj *networkingv1.NetworkPolicy) error {
+	for _, rule := range npObj.Spec.Ingress {
+		for _, portRule := range rule.Ports {
+			if err := validatePortRule(portRule); err != nil {
+				return fmt.Errorf("invalid ingress port %s: %v", craftPartialIptablesCommentFromPort(portRule, util.IptablesDstPortFlag), err)
+			}
+		}
+	}
+
+	for _, rule := range npObj.Spec.Egress {
+		for _, portRule := range rule.Ports {
+			if err := validatePortRule(portRule); err != nil {
+				return fmt.Errorf("invalid egress port %s: %v", craftPartialIptablesCommentFromPort(portRule, util.IptablesDstPortFlag), err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func craftPartialIptEntrySpecFromPort(portRule networkingv1.NetworkPolicyPort, sPortOrDPortFlag string) []string {
 	partialSpec := []string{}
 	if portRule.Protocol != nil {
@@ -25,7 +85,17 @@ func craftPartialIptEntrySpecFromPort(portRule networkingv1.NetworkPolicyPort, s
 		)
 	}
 
-	if portRule.Port != nil {
+	if namedPortSet := getNamedPortSetFromPort(portRule); namedPortSet != "" {
+		// Named ports are resolved per pod, so the destination ip and port are matched against the named port set.
+		partialSpec = append(
+			partialSpec,
+			util.IptablesModuleFlag,
+			util.IptablesSetModuleFlag,
+			util.IptablesMatchSetFlag,
+			util.GetHashedName(namedPortSet),
+			util.IptablesDstFlag+","+util.IptablesDstFlag,
+		)
+	} else if portRule.Port != nil {
 		partialSpec = append(
 			partialSpec,
 			sPortOrDPortFlag,
@@ -146,23 +216,40 @@ func craftPartialIptablesCommentFromSelector(ns string, selector *metav1.LabelSe
 	return comment[:len(comment)-len("-AND-")]
 }
 
+// getTargetOpsAndSets returns the operators and ipsets of the pods selected by the pod selector of a network policy.
+// In node-local mode, the pods are matched with the ipsets of the pods on this node. Negated ipsets keep the pods
+// of all nodes, as excluding only the pods on this node would select pods of other nodes.
+func getTargetOpsAndSets(ns string, targetSelector *metav1.LabelSelector) ([]string, []string) {
+	labelsWithOps, _, _ := parseSelector(targetSelector)
+	ops, labels := GetOperatorsAndLabels(labelsWithOps)
+	if len(ops) == 1 && len(labels) == 1 {
+		if ops[0] == "" && labels[0] == "" {
+			// targetSelector is empty. Select all pods within the namespace
+			labels[0] = "ns-" + ns
+		}
+	}
+
+	if util.IsNodeLocalModeFlag {
+		for i := range labels {
+			if ops[i] == "" {
+				labels[i] = util.GetNodeLocalSetName(labels[i])
+			}
+		}
+	}
+
+	return ops, labels
+}
+
 func translateIngress(ns string, targetSelector metav1.LabelSelector, rules []networkingv1.NetworkPolicyIngressRule) ([]string, []string, []*iptm.IptEntry) {
 	var (
-		sets    []string // ipsets with type: net:hash
+		sets    []string // ipsets with type: net:hash, or hash:ip,port for named ports
 		lists   []string // ipsets with type: list:set
 		entries []*iptm.IptEntry
 	)
 
 	log.Printf("started parsing ingress rule")
 
-	labelsWithOps, _, _ := parseSelector(&targetSelector)
-	ops, labels := GetOperatorsAndLabels(labelsWithOps)
-	if len(ops) == 1 && len(labels) == 1 {
-		if ops[0] == "" && labels[0] == "" {
-			// targetSelector is empty. Select all pods within the namespace
-			labels[0] = "ns-" + ns
-		}
-	}
+	ops, labels := getTargetOpsAndSets(ns, &targetSelector)
 	sets = append(sets, labels...)
 
 	targetSelectorIptEntrySpec := craftPartialIptEntrySpecFromOpsAndLabels(ns, ops, labels, util.IptablesDstFlag, false)
@@ -223,6 +310,10 @@ func translateIngress(ns string, targetSelector metav1.LabelSelector, rules []ne
 		// Only Ports rules exist
 		if portRuleExists && !fromRuleExists && !allowExternal {
 			for _, portRule := range rule.Ports {
+				if namedPortSet := getNamedPortSetFromPort(portRule); namedPortSet != "" {
+					sets = append(sets, namedPortSet)
+				}
+
 				entry := &iptm.IptEntry{
 					Chain: util.IptablesAzureIngressPortChain,
 					Specs: craftPartialIptEntrySpecFromPort(portRule, util.IptablesDstPortFlag),
@@ -247,6 +338,10 @@ func translateIngress(ns string, targetSelector metav1.LabelSelector, rules []ne
 		// fromRuleExists
 		if portRuleExists {
 			for _, portRule := range rule.Ports {
+				if namedPortSet := getNamedPortSetFromPort(portRule); namedPortSet != "" {
+					sets = append(sets, namedPortSet)
+				}
+
 				entry := &iptm.IptEntry{
 					Chain: util.IptablesAzureIngressPortChain,
 					Specs: craftPartialIptEntrySpecFromPort(portRule, util.IptablesDstPortFlag),
@@ -505,21 +600,14 @@ func translateIngress(ns string, targetSelector metav1.LabelSelector, rules []ne
 
 func translateEgress(ns string, targetSelector metav1.LabelSelector, rules []networkingv1.NetworkPolicyEgressRule) ([]string, []string, []*iptm.IptEntry) {
 	var (
-		sets    []string // ipsets with type: net:hash
+		sets    []string // ipsets with type: net:hash, or hash:ip,port for named ports
 		lists   []string // ipsets with type: list:set
 		entries []*iptm.IptEntry
 	)
 
 	log.Printf("started parsing egress rule")
 
-	labelsWithOps, _, _ := parseSelector(&targetSelector)
-	ops, labels := GetOperatorsAndLabels(labelsWithOps)
-	if len(ops) == 1 && len(labels) == 1 {
-		if ops[0] == "" && labels[0] == "" {
-			// targetSelector is empty. Select all pods within the namespace
-			labels[0] = "ns-" + ns
-		}
-	}
+	ops, labels := getTargetOpsAndSets(ns, &targetSelector)
 	sets = append(sets, labels...)
 	targetSelectorIptEntrySpec := craftPartialIptEntrySpecFromOpsAndLabels(ns, ops, labels, util.IptablesSrcFlag, false)
 	targetSelectorComment := craftPartialIptablesCommentFromSelector(ns, &targetSelector, false)
@@ -575,6 +663,10 @@ func translateEgress(ns string, targetSelector metav1.LabelSelector, rules []net
 		// Only Ports rules exist
 		if portRuleExists && !toRuleExists && !allowExternal {
 			for _, portRule := range rule.Ports {
+				if namedPortSet := getNamedPortSetFromPort(portRule); namedPortSet != "" {
+					sets = append(sets, namedPortSet)
+				}
+
 				entry := &iptm.IptEntry{
 					Chain: util.IptablesAzureEgressPortChain,
 					Specs: craftPartialIptEntrySpecFromPort(portRule, util.IptablesDstPortFlag),
@@ -599,6 +691,10 @@ func translateEgress(ns string, targetSelector metav1.LabelSelector, rules []net
 		// toRuleExists
 		if portRuleExists {
 			for _, portRule := range rule.Ports {
+				if namedPortSet := getNamedPortSetFromPort(portRule); namedPortSet != "" {
+					sets = append(sets, namedPortSet)
+				}
+
 				entry := &iptm.IptEntry{
 					Chain: util.IptablesAzureEgressPortChain,
 					Specs: craftPartialIptEntrySpecFromPort(portRule, util.IptablesDstPortFlag),
@@ -859,14 +955,7 @@ func translateEgress(ns string, targetSelector metav1.LabelSelector, rules []net
 func getDefaultDropEntries(ns string, targetSelector metav1.LabelSelector, hasIngress, hasEgress bool) []*iptm.IptEntry {
 	var entries []*iptm.IptEntry
 
-	labelsWithOps, _, _ := parseSelector(&targetSelector)
-	ops, labels := GetOperatorsAndLabels(labelsWithOps)
-	if len(ops) == 1 && len(labels) == 1 {
-		if ops[0] == "" && labels[0] == "" {
-			// targetSelector is empty. Select all pods within the namespace
-			labels[0] = "ns-" + ns
-		}
-	}
+	ops, labels := getTargetOpsAndSets(ns, &targetSelector)
 
 	targetSelectorIngressIptEntrySpec := craftPartialIptEntrySpecFromOpsAndLabels(ns, ops, labels, util.IptablesDstFlag, false)
 	targetSelectorEgressIptEntrySpec := craftPartialIptEntrySpecFromOpsAndLabels(ns, ops, labels, util.IptablesSrcFlag, false)
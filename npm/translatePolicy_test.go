@@ -2,6 +2,9 @@ package npm
 
 import (
 	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -13,6 +16,40 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+var updateRestorePayloads = flag.Bool("update-restore-payloads", false, "Update expected iptables-restore payloads in testdata")
+
+// Compares the iptables-restore payload adding the entries of a policy to the initialized AZURE-NPM chains
+// with the expected payload in testdata/restore.
+func checkRestorePayload(t *testing.T, name string, entries []*iptm.IptEntry) {
+	current := iptm.NewNpmChains()
+	chains := current.Copy()
+	for _, entry := range entries {
+		chains.Add(entry)
+	}
+
+	payload := chains.RestorePayload(current)
+	path := filepath.Join("testdata", "restore", name+".txt")
+
+	if *updateRestorePayloads {
+		if err := ioutil.WriteFile(path, payload, 0644); err != nil {
+			t.Errorf("Failed to update restore payload of %s, err:%v", name, err)
+		}
+		return
+	}
+
+	expectedPayload, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("Failed to read restore payload of %s, err:%v", name, err)
+		return
+	}
+
+	if string(payload) != string(expectedPayload) {
+		t.Errorf("translatedPolicy failed @ %s restore payload comparison", name)
+		t.Errorf("payload: %s", payload)
+		t.Errorf("expectedPayload: %s", expectedPayload)
+	}
+}
+
 func TestCraftPartialIptEntrySpecFromPort(t *testing.T) {
 	portRule := networkingv1.NetworkPolicyPort{}
 
@@ -77,6 +114,29 @@ func TestCraftPartialIptEntrySpecFromPort(t *testing.T) {
 		t.Errorf("iptEntrySpec:\n%v", iptEntrySpec)
 		t.Errorf("expectedIptEntrySpec:\n%v", expectedIptEntrySpec)
 	}
+
+	portHTTP := intstr.FromString("http")
+	portRule = networkingv1.NetworkPolicyPort{
+		Protocol: &tcp,
+		Port:     &portHTTP,
+	}
+
+	iptEntrySpec = craftPartialIptEntrySpecFromPort(portRule, util.IptablesDstPortFlag)
+	expectedIptEntrySpec = []string{
+		util.IptablesProtFlag,
+		"TCP",
+		util.IptablesModuleFlag,
+		util.IptablesSetModuleFlag,
+		util.IptablesMatchSetFlag,
+		util.GetHashedName("namedport:http"),
+		"dst,dst",
+	}
+
+	if !reflect.DeepEqual(iptEntrySpec, expectedIptEntrySpec) {
+		t.Errorf("TestCraftPartialIptEntrySpecFromPort failed @ tcp port http iptEntrySpec comparison")
+		t.Errorf("iptEntrySpec:\n%v", iptEntrySpec)
+		t.Errorf("expectedIptEntrySpec:\n%v", expectedIptEntrySpec)
+	}
 }
 
 func TestCraftPartialIptablesCommentFromPort(t *testing.T) {
@@ -1094,6 +1154,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "deny-all-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "backend",
@@ -1200,6 +1262,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-backend-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1280,6 +1344,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1331,6 +1397,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "deny-all-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1433,6 +1501,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-ns-testnamespace-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1535,6 +1605,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-all-ns-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1667,6 +1739,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-ns-dev-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchExpressions: []metav1.LabelSelectorRequirement{
 			metav1.LabelSelectorRequirement{
@@ -1815,6 +1889,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-all-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -1934,6 +2010,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-ns-dev-and-backend-to-frontend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "backdoor",
@@ -2027,6 +2105,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-internal-and-external-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -2143,6 +2223,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-backend-to-frontend-port-8000-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app":  "k8s",
@@ -2310,6 +2392,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-cni-or-cns-to-k8s-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "backend",
@@ -2360,6 +2444,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "deny-all-from-backend-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "backend",
@@ -2444,6 +2530,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-all-egress", iptEntries)
+
 	targetSelector = metav1.LabelSelector{}
 	denyAllFromNsUnsafePolicy := &networkingv1.NetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
@@ -2490,6 +2578,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "deny-all-from-ns-unsafe-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"app": "frontend",
@@ -2649,6 +2739,8 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
 
+	checkRestorePayload(t, "allow-frontend-to-tcp-port-80-udp-port-443-policy", iptEntries)
+
 	targetSelector = metav1.LabelSelector{
 		MatchLabels: map[string]string{
 			"role": "db",
@@ -2898,6 +2990,505 @@ func TestTranslatePolicy(t *testing.T) {
 		t.Errorf("iptEntries: %s", marshalledIptEntries)
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
+
+	checkRestorePayload(t, "k8s-example-policy", iptEntries)
+}
+
+func TestTranslateNamedPorts(t *testing.T) {
+	tcp := v1.ProtocolTCP
+	portHTTP := intstr.FromString("http")
+	portDNS := intstr.FromString("dns")
+	targetSelector := metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app": "frontend",
+		},
+	}
+	allowBackendToFrontendHTTPPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ALLOW-app:backend-TO-app:frontend-PORT-http-policy",
+			Namespace: "testnamespace",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: targetSelector,
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				networkingv1.NetworkPolicyIngressRule{
+					From: []networkingv1.NetworkPolicyPeer{
+						networkingv1.NetworkPolicyPeer{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app": "backend",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						networkingv1.NetworkPolicyPort{
+							Protocol: &tcp,
+							Port:     &portHTTP,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	sets, lists, iptEntries := translatePolicy(allowBackendToFrontendHTTPPolicy)
+
+	expectedSets := []string{
+		"app:frontend",
+		"namedport:http",
+		"app:backend",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-PORT-http-policy sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
+
+	expectedLists := []string{}
+	if !reflect.DeepEqual(lists, expectedLists) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-PORT-http-policy lists comparison")
+		t.Errorf("lists: %v", lists)
+		t.Errorf("expectedLists: %v", expectedLists)
+	}
+
+	expectedIptEntries := []*iptm.IptEntry{}
+	expectedIptEntries = append(
+		expectedIptEntries,
+		getAllowKubeSystemEntries("testnamespace", targetSelector)...,
+	)
+	nonKubeSystemEntries := []*iptm.IptEntry{
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureIngressPortChain,
+			Specs: []string{
+				util.IptablesProtFlag,
+				string(v1.ProtocolTCP),
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("namedport:http"),
+				"dst,dst",
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesDstFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAzureIngressFromChain,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-ALL-TO-TCP-PORT-http-OF-app:frontend-TO-JUMP-TO-" +
+					util.IptablesAzureIngressFromChain,
+			},
+		},
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureIngressFromChain,
+			Specs: []string{
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:backend"),
+				util.IptablesSrcFlag,
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesDstFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAccept,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-app:backend-TO-app:frontend",
+			},
+		},
+	}
+	expectedIptEntries = append(expectedIptEntries, nonKubeSystemEntries...)
+	expectedIptEntries = append(expectedIptEntries, getDefaultDropEntries("testnamespace", targetSelector, true, false)...)
+	if !reflect.DeepEqual(iptEntries, expectedIptEntries) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-PORT-http-policy policy comparison")
+		marshalledIptEntries, _ := json.Marshal(iptEntries)
+		marshalledExpectedIptEntries, _ := json.Marshal(expectedIptEntries)
+		t.Errorf("iptEntries: %s", marshalledIptEntries)
+		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
+	}
+
+	checkRestorePayload(t, "allow-backend-to-frontend-named-port-policy", iptEntries)
+
+	allowFrontendToDNSPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ALLOW-app:frontend-TO-PORT-dns-policy",
+			Namespace: "testnamespace",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: targetSelector,
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeEgress,
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				networkingv1.NetworkPolicyEgressRule{
+					Ports: []networkingv1.NetworkPolicyPort{
+						networkingv1.NetworkPolicyPort{
+							Port: &portDNS,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	sets, lists, iptEntries = translatePolicy(allowFrontendToDNSPolicy)
+
+	expectedSets = []string{
+		"app:frontend",
+		"namedport:dns",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:frontend-TO-PORT-dns-policy sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
+
+	if !reflect.DeepEqual(lists, expectedLists) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:frontend-TO-PORT-dns-policy lists comparison")
+		t.Errorf("lists: %v", lists)
+		t.Errorf("expectedLists: %v", expectedLists)
+	}
+
+	expectedIptEntries = []*iptm.IptEntry{}
+	expectedIptEntries = append(
+		expectedIptEntries,
+		getAllowKubeSystemEntries("testnamespace", targetSelector)...,
+	)
+	nonKubeSystemEntries = []*iptm.IptEntry{
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureEgressPortChain,
+			Specs: []string{
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("namedport:dns"),
+				"dst,dst",
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesSrcFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAccept,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-ALL-FROM-PORT-dns-OF-app:frontend",
+			},
+		},
+	}
+	expectedIptEntries = append(expectedIptEntries, nonKubeSystemEntries...)
+	expectedIptEntries = append(expectedIptEntries, getDefaultDropEntries("testnamespace", targetSelector, false, true)...)
+	if !reflect.DeepEqual(iptEntries, expectedIptEntries) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:frontend-TO-PORT-dns-policy policy comparison")
+		marshalledIptEntries, _ := json.Marshal(iptEntries)
+		marshalledExpectedIptEntries, _ := json.Marshal(expectedIptEntries)
+		t.Errorf("iptEntries: %s", marshalledIptEntries)
+		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
+	}
+
+	checkRestorePayload(t, "allow-frontend-to-named-port-egress-policy", iptEntries)
+}
+
+func TestValidatePolicy(t *testing.T) {
+	sctp := v1.ProtocolSCTP
+	icmp := v1.Protocol("ICMP")
+	port36412 := intstr.FromInt(36412)
+	port0 := intstr.FromInt(0)
+	port70000 := intstr.FromInt(70000)
+	portEmpty := intstr.FromString("")
+
+	newPolicy := func(ingressPort, egressPort networkingv1.NetworkPolicyPort) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-policy",
+				Namespace: "testnamespace",
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					networkingv1.NetworkPolicyIngressRule{
+						Ports: []networkingv1.NetworkPolicyPort{ingressPort},
+					},
+				},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					networkingv1.NetworkPolicyEgressRule{
+						Ports: []networkingv1.NetworkPolicyPort{egressPort},
+					},
+				},
+			},
+		}
+	}
+
+	validPort := networkingv1.NetworkPolicyPort{Protocol: &sctp, Port: &port36412}
+	if err := validatePolicy(newPolicy(validPort, networkingv1.NetworkPolicyPort{})); err != nil {
+		t.Errorf("TestValidatePolicy failed @ valid SCTP port, err:%v", err)
+	}
+
+	invalidPorts := []networkingv1.NetworkPolicyPort{
+		networkingv1.NetworkPolicyPort{Protocol: &icmp},
+		networkingv1.NetworkPolicyPort{Protocol: &sctp, Port: &port0},
+		networkingv1.NetworkPolicyPort{Protocol: &sctp, Port: &port70000},
+		networkingv1.NetworkPolicyPort{Port: &portEmpty},
+	}
+	for _, invalidPort := range invalidPorts {
+		if err := validatePolicy(newPolicy(invalidPort, validPort)); err == nil {
+			t.Errorf("TestValidatePolicy failed @ invalid ingress port %+v", invalidPort)
+		}
+
+		if err := validatePolicy(newPolicy(validPort, invalidPort)); err == nil {
+			t.Errorf("TestValidatePolicy failed @ invalid egress port %+v", invalidPort)
+		}
+	}
+}
+
+func TestTranslateSCTPPorts(t *testing.T) {
+	sctp := v1.ProtocolSCTP
+	port36412 := intstr.FromInt(36412)
+	port38412 := intstr.FromInt(38412)
+	targetSelector := metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app": "frontend",
+		},
+	}
+	allowBackendToFrontendSCTPPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ALLOW-app:backend-TO-app:frontend-SCTP-PORT-36412-AND-TO-SCTP-PORT-38412-policy",
+			Namespace: "testnamespace",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: targetSelector,
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				networkingv1.NetworkPolicyIngressRule{
+					From: []networkingv1.NetworkPolicyPeer{
+						networkingv1.NetworkPolicyPeer{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app": "backend",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						networkingv1.NetworkPolicyPort{
+							Protocol: &sctp,
+							Port:     &port36412,
+						},
+					},
+				},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				networkingv1.NetworkPolicyEgressRule{
+					Ports: []networkingv1.NetworkPolicyPort{
+						networkingv1.NetworkPolicyPort{
+							Protocol: &sctp,
+							Port:     &port38412,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	sets, lists, iptEntries := translatePolicy(allowBackendToFrontendSCTPPolicy)
+
+	expectedSets := []string{
+		"app:frontend",
+		"app:backend",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-SCTP-PORT-36412-AND-TO-SCTP-PORT-38412-policy sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
+
+	expectedLists := []string{}
+	if !reflect.DeepEqual(lists, expectedLists) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-SCTP-PORT-36412-AND-TO-SCTP-PORT-38412-policy lists comparison")
+		t.Errorf("lists: %v", lists)
+		t.Errorf("expectedLists: %v", expectedLists)
+	}
+
+	expectedIptEntries := []*iptm.IptEntry{}
+	expectedIptEntries = append(
+		expectedIptEntries,
+		getAllowKubeSystemEntries("testnamespace", targetSelector)...,
+	)
+	nonKubeSystemEntries := []*iptm.IptEntry{
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureIngressPortChain,
+			Specs: []string{
+				util.IptablesProtFlag,
+				string(v1.ProtocolSCTP),
+				util.IptablesDstPortFlag,
+				"36412",
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesDstFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAzureIngressFromChain,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-ALL-TO-SCTP-PORT-36412-OF-app:frontend-TO-JUMP-TO-" +
+					util.IptablesAzureIngressFromChain,
+			},
+		},
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureIngressFromChain,
+			Specs: []string{
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:backend"),
+				util.IptablesSrcFlag,
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesDstFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAccept,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-app:backend-TO-app:frontend",
+			},
+		},
+		&iptm.IptEntry{
+			Chain: util.IptablesAzureEgressPortChain,
+			Specs: []string{
+				util.IptablesProtFlag,
+				string(v1.ProtocolSCTP),
+				util.IptablesDstPortFlag,
+				"38412",
+				util.IptablesModuleFlag,
+				util.IptablesSetModuleFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName("app:frontend"),
+				util.IptablesSrcFlag,
+				util.IptablesJumpFlag,
+				util.IptablesAccept,
+				util.IptablesModuleFlag,
+				util.IptablesCommentModuleFlag,
+				util.IptablesCommentFlag,
+				"ALLOW-ALL-FROM-SCTP-PORT-38412-OF-app:frontend",
+			},
+		},
+	}
+	expectedIptEntries = append(expectedIptEntries, nonKubeSystemEntries...)
+	expectedIptEntries = append(expectedIptEntries, getDefaultDropEntries("testnamespace", targetSelector, true, true)...)
+	if !reflect.DeepEqual(iptEntries, expectedIptEntries) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-SCTP-PORT-36412-AND-TO-SCTP-PORT-38412-policy policy comparison")
+		marshalledIptEntries, _ := json.Marshal(iptEntries)
+		marshalledExpectedIptEntries, _ := json.Marshal(expectedIptEntries)
+		t.Errorf("iptEntries: %s", marshalledIptEntries)
+		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
+	}
+
+	checkRestorePayload(t, "allow-backend-to-frontend-sctp-port-policy", iptEntries)
+}
+
+func TestTranslateNodeLocalMode(t *testing.T) {
+	util.IsNodeLocalModeFlag = true
+	defer func() { util.IsNodeLocalModeFlag = false }()
+
+	tcp := v1.ProtocolTCP
+	port8000 := intstr.FromInt(8000)
+	allowBackendToFrontendPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ALLOW-app:backend-TO-app:frontend-AND-!tier:canary-PORT-8000-policy",
+			Namespace: "testnamespace",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "frontend",
+				},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					metav1.LabelSelectorRequirement{
+						Key:      "tier",
+						Operator: metav1.LabelSelectorOpNotIn,
+						Values:   []string{"canary"},
+					},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				networkingv1.NetworkPolicyIngressRule{
+					From: []networkingv1.NetworkPolicyPeer{
+						networkingv1.NetworkPolicyPeer{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app": "backend",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						networkingv1.NetworkPolicyPort{
+							Protocol: &tcp,
+							Port:     &port8000,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	sets, lists, iptEntries := translatePolicy(allowBackendToFrontendPolicy)
+
+	// Target pods are matched with the pods on this node, except for negated labels. Peers are matched with the pods of all nodes.
+	expectedSets := []string{
+		"local:app:frontend",
+		"tier:canary",
+		"app:backend",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-AND-!tier:canary-PORT-8000-policy sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
+
+	expectedLists := []string{}
+	if !reflect.DeepEqual(lists, expectedLists) {
+		t.Errorf("translatedPolicy failed @ ALLOW-app:backend-TO-app:frontend-AND-!tier:canary-PORT-8000-policy lists comparison")
+		t.Errorf("lists: %v", lists)
+		t.Errorf("expectedLists: %v", expectedLists)
+	}
+
+	checkRestorePayload(t, "allow-backend-to-frontend-node-local-policy", iptEntries)
+
+	// Empty pod selectors match the pods of the namespace on this node.
+	allowBackendToFrontendPolicy.Spec.PodSelector = metav1.LabelSelector{}
+	sets, _, _ = translatePolicy(allowBackendToFrontendPolicy)
+
+	expectedSets = []string{
+		"local:ns-testnamespace",
+		"app:backend",
+	}
+	if !reflect.DeepEqual(sets, expectedSets) {
+		t.Errorf("translatedPolicy failed @ empty pod selector sets comparison")
+		t.Errorf("sets: %v", sets)
+		t.Errorf("expectedSets: %v", expectedSets)
+	}
 }
 
 func TestAllowPrecedenceOverDeny(t *testing.T) {
@@ -3196,4 +3787,6 @@ func TestAllowPrecedenceOverDeny(t *testing.T) {
 		t.Errorf("iptEntries: %s", marshalledIptEntries)
 		t.Errorf("expectedIptEntries: %s", marshalledExpectedIptEntries)
 	}
+
+	checkRestorePayload(t, "allow-precedence-over-deny", iptEntries)
 }
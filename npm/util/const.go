@@ -37,6 +37,9 @@ const (
 	IptablesDestroyFlag       string = "-X"
 	IptablesJumpFlag          string = "-j"
 	IptablesWaitFlag          string = "-w"
+	IptablesTableFlag         string = "-t"
+	IptablesNoFlushFlag       string = "--noflush"
+	IptablesCommitFlag        string = "COMMIT"
 	IptablesAccept            string = "ACCEPT"
 	IptablesReject            string = "REJECT"
 	IptablesDrop              string = "DROP"
@@ -82,6 +85,8 @@ const (
 	Ipset               string = "ipset"
 	IpsetSaveFlag       string = "save"
 	IpsetRestoreFlag    string = "restore"
+	IpsetListFlag       string = "list"
+	IpsetOutputFlag     string = "-o"
 	IpsetConfigFile     string = "/var/log/ipset.conf"
 	IpsetTestConfigFile string = "/var/log/ipset-test.conf"
 	IpsetCreationFlag   string = "-N"
@@ -93,8 +98,20 @@ const (
 	IpsetExistFlag string = "-exist"
 	IpsetFileFlag  string = "-file"
 
-	IpsetSetListFlag string = "setlist"
-	IpsetNetHashFlag string = "nethash"
+	IpsetSetListFlag    string = "setlist"
+	IpsetNetHashFlag    string = "nethash"
+	IpsetIPPortHashFlag string = "hash:ip,port"
+
+	// Range of ports of network policy port rules.
+	MinPort int32 = 1
+	MaxPort int32 = 65535
+
+	// Sets of named ports hold "ip,protocol:port" elements of the pods exposing the port.
+	NamedPortIPSetPrefix string = "namedport:"
+
+	// In node-local mode, the pods selected by network policies are matched with sets of the pods on this node.
+	NodeLocalIPSetPrefix string = "local:"
+	NodeLocalModeEnv     string = "AZURE_NPM_NODE_LOCAL_MODE"
 
 	AzureNpmFlag   string = "azure-npm"
 	AzureNpmPrefix string = "azure-npm-"
@@ -16,6 +16,9 @@ import (
 // IsNewNwPolicyVerFlag indicates if the current kubernetes version is newer than 1.11 or not
 var IsNewNwPolicyVerFlag = false
 
+// IsNodeLocalModeFlag indicates if only the pods on this node populate the ipsets of the pods selected by network policies
+var IsNodeLocalModeFlag = false
+
 // Exists reports whether the named file or directory exists.
 func Exists(filePath string) bool {
 	if _, err := os.Stat(filePath); err == nil {
@@ -172,6 +175,21 @@ func GetLabelsWithoutOperators(labels []string) []string {
 	return res
 }
 
+// IsNamedPortSet checks if an ipset is the set of a named port.
+func IsNamedPortSet(setName string) bool {
+	return strings.HasPrefix(setName, NamedPortIPSetPrefix)
+}
+
+// GetNamedPortSetElement returns the element of a named port set for a pod ip, protocol and port.
+func GetNamedPortSetElement(ip string, protocol string, port int32) string {
+	return fmt.Sprintf("%s,%s:%d", ip, strings.ToLower(protocol), port)
+}
+
+// GetNodeLocalSetName returns the name of the ipset holding the pods on this node of an ipset.
+func GetNodeLocalSetName(setName string) string {
+	return NodeLocalIPSetPrefix + setName
+}
+
 // DropEmptyFields deletes empty entries from a slice.
 func DropEmptyFields(s []string) []string {
 	i := 0
@@ -0,0 +1,198 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package npm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// permanentError is an error that retrying an event cannot fix, such as an invalid object.
+// Events failing with a permanentError are dropped without retrying.
+type permanentError struct {
+	err error
+}
+
+// newPermanentError marks an error as permanent.
+func newPermanentError(err error) error {
+	return &permanentError{err: err}
+}
+
+// Error returns the message of the underlying error.
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// workItem is an event of an object to be handled by a work queue.
+type workItem struct {
+	description string
+	handle      func() error
+	retries     int
+}
+
+// workQueue handles the events of the objects of a resource.
+// Events of an object are handled in the order they are received. An event that fails is retried with
+// exponential backoff before the next events of the object, while events of other objects are handled
+// in the meantime. Retries are rate limited across all objects.
+type workQueue struct {
+	sync.Mutex
+	cond        *sync.Cond
+	name        string
+	maxRetries  int
+	ready       []string               // Keys of the objects with events ready to be handled, in order.
+	queued      map[string]bool        // Keys in ready.
+	busy        map[string]bool        // Keys of the objects with an event being handled or waiting for a retry.
+	items       map[string][]*workItem // Events of the objects not handled yet, by key.
+	backoff     *flowcontrol.Backoff
+	rateLimiter flowcontrol.RateLimiter
+	shutdown    bool
+}
+
+// newWorkQueue creates a work queue.
+func newWorkQueue(name string, maxRetries int, backoff *flowcontrol.Backoff, rateLimiter flowcontrol.RateLimiter) *workQueue {
+	queue := &workQueue{
+		name:        name,
+		maxRetries:  maxRetries,
+		queued:      make(map[string]bool),
+		busy:        make(map[string]bool),
+		items:       make(map[string][]*workItem),
+		backoff:     backoff,
+		rateLimiter: rateLimiter,
+	}
+	queue.cond = sync.NewCond(queue)
+
+	return queue
+}
+
+// Marks the events of an object ready to be handled. Must be called with the queue locked.
+func (queue *workQueue) markReady(key string) {
+	if queue.queued[key] || queue.busy[key] || len(queue.items[key]) == 0 {
+		return
+	}
+
+	queue.ready = append(queue.ready, key)
+	queue.queued[key] = true
+	queue.cond.Signal()
+}
+
+// add queues an event of the object with the given key.
+func (queue *workQueue) add(key string, description string, handle func() error) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	if queue.shutdown {
+		return
+	}
+
+	queue.items[key] = append(queue.items[key], &workItem{description: description, handle: handle})
+	queue.markReady(key)
+}
+
+// get waits for an object with events ready to be handled, and returns its key and next event.
+// Returns false once the queue is shut down.
+func (queue *workQueue) get() (string, *workItem, bool) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	for len(queue.ready) == 0 && !queue.shutdown {
+		queue.cond.Wait()
+	}
+
+	if queue.shutdown {
+		return "", nil, false
+	}
+
+	key := queue.ready[0]
+	queue.ready = queue.ready[1:]
+	delete(queue.queued, key)
+	queue.busy[key] = true
+
+	return key, queue.items[key][0], true
+}
+
+// done removes the event of an object returned by get, and marks its next events ready.
+func (queue *workQueue) done(key string) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	queue.items[key] = queue.items[key][1:]
+	if len(queue.items[key]) == 0 {
+		delete(queue.items, key)
+	}
+
+	delete(queue.busy, key)
+	queue.markReady(key)
+}
+
+// retry marks the event of an object returned by get ready to be handled again after a backoff.
+func (queue *workQueue) retry(key string) {
+	queue.backoff.Next(key, queue.backoff.Clock.Now())
+	delay := queue.backoff.Get(key)
+
+	time.AfterFunc(delay, func() {
+		queue.rateLimiter.Accept()
+
+		queue.Lock()
+		defer queue.Unlock()
+
+		delete(queue.busy, key)
+		queue.markReady(key)
+	})
+}
+
+// handle handles the next event of an object, and retries it if it fails.
+func (queue *workQueue) handle(key string, item *workItem) {
+	err := item.handle()
+	if err == nil {
+		queue.backoff.Reset(key)
+		queue.done(key)
+		return
+	}
+
+	if _, ok := err.(*permanentError); ok {
+		log.Errorf("Error: dropping %s %s of %s without retrying, err:%v.", queue.name, item.description, key, err)
+		queue.backoff.Reset(key)
+		queue.done(key)
+		return
+	}
+
+	if item.retries < queue.maxRetries {
+		item.retries++
+		log.Printf("Retrying %s %s of %s, retry:%d err:%v.", queue.name, item.description, key, item.retries, err)
+		queue.retry(key)
+		return
+	}
+
+	log.Errorf("Error: dropping %s %s of %s after %d retries, err:%v.", queue.name, item.description, key, item.retries, err)
+	queue.backoff.Reset(key)
+	queue.done(key)
+}
+
+// shutDown stops the queue. Events not handled yet are discarded.
+func (queue *workQueue) shutDown() {
+	queue.Lock()
+	defer queue.Unlock()
+
+	queue.shutdown = true
+	queue.cond.Broadcast()
+}
+
+// run handles the events of the queue until stopCh is closed.
+func (queue *workQueue) run(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+		queue.shutDown()
+	}()
+
+	for {
+		key, item, ok := queue.get()
+		if !ok {
+			return
+		}
+
+		queue.handle(key, item)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package npm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func newTestWorkQueue(maxRetries int) *workQueue {
+	return newWorkQueue(
+		"test",
+		maxRetries,
+		flowcontrol.NewBackOff(time.Millisecond, 10*time.Millisecond),
+		flowcontrol.NewFakeAlwaysRateLimiter(),
+	)
+}
+
+// Returns whether a work queue has no events left, waiting up to a second.
+func waitForEmptyQueue(queue *workQueue) bool {
+	for i := 0; i < 100; i++ {
+		queue.Lock()
+		empty := len(queue.items) == 0 && len(queue.busy) == 0 && len(queue.ready) == 0
+		queue.Unlock()
+
+		if empty {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestWorkQueueRetry(t *testing.T) {
+	queue := newTestWorkQueue(2)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	var (
+		lock     sync.Mutex
+		attempts = make(map[string]int)
+		handled  []string
+	)
+
+	// Events fail the given number of times before they succeed.
+	handle := func(name string, failures int) func() error {
+		return func() error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			attempts[name]++
+			if attempts[name] <= failures {
+				return fmt.Errorf("%s failed", name)
+			}
+
+			handled = append(handled, name)
+			return nil
+		}
+	}
+
+	// a-add succeeds on its last retry, b-add is dropped after its last retry.
+	queue.add("ns/a", "add", handle("a-add", 2))
+	queue.add("ns/a", "update", handle("a-update", 0))
+	queue.add("ns/b", "add", handle("b-add", 3))
+	queue.add("ns/b", "delete", handle("b-delete", 0))
+	go queue.run(stopCh)
+
+	if !waitForEmptyQueue(queue) {
+		t.Fatalf("TestWorkQueueRetry failed @ waiting for events to be handled")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	expectedAttempts := map[string]int{"a-add": 3, "a-update": 1, "b-add": 3, "b-delete": 1}
+	if !reflect.DeepEqual(attempts, expectedAttempts) {
+		t.Errorf("TestWorkQueueRetry failed @ attempts comparison")
+		t.Errorf("attempts: %v", attempts)
+		t.Errorf("expectedAttempts: %v", expectedAttempts)
+	}
+
+	// Events of an object are handled in order, after the retries of the previous event.
+	var handledA, handledB []string
+	for _, name := range handled {
+		if name[0] == 'a' {
+			handledA = append(handledA, name)
+		} else {
+			handledB = append(handledB, name)
+		}
+	}
+
+	if expected := []string{"a-add", "a-update"}; !reflect.DeepEqual(handledA, expected) {
+		t.Errorf("TestWorkQueueRetry failed @ ns/a events: %v", handledA)
+	}
+
+	if expected := []string{"b-delete"}; !reflect.DeepEqual(handledB, expected) {
+		t.Errorf("TestWorkQueueRetry failed @ ns/b events: %v", handledB)
+	}
+}
+
+func TestWorkQueuePermanentError(t *testing.T) {
+	queue := newTestWorkQueue(2)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	var (
+		lock     sync.Mutex
+		attempts int
+		handled  []string
+	)
+
+	// An invalid object is dropped at once, and its next event is handled.
+	queue.add("ns/a", "add", func() error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		attempts++
+		return newPermanentError(fmt.Errorf("a-add is invalid"))
+	})
+	queue.add("ns/a", "update", func() error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		handled = append(handled, "a-update")
+		return nil
+	})
+	go queue.run(stopCh)
+
+	if !waitForEmptyQueue(queue) {
+		t.Fatalf("TestWorkQueuePermanentError failed @ waiting for events to be handled")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if attempts != 1 {
+		t.Errorf("TestWorkQueuePermanentError failed @ a-add attempts: %d", attempts)
+	}
+
+	if expected := []string{"a-update"}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("TestWorkQueuePermanentError failed @ ns/a events: %v", handled)
+	}
+}
+
+func TestWorkQueueShutDown(t *testing.T) {
+	queue := newTestWorkQueue(0)
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		queue.run(stopCh)
+		close(done)
+	}()
+
+	close(stopCh)
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("TestWorkQueueShutDown failed @ queue.run didn't return")
+	}
+
+	queue.add("ns/a", "add", func() error { return nil })
+	if len(queue.items) != 0 {
+		t.Errorf("TestWorkQueueShutDown failed @ queue.add after shut down")
+	}
+}
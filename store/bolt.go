@@ -0,0 +1,237 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// Default file name for backing bolt database.
+	defaultBoltFileName = "azure-container-networking.db"
+
+	// Name of the bucket holding all key value pairs.
+	boltBucketName = "KeyValueStore"
+
+	// Time to wait for the database file lock held by another read or write.
+	boltOpenTimeout = lockMaxRetries * lockRetryDelay
+)
+
+// boltStore is an implementation of KeyValueStore using a local bolt database.
+// Each key is committed in its own transaction, so writes do not rewrite unrelated keys.
+// The database is only open for the span of each read or write. Exclusive access across
+// processes is given by Lock, which uses a lock file like jsonFileStore.
+type boltStore struct {
+	fileName       string
+	importFileName string
+	locked         bool
+	sync.Mutex
+}
+
+// NewBoltStore creates a new boltStore object, accessed as a KeyValueStore.
+// If importFileName is not empty, the contents of that JSON file store are imported
+// the first time the database is created.
+func NewBoltStore(fileName string, importFileName string) (KeyValueStore, error) {
+	if fileName == "" {
+		fileName = defaultBoltFileName
+	}
+
+	kvs := &boltStore{
+		fileName:       fileName,
+		importFileName: importFileName,
+	}
+
+	return kvs, nil
+}
+
+// Read restores the value for the given key from persistent store.
+func (kvs *boltStore) Read(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	db, err := kvs.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var raw []byte
+	err = db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(boltBucketName)).Get([]byte(key)); v != nil {
+			// Values are only valid for the life of the transaction.
+			raw = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if raw == nil {
+		return ErrKeyNotFound
+	}
+
+	return json.Unmarshal(raw, value)
+}
+
+// Write saves the given key value pair to persistent store.
+func (kvs *boltStore) Write(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	db, err := kvs.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucketName)).Put([]byte(key), raw)
+	})
+}
+
+// Flush commits in-memory state to persistent store.
+// Every write is committed on its own, so there is nothing left to flush.
+func (kvs *boltStore) Flush() error {
+	return nil
+}
+
+// Lock locks the store for exclusive access.
+func (kvs *boltStore) Lock(block bool) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if kvs.locked {
+		return ErrStoreLocked
+	}
+
+	if err := acquireLockFile(kvs.fileName+lockExtension, block); err != nil {
+		return err
+	}
+
+	kvs.locked = true
+
+	return nil
+}
+
+// Unlock unlocks the store.
+func (kvs *boltStore) Unlock(forceUnlock bool) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if !forceUnlock && !kvs.locked {
+		return ErrStoreNotLocked
+	}
+
+	err := os.Remove(kvs.fileName + lockExtension)
+	if err != nil {
+		return err
+	}
+
+	kvs.locked = false
+
+	return nil
+}
+
+// GetModificationTime returns the modification time of the persistent store.
+func (kvs *boltStore) GetModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	info, err := os.Stat(kvs.fileName)
+	if err != nil {
+		log.Printf("os.stat() for file %v failed: %v", kvs.fileName, err)
+		return time.Time{}.UTC(), err
+	}
+
+	return info.ModTime().UTC(), nil
+}
+
+// GetLockFileModificationTime returns the modification time of the lock file of the persistent store.
+func (kvs *boltStore) GetLockFileModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	return getLockFileModificationTime(kvs.fileName + lockExtension)
+}
+
+// Lock-free open for internal callers.
+// Opens the database, creating its bucket on first use. The caller closes it.
+// Every read-write transaction commits and syncs the database, so one is only started
+// when the bucket is missing.
+func (kvs *boltStore) open() (*bolt.DB, error) {
+	db, err := bolt.Open(kvs.fileName, 0664, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket([]byte(boltBucketName)) != nil
+		return nil
+	})
+	if exists {
+		return db, nil
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(boltBucketName)) != nil {
+			return nil
+		}
+
+		bucket, err := tx.CreateBucket([]byte(boltBucketName))
+		if err != nil {
+			return err
+		}
+
+		return kvs.importJsonFileStore(bucket)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// importJsonFileStore copies all key value pairs of the JSON file store to the given bucket.
+func (kvs *boltStore) importJsonFileStore(bucket *bolt.Bucket) error {
+	if kvs.importFileName == "" {
+		return nil
+	}
+
+	jsonStore := &jsonFileStore{fileName: kvs.importFileName}
+	if err := jsonStore.load(); err != nil {
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		log.Printf("[store] Failed to import %v, err:%v.", kvs.importFileName, err)
+		return err
+	}
+
+	for key, raw := range jsonStore.data {
+		if raw == nil {
+			continue
+		}
+
+		if err := bucket.Put([]byte(key), *raw); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[store] Imported %d keys from %v to %v.", len(jsonStore.data), kvs.importFileName, kvs.fileName)
+
+	return nil
+}
@@ -6,6 +6,7 @@ package store
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -20,6 +21,16 @@ const (
 	// Extension added to the file name for lock.
 	lockExtension = ".lock"
 
+	// Extension added to the file name for the temporary file used during flush.
+	tempExtension = ".tmp"
+
+	// Extension added to the file name for the backup of the last good state.
+	backupExtension = ".bak"
+
+	// Names of the copies of the persistent store that can be loaded.
+	sourcePrimary = "primary"
+	sourceBackup  = "backup"
+
 	// Maximum number of retries before failing a lock call.
 	lockMaxRetries = 200
 
@@ -33,6 +44,7 @@ type jsonFileStore struct {
 	data     map[string]*json.RawMessage
 	inSync   bool
 	locked   bool
+	source   string
 	sync.Mutex
 }
 
@@ -57,22 +69,9 @@ func (kvs *jsonFileStore) Read(key string, value interface{}) error {
 
 	// Read contents from file if memory is not in sync.
 	if !kvs.inSync {
-		// Open and parse the file if it exists.
-		file, err := os.Open(kvs.fileName)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return ErrKeyNotFound
-			}
+		if err := kvs.load(); err != nil {
 			return err
 		}
-		defer file.Close()
-
-		// Decode to raw JSON messages.
-		if err := json.NewDecoder(file).Decode(&kvs.data); err != nil {
-			return err
-		}
-
-		kvs.inSync = true
 	}
 
 	raw, ok := kvs.data[key]
@@ -107,75 +106,120 @@ func (kvs *jsonFileStore) Flush() error {
 	return kvs.flush()
 }
 
+// Lock-free load for internal callers.
+// Loads the primary file, falling back to the backup if the primary is missing or fails to decode.
+func (kvs *jsonFileStore) load() error {
+	data, err := decodeFile(kvs.fileName)
+	if err == nil {
+		kvs.data = data
+		kvs.source = sourcePrimary
+		kvs.inSync = true
+		return nil
+	}
+
+	backupName := kvs.fileName + backupExtension
+	backupData, backupErr := decodeFile(backupName)
+	if backupErr != nil {
+		if os.IsNotExist(err) && os.IsNotExist(backupErr) {
+			return ErrKeyNotFound
+		}
+		return err
+	}
+
+	log.Printf("[store] Failed to load %v: %v. Loaded state from backup %v.", kvs.fileName, err, backupName)
+
+	kvs.data = backupData
+	kvs.source = sourceBackup
+	kvs.inSync = true
+
+	return nil
+}
+
+// decodeFile decodes the JSON file with the given name to raw JSON messages.
+func decodeFile(fileName string) (map[string]*json.RawMessage, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make(map[string]*json.RawMessage)
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 // Lock-free flush for internal callers.
+// Writes to a temporary file which is then renamed over the primary, so that the primary always
+// holds either the previous or the new state. The previous state is kept as a backup.
 func (kvs *jsonFileStore) flush() error {
-	file, err := os.Create(kvs.fileName)
+	buf, err := json.MarshalIndent(&kvs.data, "", "\t")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	buf, err := json.MarshalIndent(&kvs.data, "", "\t")
+	tempName := kvs.fileName + tempExtension
+	file, err := os.Create(tempName)
 	if err != nil {
 		return err
 	}
 
 	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		os.Remove(tempName)
 		return err
 	}
-	return nil
-}
 
-// Lock locks the store for exclusive access.
-func (kvs *jsonFileStore) Lock(block bool) error {
-	kvs.Mutex.Lock()
-	defer kvs.Mutex.Unlock()
-
-	if kvs.locked {
-		return ErrStoreLocked
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempName)
+		return err
 	}
 
-	var lockFile *os.File
-	var err error
-	lockName := kvs.fileName + lockExtension
-	lockPerm := os.FileMode(0664) + os.FileMode(os.ModeExclusive)
+	if err := file.Close(); err != nil {
+		os.Remove(tempName)
+		return err
+	}
 
-	// Try to acquire the lock file.
-	var lockRetryCount uint
-	var modTimeCur time.Time
-	var modTimePrev time.Time
-	for lockRetryCount < lockMaxRetries {
-		lockFile, err = os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_RDWR, lockPerm)
-		if err == nil {
-			break
+	// Keep the current primary as the backup unless it was found to be corrupt.
+	if kvs.source != sourceBackup {
+		if err := os.Rename(kvs.fileName, kvs.fileName+backupExtension); err != nil && !os.IsNotExist(err) {
+			log.Printf("[store] Failed to back up %v: %v", kvs.fileName, err)
 		}
+	}
 
-		if !block {
-			return ErrNonBlockingLockIsAlreadyLocked
-		}
+	if err := os.Rename(tempName, kvs.fileName); err != nil {
+		os.Remove(tempName)
+		return err
+	}
 
-		// Reset the lock retry count if the timestamp for the lock file changes.
-		if fileInfo, err := os.Stat(lockName); err == nil {
-			modTimeCur = fileInfo.ModTime()
-			if !modTimeCur.Equal(modTimePrev) {
-				lockRetryCount = 0
-			}
-			modTimePrev = modTimeCur
-		}
+	kvs.source = sourcePrimary
 
-		time.Sleep(lockRetryDelay)
+	// Persist the renames, which are recorded in the parent directory.
+	return syncDir(filepath.Dir(kvs.fileName))
+}
 
-		lockRetryCount++
-	}
+// LoadedFromBackup returns whether the store was loaded from the backup because the primary file
+// was missing or corrupt, and has not been flushed since.
+func (kvs *jsonFileStore) LoadedFromBackup() bool {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
 
-	if lockRetryCount == lockMaxRetries {
-		return ErrTimeoutLockingStore
-	}
+	return kvs.source == sourceBackup
+}
 
-	defer lockFile.Close()
+// Lock locks the store for exclusive access.
+func (kvs *jsonFileStore) Lock(block bool) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
 
-	// Write the process ID for easy identification.
-	if _, err = lockFile.WriteString(strconv.Itoa(os.Getpid())); err != nil {
+	if kvs.locked {
+		return ErrStoreLocked
+	}
+
+	if err := acquireLockFile(kvs.fileName+lockExtension, block); err != nil {
 		return err
 	}
 
@@ -223,8 +267,59 @@ func (kvs *jsonFileStore) GetLockFileModificationTime() (time.Time, error) {
 	kvs.Mutex.Lock()
 	defer kvs.Mutex.Unlock()
 
-	lockFileName := kvs.fileName + lockExtension
+	return getLockFileModificationTime(kvs.fileName + lockExtension)
+}
+
+// acquireLockFile creates the lock file with the given name, retrying while another owner holds it if block is set.
+func acquireLockFile(lockName string, block bool) error {
+	var lockFile *os.File
+	var err error
+	lockPerm := os.FileMode(0664) + os.FileMode(os.ModeExclusive)
+
+	// Try to acquire the lock file.
+	var lockRetryCount uint
+	var modTimeCur time.Time
+	var modTimePrev time.Time
+	for lockRetryCount < lockMaxRetries {
+		lockFile, err = os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_RDWR, lockPerm)
+		if err == nil {
+			break
+		}
+
+		if !block {
+			return ErrNonBlockingLockIsAlreadyLocked
+		}
+
+		// Reset the lock retry count if the timestamp for the lock file changes.
+		if fileInfo, err := os.Stat(lockName); err == nil {
+			modTimeCur = fileInfo.ModTime()
+			if !modTimeCur.Equal(modTimePrev) {
+				lockRetryCount = 0
+			}
+			modTimePrev = modTimeCur
+		}
+
+		time.Sleep(lockRetryDelay)
+
+		lockRetryCount++
+	}
+
+	if lockRetryCount == lockMaxRetries {
+		return ErrTimeoutLockingStore
+	}
+
+	defer lockFile.Close()
+
+	// Write the process ID for easy identification.
+	if _, err = lockFile.WriteString(strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// getLockFileModificationTime returns the modification time of the lock file with the given name.
+func getLockFileModificationTime(lockFileName string) (time.Time, error) {
 	// Check if the file exists.
 	file, err := os.Open(lockFileName)
 	if err != nil {
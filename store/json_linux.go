@@ -0,0 +1,19 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"os"
+)
+
+// syncDir commits the entries of the given directory, such as renamed files, to stable storage.
+func syncDir(dirName string) error {
+	dir, err := os.Open(dirName)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
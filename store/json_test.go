@@ -4,14 +4,19 @@
 package store
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 const (
-	// File name used for test store.
-	testFileName = "test.json"
+	// File names used for test stores.
+	testFileName     = "test.json"
+	testBoltFileName = "test.db"
 
 	// Keys used during tests.
 	testKey1 = "key1"
@@ -24,8 +29,44 @@ type testType1 struct {
 	Field2 int
 }
 
+// KeyValueStore backend under test.
+type testBackend struct {
+	name     string
+	newStore func() (KeyValueStore, error)
+}
+
+// Backends the generic tests are run against.
+// The bolt store imports the JSON file used by the JSON file store.
+var testBackends = []testBackend{
+	{
+		name:     StoreTypeJsonFile,
+		newStore: func() (KeyValueStore, error) { return NewJsonFileStore(testFileName) },
+	},
+	{
+		name:     StoreTypeBolt,
+		newStore: func() (KeyValueStore, error) { return NewBoltStore(testBoltFileName, testFileName) },
+	},
+}
+
+// Releases the store and removes all files created by the backends under test.
+func cleanupTestStore(kvs KeyValueStore) {
+	os.Remove(testFileName)
+	os.Remove(testFileName + backupExtension)
+	os.Remove(testFileName + lockExtension)
+	os.Remove(testBoltFileName)
+	os.Remove(testBoltFileName + lockExtension)
+}
+
 // Tests that the key value pairs are reinstantiated correctly from a pre-existing JSON encoded file.
 func TestKeyValuePairsAreReinstantiatedFromJSONFile(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testKeyValuePairsAreReinstantiatedFromJSONFile(t, backend)
+		})
+	}
+}
+
+func testKeyValuePairsAreReinstantiatedFromJSONFile(t *testing.T, backend testBackend) {
 	var encodedPair = `{"key1":{"Field1":"test","Field2":42}}`
 	var expectedValue = testType1{"test", 42}
 	var actualValue testType1
@@ -42,13 +83,13 @@ func TestKeyValuePairsAreReinstantiatedFromJSONFile(t *testing.T) {
 	}
 
 	file.Close()
-	defer os.Remove(testFileName)
 
 	// Create the store, initialized using the JSON file.
-	kvs, err := NewJsonFileStore(testFileName)
+	kvs, err := backend.newStore()
 	if err != nil {
 		t.Fatalf("Failed to create KeyValueStore %v\n", err)
 	}
+	defer cleanupTestStore(kvs)
 
 	// Read the pair.
 	err = kvs.Read(testKey1, &actualValue)
@@ -95,6 +136,7 @@ func TestKeyValuePairsArePersistedToJSONFile(t *testing.T) {
 
 	file.Close()
 	os.Remove(testFileName)
+	os.Remove(testFileName + backupExtension)
 
 	// Remove indentation to normalize the JSON encoding.
 	actualPair = string(data[:n])
@@ -111,12 +153,20 @@ func TestKeyValuePairsArePersistedToJSONFile(t *testing.T) {
 
 // Tests that key value pairs are written and read back correctly.
 func TestKeyValuePairsAreWrittenAndReadCorrectly(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testKeyValuePairsAreWrittenAndReadCorrectly(t, backend)
+		})
+	}
+}
+
+func testKeyValuePairsAreWrittenAndReadCorrectly(t *testing.T, backend testBackend) {
 	var writtenValue = testType1{"test", 42}
 	var anotherValue = testType1{"any", 14}
 	var readValue testType1
 
 	// Create the store.
-	kvs, err := NewJsonFileStore(testFileName)
+	kvs, err := backend.newStore()
 	if err != nil {
 		t.Fatalf("Failed to create KeyValueStore %v\n", err)
 	}
@@ -146,15 +196,23 @@ func TestKeyValuePairsAreWrittenAndReadCorrectly(t *testing.T) {
 	}
 
 	// Cleanup.
-	os.Remove(testFileName)
+	cleanupTestStore(kvs)
 }
 
 // Tests that locking a store gives the caller exclusive access.
 func TestLockingStoreGivesExclusiveAccess(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testLockingStoreGivesExclusiveAccess(t, backend)
+		})
+	}
+}
+
+func testLockingStoreGivesExclusiveAccess(t *testing.T, backend testBackend) {
 	var anyValue = testType1{"test", 42}
 
 	// Create the store.
-	kvs, err := NewJsonFileStore(testFileName)
+	kvs, err := backend.newStore()
 	if err != nil {
 		t.Fatalf("Failed to create first store: %v", err)
 	}
@@ -172,7 +230,7 @@ func TestLockingStoreGivesExclusiveAccess(t *testing.T) {
 	}
 
 	// Create a second store pointing to the same file.
-	kvs2, err := NewJsonFileStore(testFileName)
+	kvs2, err := backend.newStore()
 	if err != nil {
 		t.Fatalf("Failed to create second store: %v", err)
 	}
@@ -204,5 +262,331 @@ func TestLockingStoreGivesExclusiveAccess(t *testing.T) {
 	}
 
 	// Cleanup.
+	cleanupTestStore(kvs)
+}
+
+// Writes the given contents to the file with the given name.
+func writeTestFile(t *testing.T, fileName string, contents string) {
+	if err := ioutil.WriteFile(fileName, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write file %v: %v", fileName, err)
+	}
+}
+
+// Tests that a write keeps the previous state as a backup and leaves no temporary file behind.
+func TestWriteKeepsBackupOfPreviousState(t *testing.T) {
+	var firstValue = testType1{"first", 1}
+	var secondValue = testType1{"second", 2}
+	var backupValue testType1
+
+	defer os.Remove(testFileName)
+	defer os.Remove(testFileName + backupExtension)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs.Write(testKey1, &firstValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err = kvs.Write(testKey1, &secondValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if _, err = os.Stat(testFileName + tempExtension); !os.IsNotExist(err) {
+		t.Errorf("Temporary file was not removed after flush: %v", err)
+	}
+
+	// The backup should hold the state before the last write.
+	backup, err := NewJsonFileStore(testFileName + backupExtension)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = backup.Read(testKey1, &backupValue); err != nil {
+		t.Fatalf("Failed to read from backup %v", err)
+	}
+
+	if backupValue != firstValue {
+		t.Errorf("Backup value %v does not match the expected value %v", backupValue, firstValue)
+	}
+}
+
+// Tests that a truncated or corrupted primary file falls back to the backup.
+func TestReadFallsBackToBackupOnCorruptPrimary(t *testing.T) {
+	var expectedValue = testType1{"test", 42}
+	var backupPair = `{"key1":{"Field1":"test","Field2":42}}`
+
+	corruptFiles := map[string]string{
+		"truncated": `{"key1":{"Field1":"te`,
+		"corrupted": "\x00\x00\x00\x00",
+		"empty":     "",
+	}
+
+	defer os.Remove(testFileName)
+	defer os.Remove(testFileName + backupExtension)
+
+	for name, contents := range corruptFiles {
+		var actualValue testType1
+
+		writeTestFile(t, testFileName, contents)
+		writeTestFile(t, testFileName+backupExtension, backupPair)
+
+		kvs, err := NewJsonFileStore(testFileName)
+		if err != nil {
+			t.Fatalf("Failed to create KeyValueStore %v\n", err)
+		}
+
+		if err = kvs.Read(testKey1, &actualValue); err != nil {
+			t.Fatalf("Failed to read from store with %v primary: %v", name, err)
+		}
+
+		if actualValue != expectedValue {
+			t.Errorf("Read value %v with %v primary does not match the expected value %v",
+				actualValue, name, expectedValue)
+		}
+
+		if !LoadedFromBackup(kvs) {
+			t.Errorf("Store with %v primary was not loaded from the backup", name)
+		}
+
+		// A write must replace the corrupt primary without overwriting the good backup.
+		if err = kvs.Write(testKey2, &expectedValue); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		backup, err := ioutil.ReadFile(testFileName + backupExtension)
+		if err != nil {
+			t.Fatalf("Failed to read backup %v", err)
+		}
+
+		if string(backup) != backupPair {
+			t.Errorf("Backup was overwritten after loading a %v primary: %v", name, string(backup))
+		}
+
+		kvs2, err := NewJsonFileStore(testFileName)
+		if err != nil {
+			t.Fatalf("Failed to create KeyValueStore %v\n", err)
+		}
+
+		if err = kvs2.Read(testKey2, &actualValue); err != nil {
+			t.Fatalf("Failed to read from repaired primary %v", err)
+		}
+
+		if LoadedFromBackup(kvs) {
+			t.Errorf("Store with %v primary still reports the backup after a write", name)
+		}
+
+		if LoadedFromBackup(kvs2) {
+			t.Errorf("Repaired store was loaded from the backup")
+		}
+	}
+}
+
+// Tests that a missing primary file falls back to the backup.
+func TestReadFallsBackToBackupOnMissingPrimary(t *testing.T) {
+	var backupPair = `{"key1":{"Field1":"test","Field2":42}}`
+	var actualValue testType1
+
 	os.Remove(testFileName)
+	writeTestFile(t, testFileName+backupExtension, backupPair)
+	defer os.Remove(testFileName + backupExtension)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs.Read(testKey1, &actualValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if !LoadedFromBackup(kvs) {
+		t.Errorf("Store with missing primary was not loaded from the backup")
+	}
+}
+
+// Tests that a corrupt primary file without a backup is reported as an error.
+func TestReadFailsOnCorruptPrimaryWithoutBackup(t *testing.T) {
+	var actualValue testType1
+
+	writeTestFile(t, testFileName, `{"key1":`)
+	os.Remove(testFileName + backupExtension)
+	defer os.Remove(testFileName)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	err = kvs.Read(testKey1, &actualValue)
+	if err == nil || err == ErrKeyNotFound {
+		t.Errorf("Reading a corrupt store without backup returned %v", err)
+	}
+}
+
+// Tests that the bolt store imports the JSON file store only when the database is first created.
+func TestBoltStoreImportsJSONFileOnce(t *testing.T) {
+	var encodedPair = `{"key1":{"Field1":"test","Field2":42}}`
+	var updatedValue = testType1{"updated", 7}
+	var actualValue testType1
+
+	writeTestFile(t, testFileName, encodedPair)
+
+	kvs, err := NewBoltStore(testBoltFileName, testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+	defer cleanupTestStore(kvs)
+
+	if err = kvs.Write(testKey1, &updatedValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	// Reopening an existing database must not import the JSON file again.
+	kvs2, err := NewBoltStore(testBoltFileName, testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+	defer cleanupTestStore(kvs2)
+
+	if err = kvs2.Read(testKey1, &actualValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if actualValue != updatedValue {
+		t.Errorf("Read value %v does not match the written value %v", actualValue, updatedValue)
+	}
+}
+
+// Returns the ID of the last transaction committed to the bolt database under test.
+func getBoltTxID(t *testing.T) int {
+	db, err := bolt.Open(testBoltFileName, 0664, &bolt.Options{Timeout: lockRetryDelay})
+	if err != nil {
+		t.Fatalf("Failed to open database %v", err)
+	}
+	defer db.Close()
+
+	var id int
+	db.View(func(tx *bolt.Tx) error {
+		id = tx.ID()
+		return nil
+	})
+
+	return id
+}
+
+// Tests that reading from the bolt store does not commit a transaction.
+func TestBoltStoreReadDoesNotWrite(t *testing.T) {
+	var expectedValue = testType1{"test", 42}
+	var actualValue testType1
+
+	kvs, err := NewBoltStore(testBoltFileName, "")
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+	defer cleanupTestStore(kvs)
+
+	if err = kvs.Write(testKey1, &expectedValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	id := getBoltTxID(t)
+
+	if err = kvs.Read(testKey1, &actualValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if newID := getBoltTxID(t); newID != id {
+		t.Errorf("Read committed transaction %d after transaction %d", newID, id)
+	}
+}
+
+// Tests that a locked bolt store does not keep the database open between reads and writes.
+func TestBoltStoreLockDoesNotHoldDatabase(t *testing.T) {
+	var expectedValue = testType1{"test", 42}
+	var actualValue testType1
+
+	kvs, err := NewBoltStore(testBoltFileName, "")
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+	defer cleanupTestStore(kvs)
+
+	if err = kvs.Lock(false); err != nil {
+		t.Fatalf("Failed to lock store %v", err)
+	}
+
+	if err = kvs.Write(testKey1, &expectedValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if _, err = kvs.GetLockFileModificationTime(); err != nil {
+		t.Errorf("Failed to get lock file modification time %v", err)
+	}
+
+	// The database file lock is released as soon as the write completes.
+	db, err := bolt.Open(testBoltFileName, 0664, &bolt.Options{Timeout: lockRetryDelay})
+	if err != nil {
+		t.Fatalf("Failed to open database held by locked store %v", err)
+	}
+	db.Close()
+
+	if err = kvs.Read(testKey1, &actualValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if actualValue != expectedValue {
+		t.Errorf("Read value %v does not match the written value %v", actualValue, expectedValue)
+	}
+
+	if err = kvs.Unlock(false); err != nil {
+		t.Fatalf("Failed to unlock store %v", err)
+	}
+}
+
+// Benchmarks the store accesses of a CNI command, which locks the store, reads the state of the
+// plugin, saves it and unlocks the store. The state holds as many endpoints as a busy node.
+func BenchmarkCNICommand(b *testing.B) {
+	state := make(map[string]testType1)
+	for i := 0; i < 250; i++ {
+		state[fmt.Sprintf("endpoint-%d", i)] = testType1{"endpoint", i}
+	}
+
+	for _, backend := range testBackends {
+		b.Run(backend.name, func(b *testing.B) {
+			kvs, err := backend.newStore()
+			if err != nil {
+				b.Fatalf("Failed to create KeyValueStore %v\n", err)
+			}
+			defer cleanupTestStore(kvs)
+
+			if err = kvs.Write(testKey1, state); err != nil {
+				b.Fatalf("Failed to write to store %v", err)
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				kvs, _ := backend.newStore()
+				if err := kvs.Lock(true); err != nil {
+					b.Fatalf("Failed to lock store %v", err)
+				}
+
+				var readState map[string]testType1
+				if err := kvs.Read(testKey1, &readState); err != nil {
+					b.Fatalf("Failed to read from store %v", err)
+				}
+
+				if err := kvs.Write(testKey1, readState); err != nil {
+					b.Fatalf("Failed to write to store %v", err)
+				}
+
+				if err := kvs.Unlock(false); err != nil {
+					b.Fatalf("Failed to unlock store %v", err)
+				}
+			}
+		})
+	}
 }
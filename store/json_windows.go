@@ -0,0 +1,10 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+// syncDir commits the entries of the given directory to stable storage.
+// Directories cannot be flushed on Windows, where renames are committed by the file system journal.
+func syncDir(dirName string) error {
+	return nil
+}
@@ -19,6 +19,19 @@ type KeyValueStore interface {
 	GetLockFileModificationTime() (time.Time, error)
 }
 
+// BackupReporter is implemented by stores that keep a backup of their last good state.
+// LoadedFromBackup returns whether the state was loaded from the backup because the primary copy
+// was missing or corrupt. Such a state can be one write behind the last saved state.
+type BackupReporter interface {
+	LoadedFromBackup() bool
+}
+
+// LoadedFromBackup returns whether the given store loaded its state from a backup.
+func LoadedFromBackup(kvs KeyValueStore) bool {
+	reporter, ok := kvs.(BackupReporter)
+	return ok && reporter.LoadedFromBackup()
+}
+
 var (
 	// Errors returned by KeyValueStore methods.
 	ErrKeyNotFound                    = fmt.Errorf("key not found")
@@ -26,4 +39,29 @@ var (
 	ErrStoreNotLocked                 = fmt.Errorf("store is not locked")
 	ErrTimeoutLockingStore            = fmt.Errorf("timed out locking store")
 	ErrNonBlockingLockIsAlreadyLocked = fmt.Errorf("attempted to perform non-blocking lock on an already locked store")
+	ErrInvalidStoreType               = fmt.Errorf("invalid store type")
 )
+
+const (
+	// Types of KeyValueStore backends.
+	StoreTypeJsonFile = "json"
+	StoreTypeBolt     = "bolt"
+
+	// File extensions used by each backend.
+	jsonFileExtension = ".json"
+	boltFileExtension = ".db"
+)
+
+// NewKeyValueStore creates a KeyValueStore of the given type persisted in files with the given base name.
+// The JSON file store is used if no type is given. The bolt store imports an existing JSON file store
+// with the same base name the first time it is created.
+func NewKeyValueStore(storeType string, baseName string) (KeyValueStore, error) {
+	switch storeType {
+	case "", StoreTypeJsonFile:
+		return NewJsonFileStore(baseName + jsonFileExtension)
+	case StoreTypeBolt:
+		return NewBoltStore(baseName+boltFileExtension, baseName+jsonFileExtension)
+	default:
+		return nil, ErrInvalidStoreType
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Schema version of values persisted before versioning was introduced.
+	legacySchemaVersion = 0
+)
+
+var (
+	// Errors returned by versioned store methods.
+	ErrSchemaVersionTooNew = fmt.Errorf("persisted schema version is newer than supported")
+	ErrMigrationNotFound   = fmt.Errorf("no migration registered for schema version")
+)
+
+// MigrationFunc converts a value persisted with a given schema version to the next schema version.
+type MigrationFunc func(value json.RawMessage) (json.RawMessage, error)
+
+// versionedValue is the envelope in which versioned values are persisted.
+type versionedValue struct {
+	SchemaVersion int
+	Value         json.RawMessage
+}
+
+// Registry of migrations, indexed by key and the schema version they migrate from.
+var (
+	migrations     = make(map[string]map[int]MigrationFunc)
+	migrationsLock sync.Mutex
+)
+
+// RegisterMigration registers a function that migrates the value of the given key
+// from the given schema version to the next schema version.
+func RegisterMigration(key string, fromVersion int, fn MigrationFunc) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	if migrations[key] == nil {
+		migrations[key] = make(map[int]MigrationFunc)
+	}
+
+	migrations[key][fromVersion] = fn
+}
+
+// IdentityMigration is a MigrationFunc for schema changes that do not alter the persisted layout.
+// Version 1 introduced the versioned envelope without changing the persisted layout, so every key
+// registers it as the migration from schema version 0.
+func IdentityMigration(value json.RawMessage) (json.RawMessage, error) {
+	return value, nil
+}
+
+// getMigration returns the migration registered for the given key and schema version.
+func getMigration(key string, fromVersion int) (MigrationFunc, bool) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	fn, ok := migrations[key][fromVersion]
+	return fn, ok
+}
+
+// WriteVersioned saves the given key value pair tagged with the given schema version.
+func WriteVersioned(kvs KeyValueStore, key string, version int, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return kvs.Write(key, &versionedValue{SchemaVersion: version, Value: raw})
+}
+
+// ReadVersioned restores the value for the given key, running any registered migrations
+// needed to bring it from its persisted schema version to the given schema version.
+// Values persisted without a version envelope are treated as legacySchemaVersion.
+func ReadVersioned(kvs KeyValueStore, key string, version int, value interface{}) error {
+	var raw json.RawMessage
+	if err := kvs.Read(key, &raw); err != nil {
+		return err
+	}
+
+	persistedVersion, data, err := decodeVersionedValue(raw)
+	if err != nil {
+		return err
+	}
+
+	if persistedVersion > version {
+		log.Printf("[store] Refusing to load %v with schema version %d, supported version is %d.",
+			key, persistedVersion, version)
+		return ErrSchemaVersionTooNew
+	}
+
+	for v := persistedVersion; v < version; v++ {
+		fn, ok := getMigration(key, v)
+		if !ok {
+			log.Printf("[store] No migration registered for %v from schema version %d.", key, v)
+			return ErrMigrationNotFound
+		}
+
+		data, err = fn(data)
+		if err != nil {
+			log.Printf("[store] Failed to migrate %v from schema version %d to %d, err:%v.", key, v, v+1, err)
+			return err
+		}
+
+		log.Printf("[store] Migrated %v from schema version %d to %d.", key, v, v+1)
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// decodeVersionedValue returns the schema version and the value contained in a persisted value.
+func decodeVersionedValue(raw json.RawMessage) (int, json.RawMessage, error) {
+	// Values without an envelope predate schema versioning.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return legacySchemaVersion, raw, nil
+	}
+
+	_, hasVersion := fields["SchemaVersion"]
+	_, hasValue := fields["Value"]
+	if !hasVersion || !hasValue || len(fields) != 2 {
+		return legacySchemaVersion, raw, nil
+	}
+
+	var vv versionedValue
+	if err := json.Unmarshal(raw, &vv); err != nil {
+		return 0, nil, err
+	}
+
+	return vv.SchemaVersion, vv.Value, nil
+}
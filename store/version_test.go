@@ -0,0 +1,135 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+const (
+	// Key used during versioning tests.
+	testVersionedKey = "versioned"
+)
+
+// Type for testing schema migrations, with Field1 renamed to Name in version 2.
+type testType2 struct {
+	Name   string
+	Field2 int
+}
+
+// Migration for testing that renames Field1 to Name.
+func renameField1(value json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, err
+	}
+
+	fields["Name"] = fields["Field1"]
+	delete(fields, "Field1")
+
+	return json.Marshal(fields)
+}
+
+// Tests that versioned values are written and read back correctly.
+func TestVersionedValuesAreWrittenAndReadCorrectly(t *testing.T) {
+	var writtenValue = testType1{"test", 42}
+	var readValue testType1
+
+	defer os.Remove(testFileName)
+	defer os.Remove(testFileName + backupExtension)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = WriteVersioned(kvs, testVersionedKey, 1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err = ReadVersioned(kvs, testVersionedKey, 1, &readValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if readValue != writtenValue {
+		t.Errorf("Read value %v does not match the written value %v", readValue, writtenValue)
+	}
+}
+
+// Tests that unversioned values are migrated through every registered migration.
+func TestLegacyValuesAreMigrated(t *testing.T) {
+	var encodedPair = `{"versioned":{"Field1":"test","Field2":42}}`
+	var expectedValue = testType2{"test", 42}
+	var actualValue testType2
+
+	RegisterMigration(testVersionedKey, 0, IdentityMigration)
+	RegisterMigration(testVersionedKey, 1, renameField1)
+
+	writeTestFile(t, testFileName, encodedPair)
+	defer os.Remove(testFileName)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = ReadVersioned(kvs, testVersionedKey, 2, &actualValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if actualValue != expectedValue {
+		t.Errorf("Migrated value %v does not match the expected value %v", actualValue, expectedValue)
+	}
+}
+
+// Tests that values persisted with a newer schema version are refused.
+func TestNewerSchemaVersionIsRefused(t *testing.T) {
+	var writtenValue = testType1{"test", 42}
+	var readValue testType1
+
+	defer os.Remove(testFileName)
+	defer os.Remove(testFileName + backupExtension)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = WriteVersioned(kvs, testVersionedKey, 3, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	err = ReadVersioned(kvs, testVersionedKey, 2, &readValue)
+	if err != ErrSchemaVersionTooNew {
+		t.Errorf("Reading a newer schema version returned %v", err)
+	}
+
+	if readValue != (testType1{}) {
+		t.Errorf("Value %v was populated from a newer schema version", readValue)
+	}
+}
+
+// Tests that a gap in the migration chain is reported as an error.
+func TestMissingMigrationIsReported(t *testing.T) {
+	var readValue testType1
+
+	defer os.Remove(testFileName)
+	defer os.Remove(testFileName + backupExtension)
+
+	kvs, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = WriteVersioned(kvs, testKey1, 1, &testType1{"test", 42}); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	err = ReadVersioned(kvs, testKey1, 2, &readValue)
+	if err != ErrMigrationNotFound {
+		t.Errorf("Reading without a registered migration returned %v", err)
+	}
+}